@@ -0,0 +1,467 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// acousticIndexFileName is the fingerprint cache kept in the library root.
+// Paths inside are relative so the library can be moved or remounted.
+const (
+	acousticIndexFileName = ".acoustic_fingerprints.json"
+	acousticIndexVersion  = 1
+
+	// acousticDuplicateThreshold is the minimum aligned similarity (one
+	// minus bit error rate) for two recordings to count as the same.
+	// Transcodes score above 0.9, remasters usually 0.8-0.9, unrelated
+	// audio around 0.5.
+	acousticDuplicateThreshold = 0.75
+	// acousticCandidateMinHits is how many identical subfingerprints two
+	// tracks must share before they are aligned and scored.
+	acousticCandidateMinHits = 2
+	// acousticCommonValueLimit drops subfingerprints shared by this many
+	// tracks (silence, test tones) from candidate search.
+	acousticCommonValueLimit = 64
+)
+
+var acousticIndexBuildWorkers = 4
+
+// acousticDuplicateFileHook, when set, is called with each file before it is
+// fingerprinted. Tests use it to act at a known point of a run.
+var acousticDuplicateFileHook func(path string)
+
+var errAcousticDuplicateCancelled = errors.New("acoustic duplicate job cancelled")
+
+type acousticIndexEntry struct {
+	Size        int64  `json:"size"`
+	ModTime     int64  `json:"mod_time"`
+	DurationMS  int64  `json:"duration_ms,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+type acousticIndexFile struct {
+	Version   int                           `json:"version"`
+	Algorithm int                           `json:"algorithm"`
+	Files     map[string]acousticIndexEntry `json:"files"`
+}
+
+type acousticTrack struct {
+	path        string
+	durationMS  int64
+	fingerprint []uint32
+}
+
+type AcousticDuplicateTrack struct {
+	FilePath   string  `json:"file_path"`
+	DurationMS int64   `json:"duration_ms,omitempty"`
+	Similarity float64 `json:"similarity"`
+	OffsetSec  float64 `json:"offset_sec"`
+}
+
+type AcousticDuplicateCluster struct {
+	Tracks        []AcousticDuplicateTrack `json:"tracks"`
+	MinSimilarity float64                  `json:"min_similarity"`
+}
+
+type AcousticDuplicateResult struct {
+	Clusters      []AcousticDuplicateCluster `json:"clusters"`
+	Fingerprinted int                        `json:"fingerprinted"`
+	Computed      int                        `json:"computed"`
+	Unsupported   int                        `json:"unsupported"`
+	ErrorCount    int                        `json:"error_count"`
+}
+
+type AcousticDuplicateProgress struct {
+	TotalFiles     int     `json:"total_files"`
+	ProcessedFiles int     `json:"processed_files"`
+	CurrentFile    string  `json:"current_file"`
+	ProgressPct    float64 `json:"progress_pct"`
+	IsComplete     bool    `json:"is_complete"`
+	IsCancelled    bool    `json:"is_cancelled,omitempty"`
+}
+
+var (
+	acousticDuplicateProgress   AcousticDuplicateProgress
+	acousticDuplicateProgressMu sync.RWMutex
+	acousticDuplicateCancel     chan struct{}
+	acousticDuplicateCancelMu   sync.Mutex
+)
+
+func loadAcousticIndex(folderPath string) map[string]acousticIndexEntry {
+	data, err := os.ReadFile(filepath.Join(folderPath, acousticIndexFileName))
+	if err != nil {
+		return map[string]acousticIndexEntry{}
+	}
+	var file acousticIndexFile
+	if err := json.Unmarshal(data, &file); err != nil ||
+		file.Version != acousticIndexVersion || file.Algorithm != chromaprintAlgorithm || file.Files == nil {
+		return map[string]acousticIndexEntry{}
+	}
+	return file.Files
+}
+
+func saveAcousticIndex(folderPath string, files map[string]acousticIndexEntry) error {
+	data, err := json.Marshal(acousticIndexFile{
+		Version:   acousticIndexVersion,
+		Algorithm: chromaprintAlgorithm,
+		Files:     files,
+	})
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(folderPath, acousticIndexFileName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// buildAcousticIndex fingerprints every supported file under folderPath,
+// reusing cached fingerprints for files whose size and mtime are unchanged,
+// and writes the refreshed cache back. Failed files are cached too so they
+// are not decoded again until they change. When cancelCh closes, the
+// fingerprints finished so far are still saved so a rerun resumes.
+func buildAcousticIndex(folderPath string, result *AcousticDuplicateResult, cancelCh <-chan struct{}) ([]acousticTrack, error) {
+	shouldStop := func() bool {
+		select {
+		case <-cancelCh:
+			return true
+		default:
+			return false
+		}
+	}
+
+	fileInfos, err := collectLibraryAudioFiles(folderPath, cancelCh)
+	if err != nil {
+		return nil, err
+	}
+
+	prev := loadAcousticIndex(folderPath)
+	files := make(map[string]acousticIndexEntry, len(fileInfos))
+	type fingerprintTask struct {
+		rel  string
+		info libraryAudioFileInfo
+	}
+	var toCompute []fingerprintTask
+	for _, info := range fileInfos {
+		if strings.EqualFold(filepath.Ext(info.path), ".cue") {
+			continue
+		}
+		rel, err := filepath.Rel(folderPath, info.path)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		if entry, ok := prev[rel]; ok && entry.Size == info.size && entry.ModTime == info.modTime {
+			files[rel] = entry
+			continue
+		}
+		toCompute = append(toCompute, fingerprintTask{rel: rel, info: info})
+	}
+
+	updateAcousticDuplicateProgress(func(p *AcousticDuplicateProgress) {
+		p.TotalFiles = len(files) + len(toCompute)
+		p.ProcessedFiles = len(files)
+	})
+
+	cancelled := false
+	if len(toCompute) > 0 {
+		entries := make([]acousticIndexEntry, len(toCompute))
+		done := make([]bool, len(toCompute))
+		workerCount := min(acousticIndexBuildWorkers, len(toCompute))
+		tasks := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < workerCount; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range tasks {
+					if shouldStop() {
+						continue
+					}
+					task := toCompute[i]
+					updateAcousticDuplicateProgress(func(p *AcousticDuplicateProgress) {
+						p.CurrentFile = filepath.Base(task.info.path)
+					})
+					if acousticDuplicateFileHook != nil {
+						acousticDuplicateFileHook(task.info.path)
+					}
+					entry := acousticIndexEntry{Size: task.info.size, ModTime: task.info.modTime}
+					fingerprint, durationMS, err := fingerprintFLAC(task.info.path)
+					if err != nil {
+						entry.Error = err.Error()
+					} else {
+						entry.DurationMS = durationMS
+						entry.Fingerprint = encodeChromaprint(fingerprint)
+					}
+					entries[i] = entry
+					done[i] = true
+					updateAcousticDuplicateProgress(func(p *AcousticDuplicateProgress) {
+						p.ProcessedFiles++
+					})
+				}
+			}()
+		}
+	feed:
+		for i := range toCompute {
+			select {
+			case tasks <- i:
+			case <-cancelCh:
+				break feed
+			}
+		}
+		close(tasks)
+		wg.Wait()
+		for i, task := range toCompute {
+			if done[i] {
+				files[task.rel] = entries[i]
+				result.Computed++
+			}
+		}
+		cancelled = shouldStop()
+	}
+
+	if result.Computed > 0 || len(files) != len(prev) {
+		if err := saveAcousticIndex(folderPath, files); err != nil {
+			GoLog("[AcousticIndex] Failed to save index for %s: %v\n", folderPath, err)
+		}
+	}
+	if cancelled {
+		return nil, errAcousticDuplicateCancelled
+	}
+
+	tracks := make([]acousticTrack, 0, len(files))
+	for rel, entry := range files {
+		if entry.Error != "" {
+			if entry.Error == errFingerprintUnsupportedFormat.Error() {
+				result.Unsupported++
+			} else {
+				result.ErrorCount++
+			}
+			continue
+		}
+		fingerprint, err := decodeChromaprint(entry.Fingerprint)
+		if err != nil || len(fingerprint) == 0 {
+			continue
+		}
+		tracks = append(tracks, acousticTrack{
+			path:        filepath.Join(folderPath, filepath.FromSlash(rel)),
+			durationMS:  entry.DurationMS,
+			fingerprint: fingerprint,
+		})
+	}
+	sort.Slice(tracks, func(i, j int) bool { return tracks[i].path < tracks[j].path })
+	result.Fingerprinted = len(tracks)
+	return tracks, nil
+}
+
+// clusterAcousticDuplicates links tracks whose fingerprints align above
+// acousticDuplicateThreshold and returns the connected groups. Candidate
+// pairs come from an inverted index of exact subfingerprints, so only
+// tracks with shared audio are ever aligned.
+func clusterAcousticDuplicates(tracks []acousticTrack) []AcousticDuplicateCluster {
+	postings := make(map[uint32][]int)
+	for i, track := range tracks {
+		seen := make(map[uint32]bool, len(track.fingerprint))
+		for _, v := range track.fingerprint {
+			if seen[v] {
+				continue
+			}
+			seen[v] = true
+			postings[v] = append(postings[v], i)
+		}
+	}
+	type pair struct{ a, b int }
+	hits := make(map[pair]int)
+	for _, ids := range postings {
+		if len(ids) < 2 || len(ids) >= acousticCommonValueLimit {
+			continue
+		}
+		for x := 0; x < len(ids); x++ {
+			for y := x + 1; y < len(ids); y++ {
+				hits[pair{ids[x], ids[y]}]++
+			}
+		}
+	}
+
+	parent := make([]int, len(tracks))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	type edge struct {
+		pair
+		match acousticMatch
+	}
+	var edges []edge
+	for p, count := range hits {
+		if count < acousticCandidateMinHits {
+			continue
+		}
+		match := compareChromaprints(tracks[p.a].fingerprint, tracks[p.b].fingerprint)
+		if match.similarity < acousticDuplicateThreshold {
+			continue
+		}
+		edges = append(edges, edge{p, match})
+		parent[find(p.a)] = find(p.b)
+	}
+
+	members := make(map[int][]int)
+	for i := range tracks {
+		root := find(i)
+		members[root] = append(members[root], i)
+	}
+	clusters := make([]AcousticDuplicateCluster, 0)
+	for _, ids := range members {
+		if len(ids) < 2 {
+			continue
+		}
+		// Report each member against the cluster's first track, the way a
+		// user would compare them: aligned similarity and time offset.
+		first := tracks[ids[0]]
+		cluster := AcousticDuplicateCluster{MinSimilarity: 1}
+		for _, id := range ids {
+			track := AcousticDuplicateTrack{FilePath: tracks[id].path, DurationMS: tracks[id].durationMS, Similarity: 1}
+			if id != ids[0] {
+				match := compareChromaprints(first.fingerprint, tracks[id].fingerprint)
+				track.Similarity = roundSimilarity(match.similarity)
+				track.OffsetSec = roundSimilarity(float64(match.offset) * chromaprintItemSeconds)
+			}
+			cluster.Tracks = append(cluster.Tracks, track)
+		}
+		for _, e := range edges {
+			if find(e.a) == find(ids[0]) && e.match.similarity < cluster.MinSimilarity {
+				cluster.MinSimilarity = roundSimilarity(e.match.similarity)
+			}
+		}
+		clusters = append(clusters, cluster)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].Tracks[0].FilePath < clusters[j].Tracks[0].FilePath
+	})
+	return clusters
+}
+
+func roundSimilarity(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
+
+// FindAcousticDuplicates fingerprints the library under folderPath and
+// returns groups of near-identical recordings, whatever their tags say.
+// Progress is reported through GetAcousticDuplicateProgress and the run can
+// be stopped with CancelAcousticDuplicateJob.
+func FindAcousticDuplicates(folderPath string) (string, error) {
+	if folderPath == "" {
+		return "", fmt.Errorf("folder path is empty")
+	}
+	info, err := os.Stat(folderPath)
+	if err != nil {
+		return "", fmt.Errorf("folder not found: %w", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("path is not a folder: %s", folderPath)
+	}
+
+	acousticDuplicateProgressMu.Lock()
+	acousticDuplicateProgress = AcousticDuplicateProgress{}
+	acousticDuplicateProgressMu.Unlock()
+
+	acousticDuplicateCancelMu.Lock()
+	if acousticDuplicateCancel != nil {
+		close(acousticDuplicateCancel)
+	}
+	acousticDuplicateCancel = make(chan struct{})
+	cancelCh := acousticDuplicateCancel
+	acousticDuplicateCancelMu.Unlock()
+
+	startTime := time.Now()
+	result := AcousticDuplicateResult{}
+	tracks, err := buildAcousticIndex(folderPath, &result, cancelCh)
+	if err != nil {
+		select {
+		case <-cancelCh:
+			finishAcousticDuplicateJob(true)
+			return "", errAcousticDuplicateCancelled
+		default:
+		}
+		return "", err
+	}
+	result.Clusters = clusterAcousticDuplicates(tracks)
+
+	GoLog("[AcousticIndex] %s: %d fingerprinted (%d computed), %d clusters in %v\n",
+		folderPath, result.Fingerprinted, result.Computed, len(result.Clusters), time.Since(startTime).Round(time.Millisecond))
+	finishAcousticDuplicateJob(false)
+	return marshalJSONString(result)
+}
+
+func updateAcousticDuplicateProgress(update func(p *AcousticDuplicateProgress)) {
+	acousticDuplicateProgressMu.Lock()
+	update(&acousticDuplicateProgress)
+	if acousticDuplicateProgress.TotalFiles > 0 {
+		acousticDuplicateProgress.ProgressPct = float64(acousticDuplicateProgress.ProcessedFiles) / float64(acousticDuplicateProgress.TotalFiles) * 100
+	}
+	acousticDuplicateProgressMu.Unlock()
+}
+
+// finishAcousticDuplicateJob marks the progress terminal, so a UI polling
+// GetAcousticDuplicateProgress stops after a cancel as well as a normal run.
+func finishAcousticDuplicateJob(cancelled bool) {
+	updateAcousticDuplicateProgress(func(p *AcousticDuplicateProgress) {
+		p.CurrentFile = ""
+		p.IsComplete = true
+		p.IsCancelled = cancelled
+	})
+}
+
+func GetAcousticDuplicateProgress() string {
+	acousticDuplicateProgressMu.RLock()
+	defer acousticDuplicateProgressMu.RUnlock()
+
+	jsonBytes, _ := json.Marshal(acousticDuplicateProgress)
+	return string(jsonBytes)
+}
+
+func CancelAcousticDuplicateJob() {
+	acousticDuplicateCancelMu.Lock()
+	defer acousticDuplicateCancelMu.Unlock()
+
+	if acousticDuplicateCancel != nil {
+		close(acousticDuplicateCancel)
+		acousticDuplicateCancel = nil
+	}
+}
+
+// CompareAudioFingerprints aligns two files' fingerprints, e.g. to check a
+// download against the recording it replaces.
+func CompareAudioFingerprints(pathA, pathB string) (string, error) {
+	a, _, err := fingerprintFLAC(pathA)
+	if err != nil {
+		return "", fmt.Errorf("failed to fingerprint %s: %w", pathA, err)
+	}
+	b, _, err := fingerprintFLAC(pathB)
+	if err != nil {
+		return "", fmt.Errorf("failed to fingerprint %s: %w", pathB, err)
+	}
+	match := compareChromaprints(a, b)
+	return marshalJSONString(map[string]any{
+		"similarity": roundSimilarity(match.similarity),
+		"offset_sec": roundSimilarity(float64(match.offset) * chromaprintItemSeconds),
+		"same":       match.similarity >= acousticDuplicateThreshold,
+	})
+}
@@ -2,10 +2,12 @@ package gobackend
 
 import (
 	"bytes"
+	"cmp"
 	"encoding/binary"
 	"fmt"
 	"io"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -33,6 +35,48 @@ type AudioMetadata struct {
 	ReplayGainTrackPeak string
 	ReplayGainAlbumGain string
 	ReplayGainAlbumPeak string
+	// Provider track IDs (SPOTIFY_ID, DEEZER_ID, TIDAL_ID, QOBUZ_ID tags)
+	SpotifyID string
+	DeezerID  string
+	TidalID   string
+	QobuzID   string
+	// ID3v2-only frames: SYLT as LRC text, POPM, the MusicBrainz UFID,
+	// CHAP chapters and TIPL/TMCL credits.
+	SyncedLyrics       string
+	Rating             int // POPM, 0-255
+	PlayCount          int64
+	MusicBrainzTrackID string
+	Chapters           []ID3Chapter
+	InvolvedPeople     []ID3Credit
+	MusicianCredits    []ID3Credit
+}
+
+// providerIDFieldKeys are the editor field keys for provider track IDs; each
+// is stored under its upper-cased name in every tag format.
+var providerIDFieldKeys = []string{"spotify_id", "deezer_id", "tidal_id", "qobuz_id"}
+
+// setProviderIDTag stores a <PROVIDER>_ID (or <PROVIDER>_TRACK_ID) tag and
+// reports whether key was one. Shared by the Vorbis, ID3 TXXX and MP4
+// freeform readers.
+func setProviderIDTag(metadata *AudioMetadata, key, value string) bool {
+	upper := strings.ToUpper(strings.TrimSpace(key))
+	if !strings.HasSuffix(upper, "_ID") {
+		return false
+	}
+	value = strings.TrimSpace(value)
+	switch strings.TrimSuffix(strings.TrimSuffix(upper, "_ID"), "_TRACK") {
+	case "SPOTIFY":
+		metadata.SpotifyID = value
+	case "DEEZER":
+		metadata.DeezerID = value
+	case "TIDAL":
+		metadata.TidalID = value
+	case "QOBUZ":
+		metadata.QobuzID = value
+	default:
+		return false
+	}
+	return true
 }
 
 type MP3Quality struct {
@@ -279,9 +323,9 @@ func parseID3v23Frames(data []byte, metadata *AudioMetadata, version byte, tagUn
 		case "TIT2":
 			metadata.Title = value
 		case "TPE1":
-			metadata.Artist = value
+			metadata.Artist = joinVorbisCommentValues(extractTextFrameValues(frameData))
 		case "TPE2":
-			metadata.AlbumArtist = value
+			metadata.AlbumArtist = joinVorbisCommentValues(extractTextFrameValues(frameData))
 		case "TALB":
 			metadata.Album = value
 		case "TYER", "TDRC":
@@ -326,11 +370,40 @@ func parseID3v23Frames(data []byte, metadata *AudioMetadata, version byte, tagUn
 				metadata.ReplayGainAlbumGain = userValue
 			case "REPLAYGAIN_ALBUM_PEAK":
 				metadata.ReplayGainAlbumPeak = userValue
+			default:
+				setProviderIDTag(metadata, upperDesc, userValue)
+			}
+		case "SYLT":
+			if metadata.SyncedLyrics == "" {
+				metadata.SyncedLyrics = parseID3SyncedLyrics(frameData)
+			}
+		case "POPM":
+			if popm, ok := parseID3Popularimeter(frameData); ok && metadata.Rating == 0 && metadata.PlayCount == 0 {
+				metadata.Rating, metadata.PlayCount = popm.rating, popm.playCount
 			}
+		case "UFID":
+			if owner, id := parseID3UniqueFileID(frameData); owner == musicBrainzUFIDOwner {
+				metadata.MusicBrainzTrackID = id
+			}
+		case "CHAP":
+			if chapter, ok := parseID3Chapter(frameData, version); ok {
+				metadata.Chapters = append(metadata.Chapters, chapter)
+			}
+		case "TIPL", "IPLS":
+			metadata.InvolvedPeople = id3CreditPairs(extractTextFrameValues(frameData))
+		case "TMCL":
+			metadata.MusicianCredits = id3CreditPairs(extractTextFrameValues(frameData))
 		}
 
 		pos += 10 + frameSize
 	}
+
+	slices.SortStableFunc(metadata.Chapters, func(a, b ID3Chapter) int {
+		return cmp.Compare(a.StartMs, b.StartMs)
+	})
+	if metadata.Lyrics == "" {
+		metadata.Lyrics = metadata.SyncedLyrics
+	}
 }
 
 func readID3v1(file *os.File) (*AudioMetadata, error) {
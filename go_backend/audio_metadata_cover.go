@@ -329,6 +329,9 @@ func extractAnyCoverArtWithHint(filePath, displayNameHint string) ([]byte, strin
 	case ".wav", ".aiff", ".aif", ".aifc":
 		return extractWAVAIFFCover(filePath)
 
+	case ".dsf", ".dff":
+		return extractDSDCover(filePath)
+
 	default:
 		return nil, "", fmt.Errorf("unsupported format: %s", ext)
 	}
@@ -291,6 +291,8 @@ func parseVorbisComments(data []byte, metadata *AudioMetadata) {
 					metadata.ReplayGainAlbumGain = db
 				}
 			}
+		default:
+			setProviderIDTag(metadata, key, value)
 		}
 	}
 
@@ -0,0 +1,568 @@
+package gobackend
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"math/cmplx"
+)
+
+// Chromaprint "TEST2" fingerprints, the algorithm fpcalc and AcoustID use by
+// default: 11025 Hz mono, 4096-sample frames every 1365 samples, 12-band
+// chroma smoothed over 5 frames, then 16 Haar-like classifiers per
+// subfingerprint. The resampler is not libavresample's, so bits can differ
+// slightly from fpcalc; fingerprints still compare within normal error.
+
+const (
+	chromaprintAlgorithm  = 1 // CHROMAPRINT_ALGORITHM_TEST2
+	chromaprintSampleRate = 11025
+	chromaprintFrameSize  = 4096
+	chromaprintFrameHop   = chromaprintFrameSize / 3
+	chromaprintMinFreq    = 28
+	chromaprintMaxFreq    = 3520
+	chromaprintBands      = 12
+	// chromaprintMaxSeconds matches fpcalc's default -length.
+	chromaprintMaxSeconds = 120
+	// chromaprintItemSeconds is the time between subfingerprints.
+	chromaprintItemSeconds = float64(chromaprintFrameHop) / chromaprintSampleRate
+)
+
+var errFingerprintUnsupportedFormat = errors.New("fingerprinting needs a FLAC file")
+
+var chromaFilterCoefficients = [...]float64{0.25, 0.75, 1.0, 0.75, 0.25}
+
+type chromaprintClassifier struct {
+	filterType, y, height, width int
+	t0, t1, t2                   float64
+}
+
+var chromaprintClassifiers = [...]chromaprintClassifier{
+	{0, 4, 3, 15, 1.98215, 2.35817, 2.63523},
+	{4, 4, 6, 15, -1.03809, -0.651211, -0.282167},
+	{1, 0, 4, 16, -0.298702, 0.119262, 0.558497},
+	{3, 8, 2, 12, -0.105439, 0.0153946, 0.135898},
+	{3, 4, 4, 8, -0.142891, 0.0258736, 0.200632},
+	{4, 0, 3, 5, -0.826319, -0.590612, -0.368214},
+	{1, 2, 2, 9, -0.557409, -0.233035, 0.0534525},
+	{2, 7, 3, 4, -0.0646826, 0.00620476, 0.0784847},
+	{2, 6, 2, 16, -0.192387, -0.029699, 0.215855},
+	{2, 1, 3, 2, -0.0397818, -0.00568076, 0.0292026},
+	{5, 10, 1, 15, -0.53823, -0.369934, -0.190235},
+	{3, 6, 2, 10, -0.124877, 0.0296483, 0.139239},
+	{2, 1, 1, 14, -0.101475, 0.0225617, 0.231971},
+	{3, 5, 6, 4, -0.0799915, -0.00729616, 0.063262},
+	{1, 9, 2, 12, -0.272556, 0.019424, 0.302559},
+	{3, 4, 2, 14, -0.164292, -0.0321188, 0.0846339},
+}
+
+const chromaprintMaxFilterWidth = 16
+
+// pcmResampler converts a mono stream to chromaprintSampleRate with a
+// windowed-sinc low-pass, one block at a time.
+type pcmResampler struct {
+	ratio  float64 // input samples per output sample
+	half   int     // taps on each side of the output position
+	phases [][]float32
+	buf    []float32
+	base   int64   // absolute index of buf[0]
+	next   float64 // absolute input position of the next output sample
+}
+
+const pcmResamplerPhases = 256
+
+func newPCMResampler(inputRate int) *pcmResampler {
+	r := &pcmResampler{ratio: float64(inputRate) / chromaprintSampleRate}
+	if r.ratio == 1 {
+		return r
+	}
+	cutoff := 0.8 * math.Min(1, 1/r.ratio)
+	r.half = int(math.Ceil(8 / cutoff))
+	r.phases = make([][]float32, pcmResamplerPhases+1)
+	for p := range r.phases {
+		frac := float64(p) / pcmResamplerPhases
+		taps := make([]float32, 2*r.half)
+		var sum float64
+		coefs := make([]float64, len(taps))
+		for j := range taps {
+			d := float64(j-r.half+1) - frac
+			x := cutoff * d
+			sinc := 1.0
+			if x != 0 {
+				sinc = math.Sin(math.Pi*x) / (math.Pi * x)
+			}
+			w := d / float64(r.half)
+			window := 0.0
+			if w > -1 && w < 1 {
+				window = 0.42 + 0.5*math.Cos(math.Pi*w) + 0.08*math.Cos(2*math.Pi*w)
+			}
+			coefs[j] = sinc * window
+			sum += coefs[j]
+		}
+		for j := range taps {
+			taps[j] = float32(coefs[j] / sum)
+		}
+		r.phases[p] = taps
+	}
+	return r
+}
+
+func (r *pcmResampler) process(in []float32, out []float32) []float32 {
+	if r.ratio == 1 {
+		return append(out, in...)
+	}
+	r.buf = append(r.buf, in...)
+	end := r.base + int64(len(r.buf))
+	for {
+		center := int64(r.next)
+		if center+int64(r.half) >= end {
+			break
+		}
+		taps := r.phases[int(math.Round((r.next-float64(center))*pcmResamplerPhases))]
+		start := center - int64(r.half) + 1
+		var y float32
+		for j, c := range taps {
+			k := start + int64(j) - r.base
+			if k >= 0 {
+				y += c * r.buf[k]
+			}
+		}
+		out = append(out, y)
+		r.next += r.ratio
+	}
+	keep := int64(r.next) - int64(r.half) + 1 - r.base
+	if keep > 0 && keep <= int64(len(r.buf)) {
+		r.buf = append(r.buf[:0], r.buf[keep:]...)
+		r.base += keep
+	}
+	return out
+}
+
+// chromaprintFFT is an in-place radix-2 FFT for chromaprintFrameSize.
+type chromaprintFFT struct {
+	twiddle []complex128
+	window  []float64
+	buf     []complex128
+	power   []float64
+}
+
+func newChromaprintFFT() *chromaprintFFT {
+	n := chromaprintFrameSize
+	f := &chromaprintFFT{
+		twiddle: make([]complex128, n/2),
+		window:  make([]float64, n),
+		buf:     make([]complex128, n),
+		power:   make([]float64, n/2+1),
+	}
+	for i := range f.twiddle {
+		f.twiddle[i] = cmplx.Exp(complex(0, -2*math.Pi*float64(i)/float64(n)))
+	}
+	// Hamming window scaled for int16 input, as chromaprint prepares it.
+	for i := range f.window {
+		f.window[i] = (0.54 - 0.46*math.Cos(2*math.Pi*float64(i)/float64(n-1))) / math.MaxInt16
+	}
+	return f
+}
+
+// powerSpectrum returns |X[k]|^2 for k in [0, n/2] of one windowed frame.
+func (f *chromaprintFFT) powerSpectrum(frame []float32) []float64 {
+	n := len(f.buf)
+	shift := 64 - bits.TrailingZeros(uint(n))
+	for i := 0; i < n; i++ {
+		f.buf[bits.Reverse64(uint64(i))>>shift] = complex(float64(frame[i])*f.window[i], 0)
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := n / size
+		for start := 0; start < n; start += size {
+			for k := 0; k < size/2; k++ {
+				t := f.twiddle[k*step] * f.buf[start+k+size/2]
+				u := f.buf[start+k]
+				f.buf[start+k] = u + t
+				f.buf[start+k+size/2] = u - t
+			}
+		}
+	}
+	for k := range f.power {
+		re, im := real(f.buf[k]), imag(f.buf[k])
+		f.power[k] = re*re + im*im
+	}
+	return f.power
+}
+
+// chromaNotes maps FFT bins in [minIndex, maxIndex) to chroma bands.
+func chromaNotes() (minIndex, maxIndex int, notes []int) {
+	freqToIndex := func(freq float64) int {
+		return int(math.Round(chromaprintFrameSize * freq / chromaprintSampleRate))
+	}
+	minIndex = max(1, freqToIndex(chromaprintMinFreq))
+	maxIndex = min(chromaprintFrameSize/2, freqToIndex(chromaprintMaxFreq))
+	notes = make([]int, maxIndex)
+	for i := minIndex; i < maxIndex; i++ {
+		freq := float64(i) * chromaprintSampleRate / chromaprintFrameSize
+		octave := math.Log2(freq / (440.0 / 16.0))
+		notes[i] = int(chromaprintBands * (octave - math.Floor(octave)))
+	}
+	return minIndex, maxIndex, notes
+}
+
+// chromaprintFromPCM fingerprints mono samples already at
+// chromaprintSampleRate, scaled to the int16 range.
+func chromaprintFromPCM(samples []float32) []uint32 {
+	if len(samples) < chromaprintFrameSize {
+		return nil
+	}
+	fft := newChromaprintFFT()
+	minIndex, maxIndex, notes := chromaNotes()
+
+	var chroma [][chromaprintBands]float64
+	for start := 0; start+chromaprintFrameSize <= len(samples); start += chromaprintFrameHop {
+		power := fft.powerSpectrum(samples[start : start+chromaprintFrameSize])
+		var bands [chromaprintBands]float64
+		for i := minIndex; i < maxIndex; i++ {
+			bands[notes[i]] += power[i]
+		}
+		chroma = append(chroma, bands)
+	}
+
+	taps := len(chromaFilterCoefficients)
+	if len(chroma) < taps {
+		return nil
+	}
+	rows := len(chroma) - taps + 1
+	// integral[r][c] sums filtered, normalized chroma rows [0,r) bands [0,c).
+	integral := make([][chromaprintBands + 1]float64, rows+1)
+	for r := 0; r < rows; r++ {
+		var features [chromaprintBands]float64
+		var norm float64
+		for b := 0; b < chromaprintBands; b++ {
+			for j, coef := range chromaFilterCoefficients {
+				features[b] += coef * chroma[r+j][b]
+			}
+			norm += features[b] * features[b]
+		}
+		norm = math.Sqrt(norm)
+		var rowSum float64
+		for b := 0; b < chromaprintBands; b++ {
+			if norm >= 0.01 {
+				rowSum += features[b] / norm
+			}
+			integral[r+1][b+1] = integral[r][b+1] + rowSum
+		}
+	}
+	if rows < chromaprintMaxFilterWidth {
+		return nil
+	}
+
+	area := func(r1, c1, r2, c2 int) float64 {
+		return integral[r2][c2] - integral[r1][c2] - integral[r2][c1] + integral[r1][c1]
+	}
+	grayCode := [4]uint32{0, 1, 3, 2}
+	fingerprint := make([]uint32, 0, rows-chromaprintMaxFilterWidth+1)
+	for x := 0; x+chromaprintMaxFilterWidth <= rows; x++ {
+		var sub uint32
+		for _, c := range chromaprintClassifiers {
+			sub = sub<<2 | grayCode[c.quantize(c.apply(area, x))]
+		}
+		fingerprint = append(fingerprint, sub)
+	}
+	return fingerprint
+}
+
+func (c chromaprintClassifier) apply(area func(r1, c1, r2, c2 int) float64, x int) float64 {
+	y, w, h := c.y, c.width, c.height
+	var a, b float64
+	switch c.filterType {
+	case 0:
+		a = area(x, y, x+w, y+h)
+	case 1:
+		h2 := h / 2
+		a = area(x, y+h2, x+w, y+h)
+		b = area(x, y, x+w, y+h2)
+	case 2:
+		w2 := w / 2
+		a = area(x+w2, y, x+w, y+h)
+		b = area(x, y, x+w2, y+h)
+	case 3:
+		w2, h2 := w/2, h/2
+		a = area(x, y+h2, x+w2, y+h) + area(x+w2, y, x+w, y+h2)
+		b = area(x, y, x+w2, y+h2) + area(x+w2, y+h2, x+w, y+h)
+	case 4:
+		h3 := h / 3
+		a = area(x, y+h3, x+w, y+2*h3)
+		b = area(x, y, x+w, y+h3) + area(x, y+2*h3, x+w, y+h)
+	case 5:
+		w3 := w / 3
+		a = area(x+w3, y, x+2*w3, y+h)
+		b = area(x, y, x+w3, y+h) + area(x+2*w3, y, x+w, y+h)
+	}
+	return math.Log(1+a) - math.Log(1+b)
+}
+
+func (c chromaprintClassifier) quantize(v float64) int {
+	if v < c.t1 {
+		if v < c.t0 {
+			return 0
+		}
+		return 1
+	}
+	if v < c.t2 {
+		return 2
+	}
+	return 3
+}
+
+// fingerprintFLAC decodes up to chromaprintMaxSeconds of a FLAC file and
+// fingerprints it. The duration reported is that of the whole stream.
+func fingerprintFLAC(path string) ([]uint32, int64, error) {
+	dec, err := openFLACDecoder(path)
+	if errors.Is(err, errMissingFLACMarker) {
+		return nil, 0, errFingerprintUnsupportedFormat
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer dec.close()
+
+	rate := dec.info.sampleRate
+	if rate <= 0 {
+		return nil, 0, fmt.Errorf("invalid sample rate %d", rate)
+	}
+	var durationMS int64
+	if dec.info.totalSamples > 0 {
+		durationMS = dec.info.totalSamples * 1000 / int64(rate)
+	}
+
+	resampler := newPCMResampler(rate)
+	limit := int64(rate) * chromaprintMaxSeconds
+	var decoded int64
+	var mono []float32
+	out := make([]float32, 0, chromaprintSampleRate*chromaprintMaxSeconds)
+	for decoded < limit {
+		frame, err := dec.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		n := frame.blockSize()
+		if int64(n) > limit-decoded {
+			n = int(limit - decoded)
+		}
+		// Downmix to mono in the int16 range chromaprint expects.
+		scale := 32768 / float64(int64(1)<<(frame.bitsPerSample-1)) / float64(len(frame.samples))
+		mono = mono[:0]
+		for i := 0; i < n; i++ {
+			var sum int64
+			for _, channel := range frame.samples {
+				sum += int64(channel[i])
+			}
+			mono = append(mono, float32(float64(sum)*scale))
+		}
+		out = resampler.process(mono, out)
+		decoded += int64(n)
+	}
+	if durationMS == 0 {
+		durationMS = decoded * 1000 / int64(rate)
+	}
+	return chromaprintFromPCM(out), durationMS, nil
+}
+
+// encodeChromaprint compresses a fingerprint the way chromaprint_encode does
+// and returns it URL-safe base64 encoded, as fpcalc prints it.
+func encodeChromaprint(fingerprint []uint32) string {
+	var normal, exceptional []byte
+	var prev uint32
+	for _, sub := range fingerprint {
+		x := sub ^ prev
+		prev = sub
+		lastBit, bit := 0, 1
+		for x != 0 {
+			if x&1 != 0 {
+				normal = append(normal, byte(bit-lastBit))
+				lastBit = bit
+			}
+			x >>= 1
+			bit++
+		}
+		normal = append(normal, 0)
+	}
+	for i, v := range normal {
+		if v >= 7 {
+			exceptional = append(exceptional, v-7)
+			normal[i] = 7
+		}
+	}
+
+	n := len(fingerprint)
+	out := []byte{chromaprintAlgorithm, byte(n >> 16), byte(n >> 8), byte(n)}
+	out = packChromaprintBits(out, normal, 3)
+	out = packChromaprintBits(out, exceptional, 5)
+	return base64.RawURLEncoding.EncodeToString(out)
+}
+
+func packChromaprintBits(out []byte, values []byte, width uint) []byte {
+	var acc uint32
+	var filled uint
+	for _, v := range values {
+		acc |= uint32(v) << filled
+		filled += width
+		for filled >= 8 {
+			out = append(out, byte(acc))
+			acc >>= 8
+			filled -= 8
+		}
+	}
+	if filled > 0 {
+		out = append(out, byte(acc))
+	}
+	return out
+}
+
+// decodeChromaprint reverses encodeChromaprint.
+func decodeChromaprint(encoded string) ([]uint32, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fingerprint encoding: %w", err)
+	}
+	if len(data) < 4 {
+		return nil, fmt.Errorf("fingerprint too short")
+	}
+	n := int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+	body := data[4:]
+
+	var normal []byte
+	pos := uint(0)
+	readBits := func(width uint) (byte, bool) {
+		if pos+width > uint(len(body))*8 {
+			return 0, false
+		}
+		var v uint32
+		for i := uint(0); i < width; i++ {
+			bit := pos + i
+			v |= uint32(body[bit/8]>>(bit%8)&1) << i
+		}
+		pos += width
+		return byte(v), true
+	}
+	terminators := 0
+	for terminators < n {
+		v, ok := readBits(3)
+		if !ok {
+			return nil, fmt.Errorf("fingerprint truncated")
+		}
+		if v == 0 {
+			terminators++
+		}
+		normal = append(normal, v)
+	}
+	pos = (pos + 7) / 8 * 8
+	for i, v := range normal {
+		if v != 7 {
+			continue
+		}
+		extra, ok := readBits(5)
+		if !ok {
+			return nil, fmt.Errorf("fingerprint truncated")
+		}
+		normal[i] = 7 + extra
+	}
+
+	fingerprint := make([]uint32, 0, n)
+	var value, prev uint32
+	lastBit := 0
+	for _, v := range normal {
+		if v == 0 {
+			prev ^= value
+			fingerprint = append(fingerprint, prev)
+			value, lastBit = 0, 0
+			continue
+		}
+		lastBit += int(v)
+		if lastBit > 32 {
+			return nil, fmt.Errorf("invalid fingerprint bit position")
+		}
+		value |= 1 << (lastBit - 1)
+	}
+	return fingerprint, nil
+}
+
+// acousticMatch is the best alignment between two fingerprints.
+type acousticMatch struct {
+	similarity float64 // 1 - bit error rate over the overlap
+	offset     int     // b[i] aligns with a[i+offset]
+	overlap    int
+}
+
+const (
+	acousticAlignBits  = 12
+	acousticMinOverlap = 40 // about 5 seconds
+)
+
+// compareChromaprints finds candidate offsets from matching subfingerprint
+// prefixes, like chromaprint's matcher, then scores the best few by bit
+// error rate. Unrelated audio lands near 0.5.
+func compareChromaprints(a, b []uint32) acousticMatch {
+	if len(a) == 0 || len(b) == 0 {
+		return acousticMatch{}
+	}
+	positions := make(map[uint32][]int, len(a))
+	for i, v := range a {
+		key := v >> (32 - acousticAlignBits)
+		positions[key] = append(positions[key], i)
+	}
+	counts := make(map[int]int)
+	for j, v := range b {
+		for _, i := range positions[v>>(32-acousticAlignBits)] {
+			counts[i-j]++
+		}
+	}
+
+	candidates := make([]int, 0, 4)
+	for len(candidates) < 3 && len(counts) > 0 {
+		best, bestCount := 0, -1
+		for offset, count := range counts {
+			if count > bestCount || (count == bestCount && absInt(offset) < absInt(best)) {
+				best, bestCount = offset, count
+			}
+		}
+		candidates = append(candidates, best)
+		delete(counts, best)
+	}
+	if len(candidates) == 0 {
+		candidates = append(candidates, 0)
+	}
+
+	var match acousticMatch
+	for _, offset := range candidates {
+		errBits, overlap := 0, 0
+		for j, v := range b {
+			i := j + offset
+			if i < 0 || i >= len(a) {
+				continue
+			}
+			errBits += bits.OnesCount32(a[i] ^ v)
+			overlap++
+		}
+		if overlap < acousticMinOverlap && overlap < min(len(a), len(b)) {
+			continue
+		}
+		if overlap == 0 {
+			continue
+		}
+		sim := 1 - float64(errBits)/float64(32*overlap)
+		if sim > match.similarity {
+			match = acousticMatch{similarity: sim, offset: offset, overlap: overlap}
+		}
+	}
+	return match
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
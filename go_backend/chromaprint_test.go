@@ -0,0 +1,194 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testMelody renders a seeded sequence of three-note chords, 250 ms each,
+// at 44.1 kHz: enough chroma movement for fingerprints to be distinctive.
+func testMelody(seed int64, seconds float64, gain float64, leadIn float64, noise float64) []int64 {
+	rng := rand.New(rand.NewSource(seed))
+	noiseRng := rand.New(rand.NewSource(seed + 1000))
+	const rate = 44100
+	chordLen := rate / 4
+	lead := int(leadIn * rate)
+	n := lead + int(seconds*rate)
+	out := make([]int64, n)
+	var freqs [3]float64
+	for i := lead; i < n; i++ {
+		if (i-lead)%chordLen == 0 {
+			for k := range freqs {
+				freqs[k] = 220 * math.Pow(2, float64(rng.Intn(36))/12)
+			}
+		}
+		t := float64(i-lead) / rate
+		var v float64
+		for _, f := range freqs {
+			v += math.Sin(2 * math.Pi * f * t)
+		}
+		v = v/3*gain + noise*(noiseRng.Float64()*2-1)
+		out[i] = int64(math.Round(math.Max(-1, math.Min(1, v)) * 32767))
+	}
+	return out
+}
+
+func TestChromaprintEncodeRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	fingerprint := make([]uint32, 300)
+	for i := range fingerprint {
+		fingerprint[i] = rng.Uint32()
+	}
+	// Repeats and top-bit-only deltas exercise empty and exceptional runs.
+	fingerprint[10] = fingerprint[9]
+	fingerprint[11] = fingerprint[10] ^ 1<<31
+
+	encoded := encodeChromaprint(fingerprint)
+	decoded, err := decodeChromaprint(encoded)
+	if err != nil {
+		t.Fatalf("decodeChromaprint: %v", err)
+	}
+	if len(decoded) != len(fingerprint) {
+		t.Fatalf("decoded %d items, want %d", len(decoded), len(fingerprint))
+	}
+	for i := range fingerprint {
+		if decoded[i] != fingerprint[i] {
+			t.Fatalf("item %d = %08x, want %08x", i, decoded[i], fingerprint[i])
+		}
+	}
+	if _, err := decodeChromaprint(encoded[:len(encoded)/2]); err == nil {
+		t.Fatal("truncated fingerprint decoded without error")
+	}
+}
+
+func TestChromaprintMatchesAcrossGainNoiseAndOffset(t *testing.T) {
+	dir := t.TempDir()
+	original := writeTestSignalFLAC(t, dir, "a.flac", testMelody(1, 20, 0.5, 0, 0))
+	remaster := writeTestSignalFLAC(t, dir, "b.flac", testMelody(1, 20, 0.9, 1.5, 0.01))
+	other := writeTestSignalFLAC(t, dir, "c.flac", testMelody(2, 20, 0.5, 0, 0))
+
+	fa, durationMS, err := fingerprintFLAC(original)
+	if err != nil {
+		t.Fatalf("fingerprintFLAC: %v", err)
+	}
+	if durationMS != 20000 {
+		t.Fatalf("duration = %d ms", durationMS)
+	}
+	// About 8 subfingerprints per second of audio.
+	if len(fa) < 140 || len(fa) > 165 {
+		t.Fatalf("fingerprint has %d items", len(fa))
+	}
+	fb, _, _ := fingerprintFLAC(remaster)
+	fc, _, _ := fingerprintFLAC(other)
+
+	same := compareChromaprints(fa, fb)
+	if same.similarity < 0.85 {
+		t.Fatalf("remaster similarity = %.3f", same.similarity)
+	}
+	if got := float64(same.offset) * chromaprintItemSeconds; math.Abs(got+1.5) > 0.25 {
+		t.Fatalf("offset = %.2fs, want -1.5s", got)
+	}
+	if diff := compareChromaprints(fa, fc); diff.similarity > 0.7 {
+		t.Fatalf("unrelated similarity = %.3f", diff.similarity)
+	}
+}
+
+func TestFindAcousticDuplicatesJSONClustersAndCachesIndex(t *testing.T) {
+	dir := t.TempDir()
+	a := writeTestSignalFLAC(t, dir, "a.flac", testMelody(1, 15, 0.5, 0, 0))
+	if err := os.MkdirAll(filepath.Join(dir, "Compilation"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	b := writeTestSignalFLAC(t, dir, filepath.Join("Compilation", "b.flac"), testMelody(1, 15, 0.8, 0.7, 0.005))
+	writeTestSignalFLAC(t, dir, "c.flac", testMelody(3, 15, 0.5, 0, 0))
+	if err := os.WriteFile(filepath.Join(dir, "d.mp3"), []byte("ID3\x03\x00\x00\x00\x00\x00\x00"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func() AcousticDuplicateResult {
+		t.Helper()
+		raw, err := FindAcousticDuplicatesJSON(dir)
+		if err != nil {
+			t.Fatalf("FindAcousticDuplicatesJSON: %v", err)
+		}
+		var result AcousticDuplicateResult
+		if err := json.Unmarshal([]byte(raw), &result); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		return result
+	}
+
+	first := run()
+	if first.Fingerprinted != 3 || first.Computed != 4 || first.Unsupported != 1 {
+		t.Fatalf("first run = %+v", first)
+	}
+	if len(first.Clusters) != 1 || len(first.Clusters[0].Tracks) != 2 {
+		t.Fatalf("clusters = %+v", first.Clusters)
+	}
+	cluster := first.Clusters[0]
+	if cluster.Tracks[0].FilePath != b || cluster.Tracks[1].FilePath != a || cluster.MinSimilarity < 0.85 {
+		t.Fatalf("cluster = %+v", cluster)
+	}
+	if _, err := os.Stat(filepath.Join(dir, acousticIndexFileName)); err != nil {
+		t.Fatalf("index not written: %v", err)
+	}
+
+	var progress AcousticDuplicateProgress
+	if err := json.Unmarshal([]byte(GetAcousticDuplicateProgressJSON()), &progress); err != nil {
+		t.Fatalf("progress: %v", err)
+	}
+	if !progress.IsComplete || progress.TotalFiles != 4 || progress.ProcessedFiles != 4 || progress.ProgressPct != 100 {
+		t.Fatalf("progress = %+v", progress)
+	}
+
+	second := run()
+	if second.Computed != 0 || len(second.Clusters) != 1 {
+		t.Fatalf("second run = %+v", second)
+	}
+}
+
+func TestFindAcousticDuplicatesCancelIsTerminal(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 3 {
+		writeTestSignalFLAC(t, dir, fmt.Sprintf("%d.flac", i), testMelody(int64(i+1), 2, 0.5, 0, 0))
+	}
+
+	workers := acousticIndexBuildWorkers
+	acousticIndexBuildWorkers = 1
+	acousticDuplicateFileHook = func(string) { CancelAcousticDuplicateJobJSON() }
+	t.Cleanup(func() {
+		acousticIndexBuildWorkers = workers
+		acousticDuplicateFileHook = nil
+	})
+	if _, err := FindAcousticDuplicatesJSON(dir); !errors.Is(err, errAcousticDuplicateCancelled) {
+		t.Fatalf("cancelled job = %v", err)
+	}
+
+	var progress AcousticDuplicateProgress
+	if err := json.Unmarshal([]byte(GetAcousticDuplicateProgressJSON()), &progress); err != nil {
+		t.Fatal(err)
+	}
+	if !progress.IsComplete || !progress.IsCancelled || progress.TotalFiles != 3 || progress.ProcessedFiles != 1 {
+		t.Fatalf("progress after cancel = %+v", progress)
+	}
+
+	// The fingerprint finished before the cancel is kept, so a rerun resumes.
+	acousticDuplicateFileHook = nil
+	raw, err := FindAcousticDuplicatesJSON(dir)
+	if err != nil {
+		t.Fatalf("rerun: %v", err)
+	}
+	var result AcousticDuplicateResult
+	if err := json.Unmarshal([]byte(raw), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Computed != 2 {
+		t.Fatalf("rerun = %+v", result)
+	}
+}
@@ -0,0 +1,220 @@
+package gobackend
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	textunicode "golang.org/x/text/encoding/unicode"
+)
+
+// Encodings reported in CueSheet.Encoding; explicit names go through the
+// WHATWG label table, so "sjis", "cp1251", "latin1" and friends work too.
+const (
+	cueEncodingUTF8        = "utf-8"
+	cueEncodingUTF16LE     = "utf-16le"
+	cueEncodingUTF16BE     = "utf-16be"
+	cueEncodingShiftJIS    = "shift_jis"
+	cueEncodingGBK         = "gbk"
+	cueEncodingWindows1251 = "windows-1251"
+	cueEncodingWindows1252 = "windows-1252"
+)
+
+// Windows code page names EAC and foobar2000 users tend to pass, which the
+// WHATWG table does not list.
+var cueEncodingAliases = map[string]string{
+	"cp932": cueEncodingShiftJIS,
+	"ms932": cueEncodingShiftJIS,
+	"cp936": cueEncodingGBK,
+	"cp949": "euc-kr",
+	"cp950": "big5",
+}
+
+func lookupCueEncoding(name string) (encoding.Encoding, string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := cueEncodingAliases[name]; ok {
+		name = alias
+	}
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, "", fmt.Errorf("unknown cue encoding: %s", name)
+	}
+	canonical, err := htmlindex.Name(enc)
+	if err != nil {
+		canonical = name
+	}
+	return enc, strings.ToLower(canonical), nil
+}
+
+// decodeCueText converts raw .cue bytes to UTF-8. A byte order mark always
+// wins; otherwise an explicit encoding is used as given, and without one the
+// charset is guessed. Returns the text and the encoding's name.
+func decodeCueText(data []byte, encodingName string) (string, string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return string(data[3:]), cueEncodingUTF8, nil
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return decodeCueWith(textunicode.UTF16(textunicode.LittleEndian, textunicode.IgnoreBOM), data[2:], cueEncodingUTF16LE)
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return decodeCueWith(textunicode.UTF16(textunicode.BigEndian, textunicode.IgnoreBOM), data[2:], cueEncodingUTF16BE)
+	}
+
+	if strings.TrimSpace(encodingName) != "" {
+		enc, name, err := lookupCueEncoding(encodingName)
+		if err != nil {
+			return "", "", err
+		}
+		return decodeCueWith(enc, data, name)
+	}
+
+	name := detectCueEncoding(data)
+	switch name {
+	case cueEncodingUTF8:
+		return string(data), name, nil
+	case cueEncodingUTF16LE:
+		return decodeCueWith(textunicode.UTF16(textunicode.LittleEndian, textunicode.IgnoreBOM), data, name)
+	case cueEncodingUTF16BE:
+		return decodeCueWith(textunicode.UTF16(textunicode.BigEndian, textunicode.IgnoreBOM), data, name)
+	}
+	enc, _, err := lookupCueEncoding(name)
+	if err != nil {
+		return "", "", err
+	}
+	return decodeCueWith(enc, data, name)
+}
+
+func decodeCueWith(enc encoding.Encoding, data []byte, name string) (string, string, error) {
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decode cue sheet as %s: %w", name, err)
+	}
+	return string(decoded), name, nil
+}
+
+// detectCueEncoding guesses the charset of a BOM-less sheet. CUE keywords
+// are ASCII, so only titles and names carry signal; the checks run from the
+// most to the least distinctive byte pattern and Windows-1252 catches the
+// rest, since it decodes anything.
+func detectCueEncoding(data []byte) string {
+	// UTF-16 first: its ASCII is full of NULs, which are valid UTF-8.
+	if name := sniffUTF16(data); name != "" {
+		return name
+	}
+	if utf8.Valid(data) {
+		return cueEncodingUTF8
+	}
+	if looksLikeShiftJIS(data) {
+		return cueEncodingShiftJIS
+	}
+	if looksLikeWindows1251(data) {
+		return cueEncodingWindows1251
+	}
+	if looksLikeGBK(data) {
+		return cueEncodingGBK
+	}
+	return cueEncodingWindows1252
+}
+
+// sniffUTF16 spots BOM-less UTF-16 from the zero high bytes of ASCII text.
+func sniffUTF16(data []byte) string {
+	if len(data) < 4 || len(data)%2 != 0 {
+		return ""
+	}
+	var evenZeros, oddZeros int
+	for i := 0; i+1 < len(data); i += 2 {
+		if data[i] == 0 {
+			evenZeros++
+		}
+		if data[i+1] == 0 {
+			oddZeros++
+		}
+	}
+	units := len(data) / 2
+	switch {
+	case oddZeros*10 >= units*7 && evenZeros*10 < units:
+		return cueEncodingUTF16LE
+	case evenZeros*10 >= units*7 && oddZeros*10 < units:
+		return cueEncodingUTF16BE
+	}
+	return ""
+}
+
+// looksLikeShiftJIS requires a clean decode with kana in it. Half-width
+// katakana (single bytes 0xA1-0xDF) is what GBK and Cyrillic bytes turn into
+// under Shift-JIS, so any of it rules the encoding out.
+func looksLikeShiftJIS(data []byte) bool {
+	decoded, err := japanese.ShiftJIS.NewDecoder().Bytes(data)
+	if err != nil {
+		return false
+	}
+	kana := 0
+	for _, r := range string(decoded) {
+		switch {
+		case r == utf8.RuneError:
+			return false
+		case r >= 0xFF61 && r <= 0xFF9F:
+			return false
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		}
+	}
+	return kana > 0
+}
+
+// looksLikeWindows1251 checks that high bytes are Cyrillic letters (0xC0-0xFF,
+// Ё/ё) grouped into words; accented Latin in Windows-1252 shows up as lone
+// high bytes between ASCII letters instead.
+func looksLikeWindows1251(data []byte) bool {
+	var high, letters, runs, lower int
+	inRun := false
+	for _, b := range data {
+		if b < 0x80 {
+			inRun = false
+			continue
+		}
+		high++
+		if b >= 0xC0 || b == 0xA8 || b == 0xB8 {
+			letters++
+			if b >= 0xE0 || b == 0xB8 {
+				lower++
+			}
+		}
+		if !inRun {
+			runs++
+			inRun = true
+		}
+	}
+	if high == 0 || letters*100 < high*95 {
+		return false
+	}
+	return high*10 >= runs*25 && lower*2 >= letters
+}
+
+// looksLikeGBK checks that multi-byte characters fall mostly in the GB2312
+// hanzi block (lead 0xB0-0xF7, trail 0xA1-0xFE) where everyday Chinese
+// lives, rather than the sparse extension rows other encodings land in.
+func looksLikeGBK(data []byte) bool {
+	decoded, err := simplifiedchinese.GBK.NewDecoder().Bytes(data)
+	if err != nil || bytes.ContainsRune(decoded, utf8.RuneError) {
+		return false
+	}
+	var pairs, common int
+	for i := 0; i < len(data); i++ {
+		if data[i] < 0x81 || i+1 >= len(data) {
+			continue
+		}
+		lead, trail := data[i], data[i+1]
+		pairs++
+		if lead >= 0xB0 && lead <= 0xF7 && trail >= 0xA1 && trail <= 0xFE {
+			common++
+		}
+		i++
+	}
+	return pairs > 0 && common*10 >= pairs*8
+}
@@ -0,0 +1,94 @@
+package gobackend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	textunicode "golang.org/x/text/encoding/unicode"
+)
+
+func encodedCue(t *testing.T, enc encoding.Encoding, performer, title, track string) []byte {
+	t.Helper()
+	text := "REM DATE 2004\r\nPERFORMER \"" + performer + "\"\r\nTITLE \"" + title + "\"\r\n" +
+		"FILE \"image.wav\" WAVE\r\n  TRACK 01 AUDIO\r\n    TITLE \"" + track + "\"\r\n    INDEX 01 00:00:00\r\n"
+	if enc == nil {
+		return []byte(text)
+	}
+	data, err := enc.NewEncoder().Bytes([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseCueFileDetectsEncoding(t *testing.T) {
+	tests := []struct {
+		name, want              string
+		enc                     encoding.Encoding
+		performer, title, track string
+		prefix                  []byte
+	}{
+		{name: "utf8", want: cueEncodingUTF8, performer: "Sigur Rós", title: "Ágætis byrjun", track: "Svefn-g-englar"},
+		{name: "utf8 bom", want: cueEncodingUTF8, prefix: []byte{0xEF, 0xBB, 0xBF}, performer: "宇多田ヒカル", title: "First Love", track: "Automatic"},
+		{name: "shift_jis", want: cueEncodingShiftJIS, enc: japanese.ShiftJIS, performer: "椎名林檎", title: "無罪モラトリアム", track: "正しい街"},
+		{name: "windows-1251", want: cueEncodingWindows1251, enc: charmap.Windows1251, performer: "Кино", title: "Группа крови", track: "Закрой за мной дверь"},
+		{name: "gbk", want: cueEncodingGBK, enc: simplifiedchinese.GBK, performer: "王菲", title: "寓言", track: "新房客"},
+		{name: "windows-1252", want: cueEncodingWindows1252, enc: charmap.Windows1252, performer: "Beyoncé", title: "Déjà Vu", track: "Crème brûlée"},
+		{name: "utf-16le", want: cueEncodingUTF16LE, enc: textunicode.UTF16(textunicode.LittleEndian, textunicode.IgnoreBOM), performer: "Кино", title: "Звезда по имени Солнце", track: "Кукушка"},
+		{name: "utf-16be bom", want: cueEncodingUTF16BE, enc: textunicode.UTF16(textunicode.BigEndian, textunicode.IgnoreBOM), prefix: []byte{0xFE, 0xFF}, performer: "中島みゆき", title: "時代", track: "時代"},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := append(append([]byte{}, tt.prefix...), encodedCue(t, tt.enc, tt.performer, tt.title, tt.track)...)
+			cuePath := filepath.Join(dir, tt.name+".cue")
+			if err := os.WriteFile(cuePath, data, 0600); err != nil {
+				t.Fatal(err)
+			}
+			sheet, err := ParseCueFile(cuePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sheet.Encoding != tt.want || sheet.Performer != tt.performer || sheet.Title != tt.title ||
+				len(sheet.Tracks) != 1 || sheet.Tracks[0].Title != tt.track {
+				t.Fatalf("sheet = %+v (encoding %s, want %s)", sheet, sheet.Encoding, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCueFileExplicitEncoding(t *testing.T) {
+	dir := t.TempDir()
+	// Kanji only, no kana: detection cannot tell Shift-JIS from GBK.
+	cuePath := filepath.Join(dir, "kanji.cue")
+	if err := os.WriteFile(cuePath, encodedCue(t, japanese.ShiftJIS, "東京事変", "教育", "林檎"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"shift_jis", "SJIS", "cp932"} {
+		sheet, err := ParseCueFileWithEncoding(cuePath, name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if sheet.Performer != "東京事変" || sheet.Title != "教育" || sheet.Encoding != cueEncodingShiftJIS {
+			t.Fatalf("%s: sheet = %+v", name, sheet)
+		}
+	}
+	if _, err := ParseCueFileWithEncoding(cuePath, "klingon"); err == nil {
+		t.Fatal("unknown encoding accepted")
+	}
+
+	// A BOM overrides a wrong explicit encoding.
+	bomPath := filepath.Join(dir, "bom.cue")
+	data := append([]byte{0xEF, 0xBB, 0xBF}, encodedCue(t, nil, "Björk", "Homogenic", "Jóga")...)
+	if err := os.WriteFile(bomPath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if sheet, err := ParseCueFileWithEncoding(bomPath, "windows-1251"); err != nil || sheet.Performer != "Björk" {
+		t.Fatalf("sheet = %+v, err = %v", sheet, err)
+	}
+}
@@ -0,0 +1,317 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+
+	flacvorbis "github.com/go-flac/flacvorbis/v2"
+	flac "github.com/go-flac/go-flac/v2"
+)
+
+// FLAC CUESHEET block layout (RFC 9639 §8.7).
+const (
+	flacCueSheetHeaderSize = 128 + 8 + 259 + 1
+	flacCueSheetTrackSize  = 8 + 1 + 12 + 14 + 1
+	flacCueSheetIndexSize  = 8 + 1 + 3
+	flacCueSheetLeadOutCD  = 170
+	flacCueSheetLeadOut    = 255
+	cdSamplesPerFrame      = 44100 / cueFramesPerSecond
+	cdLeadInSamples        = 2 * 44100
+)
+
+// cueSheetFromFLACBlock converts a CUESHEET block into a CueSheet with
+// absolute track positions. The block carries no titles, so only numbers,
+// ISRCs, the catalog and the index points survive.
+func cueSheetFromFLACBlock(data []byte, sampleRate int) (*CueSheet, error) {
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid sample rate %d", sampleRate)
+	}
+	if len(data) < flacCueSheetHeaderSize {
+		return nil, fmt.Errorf("cuesheet block too short: %d bytes", len(data))
+	}
+	sheet := &CueSheet{
+		Catalog: strings.TrimRight(string(data[:128]), "\x00 "),
+	}
+	numTracks := int(data[flacCueSheetHeaderSize-1])
+	pos := flacCueSheetHeaderSize
+	seconds := func(samples uint64) float64 {
+		return float64(samples) / float64(sampleRate)
+	}
+
+	for i := 0; i < numTracks; i++ {
+		if pos+flacCueSheetTrackSize > len(data) {
+			return nil, fmt.Errorf("cuesheet track %d truncated", i+1)
+		}
+		trackOffset := binary.BigEndian.Uint64(data[pos : pos+8])
+		number := int(data[pos+8])
+		isrc := strings.TrimRight(string(data[pos+9:pos+21]), "\x00 ")
+		nonAudio := data[pos+21]&0x80 != 0
+		numIndexes := int(data[pos+35])
+		pos += flacCueSheetTrackSize
+		if pos+numIndexes*flacCueSheetIndexSize > len(data) {
+			return nil, fmt.Errorf("cuesheet track %d indexes truncated", number)
+		}
+
+		track := CueTrack{Number: number, ISRC: isrc, PreGap: -1}
+		haveStart := false
+		for j := 0; j < numIndexes; j++ {
+			offset := trackOffset + binary.BigEndian.Uint64(data[pos:pos+8])
+			switch indexNumber := data[pos+8]; {
+			case indexNumber == 0:
+				track.PreGap = seconds(offset)
+			case indexNumber == 1 || !haveStart:
+				track.StartTime = seconds(offset)
+				haveStart = indexNumber == 1
+			}
+			pos += flacCueSheetIndexSize
+		}
+		if number == flacCueSheetLeadOutCD || number == flacCueSheetLeadOut || nonAudio || numIndexes == 0 {
+			continue
+		}
+		sheet.Tracks = append(sheet.Tracks, track)
+	}
+	if len(sheet.Tracks) == 0 {
+		return nil, fmt.Errorf("cuesheet block has no audio tracks")
+	}
+	return sheet, nil
+}
+
+// buildFLACCueSheetBlock encodes sheet as a CUESHEET block for a stream of
+// totalSamples at sampleRate. The block is flagged as CD-DA only when every
+// position lands on a CD frame, which CUE timestamps at 44.1 kHz always do.
+func buildFLACCueSheetBlock(sheet *CueSheet, sampleRate int, totalSamples uint64) ([]byte, error) {
+	if sampleRate <= 0 || totalSamples == 0 {
+		return nil, fmt.Errorf("stream length unknown")
+	}
+	if len(sheet.Tracks) == 0 || len(sheet.Tracks) > 99 {
+		return nil, fmt.Errorf("cuesheet needs 1-99 tracks, got %d", len(sheet.Tracks))
+	}
+	toSamples := func(seconds float64) uint64 {
+		return uint64(math.Round(seconds * float64(sampleRate)))
+	}
+
+	type blockIndex struct {
+		number byte
+		offset uint64
+	}
+	type blockTrack struct {
+		number  byte
+		offset  uint64
+		isrc    string
+		indexes []blockIndex
+	}
+	tracks := make([]blockTrack, 0, len(sheet.Tracks)+1)
+	var previous uint64
+	for i, track := range sheet.Tracks {
+		number := track.Number
+		if number <= 0 {
+			number = i + 1
+		}
+		if number > 99 {
+			return nil, fmt.Errorf("track number %d out of range", number)
+		}
+		start := toSamples(track.StartTime)
+		offset := start
+		if track.PreGap >= 0 && track.PreGap < track.StartTime {
+			offset = toSamples(track.PreGap)
+		}
+		if start >= totalSamples || (i > 0 && offset < previous) {
+			return nil, fmt.Errorf("track %d starts outside the stream or out of order", number)
+		}
+		previous = start
+
+		entry := blockTrack{number: byte(number), offset: offset, isrc: track.ISRC}
+		if offset < start {
+			entry.indexes = append(entry.indexes, blockIndex{number: 0})
+		}
+		entry.indexes = append(entry.indexes, blockIndex{number: 1, offset: start - offset})
+		tracks = append(tracks, entry)
+	}
+
+	isCD := sampleRate == 44100 && totalSamples%cdSamplesPerFrame == 0
+	for _, track := range tracks {
+		for _, index := range track.indexes {
+			if (track.offset+index.offset)%cdSamplesPerFrame != 0 {
+				isCD = false
+			}
+		}
+	}
+	leadOut := blockTrack{number: flacCueSheetLeadOut, offset: totalSamples}
+	if isCD {
+		leadOut.number = flacCueSheetLeadOutCD
+	}
+	tracks = append(tracks, leadOut)
+
+	var buf bytes.Buffer
+	catalog := make([]byte, 128)
+	copy(catalog, strings.TrimSpace(sheet.Catalog))
+	buf.Write(catalog)
+	var leadIn uint64
+	if isCD {
+		leadIn = cdLeadInSamples
+	}
+	_ = binary.Write(&buf, binary.BigEndian, leadIn)
+	flags := make([]byte, 259)
+	if isCD {
+		flags[0] = 0x80
+	}
+	buf.Write(flags)
+	buf.WriteByte(byte(len(tracks)))
+
+	for _, track := range tracks {
+		_ = binary.Write(&buf, binary.BigEndian, track.offset)
+		buf.WriteByte(track.number)
+		isrc := make([]byte, 12)
+		copy(isrc, strings.TrimSpace(track.isrc))
+		buf.Write(isrc)
+		buf.Write(make([]byte, 14))
+		buf.WriteByte(byte(len(track.indexes)))
+		for _, index := range track.indexes {
+			_ = binary.Write(&buf, binary.BigEndian, index.offset)
+			buf.WriteByte(index.number)
+			buf.Write(make([]byte, 3))
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// readFLACEmbeddedCueSheet returns the cuesheet carried inside a FLAC image,
+// or nil when there is none. A CUESHEET Vorbis comment wins over the native
+// block because it keeps titles and performers; album fields missing from
+// either are filled from the regular tags.
+func readFLACEmbeddedCueSheet(path string) *CueSheet {
+	payloads := readFlacMetadataPayloads(path, 0, 4, 5) // STREAMINFO, VORBIS_COMMENT, CUESHEET
+	if payloads == nil {
+		return nil
+	}
+	comments := payloads[4]
+
+	var sheet *CueSheet
+	if text := vorbisCommentValue(comments, "CUESHEET"); text != "" {
+		if parsed, err := parseCueSheet(strings.NewReader(text)); err == nil && len(parsed.Files) <= 1 {
+			sheet = parsed
+		}
+	}
+	if sheet == nil && payloads[5] != nil {
+		info, ok := parseFLACStreamInfo(payloads[0])
+		if !ok {
+			return nil
+		}
+		parsed, err := cueSheetFromFLACBlock(payloads[5], info.sampleRate)
+		if err != nil {
+			GoLog("[CUE] Ignoring embedded cuesheet in %s: %v\n", path, err)
+			return nil
+		}
+		sheet = parsed
+	}
+	if sheet == nil {
+		return nil
+	}
+
+	fill := func(field *string, keys ...string) {
+		for _, key := range keys {
+			if *field != "" {
+				return
+			}
+			*field = vorbisCommentValue(comments, key)
+		}
+	}
+	fill(&sheet.Title, "ALBUM")
+	fill(&sheet.Performer, "ALBUMARTIST", "ALBUM ARTIST", "ARTIST")
+	fill(&sheet.Date, "DATE", "YEAR")
+	fill(&sheet.Genre, "GENRE")
+	fill(&sheet.Catalog, "CATALOGNUMBER", "CATALOG")
+	pointCueSheetAt(sheet, filepath.Base(path))
+	return sheet
+}
+
+// pointCueSheetAt makes a single-FILE sheet reference fileName.
+func pointCueSheetAt(sheet *CueSheet, fileName string) {
+	sheet.FileName = fileName
+	sheet.FileType = "WAVE"
+	sheet.Files = []CueFile{{Name: fileName, Type: "WAVE"}}
+	for i := range sheet.Tracks {
+		sheet.Tracks[i].FileName = fileName
+		sheet.Tracks[i].PreGapFile = ""
+	}
+}
+
+// scanEmbeddedCueForLibrary expands a FLAC image with an embedded cuesheet
+// into per-track library entries, the same ones a sidecar .cue produces.
+// Returns nil for anything that is not a multi-track image.
+func scanEmbeddedCueForLibrary(path, virtualPathPrefix string, fileModTime int64, coverCacheKey, scanTime string) []LibraryScanResult {
+	if strings.ToLower(filepath.Ext(path)) != ".flac" {
+		return nil
+	}
+	sheet := readFLACEmbeddedCueSheet(path)
+	if sheet == nil || len(sheet.Tracks) < 2 {
+		return nil
+	}
+	results, err := scanCueSheetForLibrary(path, sheet, path, virtualPathPrefix, fileModTime, coverCacheKey, scanTime)
+	if err != nil {
+		GoLog("[LibraryScan] Embedded cuesheet in %s: %v\n", path, err)
+		return nil
+	}
+	return results
+}
+
+// ReadFLACCueSheetText returns the embedded cuesheet of a FLAC image as CUE
+// text referencing the image itself.
+func ReadFLACCueSheetText(flacPath string) (string, error) {
+	sheet := readFLACEmbeddedCueSheet(flacPath)
+	if sheet == nil {
+		return "", fmt.Errorf("no embedded cuesheet in %s", filepath.Base(flacPath))
+	}
+	return FormatCueSheet(sheet), nil
+}
+
+// EmbedFLACCueSheet writes the sheet from cuePath into flacPath as both a
+// native CUESHEET block and a CUESHEET Vorbis comment, replacing any existing
+// ones. The FILE line is rewritten to name the image.
+func EmbedFLACCueSheet(flacPath, cuePath string) error {
+	sheet, err := ParseCueFile(cuePath)
+	if err != nil {
+		return fmt.Errorf("failed to parse cue file: %w", err)
+	}
+	if len(sheet.Files) > 1 {
+		return fmt.Errorf("cue sheet spans %d files; only single-file images can carry it", len(sheet.Files))
+	}
+	pointCueSheetAt(sheet, filepath.Base(flacPath))
+
+	err = updateFlacVorbis(flacPath, func(f *flac.File, cmt *flacvorbis.MetaDataBlockVorbisComment) error {
+		if len(f.Meta) == 0 || f.Meta[0].Type != flac.StreamInfo {
+			return fmt.Errorf("missing STREAMINFO")
+		}
+		info, ok := parseFLACStreamInfo(f.Meta[0].Data)
+		if !ok {
+			return fmt.Errorf("invalid STREAMINFO")
+		}
+		block, err := buildFLACCueSheetBlock(sheet, info.sampleRate, uint64(info.totalSamples))
+		if err != nil {
+			return err
+		}
+		cueBlock := &flac.MetaDataBlock{Type: flac.CueSheet, Data: block}
+		replaced := false
+		for idx, meta := range f.Meta {
+			if meta.Type == flac.CueSheet {
+				f.Meta[idx] = cueBlock
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			f.Meta = append(f.Meta, cueBlock)
+		}
+		setComment(cmt, "CUESHEET", FormatCueSheet(sheet))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	GoLog("[CUE] Embedded %d-track cuesheet into %s\n", len(sheet.Tracks), filepath.Base(flacPath))
+	return nil
+}
@@ -0,0 +1,144 @@
+package gobackend
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatCueSheetRoundTrip(t *testing.T) {
+	sheet := &CueSheet{
+		Performer: `The "Band"`,
+		Title:     "Album",
+		FileName:  "image.flac",
+		FileType:  "WAVE",
+		Genre:     "Rock",
+		Date:      "2001",
+		Catalog:   "0123456789012",
+		Tracks: []CueTrack{
+			{Number: 1, Title: "One", StartTime: 0, PreGap: -1},
+			{Number: 2, Title: "Two", Performer: "Guest", ISRC: "TEST00000002", StartTime: 62 + 39.0/75, PreGap: 60},
+		},
+	}
+	text := FormatCueSheet(sheet)
+	if !strings.Contains(text, "INDEX 00 01:00:00\n") || !strings.Contains(text, "INDEX 01 01:02:39\n") {
+		t.Fatalf("indexes not written as mm:ss:ff:\n%s", text)
+	}
+
+	parsed, err := parseCueSheet(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Performer != "The 'Band'" || parsed.Catalog != sheet.Catalog || parsed.Genre != "Rock" || parsed.FileName != "image.flac" {
+		t.Fatalf("sheet = %+v", parsed)
+	}
+	if len(parsed.Tracks) != 2 || parsed.Tracks[0].PreGap != -1 || parsed.Tracks[1].PreGap != 60 ||
+		parsed.Tracks[1].StartTime != sheet.Tracks[1].StartTime || parsed.Tracks[1].ISRC != "TEST00000002" {
+		t.Fatalf("tracks = %+v", parsed.Tracks)
+	}
+
+	if _, err := FormatCueSheetJSON(`{"file_name":"a.wav","tracks":[{"number":1,"start_time":0}]}`); err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := FormatCueSheetJSON(`{"file_name":"a.wav","tracks":[{"number":1,"start_time":3}]}`); strings.Contains(text, "INDEX 00") {
+		t.Fatalf("missing pre_gap produced an INDEX 00:\n%s", text)
+	}
+}
+
+func TestFLACCueSheetBlockRoundTrip(t *testing.T) {
+	sheet := &CueSheet{
+		Catalog: "0123456789012",
+		Tracks: []CueTrack{
+			{Number: 1, StartTime: 0, PreGap: -1},
+			{Number: 2, ISRC: "TEST00000002", StartTime: 10, PreGap: 8},
+		},
+	}
+	block, err := buildFLACCueSheetBlock(sheet, 44100, 44100*30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block[128+8]&0x80 == 0 {
+		t.Fatal("CD-aligned sheet not flagged as CD-DA")
+	}
+	parsed, err := cueSheetFromFLACBlock(block, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Catalog != sheet.Catalog || len(parsed.Tracks) != 2 {
+		t.Fatalf("sheet = %+v", parsed)
+	}
+	if got := parsed.Tracks[1]; got.StartTime != 10 || got.PreGap != 8 || got.ISRC != "TEST00000002" {
+		t.Fatalf("track 2 = %+v", got)
+	}
+
+	if _, err := buildFLACCueSheetBlock(sheet, 44100, 44100*9); err == nil {
+		t.Fatal("track past the end of the stream accepted")
+	}
+}
+
+func TestEmbeddedCueSheetScan(t *testing.T) {
+	dir := t.TempDir()
+	cuePath, _ := writeCueSplitFixture(t, dir)
+	imagePath := filepath.Join(dir, "image.flac")
+
+	if _, err := EmbedCueSheetInFlac(imagePath, cuePath); err != nil {
+		t.Fatalf("EmbedCueSheetInFlac: %v", err)
+	}
+	if err := os.Remove(cuePath); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyDownloadedAudioIntegrity(imagePath); err != nil {
+		t.Fatalf("image damaged by embedding: %v", err)
+	}
+
+	text, err := ExtractFlacCueSheet(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text, `TITLE "Four"`) || !strings.Contains(text, `FILE "image.flac" WAVE`) {
+		t.Fatalf("extracted sheet:\n%s", text)
+	}
+
+	// Without the comment the native block still yields the track layout.
+	payloads := readFlacMetadataPayloads(imagePath, 0, 5)
+	info, _ := parseFLACStreamInfo(payloads[0])
+	blockSheet, err := cueSheetFromFLACBlock(payloads[5], info.sampleRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blockSheet.Tracks) != 4 || math.Round(blockSheet.Tracks[3].StartTime*75) != 13 || blockSheet.Tracks[1].ISRC != "TEST00000002" {
+		t.Fatalf("block sheet = %+v", blockSheet.Tracks)
+	}
+
+	stat, err := os.Stat(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modTime := stat.ModTime().UnixMilli()
+	files := []libraryAudioFileInfo{{path: imagePath, modTime: modTime, size: stat.Size()}}
+	scan, err := scanLibraryFilesIncremental(files, map[string]int64{imagePath: modTime - 1000}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scan.Scanned) != 4 || scan.Scanned[0].FilePath != imagePath+"#track01" || scan.Scanned[3].TrackName != "Four" ||
+		scan.Scanned[3].ArtistName != "Guest" || scan.Scanned[0].Format != "cue+flac" {
+		t.Fatalf("scanned = %+v", scan.Scanned)
+	}
+	if len(scan.DeletedPaths) != 1 || scan.DeletedPaths[0] != imagePath {
+		t.Fatalf("stale single-track entry not removed: %v", scan.DeletedPaths)
+	}
+
+	existing := make(map[string]int64)
+	for _, result := range scan.Scanned {
+		existing[result.FilePath] = modTime
+	}
+	rescan, err := scanLibraryFilesIncremental(files, existing, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rescan.SkippedCount != 1 || len(rescan.Scanned) != 0 || len(rescan.DeletedPaths) != 0 {
+		t.Fatalf("unchanged image rescanned: %+v", rescan)
+	}
+}
@@ -0,0 +1,178 @@
+package gobackend
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Gap handling for the INDEX 00 -> INDEX 01 stretch before a track.
+const (
+	CueGapAppend  = "append"  // gap ends the previous track (CD player behaviour)
+	CueGapPrepend = "prepend" // gap opens the track it belongs to
+	CueGapDiscard = "discard" // gap belongs to no track
+)
+
+func normalizeCueGapMode(mode string) (string, error) {
+	switch mode = strings.ToLower(strings.TrimSpace(mode)); mode {
+	case "":
+		return CueGapDiscard, nil
+	case CueGapAppend, CueGapPrepend, CueGapDiscard:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown cue gap mode: %s", mode)
+}
+
+// cueSheetFiles returns the sheet's FILE entries, falling back to the single
+// FileName for sheets built without a Files list.
+func cueSheetFiles(sheet *CueSheet) []CueFile {
+	if len(sheet.Files) > 0 {
+		return sheet.Files
+	}
+	return []CueFile{{Name: sheet.FileName, Type: sheet.FileType}}
+}
+
+// cuePosition is a point in a sheet: a FILE index and seconds into it.
+// sec -1 marks the end of that file and only appears as a span end.
+type cuePosition struct {
+	file int
+	sec  float64
+}
+
+func (p cuePosition) before(q cuePosition) bool {
+	if p.file != q.file {
+		return p.file < q.file
+	}
+	return p.sec < q.sec
+}
+
+// cueSegment is a contiguous run of audio inside one FILE.
+type cueSegment struct {
+	file       int
+	start, end float64 // end -1 = until end of file
+}
+
+type cueSpan struct {
+	start, end cuePosition
+}
+
+// segments cuts the span at FILE boundaries, dropping empty pieces such as a
+// span ending at 00:00:00 of the next file.
+func (s cueSpan) segments() []cueSegment {
+	var out []cueSegment
+	for file := s.start.file; file <= s.end.file; file++ {
+		seg := cueSegment{file: file, end: -1}
+		if file == s.start.file {
+			seg.start = s.start.sec
+		}
+		if file == s.end.file {
+			seg.end = s.end.sec
+		}
+		if seg.end >= 0 && seg.end <= seg.start {
+			continue
+		}
+		out = append(out, seg)
+	}
+	return out
+}
+
+// cueTrackSpans lays the tracks out on the sheet's timeline under gapMode.
+// hidden is the hidden-track-one-audio span (INDEX 00 of track 1 before its
+// INDEX 01), which only append mode keeps as a separate track.
+func cueTrackSpans(sheet *CueSheet, gapMode string) (spans []cueSpan, hidden *cueSpan) {
+	files := cueSheetFiles(sheet)
+	fileIndex := func(name string) int {
+		for i, file := range files {
+			if file.Name == name {
+				return i
+			}
+		}
+		return 0
+	}
+
+	type trackIndexes struct {
+		index00, index01 cuePosition
+		hasGap           bool
+	}
+	indexes := make([]trackIndexes, len(sheet.Tracks))
+	for i, track := range sheet.Tracks {
+		idx := trackIndexes{index01: cuePosition{file: fileIndex(track.FileName), sec: track.StartTime}}
+		if track.PreGap >= 0 {
+			gapFile := track.PreGapFile
+			if gapFile == "" {
+				gapFile = track.FileName
+			}
+			idx.index00 = cuePosition{file: fileIndex(gapFile), sec: track.PreGap}
+			idx.hasGap = idx.index00.before(idx.index01)
+		}
+		indexes[i] = idx
+	}
+
+	end := cuePosition{file: len(files) - 1, sec: -1}
+	for i, idx := range indexes {
+		span := cueSpan{start: idx.index01, end: end}
+		if gapMode == CueGapPrepend && idx.hasGap {
+			span.start = idx.index00
+		}
+		if i+1 < len(indexes) {
+			next := indexes[i+1]
+			span.end = next.index01
+			if gapMode != CueGapAppend && next.hasGap {
+				span.end = next.index00
+			}
+		}
+		spans = append(spans, span)
+	}
+	if len(indexes) > 0 && indexes[0].hasGap && gapMode == CueGapAppend {
+		hidden = &cueSpan{start: indexes[0].index00, end: indexes[0].index01}
+	}
+	return spans, hidden
+}
+
+// resolveCueFiles maps every FILE entry to a path on disk. The first file
+// gets ResolveCueAudioPath's full fallback search (renamed images, a lone
+// audio file in the folder); later ones only exact names or a re-encoded
+// extension, since a fallback would map every file to the same image.
+// Unresolved entries are "".
+func resolveCueFiles(firstAudioPath string, sheet *CueSheet) []string {
+	files := cueSheetFiles(sheet)
+	paths := make([]string, len(files))
+	paths[0] = firstAudioPath
+	dir := filepath.Dir(firstAudioPath)
+	for i := 1; i < len(files); i++ {
+		name := files[i].Name
+		candidate := filepath.Join(dir, name)
+		if _, err := os.Stat(candidate); err == nil {
+			paths[i] = candidate
+			continue
+		}
+		base := strings.TrimSuffix(name, filepath.Ext(name))
+		for _, ext := range []string{".flac", ".wav", ".ape", ".wv", ".aiff", ".mp3", ".m4a", ".ogg"} {
+			candidate = filepath.Join(dir, base+ext)
+			if _, err := os.Stat(candidate); err == nil {
+				paths[i] = candidate
+				break
+			}
+		}
+	}
+	return paths
+}
+
+// cueTrackDuration sums a track's segments, reading each file's length from
+// durations when the segment runs to the end of it. Returns 0 when a needed
+// length is unknown.
+func cueTrackDuration(span cueSpan, durations []float64) float64 {
+	var total float64
+	for _, seg := range span.segments() {
+		end := seg.end
+		if end < 0 {
+			if seg.file >= len(durations) || durations[seg.file] <= 0 {
+				return 0
+			}
+			end = durations[seg.file]
+		}
+		total += end - seg.start
+	}
+	return total
+}
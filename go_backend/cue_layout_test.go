@@ -0,0 +1,186 @@
+package gobackend
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// eacGapsAppendedCue is an EAC "gaps appended to previous track" sheet: one
+// FILE per track, track 2's INDEX 00 at the end of 01.wav, hidden track one
+// audio before track 1 and a compliant in-file gap before track 4.
+const eacGapsAppendedCue = `REM DISCNUMBER 2
+REM TOTALDISCS 3
+REM REPLAYGAIN_ALBUM_GAIN -7.20 dB
+CATALOG 0123456789012
+PERFORMER "Artist"
+TITLE "Album"
+FILE "01.wav" WAVE
+  TRACK 01 AUDIO
+    FLAGS DCP PRE
+    TITLE "One"
+    REM REPLAYGAIN_TRACK_GAIN -6.50 dB
+    INDEX 00 00:00:00
+    INDEX 01 00:10:00
+  TRACK 02 AUDIO
+    TITLE "Two"
+    INDEX 00 03:00:00
+FILE "02.wav" WAVE
+    INDEX 01 00:00:00
+  TRACK 03 AUDIO
+    TITLE "Three"
+    PREGAP 00:02:00
+    INDEX 01 02:00:00
+    POSTGAP 00:01:00
+FILE "03.wav" WAVE
+  TRACK 04 AUDIO
+    TITLE "Four"
+    INDEX 00 00:00:00
+    INDEX 01 00:01:00
+`
+
+func writeEACGapsFixture(t *testing.T) (string, *CueSheet) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{"01.wav", "02.wav", "03.wav"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("audio"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cuePath := filepath.Join(dir, "album.cue")
+	if err := os.WriteFile(cuePath, []byte(eacGapsAppendedCue), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sheet, err := ParseCueFile(cuePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cuePath, sheet
+}
+
+func TestParseCueMultiFileSheet(t *testing.T) {
+	_, sheet := writeEACGapsFixture(t)
+
+	if sheet.FileName != "01.wav" || len(sheet.Files) != 3 || sheet.DiscNumber != 2 || sheet.TotalDiscs != 3 ||
+		sheet.ReplayGainAlbumGain != "-7.20 dB" || sheet.Catalog != "0123456789012" {
+		t.Fatalf("sheet = %+v", sheet)
+	}
+	one, two, three := sheet.Tracks[0], sheet.Tracks[1], sheet.Tracks[2]
+	if !reflect.DeepEqual(one.Flags, []string{"DCP", "PRE"}) || one.ReplayGainTrackGain != "-6.50 dB" || one.PreGap != 0 {
+		t.Fatalf("track 1 = %+v", one)
+	}
+	if two.FileName != "02.wav" || two.PreGapFile != "01.wav" || two.PreGap != 180 || two.StartTime != 0 {
+		t.Fatalf("track 2 = %+v", two)
+	}
+	if three.FileName != "02.wav" || three.PregapLength != 2 || three.PostgapLength != 1 || three.PreGap != -1 {
+		t.Fatalf("track 3 = %+v", three)
+	}
+
+	// The writer reproduces the layout, FILE switches inside track 2 included.
+	reparsed, err := parseCueSheet(strings.NewReader(FormatCueSheet(sheet)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reparsed.Encoding = sheet.Encoding
+	if !reflect.DeepEqual(reparsed, sheet) {
+		t.Fatalf("round trip:\n got %+v\nwant %+v\n%s", reparsed, sheet, FormatCueSheet(sheet))
+	}
+}
+
+func TestBuildCueSplitInfoGapModes(t *testing.T) {
+	cuePath, sheet := writeEACGapsFixture(t)
+	dir := filepath.Dir(cuePath)
+	file := func(name string) string { return filepath.Join(dir, name) }
+	seg := func(name string, start, end float64) CueSplitSegment {
+		return CueSplitSegment{AudioPath: file(name), StartSec: start, EndSec: end}
+	}
+
+	tests := []struct {
+		mode   string
+		hidden []CueSplitSegment
+		tracks [][]CueSplitSegment
+	}{
+		{
+			mode: CueGapDiscard,
+			tracks: [][]CueSplitSegment{
+				{seg("01.wav", 10, 180)},
+				{seg("02.wav", 0, 120)},
+				{seg("02.wav", 120, -1)},
+				{seg("03.wav", 1, -1)},
+			},
+		},
+		{
+			mode:   CueGapAppend,
+			hidden: []CueSplitSegment{seg("01.wav", 0, 10)},
+			tracks: [][]CueSplitSegment{
+				{seg("01.wav", 10, -1)},
+				{seg("02.wav", 0, 120)},
+				{seg("02.wav", 120, -1), seg("03.wav", 0, 1)},
+				{seg("03.wav", 1, -1)},
+			},
+		},
+		{
+			mode: CueGapPrepend,
+			tracks: [][]CueSplitSegment{
+				{seg("01.wav", 0, 180)},
+				{seg("01.wav", 180, -1), seg("02.wav", 0, 120)},
+				{seg("02.wav", 120, -1)},
+				{seg("03.wav", 0, -1)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			info, err := BuildCueSplitInfoWithGapMode(cuePath, sheet, "", tt.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.GapMode != tt.mode || len(info.AudioFiles) != 3 || info.DiscNumber != 2 {
+				t.Fatalf("info = %+v", info)
+			}
+			if (info.HiddenTrack == nil) != (tt.hidden == nil) ||
+				(info.HiddenTrack != nil && !reflect.DeepEqual(info.HiddenTrack.Segments, tt.hidden)) {
+				t.Fatalf("hidden track = %+v", info.HiddenTrack)
+			}
+			for i, track := range info.Tracks {
+				if !reflect.DeepEqual(track.Segments, tt.tracks[i]) {
+					t.Fatalf("track %d segments = %+v, want %+v", track.Number, track.Segments, tt.tracks[i])
+				}
+				first := tt.tracks[i][0]
+				if track.AudioPath != first.AudioPath || track.StartSec != first.StartSec || track.EndSec != first.EndSec {
+					t.Fatalf("track %d single-file fields = %s %v-%v", track.Number, track.AudioPath, track.StartSec, track.EndSec)
+				}
+			}
+		})
+	}
+
+	if info, _ := BuildCueSplitInfo(cuePath, sheet, ""); info.Tracks[2].PregapSec != 2 || info.Tracks[0].ReplayGainTrackGain != "-6.50 dB" {
+		t.Fatalf("track extras = %+v", info.Tracks)
+	}
+	if _, err := BuildCueSplitInfoWithGapMode(cuePath, sheet, "", "middle"); err == nil {
+		t.Fatal("unknown gap mode accepted")
+	}
+
+	if err := os.Remove(file("03.wav")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BuildCueSplitInfo(cuePath, sheet, ""); err == nil || !strings.Contains(err.Error(), "03.wav") {
+		t.Fatalf("missing second file error = %v", err)
+	}
+}
+
+func TestScanMultiFileCueForLibrary(t *testing.T) {
+	cuePath, sheet := writeEACGapsFixture(t)
+	results, err := scanCueSheetForLibrary(cuePath, sheet, filepath.Join(filepath.Dir(cuePath), "01.wav"), "", 1, "", "scan-time")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 4 || results[0].Duration != 170 || results[1].Duration != 120 {
+		t.Fatalf("durations = %+v", results)
+	}
+	if results[0].DiscNumber != 2 || results[0].TotalDiscs != 3 {
+		t.Fatalf("disc = %d/%d", results[0].DiscNumber, results[0].TotalDiscs)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -12,45 +13,90 @@ import (
 )
 
 type CueSheet struct {
-	Performer string     `json:"performer"`
-	Title     string     `json:"title"`
-	FileName  string     `json:"file_name"`
-	FileType  string     `json:"file_type"` // WAVE, FLAC, MP3, AIFF, etc.
-	Genre     string     `json:"genre,omitempty"`
-	Date      string     `json:"date,omitempty"`
-	Comment   string     `json:"comment,omitempty"`
-	Composer  string     `json:"composer,omitempty"`
-	Tracks    []CueTrack `json:"tracks"`
+	Performer           string     `json:"performer"`
+	Title               string     `json:"title"`
+	FileName            string     `json:"file_name"`
+	FileType            string     `json:"file_type"` // WAVE, FLAC, MP3, AIFF, etc.
+	Files               []CueFile  `json:"files,omitempty"`
+	Genre               string     `json:"genre,omitempty"`
+	Date                string     `json:"date,omitempty"`
+	Comment             string     `json:"comment,omitempty"`
+	Composer            string     `json:"composer,omitempty"`
+	Catalog             string     `json:"catalog,omitempty"`
+	Encoding            string     `json:"encoding,omitempty"` // charset the .cue was decoded from
+	DiscNumber          int        `json:"disc_number,omitempty"`
+	TotalDiscs          int        `json:"total_discs,omitempty"`
+	ReplayGainAlbumGain string     `json:"replaygain_album_gain,omitempty"`
+	ReplayGainAlbumPeak string     `json:"replaygain_album_peak,omitempty"`
+	Tracks              []CueTrack `json:"tracks"`
+}
+
+// CueFile is one FILE entry; multi-FILE sheets list them in order.
+type CueFile struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
 }
 
 type CueTrack struct {
-	Number    int     `json:"number"`
-	Title     string  `json:"title"`
-	Performer string  `json:"performer"`
-	ISRC      string  `json:"isrc,omitempty"`
-	Composer  string  `json:"composer,omitempty"`
-	StartTime float64 `json:"start_time"` // INDEX 01 in seconds
-	PreGap    float64 `json:"pre_gap"`    // INDEX 00 in seconds (or -1 if not present)
+	Number              int      `json:"number"`
+	Title               string   `json:"title"`
+	Performer           string   `json:"performer"`
+	ISRC                string   `json:"isrc,omitempty"`
+	Composer            string   `json:"composer,omitempty"`
+	Flags               []string `json:"flags,omitempty"`
+	FileName            string   `json:"file_name,omitempty"`     // FILE holding INDEX 01
+	StartTime           float64  `json:"start_time"`              // INDEX 01 in seconds
+	PreGap              float64  `json:"pre_gap"`                 // INDEX 00 in seconds (or -1 if not present)
+	PreGapFile          string   `json:"pre_gap_file,omitempty"`  // FILE holding INDEX 00 when it differs
+	PregapLength        float64  `json:"pregap_length,omitempty"` // PREGAP: silence not present in the file
+	PostgapLength       float64  `json:"postgap_length,omitempty"`
+	ReplayGainTrackGain string   `json:"replaygain_track_gain,omitempty"`
+	ReplayGainTrackPeak string   `json:"replaygain_track_peak,omitempty"`
 }
 
 type CueSplitInfo struct {
-	CuePath   string          `json:"cue_path"`
-	AudioPath string          `json:"audio_path"`
-	Album     string          `json:"album"`
-	Artist    string          `json:"artist"`
-	Genre     string          `json:"genre,omitempty"`
-	Date      string          `json:"date,omitempty"`
-	Tracks    []CueSplitTrack `json:"tracks"`
+	CuePath             string          `json:"cue_path"`
+	AudioPath           string          `json:"audio_path"`
+	AudioFiles          []string        `json:"audio_files,omitempty"`
+	GapMode             string          `json:"gap_mode"`
+	Album               string          `json:"album"`
+	Artist              string          `json:"artist"`
+	Genre               string          `json:"genre,omitempty"`
+	Date                string          `json:"date,omitempty"`
+	Catalog             string          `json:"catalog,omitempty"`
+	Encoding            string          `json:"encoding,omitempty"`
+	DiscNumber          int             `json:"disc_number,omitempty"`
+	TotalDiscs          int             `json:"total_discs,omitempty"`
+	ReplayGainAlbumGain string          `json:"replaygain_album_gain,omitempty"`
+	ReplayGainAlbumPeak string          `json:"replaygain_album_peak,omitempty"`
+	HiddenTrack         *CueSplitTrack  `json:"hidden_track,omitempty"` // HTOA before track 1 (append mode)
+	Tracks              []CueSplitTrack `json:"tracks"`
 }
 
+// CueSplitTrack describes one track's audio. Segments lists every piece in
+// play order, more than one when a track spans FILE boundaries;
+// AudioPath/StartSec/EndSec repeat the first piece for single-file callers.
 type CueSplitTrack struct {
-	Number   int     `json:"number"`
-	Title    string  `json:"title"`
-	Artist   string  `json:"artist"`
-	ISRC     string  `json:"isrc,omitempty"`
-	Composer string  `json:"composer,omitempty"`
-	StartSec float64 `json:"start_sec"`
-	EndSec   float64 `json:"end_sec"` // -1 means until end of file
+	Number              int               `json:"number"`
+	Title               string            `json:"title"`
+	Artist              string            `json:"artist"`
+	ISRC                string            `json:"isrc,omitempty"`
+	Composer            string            `json:"composer,omitempty"`
+	Flags               []string          `json:"flags,omitempty"`
+	AudioPath           string            `json:"audio_path,omitempty"`
+	StartSec            float64           `json:"start_sec"`
+	EndSec              float64           `json:"end_sec"` // -1 means until end of file
+	Segments            []CueSplitSegment `json:"segments,omitempty"`
+	PregapSec           float64           `json:"pregap_sec,omitempty"`  // silence to generate before the track
+	PostgapSec          float64           `json:"postgap_sec,omitempty"` // silence to generate after it
+	ReplayGainTrackGain string            `json:"replaygain_track_gain,omitempty"`
+	ReplayGainTrackPeak string            `json:"replaygain_track_peak,omitempty"`
+}
+
+type CueSplitSegment struct {
+	AudioPath string  `json:"audio_path"`
+	StartSec  float64 `json:"start_sec"`
+	EndSec    float64 `json:"end_sec"` // -1 means until end of file
 }
 
 var (
@@ -59,16 +105,37 @@ var (
 )
 
 func ParseCueFile(cuePath string) (*CueSheet, error) {
-	f, err := os.Open(cuePath)
+	return ParseCueFileWithEncoding(cuePath, "")
+}
+
+// ParseCueFileWithEncoding parses a .cue file written in encodingName (any
+// WHATWG label such as "shift_jis" or "windows-1251"). An empty name detects
+// the charset; a byte order mark overrides either.
+func ParseCueFileWithEncoding(cuePath, encodingName string) (*CueSheet, error) {
+	data, err := os.ReadFile(cuePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open cue file: %w", err)
 	}
-	defer f.Close()
+	text, detected, err := decodeCueText(data, encodingName)
+	if err != nil {
+		return nil, err
+	}
+	sheet, err := parseCueSheet(strings.NewReader(text))
+	if err != nil {
+		return nil, err
+	}
+	sheet.Encoding = detected
+	return sheet, nil
+}
 
+// parseCueSheet parses CUE text from r; ParseCueFile and the CUESHEET Vorbis
+// comment of FLAC images share it.
+func parseCueSheet(r io.Reader) (*CueSheet, error) {
 	sheet := &CueSheet{}
 	var currentTrack *CueTrack
+	var currentFile string
 
-	scanner := bufio.NewScanner(f)
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" {
@@ -100,6 +167,22 @@ func ParseCueFile(cuePath string) (*CueSheet, error) {
 					} else {
 						sheet.Composer = value
 					}
+				case "DISCNUMBER":
+					sheet.DiscNumber, _ = strconv.Atoi(value)
+				case "TOTALDISCS":
+					sheet.TotalDiscs, _ = strconv.Atoi(value)
+				case "REPLAYGAIN_ALBUM_GAIN":
+					sheet.ReplayGainAlbumGain = value
+				case "REPLAYGAIN_ALBUM_PEAK":
+					sheet.ReplayGainAlbumPeak = value
+				case "REPLAYGAIN_TRACK_GAIN":
+					if currentTrack != nil {
+						currentTrack.ReplayGainTrackGain = value
+					}
+				case "REPLAYGAIN_TRACK_PEAK":
+					if currentTrack != nil {
+						currentTrack.ReplayGainTrackPeak = value
+					}
 				}
 			}
 			continue
@@ -128,8 +211,12 @@ func ParseCueFile(cuePath string) (*CueSheet, error) {
 		if strings.HasPrefix(upper, "FILE ") {
 			rest := line[len("FILE "):]
 			fname, ftype := parseCueFileLine(rest)
-			sheet.FileName = fname
-			sheet.FileType = ftype
+			if len(sheet.Files) == 0 {
+				sheet.FileName = fname
+				sheet.FileType = ftype
+			}
+			sheet.Files = append(sheet.Files, CueFile{Name: fname, Type: ftype})
+			currentFile = fname
 			continue
 		}
 
@@ -145,8 +232,9 @@ func ParseCueFile(cuePath string) (*CueSheet, error) {
 			}
 
 			currentTrack = &CueTrack{
-				Number: trackNum,
-				PreGap: -1,
+				Number:   trackNum,
+				PreGap:   -1,
+				FileName: currentFile,
 			}
 			continue
 		}
@@ -156,16 +244,47 @@ func ParseCueFile(cuePath string) (*CueSheet, error) {
 			if len(parts) >= 3 {
 				indexNum, _ := strconv.Atoi(parts[1])
 				timeSec := parseCueTimestamp(parts[2])
+				// In EAC "gaps appended" sheets INDEX 00 sits at the end of the
+				// previous FILE and INDEX 01 at the start of the next one.
 				switch indexNum {
 				case 0:
 					currentTrack.PreGap = timeSec
+					if currentFile != currentTrack.FileName {
+						currentTrack.PreGapFile = currentFile
+					}
 				case 1:
 					currentTrack.StartTime = timeSec
+					if currentFile != currentTrack.FileName {
+						if currentTrack.PreGap >= 0 && currentTrack.PreGapFile == "" {
+							currentTrack.PreGapFile = currentTrack.FileName
+						}
+						currentTrack.FileName = currentFile
+					}
 				}
 			}
 			continue
 		}
 
+		if strings.HasPrefix(upper, "FLAGS ") && currentTrack != nil {
+			currentTrack.Flags = strings.Fields(strings.ToUpper(line[len("FLAGS "):]))
+			continue
+		}
+
+		if strings.HasPrefix(upper, "PREGAP ") && currentTrack != nil {
+			currentTrack.PregapLength = parseCueTimestamp(strings.TrimSpace(line[len("PREGAP "):]))
+			continue
+		}
+
+		if strings.HasPrefix(upper, "POSTGAP ") && currentTrack != nil {
+			currentTrack.PostgapLength = parseCueTimestamp(strings.TrimSpace(line[len("POSTGAP "):]))
+			continue
+		}
+
+		if strings.HasPrefix(upper, "CATALOG ") {
+			sheet.Catalog = strings.TrimSpace(line[len("CATALOG "):])
+			continue
+		}
+
 		if strings.HasPrefix(upper, "ISRC ") && currentTrack != nil {
 			currentTrack.ISRC = strings.TrimSpace(line[len("ISRC "):])
 			continue
@@ -309,6 +428,17 @@ func ResolveCueAudioPath(cuePath string, cueFileName string) string {
 }
 
 func BuildCueSplitInfo(cuePath string, sheet *CueSheet, audioDir string) (*CueSplitInfo, error) {
+	return BuildCueSplitInfoWithGapMode(cuePath, sheet, audioDir, "")
+}
+
+// BuildCueSplitInfoWithGapMode resolves every FILE of the sheet and lays the
+// tracks out with gapMode (CueGapAppend, CueGapPrepend or CueGapDiscard;
+// empty keeps the historical discard behaviour).
+func BuildCueSplitInfoWithGapMode(cuePath string, sheet *CueSheet, audioDir, gapMode string) (*CueSplitInfo, error) {
+	gapMode, err := normalizeCueGapMode(gapMode)
+	if err != nil {
+		return nil, err
+	}
 	resolveDir := cuePath
 	if audioDir != "" {
 		resolveDir = filepath.Join(audioDir, filepath.Base(cuePath))
@@ -317,16 +447,33 @@ func BuildCueSplitInfo(cuePath string, sheet *CueSheet, audioDir string) (*CueSp
 	if audioPath == "" {
 		return nil, fmt.Errorf("audio file not found for cue sheet: %s (referenced: %s)", cuePath, sheet.FileName)
 	}
-
-	info := &CueSplitInfo{
-		CuePath:   cuePath,
-		AudioPath: audioPath,
-		Album:     sheet.Title,
-		Artist:    sheet.Performer,
-		Genre:     sheet.Genre,
-		Date:      sheet.Date,
+	audioFiles := resolveCueFiles(audioPath, sheet)
+	for i, path := range audioFiles {
+		if path == "" {
+			return nil, fmt.Errorf("audio file not found for cue sheet: %s (referenced: %s)", cuePath, cueSheetFiles(sheet)[i].Name)
+		}
 	}
 
+	info := &CueSplitInfo{
+		CuePath:             cuePath,
+		AudioPath:           audioPath,
+		GapMode:             gapMode,
+		Album:               sheet.Title,
+		Artist:              sheet.Performer,
+		Genre:               sheet.Genre,
+		Date:                sheet.Date,
+		Catalog:             sheet.Catalog,
+		Encoding:            sheet.Encoding,
+		DiscNumber:          sheet.DiscNumber,
+		TotalDiscs:          sheet.TotalDiscs,
+		ReplayGainAlbumGain: sheet.ReplayGainAlbumGain,
+		ReplayGainAlbumPeak: sheet.ReplayGainAlbumPeak,
+	}
+	if len(audioFiles) > 1 {
+		info.AudioFiles = audioFiles
+	}
+
+	spans, hidden := cueTrackSpans(sheet, gapMode)
 	for i, track := range sheet.Tracks {
 		performer := track.Performer
 		if performer == "" {
@@ -338,37 +485,64 @@ func BuildCueSplitInfo(cuePath string, sheet *CueSheet, audioDir string) (*CueSp
 			composer = sheet.Composer
 		}
 
-		endSec := float64(-1)
-		if i+1 < len(sheet.Tracks) {
-			nextTrack := sheet.Tracks[i+1]
-			if nextTrack.PreGap >= 0 {
-				endSec = nextTrack.PreGap
-			} else {
-				endSec = nextTrack.StartTime
-			}
+		splitTrack := CueSplitTrack{
+			Number:              track.Number,
+			Title:               track.Title,
+			Artist:              performer,
+			ISRC:                track.ISRC,
+			Composer:            composer,
+			Flags:               track.Flags,
+			PregapSec:           track.PregapLength,
+			PostgapSec:          track.PostgapLength,
+			ReplayGainTrackGain: track.ReplayGainTrackGain,
+			ReplayGainTrackPeak: track.ReplayGainTrackPeak,
 		}
-
-		info.Tracks = append(info.Tracks, CueSplitTrack{
-			Number:   track.Number,
-			Title:    track.Title,
-			Artist:   performer,
-			ISRC:     track.ISRC,
-			Composer: composer,
-			StartSec: track.StartTime,
-			EndSec:   endSec,
-		})
+		applyCueSpan(&splitTrack, spans[i], audioFiles)
+		info.Tracks = append(info.Tracks, splitTrack)
+	}
+	if hidden != nil {
+		info.HiddenTrack = &CueSplitTrack{Title: "Hidden Track", Artist: sheet.Performer}
+		applyCueSpan(info.HiddenTrack, *hidden, audioFiles)
 	}
 
 	return info, nil
 }
 
+// applyCueSpan fills the track's segments and mirrors the first one into
+// the single-file fields.
+func applyCueSpan(track *CueSplitTrack, span cueSpan, audioFiles []string) {
+	for _, seg := range span.segments() {
+		track.Segments = append(track.Segments, CueSplitSegment{
+			AudioPath: audioFiles[seg.file],
+			StartSec:  seg.start,
+			EndSec:    seg.end,
+		})
+	}
+	if len(track.Segments) == 0 {
+		track.AudioPath = audioFiles[span.start.file]
+		track.StartSec = span.start.sec
+		track.EndSec = span.start.sec
+		return
+	}
+	first := track.Segments[0]
+	track.AudioPath, track.StartSec, track.EndSec = first.AudioPath, first.StartSec, first.EndSec
+}
+
 func ParseCueFileJSON(cuePath string, audioDir string) (string, error) {
-	sheet, err := ParseCueFile(cuePath)
+	return ParseCueFileJSONWithGapMode(cuePath, audioDir, "")
+}
+
+func ParseCueFileJSONWithGapMode(cuePath, audioDir, gapMode string) (string, error) {
+	return ParseCueFileJSONWithGapModeAndEncoding(cuePath, audioDir, gapMode, "")
+}
+
+func ParseCueFileJSONWithGapModeAndEncoding(cuePath, audioDir, gapMode, encodingName string) (string, error) {
+	sheet, err := ParseCueFileWithEncoding(cuePath, encodingName)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse cue file: %w", err)
 	}
 
-	info, err := BuildCueSplitInfo(cuePath, sheet, audioDir)
+	info, err := BuildCueSplitInfoWithGapMode(cuePath, sheet, audioDir, gapMode)
 	if err != nil {
 		return "", err
 	}
@@ -405,7 +579,19 @@ func ScanCueFileForLibraryExt(cuePath, audioDir, virtualPathPrefix string, fileM
 }
 
 func ScanCueFileForLibraryExtWithCoverCacheKey(cuePath, audioDir, virtualPathPrefix string, fileModTime int64, coverCacheKey, scanTime string) ([]LibraryScanResult, error) {
-	sheet, err := ParseCueFile(cuePath)
+	return ScanCueFileForLibraryExtWithCoverCacheKeyAndEncoding(
+		cuePath,
+		audioDir,
+		virtualPathPrefix,
+		fileModTime,
+		coverCacheKey,
+		"",
+		scanTime,
+	)
+}
+
+func ScanCueFileForLibraryExtWithCoverCacheKeyAndEncoding(cuePath, audioDir, virtualPathPrefix string, fileModTime int64, coverCacheKey, encodingName, scanTime string) ([]LibraryScanResult, error) {
+	sheet, err := ParseCueFileWithEncoding(cuePath, encodingName)
 	if err != nil {
 		return nil, err
 	}
@@ -439,31 +625,46 @@ func resolveCueAudioPathForLibrary(cuePath string, sheet *CueSheet, audioDir str
 	return audioPath, nil
 }
 
-func scanCueSheetForLibrary(cuePath string, sheet *CueSheet, audioPath, virtualPathPrefix string, fileModTime int64, coverCacheKey, scanTime string) ([]LibraryScanResult, error) {
-	if sheet == nil {
-		return nil, fmt.Errorf("cue sheet is nil for %s", cuePath)
-	}
-
-	var bitDepth, sampleRate int
-	var totalDurationSec float64
-	audioExt := strings.ToLower(filepath.Ext(audioPath))
-	switch audioExt {
+// cueAudioQuality reads what the library shows for a cue image: bit depth,
+// sample rate and length in seconds (zero when unknown).
+func cueAudioQuality(audioPath string) (bitDepth, sampleRate int, durationSec float64) {
+	switch strings.ToLower(filepath.Ext(audioPath)) {
 	case ".flac":
 		quality, qErr := GetAudioQuality(audioPath)
 		if qErr == nil {
 			bitDepth = quality.BitDepth
 			sampleRate = quality.SampleRate
 			if quality.SampleRate > 0 && quality.TotalSamples > 0 {
-				totalDurationSec = float64(quality.TotalSamples) / float64(quality.SampleRate)
+				durationSec = float64(quality.TotalSamples) / float64(quality.SampleRate)
 			}
 		}
 	case ".mp3":
 		quality, qErr := GetMP3Quality(audioPath)
 		if qErr == nil {
 			sampleRate = quality.SampleRate
-			totalDurationSec = float64(quality.Duration)
+			durationSec = float64(quality.Duration)
+		}
+	}
+	return bitDepth, sampleRate, durationSec
+}
+
+func scanCueSheetForLibrary(cuePath string, sheet *CueSheet, audioPath, virtualPathPrefix string, fileModTime int64, coverCacheKey, scanTime string) ([]LibraryScanResult, error) {
+	if sheet == nil {
+		return nil, fmt.Errorf("cue sheet is nil for %s", cuePath)
+	}
+
+	audioExt := strings.ToLower(filepath.Ext(audioPath))
+	bitDepth, sampleRate, firstDurationSec := cueAudioQuality(audioPath)
+	audioFiles := resolveCueFiles(audioPath, sheet)
+	fileDurations := []float64{firstDurationSec}
+	for _, path := range audioFiles[1:] {
+		var durationSec float64
+		if path != "" {
+			_, _, durationSec = cueAudioQuality(path)
 		}
+		fileDurations = append(fileDurations, durationSec)
 	}
+	spans, _ := cueTrackSpans(sheet, CueGapDiscard)
 
 	var coverPath string
 	libraryCoverCacheMu.RLock()
@@ -493,6 +694,12 @@ func scanCueSheetForLibrary(cuePath string, sheet *CueSheet, audioPath, virtualP
 		}
 	}
 
+	discNumber, totalDiscs := 1, 1
+	if sheet.DiscNumber > 0 {
+		discNumber = sheet.DiscNumber
+		totalDiscs = max(sheet.TotalDiscs, discNumber)
+	}
+
 	var results []LibraryScanResult
 	for i, track := range sheet.Tracks {
 		performer := track.Performer
@@ -518,16 +725,7 @@ func scanCueSheetForLibrary(cuePath string, sheet *CueSheet, audioPath, virtualP
 			composer = sheet.Composer
 		}
 
-		var duration int
-		if i+1 < len(sheet.Tracks) {
-			nextStart := sheet.Tracks[i+1].StartTime
-			if sheet.Tracks[i+1].PreGap >= 0 {
-				nextStart = sheet.Tracks[i+1].PreGap
-			}
-			duration = int(nextStart - track.StartTime)
-		} else if totalDurationSec > 0 {
-			duration = int(totalDurationSec - track.StartTime)
-		}
+		duration := int(cueTrackDuration(spans[i], fileDurations))
 
 		id := generateLibraryID(fmt.Sprintf("%s#track%d", pathBase, track.Number))
 
@@ -545,8 +743,8 @@ func scanCueSheetForLibrary(cuePath string, sheet *CueSheet, audioPath, virtualP
 			ISRC:        track.ISRC,
 			TrackNumber: track.Number,
 			TotalTracks: len(sheet.Tracks),
-			DiscNumber:  1,
-			TotalDiscs:  1,
+			DiscNumber:  discNumber,
+			TotalDiscs:  totalDiscs,
 			Duration:    duration,
 			ReleaseDate: sheet.Date,
 			BitDepth:    bitDepth,
@@ -0,0 +1,604 @@
+package gobackend
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-flac/flacvorbis/v2"
+	flac "github.com/go-flac/go-flac/v2"
+)
+
+// Splitting CUE+FLAC images into per-track FLACs without FFmpeg.
+// Frames wholly inside a track are copied byte for byte; only their headers
+// are rewritten, since every output is a variable-block-size stream numbered
+// from sample 0. In sample mode the frames a track boundary falls inside are
+// decoded and the track's part is re-encoded as verbatim subframes, so the
+// cut lands on the exact CUE position at the cost of two uncompressed frames
+// per track. Frame mode moves each boundary to the nearest frame start and
+// copies only.
+
+const (
+	cueSplitGranularitySample = "sample"
+	cueSplitGranularityFrame  = "frame"
+
+	// flacMinBlockSize is the smallest block FLAC allows anywhere but the
+	// last frame of a stream.
+	flacMinBlockSize = 16
+	flacMaxBlockSize = 65535
+)
+
+type CueSplitOptions struct {
+	// Granularity is "sample" (default) or "frame".
+	Granularity string `json:"granularity,omitempty"`
+	// GapMode places INDEX 00 gaps: "discard" (default), "append" or
+	// "prepend". Append mode also writes hidden track one audio as track 00.
+	GapMode string `json:"gap_mode,omitempty"`
+	// Encoding is the .cue charset; empty detects it.
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type CueSplitOutput struct {
+	Number      int     `json:"number"`
+	Title       string  `json:"title"`
+	Path        string  `json:"path"`
+	StartSample int64   `json:"start_sample"`
+	EndSample   int64   `json:"end_sample"`
+	Duration    float64 `json:"duration"`
+}
+
+type CueSplitResult struct {
+	AudioPath   string           `json:"audio_path"`
+	OutputDir   string           `json:"output_dir"`
+	Granularity string           `json:"granularity"`
+	GapMode     string           `json:"gap_mode"`
+	Tracks      []CueSplitOutput `json:"tracks"`
+}
+
+// flacFrameSpan locates one source frame.
+type flacFrameSpan struct {
+	offset      int64
+	length      int
+	firstSample int64
+	blockSize   int
+}
+
+// flacImage is an indexed source FLAC.
+type flacImage struct {
+	f        *os.File
+	info     flacStreamInfo
+	frames   []flacFrameSpan
+	samples  int64
+	pictures []*flac.MetaDataBlock
+}
+
+func openFLACImage(path string) (*flacImage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	img := &flacImage{f: f}
+	if err := img.index(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if parsed, err := parseFlacFile(path); err == nil {
+		for _, meta := range parsed.Meta {
+			if meta.Type == flac.Picture {
+				img.pictures = append(img.pictures, meta)
+			}
+		}
+		parsed.Close()
+	}
+	return img, nil
+}
+
+func (img *flacImage) index() error {
+	info, audioStart, err := readFLACLayout(img.f)
+	if err != nil {
+		return err
+	}
+	stat, err := img.f.Stat()
+	if err != nil {
+		return err
+	}
+	audioEnd := stat.Size()
+	if audioEnd-audioStart >= 128 {
+		tag := make([]byte, 3)
+		if _, err := img.f.ReadAt(tag, audioEnd-128); err == nil && string(tag) == "TAG" {
+			audioEnd -= 128
+		}
+	}
+	if audioStart >= audioEnd {
+		return fmt.Errorf("no audio frames after metadata")
+	}
+	img.info = info
+
+	offset := audioStart
+	reader := bufio.NewReaderSize(io.NewSectionReader(img.f, audioStart, audioEnd-audioStart), 256*1024)
+	_, samples, err := walkFLACFrames(reader, func(header flacFrameHeader, length int) {
+		img.frames = append(img.frames, flacFrameSpan{
+			offset:      offset,
+			length:      length,
+			firstSample: img.samples,
+			blockSize:   header.blockSize,
+		})
+		offset += int64(length)
+		img.samples += int64(header.blockSize)
+	})
+	if err != nil {
+		return fmt.Errorf("index FLAC frames: %w", err)
+	}
+	img.samples = samples
+	return nil
+}
+
+func (img *flacImage) close() error {
+	return img.f.Close()
+}
+
+func (img *flacImage) readFrame(i int) ([]byte, error) {
+	span := img.frames[i]
+	buf := make([]byte, span.length)
+	if _, err := img.f.ReadAt(buf, span.offset); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// nearestFrameStart snaps sample to the closest frame boundary.
+func (img *flacImage) nearestFrameStart(sample int64) int64 {
+	if sample >= img.samples {
+		return img.samples
+	}
+	i := sort.Search(len(img.frames), func(i int) bool {
+		return img.frames[i].firstSample > sample
+	}) - 1
+	if i < 0 {
+		return 0
+	}
+	span := img.frames[i]
+	if sample-span.firstSample >= int64(span.blockSize)/2 {
+		return span.firstSample + int64(span.blockSize)
+	}
+	return span.firstSample
+}
+
+// flacTrackWriter accumulates one output stream's frames.
+type flacTrackWriter struct {
+	w            io.Writer
+	info         flacStreamInfo
+	samples      int64
+	frames       int
+	minBlockSize int
+	maxBlockSize int
+	minFrameSize int
+	maxFrameSize int
+	lastBlock    int
+}
+
+func (t *flacTrackWriter) emit(frame []byte, blockSize int) error {
+	if _, err := t.w.Write(frame); err != nil {
+		return err
+	}
+	// STREAMINFO's minimum excludes the last block, which may be short;
+	// the previous block is folded in once another one follows it.
+	if t.frames > 0 {
+		if t.minBlockSize == 0 || t.lastBlock < t.minBlockSize {
+			t.minBlockSize = t.lastBlock
+		}
+	}
+	t.maxBlockSize = max(t.maxBlockSize, blockSize)
+	if t.minFrameSize == 0 || len(frame) < t.minFrameSize {
+		t.minFrameSize = len(frame)
+	}
+	t.maxFrameSize = max(t.maxFrameSize, len(frame))
+	t.lastBlock = blockSize
+	t.samples += int64(blockSize)
+	t.frames++
+	return nil
+}
+
+// copyFrame emits a source frame renumbered to the writer's position.
+func (t *flacTrackWriter) copyFrame(data []byte) error {
+	header, ok := parseFLACFrameHeader(data)
+	if !ok || len(data) < header.size+2 {
+		return fmt.Errorf("invalid source frame header")
+	}
+	_, numberLen, _ := decodeFLACCodedNumber(data[4:])
+
+	frame := make([]byte, 0, len(data)+7)
+	frame = append(frame, 0xFF, 0xF9, data[2], data[3])
+	frame = append(frame, encodeFLACCodedNumber(uint64(t.samples))...)
+	frame = append(frame, data[4+numberLen:header.size-1]...)
+	frame = append(frame, flacCRC8(frame))
+	frame = append(frame, data[header.size:len(data)-2]...)
+	crc := flacCRC16(frame)
+	frame = append(frame, byte(crc>>8), byte(crc))
+	return t.emit(frame, header.blockSize)
+}
+
+// encodeFrame emits samples (one slice per channel) as a frame of verbatim
+// subframes.
+func (t *flacTrackWriter) encodeFrame(samples [][]int32) error {
+	n := len(samples[0])
+	var bw flacBitWriter
+	bw.writeBits(0xFFF9, 16)
+	blockCode := uint64(7)
+	if n <= 256 {
+		blockCode = 6
+	}
+	bw.writeBits(blockCode<<4, 8) // sample rate from STREAMINFO
+	bw.writeBits(uint64(len(samples)-1)<<4, 8)
+	for _, b := range encodeFLACCodedNumber(uint64(t.samples)) {
+		bw.writeBits(uint64(b), 8)
+	}
+	if blockCode == 6 {
+		bw.writeBits(uint64(n-1), 8)
+	} else {
+		bw.writeBits(uint64(n-1), 16)
+	}
+	bw.writeBits(uint64(flacCRC8(bw.buf)), 8)
+
+	bps := uint(t.info.bitsPerSample)
+	mask := uint64(1)<<bps - 1
+	for _, channel := range samples {
+		bw.writeBits(0x02, 8) // verbatim, no wasted bits
+		for _, s := range channel {
+			bw.writeBits(uint64(int64(s))&mask, bps)
+		}
+	}
+	bw.align()
+	crc := flacCRC16(bw.buf)
+	bw.writeBits(uint64(crc), 16)
+	return t.emit(bw.buf, n)
+}
+
+// streamInfo builds the output STREAMINFO. The MD5 is left zero ("not
+// computed"): copied frames are never decoded.
+func (t *flacTrackWriter) streamInfo() []byte {
+	minBlock := t.minBlockSize
+	if t.frames == 1 {
+		minBlock = t.maxBlockSize
+	}
+	block := make([]byte, 34)
+	binary.BigEndian.PutUint16(block[0:2], uint16(max(minBlock, flacMinBlockSize)))
+	binary.BigEndian.PutUint16(block[2:4], uint16(max(t.maxBlockSize, flacMinBlockSize)))
+	putUint24(block[4:7], t.minFrameSize)
+	putUint24(block[7:10], t.maxFrameSize)
+	packed := uint64(t.info.sampleRate)<<44 |
+		uint64(t.info.channels-1)<<41 |
+		uint64(t.info.bitsPerSample-1)<<36 |
+		uint64(t.samples)&(1<<36-1)
+	binary.BigEndian.PutUint64(block[10:18], packed)
+	return block
+}
+
+func putUint24(dst []byte, v int) {
+	dst[0] = byte(v >> 16)
+	dst[1] = byte(v >> 8)
+	dst[2] = byte(v)
+}
+
+// flacBitWriter writes MSB-first bits.
+type flacBitWriter struct {
+	buf   []byte
+	cache uint64
+	n     uint
+}
+
+func (b *flacBitWriter) writeBits(v uint64, n uint) {
+	for n > 0 {
+		take := min(n, 32)
+		n -= take
+		b.cache = b.cache<<take | (v>>n)&(1<<take-1)
+		b.n += take
+		for b.n >= 8 {
+			b.n -= 8
+			b.buf = append(b.buf, byte(b.cache>>b.n))
+		}
+		b.cache &= 1<<b.n - 1
+	}
+}
+
+func (b *flacBitWriter) align() {
+	if b.n > 0 {
+		b.writeBits(0, 8-b.n)
+	}
+}
+
+// writeTrack writes samples [start, end) of img as a FLAC stream to w.
+func (img *flacImage) writeTrack(t *flacTrackWriter, start, end int64) error {
+	var pending [][]int32
+	pendingLen := 0
+	flush := func() error {
+		if pendingLen == 0 {
+			return nil
+		}
+		err := t.encodeFrame(pending)
+		pending, pendingLen = nil, 0
+		return err
+	}
+
+	i := sort.Search(len(img.frames), func(i int) bool {
+		span := img.frames[i]
+		return span.firstSample+int64(span.blockSize) > start
+	})
+	for ; i < len(img.frames) && img.frames[i].firstSample < end; i++ {
+		span := img.frames[i]
+		frameEnd := span.firstSample + int64(span.blockSize)
+		lo, hi := max(start, span.firstSample), min(end, frameEnd)
+		data, err := img.readFrame(i)
+		if err != nil {
+			return err
+		}
+
+		// A short re-encoded head would be an undersized block mid-stream;
+		// the following frame is re-encoded along with it instead.
+		whole := lo == span.firstSample && hi == frameEnd
+		if whole && (pendingLen == 0 || pendingLen >= flacMinBlockSize) {
+			if err := flush(); err != nil {
+				return err
+			}
+			if err := t.copyFrame(data); err != nil {
+				return fmt.Errorf("frame at sample %d: %w", span.firstSample, err)
+			}
+			continue
+		}
+
+		frame, err := decodeFLACFrame(img.info, data)
+		if err != nil {
+			return err
+		}
+		if pendingLen+int(hi-lo) > flacMaxBlockSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if pending == nil {
+			pending = make([][]int32, len(frame.samples))
+		}
+		for ch, samples := range frame.samples {
+			pending[ch] = append(pending[ch], samples[lo-span.firstSample:hi-span.firstSample]...)
+		}
+		pendingLen += int(hi - lo)
+	}
+	return flush()
+}
+
+func cueSplitTrackMetadata(info *CueSplitInfo, sheet *CueSheet, track CueSplitTrack) Metadata {
+	return Metadata{
+		Title:               track.Title,
+		Artist:              track.Artist,
+		Album:               info.Album,
+		AlbumArtist:         info.Artist,
+		Date:                info.Date,
+		TrackNumber:         track.Number,
+		TotalTracks:         len(info.Tracks),
+		ISRC:                track.ISRC,
+		Genre:               info.Genre,
+		Composer:            track.Composer,
+		Comment:             sheet.Comment,
+		DiscNumber:          info.DiscNumber,
+		TotalDiscs:          info.TotalDiscs,
+		ReplayGainTrackGain: track.ReplayGainTrackGain,
+		ReplayGainTrackPeak: track.ReplayGainTrackPeak,
+		ReplayGainAlbumGain: info.ReplayGainAlbumGain,
+		ReplayGainAlbumPeak: info.ReplayGainAlbumPeak,
+	}
+}
+
+func cueSplitFileName(track CueSplitTrack) string {
+	title := strings.TrimSpace(track.Title)
+	if title == "" {
+		title = fmt.Sprintf("Track %02d", track.Number)
+	}
+	return fmt.Sprintf("%02d - %s.flac", track.Number, sanitizeFilename(title))
+}
+
+// writeSplitTrack writes one track crash-safely: the stream goes to a
+// ".partial" sibling (which library scans ignore) and is renamed into place.
+func (img *flacImage) writeSplitTrack(path string, start, end int64, meta Metadata, pictures []flac.MetaDataBlock) error {
+	tmpPath := path + ".split.partial"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	cleanup := func() {
+		out.Close()
+		os.Remove(tmpPath)
+	}
+
+	cmt := flacvorbis.New()
+	writeVorbisMetadata(cmt, meta)
+	blocks := []flac.MetaDataBlock{
+		{Type: flac.StreamInfo, Data: make([]byte, 34)},
+		cmt.Marshal(),
+	}
+	blocks = append(blocks, pictures...)
+
+	bw := bufio.NewWriterSize(out, 256*1024)
+	bw.WriteString("fLaC")
+	for i := range blocks {
+		bw.Write(blocks[i].Marshal(i == len(blocks)-1))
+	}
+	writer := &flacTrackWriter{w: bw, info: img.info}
+	if err := img.writeTrack(writer, start, end); err != nil {
+		cleanup()
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		cleanup()
+		return err
+	}
+	// STREAMINFO follows the marker and its 4-byte block header.
+	if _, err := out.WriteAt(writer.streamInfo(), 8); err != nil {
+		cleanup()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		cleanup()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// cueSplitPictures returns the image's embedded pictures, or the folder
+// cover beside the CUE sheet as a front cover.
+func cueSplitPictures(img *flacImage, cuePath string) []flac.MetaDataBlock {
+	var pictures []flac.MetaDataBlock
+	for _, meta := range img.pictures {
+		pictures = append(pictures, *meta)
+	}
+	if len(pictures) > 0 {
+		return pictures
+	}
+	coverPath := findFolderCover(filepath.Dir(cuePath))
+	if coverPath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(coverPath)
+	if err != nil {
+		return nil
+	}
+	block, err := buildPictureBlock(coverPath, data)
+	if err != nil {
+		GoLog("[CueSplit] Skipping cover %s: %v\n", coverPath, err)
+		return nil
+	}
+	return []flac.MetaDataBlock{block}
+}
+
+// SplitCueFLAC splits the FLAC image referenced by cuePath into one FLAC per
+// track in outputDir, tagged from the sheet.
+func SplitCueFLAC(cuePath, audioDir, outputDir string, options CueSplitOptions) (*CueSplitResult, error) {
+	granularity := strings.ToLower(strings.TrimSpace(options.Granularity))
+	switch granularity {
+	case "":
+		granularity = cueSplitGranularitySample
+	case cueSplitGranularitySample, cueSplitGranularityFrame:
+	default:
+		return nil, fmt.Errorf("unknown split granularity: %s", options.Granularity)
+	}
+
+	sheet, err := ParseCueFileWithEncoding(cuePath, options.Encoding)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cue file: %w", err)
+	}
+	info, err := BuildCueSplitInfoWithGapMode(cuePath, sheet, audioDir, options.GapMode)
+	if err != nil {
+		return nil, err
+	}
+	tracks := info.Tracks
+	if info.HiddenTrack != nil {
+		tracks = append([]CueSplitTrack{*info.HiddenTrack}, tracks...)
+	}
+	for _, track := range tracks {
+		if len(track.Segments) > 1 {
+			return nil, fmt.Errorf("track %d spans %d files; split with gap mode %q instead", track.Number, len(track.Segments), CueGapAppend)
+		}
+		if strings.ToLower(filepath.Ext(track.AudioPath)) != ".flac" {
+			return nil, fmt.Errorf("cue image is not FLAC: %s", track.AudioPath)
+		}
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output folder: %w", err)
+	}
+
+	images := make(map[string]*flacImage)
+	defer func() {
+		for _, img := range images {
+			img.close()
+		}
+	}()
+	openImage := func(path string) (*flacImage, error) {
+		if img, ok := images[path]; ok {
+			return img, nil
+		}
+		img, err := openFLACImage(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read FLAC image: %w", err)
+		}
+		images[path] = img
+		return img, nil
+	}
+	first, err := openImage(info.AudioPath)
+	if err != nil {
+		return nil, err
+	}
+	pictures := cueSplitPictures(first, cuePath)
+
+	result := &CueSplitResult{
+		AudioPath:   info.AudioPath,
+		OutputDir:   outputDir,
+		Granularity: granularity,
+		GapMode:     info.GapMode,
+	}
+	for _, track := range tracks {
+		img, err := openImage(track.AudioPath)
+		if err != nil {
+			return result, err
+		}
+		rate := float64(img.info.sampleRate)
+		toSample := func(sec float64) int64 {
+			if sec < 0 {
+				return img.samples
+			}
+			sample := min(int64(math.Round(sec*rate)), img.samples)
+			if granularity == cueSplitGranularityFrame {
+				sample = img.nearestFrameStart(sample)
+			}
+			return sample
+		}
+
+		start, end := toSample(track.StartSec), toSample(track.EndSec)
+		if start >= end {
+			return result, fmt.Errorf("track %d has no audio (samples %d-%d)", track.Number, start, end)
+		}
+		path := filepath.Join(outputDir, cueSplitFileName(track))
+		meta := cueSplitTrackMetadata(info, sheet, track)
+		if err := img.writeSplitTrack(path, start, end, meta, pictures); err != nil {
+			return result, fmt.Errorf("failed to write track %d: %w", track.Number, err)
+		}
+		result.Tracks = append(result.Tracks, CueSplitOutput{
+			Number:      track.Number,
+			Title:       track.Title,
+			Path:        path,
+			StartSample: start,
+			EndSample:   end,
+			Duration:    float64(end-start) / rate,
+		})
+	}
+	syncDir(outputDir)
+	GoLog("[CueSplit] Split %s into %d tracks (%s granularity, %s gaps)\n", filepath.Base(info.AudioPath), len(result.Tracks), granularity, info.GapMode)
+	return result, nil
+}
+
+func SplitCueFLACJSON(cuePath, audioDir, outputDir, optionsJSON string) (string, error) {
+	var options CueSplitOptions
+	if strings.TrimSpace(optionsJSON) != "" {
+		if err := json.Unmarshal([]byte(optionsJSON), &options); err != nil {
+			return "", fmt.Errorf("invalid split options: %w", err)
+		}
+	}
+	result, err := SplitCueFLAC(cuePath, audioDir, outputDir, options)
+	if err != nil {
+		return "", err
+	}
+	return marshalJSONString(result)
+}
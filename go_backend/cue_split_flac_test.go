@@ -0,0 +1,219 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	flac "github.com/go-flac/go-flac/v2"
+)
+
+// writeCueSplitFixture writes a ten-frame stereo FLAC image, a cover and a
+// four-track sheet whose boundaries fall mid-frame (1 CUE frame = 588
+// samples at 44.1 kHz).
+func writeCueSplitFixture(t *testing.T, dir string) (string, [][]int64) {
+	t.Helper()
+	const blockSize = 1152
+	left := flacTestSignal(blockSize*10, 16, 0)
+	right := flacTestSignal(blockSize*10, 16, 0.7)
+	lpc := flacTestSubframe{kind: "lpc", coefs: []int64{1900, -905}, precision: 13, shift: 10}
+	frames := make([]flacTestFrame, 10)
+	for i := range frames {
+		frames[i] = flacTestFrame{channelMode: 10, subframes: []flacTestSubframe{lpc, {kind: "fixed", order: 2}}}
+	}
+	data := encodeTestFLAC(t, 16, blockSize, [][]int64{left, right}, frames)
+	if err := os.WriteFile(filepath.Join(dir, "image.flac"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cover.png"), []byte{0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a, 1, 2}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cue := `PERFORMER "Artist"
+TITLE "Album"
+REM DATE 1999
+FILE "image.flac" WAVE
+  TRACK 01 AUDIO
+    TITLE "One"
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    TITLE "Two"
+    ISRC TEST00000002
+    INDEX 01 00:00:05
+  TRACK 03 AUDIO
+    TITLE "Three"
+    INDEX 01 00:00:12
+  TRACK 04 AUDIO
+    TITLE "Four"
+    PERFORMER "Guest"
+    INDEX 01 00:00:13
+`
+	cuePath := filepath.Join(dir, "image.cue")
+	if err := os.WriteFile(cuePath, []byte(cue), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return cuePath, [][]int64{left, right}
+}
+
+func readCueSplitTrack(t *testing.T, path string) [][]int64 {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyDownloadedAudioIntegrity(path); err != nil {
+		t.Fatalf("integrity of %s: %v", filepath.Base(path), err)
+	}
+	return decodeAllFLAC(t, data)
+}
+
+func TestSplitCueFLACSampleAccurate(t *testing.T) {
+	dir := t.TempDir()
+	cuePath, source := writeCueSplitFixture(t, dir)
+	outDir := filepath.Join(dir, "split")
+
+	result, err := SplitCueFLAC(cuePath, "", outDir, CueSplitOptions{})
+	if err != nil {
+		t.Fatalf("SplitCueFLAC: %v", err)
+	}
+	wantBounds := [][2]int64{{0, 2940}, {2940, 7056}, {7056, 7644}, {7644, 11520}}
+	if len(result.Tracks) != len(wantBounds) {
+		t.Fatalf("tracks = %+v", result.Tracks)
+	}
+	for i, track := range result.Tracks {
+		if track.StartSample != wantBounds[i][0] || track.EndSample != wantBounds[i][1] {
+			t.Fatalf("track %d bounds = %d-%d, want %v", track.Number, track.StartSample, track.EndSample, wantBounds[i])
+		}
+		want := [][]int64{source[0][track.StartSample:track.EndSample], source[1][track.StartSample:track.EndSample]}
+		assertFLACSamples(t, readCueSplitTrack(t, track.Path), want)
+	}
+
+	meta, err := ReadMetadata(result.Tracks[3].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Title != "Four" || meta.Artist != "Guest" || meta.AlbumArtist != "Artist" || meta.Album != "Album" ||
+		meta.TrackNumber != 4 || meta.TotalTracks != 4 || meta.Date != "1999" {
+		t.Fatalf("track 4 tags = %+v", meta)
+	}
+	if meta, _ := ReadMetadata(result.Tracks[1].Path); meta == nil || meta.ISRC != "TEST00000002" {
+		t.Fatalf("track 2 tags = %+v", meta)
+	}
+	if filepath.Base(result.Tracks[0].Path) != "01 - One.flac" {
+		t.Fatalf("track 1 path = %s", result.Tracks[0].Path)
+	}
+
+	parsed, err := parseFlacFile(result.Tracks[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer parsed.Close()
+	pictures := 0
+	for _, meta := range parsed.Meta {
+		if meta.Type == flac.Picture {
+			pictures++
+		}
+	}
+	if pictures != 1 {
+		t.Fatalf("track 1 has %d pictures, want the folder cover", pictures)
+	}
+}
+
+func TestSplitCueFLACFrameGranularity(t *testing.T) {
+	dir := t.TempDir()
+	cuePath, source := writeCueSplitFixture(t, dir)
+
+	jsonText, err := SplitCueFLACJSON(cuePath, "", filepath.Join(dir, "split"), `{"granularity":"frame"}`)
+	if err != nil {
+		t.Fatalf("SplitCueFLACJSON: %v", err)
+	}
+	var result CueSplitResult
+	if err := json.Unmarshal([]byte(jsonText), &result); err != nil {
+		t.Fatal(err)
+	}
+	// Each boundary moves to the nearest 1152-sample frame start.
+	wantBounds := [][2]int64{{0, 3456}, {3456, 6912}, {6912, 8064}, {8064, 11520}}
+	if result.Granularity != "frame" || len(result.Tracks) != len(wantBounds) {
+		t.Fatalf("result = %+v", result)
+	}
+	for i, track := range result.Tracks {
+		if track.StartSample != wantBounds[i][0] || track.EndSample != wantBounds[i][1] {
+			t.Fatalf("track %d bounds = %d-%d, want %v", track.Number, track.StartSample, track.EndSample, wantBounds[i])
+		}
+		want := [][]int64{source[0][track.StartSample:track.EndSample], source[1][track.StartSample:track.EndSample]}
+		assertFLACSamples(t, readCueSplitTrack(t, track.Path), want)
+	}
+
+	if _, err := SplitCueFLACJSON(cuePath, "", filepath.Join(dir, "split"), `{"granularity":"byte"}`); err == nil {
+		t.Fatal("unknown granularity accepted")
+	}
+}
+
+func TestFLACImageShortHeadIsMerged(t *testing.T) {
+	dir := t.TempDir()
+	_, source := writeCueSplitFixture(t, dir)
+	img, err := openFLACImage(filepath.Join(dir, "image.flac"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer img.close()
+
+	// Eight samples before a frame boundary: the head must not become an
+	// 8-sample block in the middle of the stream.
+	path := filepath.Join(dir, "short.flac")
+	if err := img.writeSplitTrack(path, 1144, 4000, Metadata{Title: "Short"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	assertFLACSamples(t, readCueSplitTrack(t, path), [][]int64{source[0][1144:4000], source[1][1144:4000]})
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	info, _, err := readFLACLayout(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.minBlockSize < flacMinBlockSize || info.totalSamples != 4000-1144 {
+		t.Fatalf("STREAMINFO = %+v", info)
+	}
+}
+
+func TestSplitCueFLACAppendGapsWritesHiddenTrack(t *testing.T) {
+	dir := t.TempDir()
+	cuePath, source := writeCueSplitFixture(t, dir)
+	cue := `FILE "image.flac" WAVE
+  TRACK 01 AUDIO
+    TITLE "One"
+    INDEX 00 00:00:00
+    INDEX 01 00:00:03
+  TRACK 02 AUDIO
+    TITLE "Two"
+    INDEX 00 00:00:10
+    INDEX 01 00:00:12
+`
+	if err := os.WriteFile(cuePath, []byte(cue), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := SplitCueFLAC(cuePath, "", filepath.Join(dir, "split"), CueSplitOptions{GapMode: CueGapAppend})
+	if err != nil {
+		t.Fatalf("SplitCueFLAC: %v", err)
+	}
+	// 1 CUE frame = 588 samples: HTOA 0-1764, track 1 keeps track 2's gap.
+	wantBounds := [][2]int64{{0, 1764}, {1764, 7056}, {7056, 11520}}
+	if result.GapMode != CueGapAppend || len(result.Tracks) != len(wantBounds) || result.Tracks[0].Number != 0 {
+		t.Fatalf("result = %+v", result)
+	}
+	for i, track := range result.Tracks {
+		if track.StartSample != wantBounds[i][0] || track.EndSample != wantBounds[i][1] {
+			t.Fatalf("track %d bounds = %d-%d, want %v", track.Number, track.StartSample, track.EndSample, wantBounds[i])
+		}
+		want := [][]int64{source[0][track.StartSample:track.EndSample], source[1][track.StartSample:track.EndSample]}
+		assertFLACSamples(t, readCueSplitTrack(t, track.Path), want)
+	}
+	if filepath.Base(result.Tracks[0].Path) != "00 - Hidden Track.flac" {
+		t.Fatalf("hidden track path = %s", result.Tracks[0].Path)
+	}
+}
@@ -0,0 +1,166 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const cueFramesPerSecond = 75
+
+// formatCueIndex renders seconds as an INDEX position (mm:ss:ff, 75 frames
+// per second). Minutes are not wrapped into hours; CUE has no hour field.
+func formatCueIndex(seconds float64) string {
+	if seconds < 0 {
+		seconds = 0
+	}
+	frames := int64(math.Round(seconds * cueFramesPerSecond))
+	return fmt.Sprintf("%02d:%02d:%02d",
+		frames/(60*cueFramesPerSecond),
+		frames/cueFramesPerSecond%60,
+		frames%cueFramesPerSecond)
+}
+
+// quoteCue quotes a CUE string value. CUE has no escape syntax, so embedded
+// double quotes are downgraded to single quotes rather than ending the value.
+func quoteCue(s string) string {
+	s = strings.ReplaceAll(s, "\r", " ")
+	s = strings.ReplaceAll(s, "\n", " ")
+	return `"` + strings.ReplaceAll(strings.TrimSpace(s), `"`, `'`) + `"`
+}
+
+// FormatCueSheet writes sheet as CUE text that ParseCueFile reads back.
+func FormatCueSheet(sheet *CueSheet) string {
+	var b strings.Builder
+	if sheet.Genre != "" {
+		fmt.Fprintf(&b, "REM GENRE %s\n", quoteCue(sheet.Genre))
+	}
+	if sheet.Date != "" {
+		fmt.Fprintf(&b, "REM DATE %s\n", strings.TrimSpace(sheet.Date))
+	}
+	if sheet.Comment != "" {
+		fmt.Fprintf(&b, "REM COMMENT %s\n", quoteCue(sheet.Comment))
+	}
+	if sheet.Composer != "" {
+		fmt.Fprintf(&b, "REM COMPOSER %s\n", quoteCue(sheet.Composer))
+	}
+	if sheet.DiscNumber > 0 {
+		fmt.Fprintf(&b, "REM DISCNUMBER %d\n", sheet.DiscNumber)
+	}
+	if sheet.TotalDiscs > 0 {
+		fmt.Fprintf(&b, "REM TOTALDISCS %d\n", sheet.TotalDiscs)
+	}
+	if sheet.ReplayGainAlbumGain != "" {
+		fmt.Fprintf(&b, "REM REPLAYGAIN_ALBUM_GAIN %s\n", strings.TrimSpace(sheet.ReplayGainAlbumGain))
+	}
+	if sheet.ReplayGainAlbumPeak != "" {
+		fmt.Fprintf(&b, "REM REPLAYGAIN_ALBUM_PEAK %s\n", strings.TrimSpace(sheet.ReplayGainAlbumPeak))
+	}
+	if sheet.Catalog != "" {
+		fmt.Fprintf(&b, "CATALOG %s\n", strings.TrimSpace(sheet.Catalog))
+	}
+	if sheet.Performer != "" {
+		fmt.Fprintf(&b, "PERFORMER %s\n", quoteCue(sheet.Performer))
+	}
+	if sheet.Title != "" {
+		fmt.Fprintf(&b, "TITLE %s\n", quoteCue(sheet.Title))
+	}
+
+	files := cueSheetFiles(sheet)
+	currentFile := -1
+	switchFile := func(name string) {
+		index := 0
+		for i, file := range files {
+			if file.Name == name {
+				index = i
+				break
+			}
+		}
+		// FILE entries with no index of their own still have to be listed.
+		for currentFile < index {
+			currentFile++
+			fileType := strings.ToUpper(strings.TrimSpace(files[currentFile].Type))
+			if fileType == "" {
+				fileType = "WAVE"
+			}
+			fmt.Fprintf(&b, "FILE %s %s\n", quoteCue(files[currentFile].Name), fileType)
+		}
+	}
+
+	for i, track := range sheet.Tracks {
+		number := track.Number
+		if number <= 0 {
+			number = i + 1
+		}
+		gapInEarlierFile := track.PreGapFile != "" && track.PreGapFile != track.FileName
+		hasGap := track.PreGap >= 0 && (gapInEarlierFile || track.PreGap < track.StartTime)
+		gapFile := track.FileName
+		if hasGap && track.PreGapFile != "" {
+			gapFile = track.PreGapFile
+		}
+		switchFile(gapFile)
+		fmt.Fprintf(&b, "  TRACK %02d AUDIO\n", number)
+		if len(track.Flags) > 0 {
+			fmt.Fprintf(&b, "    FLAGS %s\n", strings.Join(track.Flags, " "))
+		}
+		if track.Title != "" {
+			fmt.Fprintf(&b, "    TITLE %s\n", quoteCue(track.Title))
+		}
+		if track.Performer != "" {
+			fmt.Fprintf(&b, "    PERFORMER %s\n", quoteCue(track.Performer))
+		}
+		if track.Composer != "" {
+			fmt.Fprintf(&b, "    SONGWRITER %s\n", quoteCue(track.Composer))
+		}
+		if track.ISRC != "" {
+			fmt.Fprintf(&b, "    ISRC %s\n", strings.TrimSpace(track.ISRC))
+		}
+		if track.ReplayGainTrackGain != "" {
+			fmt.Fprintf(&b, "    REM REPLAYGAIN_TRACK_GAIN %s\n", strings.TrimSpace(track.ReplayGainTrackGain))
+		}
+		if track.ReplayGainTrackPeak != "" {
+			fmt.Fprintf(&b, "    REM REPLAYGAIN_TRACK_PEAK %s\n", strings.TrimSpace(track.ReplayGainTrackPeak))
+		}
+		if track.PregapLength > 0 {
+			fmt.Fprintf(&b, "    PREGAP %s\n", formatCueIndex(track.PregapLength))
+		}
+		if hasGap {
+			fmt.Fprintf(&b, "    INDEX 00 %s\n", formatCueIndex(track.PreGap))
+		}
+		switchFile(track.FileName)
+		fmt.Fprintf(&b, "    INDEX 01 %s\n", formatCueIndex(track.StartTime))
+		if track.PostgapLength > 0 {
+			fmt.Fprintf(&b, "    POSTGAP %s\n", formatCueIndex(track.PostgapLength))
+		}
+	}
+	switchFile(files[len(files)-1].Name)
+	return b.String()
+}
+
+// FormatCueSheetJSON builds CUE text from a JSON-encoded CueSheet. Tracks
+// that omit "pre_gap" get no INDEX 00 rather than one at 00:00:00.
+func FormatCueSheetJSON(sheetJSON string) (string, error) {
+	var sheet CueSheet
+	if err := json.Unmarshal([]byte(sheetJSON), &sheet); err != nil {
+		return "", fmt.Errorf("invalid cue sheet JSON: %w", err)
+	}
+	var raw struct {
+		Tracks []map[string]json.RawMessage `json:"tracks"`
+	}
+	_ = json.Unmarshal([]byte(sheetJSON), &raw)
+	for i := range sheet.Tracks {
+		if i < len(raw.Tracks) {
+			if _, ok := raw.Tracks[i]["pre_gap"]; !ok {
+				sheet.Tracks[i].PreGap = -1
+			}
+		}
+	}
+	if len(sheet.Tracks) == 0 {
+		return "", fmt.Errorf("cue sheet has no tracks")
+	}
+	if sheet.FileName == "" {
+		return "", fmt.Errorf("cue sheet has no file name")
+	}
+	return FormatCueSheet(&sheet), nil
+}
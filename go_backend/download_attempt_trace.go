@@ -0,0 +1,139 @@
+package gobackend
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// DownloadAttempt is one provider's entry in DownloadResponse.Attempts: what
+// DownloadWithExtensionFallback asked it, what it answered and why the
+// fallback moved on (or stopped).
+type DownloadAttempt struct {
+	ProviderID string `json:"provider_id"`
+	// Phase is where in the fallback walk the provider was tried:
+	// "source_preflight", "verified_resume", "source" or "fallback".
+	Phase              string                `json:"phase"`
+	Available          *bool                 `json:"available,omitempty"`
+	AvailabilityReason string                `json:"availability_reason,omitempty"`
+	SkipFallback       bool                  `json:"skip_fallback,omitempty"`
+	TrackID            string                `json:"track_id,omitempty"`
+	Quality            string                `json:"quality,omitempty"`
+	MatchVerdict       string                `json:"match_verdict,omitempty"`
+	Outcome            string                `json:"outcome"`
+	Error              string                `json:"error,omitempty"`
+	ErrorType          string                `json:"error_type,omitempty"`
+	DurationMs         float64               `json:"duration_ms"`
+	Calls              []ExtensionCallTiming `json:"calls,omitempty"`
+
+	startedAt time.Time
+}
+
+// Attempt outcomes.
+const (
+	attemptOutcomeSuccess       = "success"
+	attemptOutcomeAlreadyExists = "already_exists"
+	attemptOutcomeAvailable     = "available"
+	attemptOutcomeNotAvailable  = "not_available"
+	attemptOutcomeTrackMismatch = "track_mismatch"
+	attemptOutcomeCorrupt       = "corrupt"
+	attemptOutcomeFailed        = "failed"
+	attemptOutcomeCancelled     = "cancelled"
+	attemptOutcomeSkipped       = "skipped"
+)
+
+// downloadAttemptTrace collects attempts for one DownloadWithExtensionFallback
+// call. A nil trace (and the nil attempts it hands out) records nothing, so
+// helpers shared with other callers can take it unconditionally.
+type downloadAttemptTrace struct {
+	attempts []*DownloadAttempt
+}
+
+func (t *downloadAttemptTrace) begin(providerID, phase string) *DownloadAttempt {
+	if t == nil {
+		return nil
+	}
+	attempt := &DownloadAttempt{
+		ProviderID: strings.TrimSpace(providerID),
+		Phase:      phase,
+		startedAt:  time.Now(),
+	}
+	t.attempts = append(t.attempts, attempt)
+	return attempt
+}
+
+func (t *downloadAttemptTrace) skip(providerID, phase, reason string) {
+	attempt := t.begin(providerID, phase)
+	if attempt == nil {
+		return
+	}
+	attempt.Outcome = attemptOutcomeSkipped
+	attempt.Error = reason
+}
+
+func (t *downloadAttemptTrace) list() []DownloadAttempt {
+	if t == nil || len(t.attempts) == 0 {
+		return nil
+	}
+	result := make([]DownloadAttempt, 0, len(t.attempts))
+	for _, attempt := range t.attempts {
+		if attempt.Outcome == "" {
+			// Left open by an early return (e.g. verification pause).
+			attempt.finish(attemptOutcomeFailed, nil, "")
+		}
+		result = append(result, *attempt)
+	}
+	return result
+}
+
+// bind routes the provider's call timings into this attempt.
+func (a *DownloadAttempt) bind(provider *extensionProviderWrapper) {
+	if a == nil || provider == nil {
+		return
+	}
+	provider.perfSink = func(timing ExtensionCallTiming) {
+		a.Calls = append(a.Calls, timing)
+	}
+}
+
+func (a *DownloadAttempt) recordAvailability(availability *ExtAvailabilityResult, err error) {
+	if a == nil {
+		return
+	}
+	available := err == nil && availability != nil && availability.Available
+	a.Available = &available
+	if availability != nil {
+		a.AvailabilityReason = strings.TrimSpace(availability.Reason)
+		a.SkipFallback = availability.SkipFallback
+		if trackID := strings.TrimSpace(availability.TrackID); trackID != "" {
+			a.TrackID = trackID
+		}
+	}
+	if err != nil {
+		a.Error = err.Error()
+		a.ErrorType = classifyDownloadErrorType(err.Error())
+	}
+}
+
+// finish closes the attempt. errorType falls back to the message's
+// classification when the provider did not report one.
+func (a *DownloadAttempt) finish(outcome string, err error, errorType string) {
+	if a == nil {
+		return
+	}
+	a.Outcome = outcome
+	if err != nil {
+		a.Error = err.Error()
+		if errors.Is(err, ErrDownloadCancelled) {
+			a.Outcome = attemptOutcomeCancelled
+		}
+	}
+	errorType = strings.TrimSpace(errorType)
+	if errorType == "" && a.Error != "" && outcome != attemptOutcomeSuccess {
+		errorType = classifyDownloadErrorType(a.Error)
+	}
+	if errorType != "" {
+		a.ErrorType = errorType
+	}
+	a.DurationMs = extensionDurationMs(time.Since(a.startedAt))
+}
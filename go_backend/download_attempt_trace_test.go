@@ -0,0 +1,196 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownloadAttemptTraceRecordsOutcomesInOrder(t *testing.T) {
+	trace := &downloadAttemptTrace{}
+
+	trace.skip("offline-ext", "fallback", "service health offline")
+
+	missing := trace.begin("missing-ext", "fallback")
+	missing.recordAvailability(&ExtAvailabilityResult{Available: false, Reason: "region_locked"}, nil)
+	missing.finish(attemptOutcomeNotAvailable, nil, "")
+
+	wrong := trace.begin("wrong-ext", "fallback")
+	wrong.recordAvailability(&ExtAvailabilityResult{Available: true, TrackID: "t-1"}, nil)
+	wrong.MatchVerdict = trackMatchTitleMismatch
+	wrong.finish(attemptOutcomeTrackMismatch, errors.New("provider wrong-ext returned a different track"), "not_found")
+
+	rateLimited := trace.begin("busy-ext", "fallback")
+	rateLimited.finish(attemptOutcomeFailed, errors.New("HTTP 429 too many requests"), "")
+
+	open := trace.begin("paused-ext", "fallback")
+	open.Calls = append(open.Calls, ExtensionCallTiming{Operation: "download", TotalMs: 1})
+
+	attempts := trace.list()
+	if len(attempts) != 5 {
+		t.Fatalf("attempts = %d, want 5", len(attempts))
+	}
+	wantOutcomes := []string{
+		attemptOutcomeSkipped,
+		attemptOutcomeNotAvailable,
+		attemptOutcomeTrackMismatch,
+		attemptOutcomeFailed,
+		attemptOutcomeFailed,
+	}
+	for i, want := range wantOutcomes {
+		if attempts[i].Outcome != want {
+			t.Fatalf("attempt %d (%s) outcome = %q, want %q", i, attempts[i].ProviderID, attempts[i].Outcome, want)
+		}
+	}
+	if attempts[1].Available == nil || *attempts[1].Available || attempts[1].AvailabilityReason != "region_locked" {
+		t.Fatalf("availability not recorded: %+v", attempts[1])
+	}
+	if attempts[2].TrackID != "t-1" || attempts[2].ErrorType != "not_found" {
+		t.Fatalf("mismatch attempt = %+v", attempts[2])
+	}
+	if attempts[3].ErrorType != "rate_limit" {
+		t.Fatalf("error type = %q, want classified rate_limit", attempts[3].ErrorType)
+	}
+	if len(attempts[4].Calls) != 1 {
+		t.Fatalf("calls = %+v", attempts[4].Calls)
+	}
+
+	raw, err := json.Marshal(DownloadResponse{Attempts: attempts})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var decoded struct {
+		Attempts []map[string]any `json:"attempts"`
+	}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if decoded.Attempts[0]["provider_id"] != "offline-ext" || decoded.Attempts[0]["phase"] != "fallback" {
+		t.Fatalf("json attempt = %v", decoded.Attempts[0])
+	}
+}
+
+func TestNilDownloadAttemptTraceIsNoop(t *testing.T) {
+	var trace *downloadAttemptTrace
+	attempt := trace.begin("ext", "source")
+	attempt.bind(&extensionProviderWrapper{})
+	attempt.recordAvailability(nil, errors.New("boom"))
+	attempt.finish(attemptOutcomeFailed, nil, "")
+	trace.skip("ext", "fallback", "reason")
+	if got := trace.list(); got != nil {
+		t.Fatalf("list = %v, want nil", got)
+	}
+}
+
+func TestEvaluateTrackMatchVerdicts(t *testing.T) {
+	req := DownloadRequest{
+		TrackName:  "Song",
+		ArtistName: "Artist",
+		ISRC:       "USABC1234567",
+		DurationMS: 200000,
+	}
+	cases := []struct {
+		name     string
+		resolved resolvedTrackInfo
+		want     string
+	}{
+		{"isrc", resolvedTrackInfo{Title: "Other", ArtistName: "Someone", ISRC: "usabc1234567", Duration: 200}, trackMatchISRC},
+		{"names", resolvedTrackInfo{Title: "Song", ArtistName: "Artist", Duration: 201}, trackMatchNames},
+		{"skipped", resolvedTrackInfo{Title: "Other", SkipNameVerification: true}, trackMatchUnverified},
+		{"artist", resolvedTrackInfo{Title: "Song", ArtistName: "Someone Else"}, trackMatchArtistMismatch},
+		{"duration", resolvedTrackInfo{Title: "Song", ArtistName: "Artist", Duration: 260}, trackMatchDurationMismatch},
+	}
+	for _, tc := range cases {
+		got := evaluateTrackMatch(req, tc.resolved, "test")
+		if got != tc.want {
+			t.Fatalf("%s: verdict = %q, want %q", tc.name, got, tc.want)
+		}
+		if trackMatchVerdictAccepted(got) != trackMatchesRequest(req, tc.resolved, "test") {
+			t.Fatalf("%s: accepted verdict disagrees with trackMatchesRequest", tc.name)
+		}
+	}
+}
+
+const failingProviderExtensionJS = `
+registerExtension({
+  initialize: function() { return true; },
+  checkAvailability: function(isrc, name, artist, ids) {
+    return { available: true, trackId: "failing-track" };
+  },
+  download: function(id, quality, outputPath, onProgress) {
+    return { success: false, error: "upstream returned HTTP 502" };
+  }
+});
+`
+
+func TestDownloadWithExtensionFallbackKeepsAttemptsWhenAllProvidersFail(t *testing.T) {
+	manager := getExtensionManager()
+	extensions := make(map[string]*loadedExtension)
+	for _, id := range []string{"failing-a", "failing-b"} {
+		ext := newTestLoadedExtension(t, ExtensionTypeDownloadProvider)
+		ext.ID = id
+		ext.Manifest.Name = id
+		ext.Manifest.TrackMatching = nil
+		if err := os.WriteFile(filepath.Join(ext.SourceDir, "index.js"), []byte(failingProviderExtensionJS), 0600); err != nil {
+			t.Fatal(err)
+		}
+		extensions[id] = ext
+	}
+	manager.mu.Lock()
+	previousExtensions := manager.extensions
+	manager.extensions = extensions
+	manager.mu.Unlock()
+	previousPriority := GetProviderPriority()
+	SetProviderPriority([]string{"failing-a", "failing-b"})
+	t.Cleanup(func() {
+		SetProviderPriority(previousPriority)
+		for _, ext := range extensions {
+			teardownExtension(ext)
+		}
+		manager.mu.Lock()
+		manager.extensions = previousExtensions
+		manager.mu.Unlock()
+	})
+
+	resp, err := DownloadWithExtensionFallback(DownloadRequest{
+		ISRC:           "USRC17607839",
+		TrackName:      "Track",
+		ArtistName:     "Artist",
+		OutputDir:      t.TempDir(),
+		OutputExt:      ".flac",
+		FilenameFormat: "{title}",
+		UseFallback:    true,
+	})
+	if err != nil {
+		t.Fatalf("DownloadWithExtensionFallback: %v", err)
+	}
+	if resp.Success || !strings.HasPrefix(resp.Error, "All providers failed") {
+		t.Fatalf("response = success %v error %q", resp.Success, resp.Error)
+	}
+	var failed []string
+	for _, attempt := range resp.Attempts {
+		if attempt.Outcome == attemptOutcomeFailed {
+			failed = append(failed, attempt.ProviderID)
+		}
+	}
+	if len(failed) != 2 || failed[0] != "failing-a" || failed[1] != "failing-b" {
+		t.Fatalf("attempts = %+v", resp.Attempts)
+	}
+}
+
+func TestDownloadWithExtensionFallbackKeepsAttemptsWhenCancelled(t *testing.T) {
+	initDownloadCancel("cancelled-before-start")
+	defer clearDownloadCancel("cancelled-before-start")
+	cancelDownload("cancelled-before-start")
+
+	resp, err := DownloadWithExtensionFallback(DownloadRequest{ItemID: "cancelled-before-start"})
+	if !errors.Is(err, ErrDownloadCancelled) {
+		t.Fatalf("err = %v", err)
+	}
+	if resp == nil || resp.Success || resp.ErrorType != "cancelled" {
+		t.Fatalf("response = %+v", resp)
+	}
+}
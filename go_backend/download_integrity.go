@@ -0,0 +1,345 @@
+package gobackend
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// downloadIntegrityErrorType is reported when a finished download fails the
+// container check. Provider fallback treats it like any other provider
+// failure, so a truncated file from one source moves on to the next.
+const downloadIntegrityErrorType = "integrity_failed"
+
+// maxMP4SampleTableSize bounds how much of a single stco/co64/stsc/stsz box is
+// read into memory. Real tables for a track are a few hundred KiB at most.
+const maxMP4SampleTableSize = 64 * 1024 * 1024
+
+// flacDecodedAudioMD5 returns the MD5 of a FLAC file's decoded samples in the
+// STREAMINFO layout. When nil, only frame CRCs are checked.
+var flacDecodedAudioMD5 = flacAudioMD5
+
+type downloadIntegrityError struct {
+	path   string
+	reason string
+}
+
+func (e *downloadIntegrityError) Error() string {
+	return fmt.Sprintf("integrity check failed for %s: %s", e.path, e.reason)
+}
+
+func integrityErrorf(path, format string, args ...any) error {
+	return &downloadIntegrityError{path: path, reason: fmt.Sprintf(format, args...)}
+}
+
+// verifyDownloadedAudioIntegrity checks that a finished FLAC or MP4 file is
+// complete. Other containers, and paths that cannot be reopened (SAF FDs,
+// content URIs), are accepted unchecked.
+func verifyDownloadedAudioIntegrity(path string) error {
+	path = strings.TrimSpace(path)
+	if shouldSkipQualityProbe(path) {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return integrityErrorf(path, "open: %v", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return integrityErrorf(path, "stat: %v", err)
+	}
+	size := info.Size()
+
+	head := make([]byte, 12)
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+	switch {
+	case len(head) >= 4 && string(head[:4]) == "fLaC":
+		return verifyFLACIntegrity(f, path, size)
+	case len(head) >= 3 && string(head[:3]) == "ID3":
+		// MP3, or FLAC behind a leading ID3v2 tag.
+		if _, _, err := readFLACLayout(f); !errors.Is(err, errMissingFLACMarker) {
+			return verifyFLACIntegrity(f, path, size)
+		}
+	case len(head) >= 8 && string(head[4:8]) == "ftyp":
+		return verifyMP4Integrity(f, path, size)
+	}
+	LogDebug("Download", "Integrity check not available for %s", path)
+	return nil
+}
+
+func verifyFLACIntegrity(f *os.File, path string, size int64) error {
+	info, audioStart, err := readFLACLayout(f)
+	if err != nil {
+		return integrityErrorf(path, "%v", err)
+	}
+	audioEnd := flacAudioEnd(f, audioStart, size)
+	if audioStart >= audioEnd {
+		return integrityErrorf(path, "no audio frames after metadata")
+	}
+
+	reader := bufio.NewReaderSize(io.NewSectionReader(f, audioStart, audioEnd-audioStart), 256*1024)
+	frames, samples, err := scanFLACFrames(reader)
+	if err != nil {
+		return integrityErrorf(path, "%v (after %d frames, %d samples)", err, frames, samples)
+	}
+	if info.totalSamples > 0 && samples != info.totalSamples {
+		return integrityErrorf(path, "frames hold %d samples, STREAMINFO declares %d", samples, info.totalSamples)
+	}
+
+	if flacDecodedAudioMD5 != nil && info.md5 != [16]byte{} {
+		sum, err := flacDecodedAudioMD5(path)
+		if err != nil {
+			return integrityErrorf(path, "decode: %v", err)
+		}
+		if sum != info.md5 {
+			return integrityErrorf(path, "decoded audio MD5 does not match STREAMINFO")
+		}
+	}
+	return nil
+}
+
+// flacAudioEnd returns where the FLAC frames end, before any trailing ID3v1
+// tag and APEv2 tag (in that order from the end of the file) some taggers
+// append after the last frame.
+func flacAudioEnd(f *os.File, audioStart, size int64) int64 {
+	audioEnd := size
+	if audioEnd-audioStart >= 128 {
+		tag := make([]byte, 3)
+		if _, err := f.ReadAt(tag, audioEnd-128); err == nil && string(tag) == "TAG" {
+			audioEnd -= 128
+		}
+	}
+	if audioEnd-audioStart < apeTagHeaderSize {
+		return audioEnd
+	}
+	footer := make([]byte, apeTagHeaderSize)
+	if _, err := f.ReadAt(footer, audioEnd-apeTagHeaderSize); err != nil || string(footer[:8]) != apeTagPreamble {
+		return audioEnd
+	}
+	flags := binary.LittleEndian.Uint32(footer[20:24])
+	tagSize := int64(binary.LittleEndian.Uint32(footer[12:16])) // items + footer
+	if flags&apeTagFlagHeader != 0 || tagSize < apeTagHeaderSize {
+		return audioEnd
+	}
+	if flags&(1<<31) != 0 { // bit 31 = tag contains header
+		tagSize += apeTagHeaderSize
+	}
+	if audioEnd-audioStart < tagSize {
+		return audioEnd
+	}
+	return audioEnd - tagSize
+}
+
+func verifyMP4Integrity(f *os.File, path string, size int64) error {
+	var mdats []atomHeader
+	var moov atomHeader
+	haveMoov := false
+	for pos := int64(0); pos < size; {
+		if size-pos < 8 {
+			return integrityErrorf(path, "%d trailing bytes after the last atom", size-pos)
+		}
+		header, err := readAtomHeaderAt(f, pos, size)
+		if err != nil {
+			return integrityErrorf(path, "atom header at %d: %v", pos, err)
+		}
+		if header.size == 0 {
+			header.size = size - pos
+		}
+		if header.size < header.headerSize {
+			return integrityErrorf(path, "invalid %s atom size %d at %d", header.typ, header.size, pos)
+		}
+		if pos+header.size > size {
+			return integrityErrorf(path, "%s atom at %d declares %d bytes, only %d present", header.typ, pos, header.size, size-pos)
+		}
+		switch header.typ {
+		case "moov":
+			moov, haveMoov = header, true
+		case "mdat":
+			mdats = append(mdats, header)
+		}
+		pos += header.size
+	}
+	if !haveMoov {
+		return integrityErrorf(path, "missing moov atom")
+	}
+	if len(mdats) == 0 {
+		return integrityErrorf(path, "missing mdat atom")
+	}
+
+	var tableErr error
+	walkErr := walkMP4AtomsInRange(f, moov.offset+moov.headerSize, moov.size-moov.headerSize, size, func(header atomHeader) bool {
+		if tableErr != nil {
+			return false
+		}
+		if header.typ == "stbl" {
+			tableErr = verifyMP4SampleTable(f, header, size, mdats)
+			return false
+		}
+		return header.typ == "trak" || header.typ == "mdia" || header.typ == "minf"
+	})
+	if walkErr != nil {
+		return integrityErrorf(path, "moov: %v", walkErr)
+	}
+	if tableErr != nil {
+		return integrityErrorf(path, "%v", tableErr)
+	}
+	return nil
+}
+
+// verifyMP4SampleTable checks that every chunk of one track starts, and with
+// stsc/stsz present also ends, inside an mdat atom.
+func verifyMP4SampleTable(f *os.File, stbl atomHeader, fileSize int64, mdats []atomHeader) error {
+	tables := map[string][]byte{}
+	err := walkMP4AtomsInRange(f, stbl.offset+stbl.headerSize, stbl.size-stbl.headerSize, fileSize, func(header atomHeader) bool {
+		switch header.typ {
+		case "stco", "co64", "stsc", "stsz":
+		default:
+			return false
+		}
+		payloadSize := header.size - header.headerSize
+		if payloadSize > maxMP4SampleTableSize {
+			return false
+		}
+		payload := make([]byte, payloadSize)
+		if _, err := f.ReadAt(payload, header.offset+header.headerSize); err == nil {
+			tables[header.typ] = payload
+		}
+		return false
+	})
+	if err != nil {
+		return fmt.Errorf("stbl: %w", err)
+	}
+
+	offsets, err := parseMP4ChunkOffsets(tables)
+	if err != nil {
+		return err
+	}
+	if len(offsets) == 0 {
+		// Fragmented files keep their samples in moof/mdat pairs.
+		return nil
+	}
+	chunkSizes, err := mp4ChunkSizes(tables, len(offsets))
+	if err != nil {
+		return err
+	}
+
+	for i, offset := range offsets {
+		var length int64
+		if chunkSizes != nil {
+			length = chunkSizes[i]
+		}
+		if offset >= fileSize {
+			return fmt.Errorf("chunk %d offset %d is past the end of the file (%d bytes)", i+1, offset, fileSize)
+		}
+		if !mp4RangeInMdat(mdats, offset, length) {
+			return fmt.Errorf("chunk %d (%d bytes at %d) lies outside mdat", i+1, length, offset)
+		}
+	}
+	return nil
+}
+
+func parseMP4ChunkOffsets(tables map[string][]byte) ([]int64, error) {
+	entrySize := 4
+	payload, ok := tables["stco"]
+	if !ok {
+		if payload, ok = tables["co64"]; !ok {
+			return nil, nil
+		}
+		entrySize = 8
+	}
+	if len(payload) < 8 {
+		return nil, errors.New("truncated chunk offset table")
+	}
+	count := int(binary.BigEndian.Uint32(payload[4:8]))
+	if count < 0 || len(payload)-8 < count*entrySize {
+		return nil, fmt.Errorf("chunk offset table declares %d entries in %d bytes", count, len(payload)-8)
+	}
+	offsets := make([]int64, count)
+	for i := range offsets {
+		entry := payload[8+i*entrySize:]
+		if entrySize == 8 {
+			offsets[i] = int64(binary.BigEndian.Uint64(entry))
+		} else {
+			offsets[i] = int64(binary.BigEndian.Uint32(entry))
+		}
+	}
+	return offsets, nil
+}
+
+// mp4ChunkSizes sums stsz sample sizes per chunk using the stsc runs. It
+// returns nil when either table is missing.
+func mp4ChunkSizes(tables map[string][]byte, chunkCount int) ([]int64, error) {
+	stsc, haveStsc := tables["stsc"]
+	stsz, haveStsz := tables["stsz"]
+	if !haveStsc || !haveStsz {
+		return nil, nil
+	}
+	if len(stsc) < 8 || len(stsz) < 12 {
+		return nil, errors.New("truncated sample table")
+	}
+	runCount := int(binary.BigEndian.Uint32(stsc[4:8]))
+	if runCount < 0 || len(stsc)-8 < runCount*12 {
+		return nil, fmt.Errorf("stsc declares %d entries in %d bytes", runCount, len(stsc)-8)
+	}
+	uniformSize := int64(binary.BigEndian.Uint32(stsz[4:8]))
+	sampleCount := int(binary.BigEndian.Uint32(stsz[8:12]))
+	if sampleCount < 0 || uniformSize == 0 && len(stsz)-12 < sampleCount*4 {
+		return nil, fmt.Errorf("stsz declares %d samples in %d bytes", sampleCount, len(stsz)-12)
+	}
+
+	sizes := make([]int64, chunkCount)
+	sample := 0
+	for run := 0; run < runCount; run++ {
+		entry := stsc[8+run*12:]
+		firstChunk := int(binary.BigEndian.Uint32(entry[0:4]))
+		perChunk := int(binary.BigEndian.Uint32(entry[4:8]))
+		lastChunk := chunkCount
+		if run+1 < runCount {
+			lastChunk = int(binary.BigEndian.Uint32(stsc[8+(run+1)*12:])) - 1
+		}
+		if firstChunk < 1 || lastChunk > chunkCount {
+			return nil, fmt.Errorf("stsc run %d covers chunks %d-%d of %d", run+1, firstChunk, lastChunk, chunkCount)
+		}
+		for chunk := firstChunk; chunk <= lastChunk; chunk++ {
+			for i := 0; i < perChunk; i++ {
+				if sample >= sampleCount {
+					return nil, fmt.Errorf("stsc references sample %d of %d", sample+1, sampleCount)
+				}
+				if uniformSize != 0 {
+					sizes[chunk-1] += uniformSize
+				} else {
+					sizes[chunk-1] += int64(binary.BigEndian.Uint32(stsz[12+sample*4:]))
+				}
+				sample++
+			}
+		}
+	}
+	return sizes, nil
+}
+
+func mp4RangeInMdat(mdats []atomHeader, offset, length int64) bool {
+	for _, mdat := range mdats {
+		start := mdat.offset + mdat.headerSize
+		if offset >= start && offset+length <= mdat.offset+mdat.size {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyExtensionDownloadIntegrity runs the integrity check on a provider's
+// fresh output. Encrypted payloads are skipped: their bytes only become a
+// valid container after decryption.
+func verifyExtensionDownloadIntegrity(result *ExtDownloadResult) error {
+	if result == nil || result.AlreadyExists ||
+		strings.TrimSpace(result.DecryptionKey) != "" || result.Decryption != nil {
+		return nil
+	}
+	return verifyDownloadedAudioIntegrity(result.FilePath)
+}
@@ -0,0 +1,236 @@
+package gobackend
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildTestFLAC returns a mono 16-bit 44.1 kHz FLAC made of fixed 4096-sample
+// frames with CONSTANT subframes. declaredFrames sets STREAMINFO's total.
+func buildTestFLAC(frames, declaredFrames int) []byte {
+	const blockSize = 4096
+	streamInfo := make([]byte, 34)
+	binary.BigEndian.PutUint16(streamInfo[0:], blockSize)
+	binary.BigEndian.PutUint16(streamInfo[2:], blockSize)
+	packed := uint64(44100)<<44 | uint64(0)<<41 | uint64(15)<<36 | uint64(declaredFrames*blockSize)
+	binary.BigEndian.PutUint64(streamInfo[10:], packed)
+
+	out := []byte("fLaC")
+	out = append(out, 0x80, 0, 0, 34)
+	out = append(out, streamInfo...)
+	for i := 0; i < frames; i++ {
+		frame := []byte{0xFF, 0xF8, 0xC9, 0x08, byte(i)}
+		frame = append(frame, flacCRC8(frame))
+		frame = append(frame, 0x00, byte(i), byte(i*3))
+		var crc uint16
+		for _, b := range frame {
+			crc = flacCRC16Update(crc, b)
+		}
+		out = binary.BigEndian.AppendUint16(append(out, frame...), crc)
+	}
+	return out
+}
+
+func buildTestMP4Atom(typ string, payload ...[]byte) []byte {
+	size := 8
+	for _, p := range payload {
+		size += len(p)
+	}
+	atom := binary.BigEndian.AppendUint32(nil, uint32(size))
+	atom = append(atom, typ...)
+	for _, p := range payload {
+		atom = append(atom, p...)
+	}
+	return atom
+}
+
+// buildTestMP4 lays out ftyp, moov and an mdat holding chunks of two
+// 100-byte samples each. chunkOffsetShift moves every stco entry.
+func buildTestMP4(chunks int, chunkOffsetShift uint32) []byte {
+	ftyp := buildTestMP4Atom("ftyp", []byte("M4A \x00\x00\x00\x00M4A isom"))
+	stsc := buildTestMP4Atom("stsc", []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 1})
+	stsz := binary.BigEndian.AppendUint32(make([]byte, 4), 100)
+	stsz = buildTestMP4Atom("stsz", binary.BigEndian.AppendUint32(stsz, uint32(chunks*2)))
+	stcoSize := 8 + 8 + 4*chunks
+	moovSize := 8 + 8 + 8 + 8 + 8 + len(stsc) + len(stsz) + stcoSize
+	mdatStart := uint32(len(ftyp) + moovSize + 8)
+	stcoPayload := binary.BigEndian.AppendUint32(make([]byte, 4), uint32(chunks))
+	for i := 0; i < chunks; i++ {
+		stcoPayload = binary.BigEndian.AppendUint32(stcoPayload, mdatStart+uint32(i*200)+chunkOffsetShift)
+	}
+	stbl := buildTestMP4Atom("stbl", stsc, stsz, buildTestMP4Atom("stco", stcoPayload))
+	moov := buildTestMP4Atom("moov", buildTestMP4Atom("trak", buildTestMP4Atom("mdia", buildTestMP4Atom("minf", stbl))))
+	mdat := buildTestMP4Atom("mdat", make([]byte, chunks*200))
+	return append(append(ftyp, moov...), mdat...)
+}
+
+func writeIntegrityTestFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVerifyDownloadedAudioIntegrityFLAC(t *testing.T) {
+	valid := buildTestFLAC(40, 40)
+	if err := verifyDownloadedAudioIntegrity(writeIntegrityTestFile(t, "ok.flac", valid)); err != nil {
+		t.Fatalf("valid FLAC rejected: %v", err)
+	}
+
+	withID3v1 := append(append([]byte{}, valid...), append([]byte("TAG"), make([]byte, 125)...)...)
+	if err := verifyDownloadedAudioIntegrity(writeIntegrityTestFile(t, "id3v1.flac", withID3v1)); err != nil {
+		t.Fatalf("FLAC with trailing ID3v1 rejected: %v", err)
+	}
+	apeTag, err := marshalAPETag(&APETag{Items: []APETagItem{{Key: "Title", Value: "Song"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withAPE := append(append([]byte{}, valid...), apeTag...)
+	if err := verifyDownloadedAudioIntegrity(writeIntegrityTestFile(t, "ape.flac", withAPE)); err != nil {
+		t.Fatalf("FLAC with trailing APEv2 rejected: %v", err)
+	}
+	withAPEAndID3v1 := append(append([]byte{}, withAPE...), withID3v1[len(valid):]...)
+	if err := verifyDownloadedAudioIntegrity(writeIntegrityTestFile(t, "ape-id3v1.flac", withAPEAndID3v1)); err != nil {
+		t.Fatalf("FLAC with trailing APEv2 and ID3v1 rejected: %v", err)
+	}
+
+	cases := map[string][]byte{
+		"cut mid-frame":       valid[:len(valid)-4],
+		"missing last frames": buildTestFLAC(30, 40),
+		"cut before APE tag":  append(append([]byte{}, valid[:len(valid)-4]...), apeTag...),
+		"corrupt byte": func() []byte {
+			data := append([]byte{}, valid...)
+			data[len(data)/2] ^= 0x40
+			return data
+		}(),
+	}
+	for name, data := range cases {
+		err := verifyDownloadedAudioIntegrity(writeIntegrityTestFile(t, "bad.flac", data))
+		if err == nil {
+			t.Fatalf("%s: truncated FLAC accepted", name)
+		}
+		if got := classifyDownloadErrorType(err.Error()); got != downloadIntegrityErrorType {
+			t.Fatalf("%s: error %q classified as %q", name, err, got)
+		}
+	}
+}
+
+func TestVerifyDownloadedAudioIntegrityFLACChecksDecodedMD5(t *testing.T) {
+	data := buildTestFLAC(4, 4)
+	copy(data[8+18:], []byte("0123456789abcdef"))
+	path := writeIntegrityTestFile(t, "md5.flac", data)
+
+	previous := flacDecodedAudioMD5
+	t.Cleanup(func() { flacDecodedAudioMD5 = previous })
+	flacDecodedAudioMD5 = func(string) ([16]byte, error) {
+		var sum [16]byte
+		copy(sum[:], "0123456789abcdef")
+		return sum, nil
+	}
+	if err := verifyDownloadedAudioIntegrity(path); err != nil {
+		t.Fatalf("matching MD5 rejected: %v", err)
+	}
+	flacDecodedAudioMD5 = func(string) ([16]byte, error) { return [16]byte{1}, nil }
+	if err := verifyDownloadedAudioIntegrity(path); err == nil || !strings.Contains(err.Error(), "MD5") {
+		t.Fatalf("MD5 mismatch error = %v", err)
+	}
+}
+
+func TestVerifyDownloadedAudioIntegrityMP4(t *testing.T) {
+	valid := buildTestMP4(5, 0)
+	if err := verifyDownloadedAudioIntegrity(writeIntegrityTestFile(t, "ok.m4a", valid)); err != nil {
+		t.Fatalf("valid MP4 rejected: %v", err)
+	}
+
+	cases := map[string][]byte{
+		"truncated mdat":        valid[:len(valid)-50],
+		"chunk past mdat":       buildTestMP4(5, 150),
+		"offset past file size": buildTestMP4(5, 10_000),
+	}
+	for name, data := range cases {
+		if err := verifyDownloadedAudioIntegrity(writeIntegrityTestFile(t, "bad.m4a", data)); err == nil {
+			t.Fatalf("%s: broken MP4 accepted", name)
+		}
+	}
+
+	if err := verifyDownloadedAudioIntegrity(writeIntegrityTestFile(t, "song.mp3", []byte("ID3\x03\x00\x00\x00\x00\x00\x00\xFF\xFB"))); err != nil {
+		t.Fatalf("unsupported container should be accepted unchecked: %v", err)
+	}
+}
+
+const integrityTestExtensionJS = `
+registerExtension({
+  initialize: function() { return true; },
+  checkAvailability: function(isrc, name, artist, ids) {
+    return { available: true, trackId: "truncated-track" };
+  },
+  download: function(id, quality, outputPath, onProgress) {
+    return { success: true, filePath: outputPath.replace(".flac", "-provider.flac"), title: "Track", artist: "Artist", isrc: "USRC17607839" };
+  }
+});
+`
+
+func TestDownloadWithExtensionFallbackRejectsTruncatedOutput(t *testing.T) {
+	ext := newTestLoadedExtension(t, ExtensionTypeDownloadProvider)
+	ext.ID = "truncating-ext"
+	ext.Manifest.Name = ext.ID
+	ext.Manifest.TrackMatching = nil
+	if err := os.WriteFile(filepath.Join(ext.SourceDir, "index.js"), []byte(integrityTestExtensionJS), 0600); err != nil {
+		t.Fatal(err)
+	}
+	manager := getExtensionManager()
+	manager.mu.Lock()
+	previousExtensions := manager.extensions
+	manager.extensions = map[string]*loadedExtension{ext.ID: ext}
+	manager.mu.Unlock()
+	t.Cleanup(func() {
+		teardownExtension(ext)
+		manager.mu.Lock()
+		manager.extensions = previousExtensions
+		manager.mu.Unlock()
+	})
+
+	req := DownloadRequest{
+		ISRC:            "USRC17607839",
+		Service:         ext.ID,
+		Source:          ext.ID,
+		TrackName:       "Track",
+		ArtistName:      "Artist",
+		OutputDir:       t.TempDir(),
+		OutputExt:       ".flac",
+		FilenameFormat:  "{title}",
+		VerifyIntegrity: true,
+	}
+	// The provider writes next to the requested path; an existing file at the
+	// requested path itself would be reused without calling download.
+	outputPath := strings.TrimSuffix(buildOutputPathForExtension(req, ext), ".flac") + "-provider.flac"
+	valid := buildTestFLAC(20, 20)
+	if err := os.WriteFile(outputPath, valid[:len(valid)-7], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := DownloadWithExtensionFallback(req)
+	if err != nil {
+		t.Fatalf("DownloadWithExtensionFallback: %v", err)
+	}
+	if resp.Success || resp.ErrorType != downloadIntegrityErrorType {
+		t.Fatalf("response = success %v type %q error %q", resp.Success, resp.ErrorType, resp.Error)
+	}
+	var sawCorrupt bool
+	for _, attempt := range resp.Attempts {
+		if attempt.ProviderID == ext.ID && attempt.Outcome == attemptOutcomeCorrupt {
+			sawCorrupt = true
+		}
+	}
+	if !sawCorrupt {
+		t.Fatalf("attempts = %+v", resp.Attempts)
+	}
+	if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+		t.Fatalf("truncated output kept: %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+package gobackend
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DownloadLimits caps how hard extension downloads hit providers and the
+// network. Zero values mean "unlimited".
+type DownloadLimits struct {
+	// MaxConcurrentPerProvider bounds in-flight downloads for every provider
+	// without an explicit entry in ProviderMaxConcurrent.
+	MaxConcurrentPerProvider int            `json:"max_concurrent_per_provider"`
+	ProviderMaxConcurrent    map[string]int `json:"provider_max_concurrent,omitempty"`
+	// MaxBytesPerSecond is a global cap shared by all extension downloads.
+	MaxBytesPerSecond int64 `json:"max_bytes_per_second"`
+}
+
+// minDownloadBytesPerSecond keeps a misconfigured cap from starving the stall
+// watchdog: at this rate a single 32 KiB read completes well within it.
+const minDownloadBytesPerSecond = 32 * 1024
+
+type providerDownloadScheduler struct {
+	mu     sync.Mutex
+	limits DownloadLimits
+	active map[string]int
+	// changed is closed and replaced whenever a slot frees up or the limits
+	// change, waking every waiter to re-check its provider.
+	changed chan struct{}
+}
+
+var downloadScheduler = &providerDownloadScheduler{
+	active:  make(map[string]int),
+	changed: make(chan struct{}),
+}
+
+var downloadBandwidth = &bandwidthLimiter{}
+
+func normalizeDownloadLimits(limits DownloadLimits) DownloadLimits {
+	if limits.MaxConcurrentPerProvider < 0 {
+		limits.MaxConcurrentPerProvider = 0
+	}
+	if limits.MaxBytesPerSecond < 0 {
+		limits.MaxBytesPerSecond = 0
+	} else if limits.MaxBytesPerSecond > 0 && limits.MaxBytesPerSecond < minDownloadBytesPerSecond {
+		limits.MaxBytesPerSecond = minDownloadBytesPerSecond
+	}
+	normalized := make(map[string]int, len(limits.ProviderMaxConcurrent))
+	for providerID, max := range limits.ProviderMaxConcurrent {
+		providerID = strings.ToLower(strings.TrimSpace(providerID))
+		if providerID == "" || max < 0 {
+			continue
+		}
+		normalized[providerID] = max
+	}
+	limits.ProviderMaxConcurrent = normalized
+	return limits
+}
+
+func setDownloadLimits(limits DownloadLimits) {
+	limits = normalizeDownloadLimits(limits)
+	downloadScheduler.mu.Lock()
+	downloadScheduler.limits = limits
+	downloadScheduler.notifyLocked()
+	downloadScheduler.mu.Unlock()
+	downloadBandwidth.setRate(limits.MaxBytesPerSecond)
+}
+
+func getDownloadLimits() DownloadLimits {
+	downloadScheduler.mu.Lock()
+	defer downloadScheduler.mu.Unlock()
+	limits := downloadScheduler.limits
+	providers := make(map[string]int, len(limits.ProviderMaxConcurrent))
+	for providerID, max := range limits.ProviderMaxConcurrent {
+		providers[providerID] = max
+	}
+	limits.ProviderMaxConcurrent = providers
+	return limits
+}
+
+func (s *providerDownloadScheduler) notifyLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *providerDownloadScheduler) maxForLocked(providerID string) int {
+	if max, ok := s.limits.ProviderMaxConcurrent[providerID]; ok {
+		return max
+	}
+	return s.limits.MaxConcurrentPerProvider
+}
+
+// acquire blocks until providerID has a free download slot or ctx is done.
+// The returned release func must be called exactly once.
+func (s *providerDownloadScheduler) acquire(ctx context.Context, providerID string) (func(), error) {
+	providerID = strings.ToLower(strings.TrimSpace(providerID))
+	waitStarted := time.Time{}
+	for {
+		s.mu.Lock()
+		max := s.maxForLocked(providerID)
+		if max <= 0 || s.active[providerID] < max {
+			s.active[providerID]++
+			s.mu.Unlock()
+			if !waitStarted.IsZero() {
+				LogDebug("DownloadLimits", "provider=%s slot acquired after %s", providerID, time.Since(waitStarted).Round(time.Millisecond))
+			}
+			var once sync.Once
+			return func() {
+				once.Do(func() { s.release(providerID) })
+			}, nil
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		if waitStarted.IsZero() {
+			waitStarted = time.Now()
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (s *providerDownloadScheduler) release(providerID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active[providerID] <= 1 {
+		delete(s.active, providerID)
+	} else {
+		s.active[providerID]--
+	}
+	s.notifyLocked()
+}
+
+func (s *providerDownloadScheduler) activeCount(providerID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active[strings.ToLower(strings.TrimSpace(providerID))]
+}
+
+// acquireProviderDownloadSlot waits for a provider slot, aborting with
+// ErrDownloadCancelled when the item is cancelled while queued.
+func acquireProviderDownloadSlot(providerID, itemID string) (func(), error) {
+	ctx := downloadCancelContext(itemID)
+	if itemID != "" && downloadScheduler.wouldWait(providerID) {
+		SetItemPreparingStage(itemID, "waiting_for_provider_slot")
+	}
+	release, err := downloadScheduler.acquire(ctx, providerID)
+	if err != nil {
+		if itemID != "" && isDownloadCancelled(itemID) {
+			return nil, ErrDownloadCancelled
+		}
+		return nil, err
+	}
+	return release, nil
+}
+
+func (s *providerDownloadScheduler) wouldWait(providerID string) bool {
+	providerID = strings.ToLower(strings.TrimSpace(providerID))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	max := s.maxForLocked(providerID)
+	return max > 0 && s.active[providerID] >= max
+}
+
+// bandwidthLimiter is a token bucket with one second of burst. Callers take
+// tokens first and sleep off any deficit afterwards, so concurrent downloads
+// queue up fairly behind each other's debt.
+type bandwidthLimiter struct {
+	mu             sync.Mutex
+	bytesPerSecond int64
+	tokens         float64
+	last           time.Time
+}
+
+func (b *bandwidthLimiter) setRate(bytesPerSecond int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bytesPerSecond = bytesPerSecond
+	b.tokens = float64(bytesPerSecond)
+	b.last = time.Now()
+}
+
+func (b *bandwidthLimiter) wait(ctx context.Context, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	rate := b.bytesPerSecond
+	if rate <= 0 {
+		b.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * float64(rate)
+	if b.tokens > float64(rate) {
+		b.tokens = float64(rate)
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	deficit := -b.tokens
+	b.mu.Unlock()
+
+	if deficit <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(time.Duration(deficit / float64(rate) * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttledDownloadWriter applies the global bandwidth cap to a download
+// output. It sits below ItemProgressWriter so reported speed reflects the
+// throttled rate.
+type throttledDownloadWriter struct {
+	writer io.Writer
+	ctx    context.Context
+	itemID string
+}
+
+func (w *throttledDownloadWriter) Write(p []byte) (int, error) {
+	if err := downloadBandwidth.wait(w.ctx, len(p)); err != nil {
+		if w.itemID != "" && isDownloadCancelled(w.itemID) {
+			return 0, ErrDownloadCancelled
+		}
+		return 0, err
+	}
+	return w.writer.Write(p)
+}
+
+// newDownloadOutputWriter builds the writer chain used by the extension file
+// download helpers: bandwidth throttle, then optional per-item byte progress.
+func newDownloadOutputWriter(out io.Writer, itemID string, trackItemBytes bool) interface{ Write([]byte) (int, error) } {
+	var writer io.Writer = &throttledDownloadWriter{
+		writer: out,
+		ctx:    downloadCancelContext(itemID),
+		itemID: itemID,
+	}
+	if trackItemBytes && itemID != "" {
+		return NewItemProgressWriter(writer, itemID)
+	}
+	return writer
+}
@@ -0,0 +1,122 @@
+package gobackend
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func resetDownloadLimitsForTest() {
+	setDownloadLimits(DownloadLimits{})
+}
+
+func TestProviderDownloadSchedulerBoundsInFlightDownloads(t *testing.T) {
+	t.Cleanup(resetDownloadLimitsForTest)
+	setDownloadLimits(DownloadLimits{
+		MaxConcurrentPerProvider: 2,
+		ProviderMaxConcurrent:    map[string]int{" Strict-Ext ": 1},
+	})
+
+	releaseA, err := downloadScheduler.acquire(context.Background(), "strict-ext")
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if !downloadScheduler.wouldWait("STRICT-EXT") {
+		t.Fatal("provider override of 1 should block a second download")
+	}
+	if downloadScheduler.wouldWait("other-ext") {
+		t.Fatal("other providers should use the default limit")
+	}
+
+	acquired := make(chan func(), 1)
+	go func() {
+		release, err := downloadScheduler.acquire(context.Background(), "strict-ext")
+		if err == nil {
+			acquired <- release
+		}
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("second download acquired a slot past the provider limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	releaseA()
+	releaseA() // release is idempotent
+	select {
+	case releaseB := <-acquired:
+		if got := downloadScheduler.activeCount("strict-ext"); got != 1 {
+			t.Fatalf("active = %d, want 1", got)
+		}
+		releaseB()
+	case <-time.After(2 * time.Second):
+		t.Fatal("waiting download was not woken after release")
+	}
+	if got := downloadScheduler.activeCount("strict-ext"); got != 0 {
+		t.Fatalf("active after release = %d, want 0", got)
+	}
+}
+
+func TestProviderDownloadSlotCancelledWhileWaiting(t *testing.T) {
+	t.Cleanup(resetDownloadLimitsForTest)
+	setDownloadLimits(DownloadLimits{MaxConcurrentPerProvider: 1})
+
+	release, err := acquireProviderDownloadSlot("busy-ext", "")
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	defer release()
+
+	const itemID = "slot-wait-cancel"
+	initDownloadCancel(itemID)
+	defer clearDownloadCancel(itemID)
+	done := make(chan error, 1)
+	go func() {
+		_, err := acquireProviderDownloadSlot("busy-ext", itemID)
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancelDownload(itemID)
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrDownloadCancelled) {
+			t.Fatalf("err = %v, want ErrDownloadCancelled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("cancelled waiter did not return")
+	}
+}
+
+func TestThrottledDownloadWriterHonorsBandwidthCap(t *testing.T) {
+	t.Cleanup(resetDownloadLimitsForTest)
+	setDownloadLimits(DownloadLimits{MaxBytesPerSecond: 64 * 1024})
+	if got := getDownloadLimits().MaxBytesPerSecond; got != 64*1024 {
+		t.Fatalf("limit = %d", got)
+	}
+
+	var out bytes.Buffer
+	writer := newDownloadOutputWriter(&out, "", false)
+	chunk := make([]byte, 32*1024)
+	startedAt := time.Now()
+	// One second of burst is free; the next 64 KiB must take about a second.
+	for i := 0; i < 4; i++ {
+		if _, err := writer.Write(chunk); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	elapsed := time.Since(startedAt)
+	if elapsed < 800*time.Millisecond {
+		t.Fatalf("128 KiB at 64 KiB/s finished in %s", elapsed)
+	}
+	if out.Len() != 4*len(chunk) {
+		t.Fatalf("wrote %d bytes", out.Len())
+	}
+
+	setDownloadLimits(DownloadLimits{MaxBytesPerSecond: 1})
+	if got := getDownloadLimits().MaxBytesPerSecond; got != minDownloadBytesPerSecond {
+		t.Fatalf("tiny cap = %d, want clamp to %d", got, minDownloadBytesPerSecond)
+	}
+}
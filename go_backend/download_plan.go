@@ -0,0 +1,199 @@
+package gobackend
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// DownloadPlan is what DownloadWithExtensionFallback would do for a request,
+// worked out without transferring any audio.
+type DownloadPlan struct {
+	Downloadable bool `json:"downloadable"`
+	// ProviderID, TrackID and Quality describe the provider the real download
+	// would hand the request to first.
+	ProviderID    string   `json:"provider_id,omitempty"`
+	TrackID       string   `json:"track_id,omitempty"`
+	Quality       string   `json:"quality,omitempty"`
+	QualityLabel  string   `json:"quality_label,omitempty"`
+	Lossless      bool     `json:"lossless,omitempty"`
+	AudioTraits   []string `json:"audio_traits,omitempty"`
+	MatchVerdict  string   `json:"match_verdict,omitempty"`
+	AlreadyExists bool     `json:"already_exists,omitempty"`
+	OutputPath    string   `json:"output_path,omitempty"`
+	// ReplacesPath is the library file DuplicatePolicy "replace_if_better"
+	// would replace with this download.
+	ReplacesPath string `json:"replaces_path,omitempty"`
+	// Candidates lists every provider that offered a track ID, in the order
+	// the fallback would try them, including rejected ones.
+	Candidates []DownloadPlanCandidate `json:"candidates,omitempty"`
+	Error      string                  `json:"error,omitempty"`
+	ErrorType  string                  `json:"error_type,omitempty"`
+	Attempts   []DownloadAttempt       `json:"attempts,omitempty"`
+}
+
+type DownloadPlanCandidate struct {
+	ProviderID   string `json:"provider_id"`
+	TrackID      string `json:"track_id"`
+	Quality      string `json:"quality,omitempty"`
+	MatchVerdict string `json:"match_verdict,omitempty"`
+	Outcome      string `json:"outcome"`
+}
+
+const (
+	attemptOutcomePlanned = "planned"
+	// trackMatchDeferred means the provider cannot describe the track before
+	// downloading it, so the real download verifies it afterwards.
+	trackMatchDeferred = "deferred_to_download"
+)
+
+// downloadPlanner stands in for attemptExtensionDownload when
+// downloadWithExtensionFallback runs in plan mode.
+type downloadPlanner struct {
+	plan DownloadPlan
+}
+
+// attempt mirrors attemptExtensionDownload's contract: a non-nil response
+// ends the fallback walk, nil with lastErr set moves on to the next provider.
+// Matching uses the provider's getTrack metadata instead of the downloaded
+// file's tags.
+func (p *downloadPlanner) attempt(
+	req DownloadRequest,
+	ext *loadedExtension,
+	provider *extensionProviderWrapper,
+	trackID, quality, providerLabel string,
+	applyTitleFallback bool,
+	lastErr *error,
+	lastErrType *string,
+	lastRetryAfterSeconds *int,
+	attempt *DownloadAttempt,
+) (*DownloadResponse, bool) {
+	if attempt != nil {
+		attempt.TrackID = trackID
+		attempt.Quality = quality
+	}
+
+	duplicate := resolveDuplicatePolicy(req, ext, quality, planOutputPath(req))
+	if duplicate.keepExisting != "" {
+		attempt.finish(attemptOutcomeAlreadyExists, nil, "")
+		p.pick(ext, providerLabel, trackID, quality, trackMatchUnverified, nil)
+		p.plan.AlreadyExists = true
+		p.plan.OutputPath = duplicate.keepExisting
+		return &DownloadResponse{Success: true, Message: "File already exists", Service: providerLabel, AlreadyExists: true}, false
+	}
+
+	verdict := trackMatchDeferred
+	var track *ExtTrackMetadata
+	skipNameVerification := strings.EqualFold(strings.TrimSpace(req.Source), strings.TrimSpace(providerLabel)) ||
+		ext.Manifest.HasCustomMatching()
+	if skipNameVerification {
+		verdict = trackMatchUnverified
+	} else if ext.Manifest.IsMetadataProvider() && strings.TrimSpace(trackID) != "" {
+		fetched, err := provider.GetTrack(trackID)
+		if shouldAbortCancelledFallback(req.ItemID, err) {
+			attempt.finish(attemptOutcomeCancelled, nil, "cancelled")
+			return nil, true
+		}
+		if err != nil {
+			GoLog("[PlanDownload] %s getTrack(%s) failed, leaving match to download: %v\n", providerLabel, trackID, err)
+		} else {
+			track = fetched
+			verdict = evaluateTrackMatch(req, resolvedTrackInfo{
+				Title:      track.Name,
+				ArtistName: track.Artists,
+				AlbumName:  track.AlbumName,
+				ISRC:       track.ISRC,
+				Duration:   track.DurationMS / 1000,
+			}, "Plan "+providerLabel)
+		}
+	}
+	if attempt != nil {
+		attempt.MatchVerdict = verdict
+	}
+	p.addCandidate(providerLabel, trackID, quality, verdict)
+
+	if verdict != trackMatchDeferred && !trackMatchVerdictAccepted(verdict) {
+		*lastErr = fmt.Errorf("provider %s returned a different track", providerLabel)
+		*lastErrType = "not_found"
+		attempt.finish(attemptOutcomeTrackMismatch, *lastErr, *lastErrType)
+		p.markLastCandidate(attemptOutcomeTrackMismatch)
+		return nil, false
+	}
+
+	attempt.finish(attemptOutcomePlanned, nil, "")
+	p.markLastCandidate(attemptOutcomePlanned)
+	p.pick(ext, providerLabel, trackID, quality, verdict, track)
+	p.plan.ReplacesPath = duplicate.replacePath
+	return &DownloadResponse{Success: true, Message: "Would download from " + providerLabel, Service: providerLabel}, false
+}
+
+func (p *downloadPlanner) addCandidate(providerID, trackID, quality, verdict string) {
+	if strings.TrimSpace(trackID) == "" {
+		return
+	}
+	p.plan.Candidates = append(p.plan.Candidates, DownloadPlanCandidate{
+		ProviderID:   providerID,
+		TrackID:      trackID,
+		Quality:      quality,
+		MatchVerdict: verdict,
+	})
+}
+
+func (p *downloadPlanner) markLastCandidate(outcome string) {
+	if n := len(p.plan.Candidates); n > 0 {
+		p.plan.Candidates[n-1].Outcome = outcome
+	}
+}
+
+func (p *downloadPlanner) pick(ext *loadedExtension, providerID, trackID, quality, verdict string, track *ExtTrackMetadata) {
+	p.plan.Downloadable = true
+	p.plan.ProviderID = providerID
+	p.plan.TrackID = trackID
+	p.plan.Quality = quality
+	p.plan.MatchVerdict = verdict
+
+	// Quality tokens are provider-defined, so judge them by their labels the
+	// same way album badges are derived from track audio quality.
+	label, text := extensionQualityText(ext, quality)
+	p.plan.QualityLabel = label
+	probes := []ExtTrackMetadata{{AudioQuality: text}}
+	if track != nil {
+		probes = append(probes, ExtTrackMetadata{AudioQuality: track.AudioQuality, AudioModes: track.AudioModes})
+	}
+	p.plan.AudioTraits = albumAudioTraitsFromTracks(probes)
+	for _, trait := range p.plan.AudioTraits {
+		if trait == "lossless" || trait == "hi_res_lossless" {
+			p.plan.Lossless = true
+		}
+	}
+}
+
+// planOutputPath is buildOutputPathForExtension without its directory
+// creation; only paths that can already hold a finished file are returned.
+func planOutputPath(req DownloadRequest) string {
+	if outputPath := strings.TrimSpace(req.OutputPath); outputPath != "" {
+		return outputPath
+	}
+	if isFDOutput(req.OutputFD) || strings.TrimSpace(req.OutputDir) == "" {
+		return ""
+	}
+	return filepath.Join(strings.TrimSpace(req.OutputDir), buildDownloadFilename(req))
+}
+
+// planDownload runs the fallback walk in plan mode for req.
+func planDownload(req DownloadRequest) (*DownloadPlan, error) {
+	trace := &downloadAttemptTrace{}
+	planner := &downloadPlanner{}
+	resp, err := downloadWithExtensionFallback(req, trace, planner)
+	if err != nil {
+		return nil, err
+	}
+	plan := planner.plan
+	if resp != nil && !resp.Success {
+		plan.Downloadable = false
+		plan.Error = resp.Error
+		plan.ErrorType = resp.ErrorType
+	}
+	plan.Attempts = trace.list()
+	return &plan, nil
+}
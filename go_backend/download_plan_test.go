@@ -0,0 +1,108 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func installPlanTestProvider(t *testing.T) *loadedExtension {
+	t.Helper()
+	ext := newTestLoadedExtension(t, ExtensionTypeMetadataProvider, ExtensionTypeDownloadProvider)
+	ext.ID = "plan-download"
+	ext.Manifest.Name = ext.ID
+	ext.Manifest.TrackMatching = nil
+	ext.Manifest.QualityOptions = []QualityOption{
+		{ID: "HIGH", Label: "AAC 320kbps"},
+		{ID: "LOSSLESS", Label: "Lossless", Description: "16-bit FLAC"},
+	}
+
+	manager := getExtensionManager()
+	manager.mu.Lock()
+	previousExtensions := manager.extensions
+	manager.extensions = map[string]*loadedExtension{ext.ID: ext}
+	manager.mu.Unlock()
+	t.Cleanup(func() {
+		teardownExtension(ext)
+		manager.mu.Lock()
+		manager.extensions = previousExtensions
+		manager.mu.Unlock()
+	})
+	return ext
+}
+
+func TestPlanDownloadPicksMatchingProviderWithoutDownloading(t *testing.T) {
+	ext := installPlanTestProvider(t)
+	outputDir := t.TempDir()
+
+	requestJSON, err := json.Marshal(DownloadRequest{
+		ItemID:         "plan-item",
+		Service:        ext.ID,
+		TrackName:      "Track download-track",
+		ArtistName:     "Artist",
+		DurationMS:     180000,
+		OutputDir:      outputDir,
+		OutputExt:      ".flac",
+		FilenameFormat: "{title}",
+		Quality:        "LOSSLESS",
+	})
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+	raw, err := PlanDownloadJSON(string(requestJSON))
+	if err != nil {
+		t.Fatalf("PlanDownloadJSON: %v", err)
+	}
+	var plan DownloadPlan
+	if err := json.Unmarshal([]byte(raw), &plan); err != nil {
+		t.Fatalf("unmarshal plan: %v", err)
+	}
+	if !plan.Downloadable || plan.ProviderID != ext.ID || plan.TrackID != "download-track" {
+		t.Fatalf("plan = %+v", plan)
+	}
+	if plan.MatchVerdict != trackMatchISRC && plan.MatchVerdict != trackMatchNames {
+		t.Fatalf("match verdict = %q", plan.MatchVerdict)
+	}
+	if !plan.Lossless || plan.QualityLabel != "Lossless" {
+		t.Fatalf("quality = %q lossless=%v traits=%v", plan.QualityLabel, plan.Lossless, plan.AudioTraits)
+	}
+	if len(plan.Candidates) != 1 || plan.Candidates[0].Outcome != attemptOutcomePlanned {
+		t.Fatalf("candidates = %+v", plan.Candidates)
+	}
+	if len(plan.Attempts) == 0 || plan.Attempts[len(plan.Attempts)-1].Outcome != attemptOutcomePlanned {
+		t.Fatalf("attempts = %+v", plan.Attempts)
+	}
+	entries, err := os.ReadDir(outputDir)
+	if err != nil {
+		t.Fatalf("read output dir: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("plan wrote %d files to the output dir", len(entries))
+	}
+	if got := GetItemProgress("plan-item"); got != "{}" {
+		t.Fatal("plan touched item progress")
+	}
+}
+
+func TestPlanDownloadRejectsMismatchedTrack(t *testing.T) {
+	ext := installPlanTestProvider(t)
+
+	plan, err := planDownload(DownloadRequest{
+		Service:    ext.ID,
+		TrackName:  "Something Else Entirely",
+		ArtistName: "Different Band",
+		Quality:    "LOSSLESS",
+	})
+	if err != nil {
+		t.Fatalf("planDownload: %v", err)
+	}
+	if plan.Downloadable {
+		t.Fatalf("mismatched track planned as downloadable: %+v", plan)
+	}
+	if len(plan.Candidates) != 1 || plan.Candidates[0].Outcome != attemptOutcomeTrackMismatch {
+		t.Fatalf("candidates = %+v", plan.Candidates)
+	}
+	if plan.Error == "" {
+		t.Fatal("expected an error explaining why nothing was planned")
+	}
+}
@@ -0,0 +1,617 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The download queue owns batch jobs on the Go side so a process death (OOM
+// kill, swipe-away) does not lose them. Every state change is appended to a
+// JSON-lines journal in the extension data dir; on the next start the journal
+// is replayed and jobs that were mid-transfer go back to "queued".
+
+const (
+	downloadQueueJournalName        = "download_queue.jsonl"
+	downloadQueueDefaultConcurrency = 2
+	downloadQueueMaxConcurrency     = 8
+	// downloadQueueCompactSlack is how many superseded journal lines may pile
+	// up beyond one line per live job before the journal is rewritten.
+	downloadQueueCompactSlack = 256
+)
+
+const (
+	queueJobStatusQueued    = "queued"
+	queueJobStatusRunning   = "running"
+	queueJobStatusPaused    = "paused"
+	queueJobStatusCompleted = "completed"
+	queueJobStatusFailed    = "failed"
+	queueJobStatusCancelled = "cancelled"
+)
+
+type downloadQueueJob struct {
+	ItemID     string            `json:"item_id"`
+	Request    DownloadRequest   `json:"request"`
+	Status     string            `json:"status"`
+	Attempts   int               `json:"attempts"`
+	Error      string            `json:"error,omitempty"`
+	ErrorType  string            `json:"error_type,omitempty"`
+	Result     *DownloadResponse `json:"result,omitempty"`
+	EnqueuedAt int64             `json:"enqueued_at"`
+	UpdatedAt  int64             `json:"updated_at"`
+}
+
+// downloadQueueJournalEntry is one journal line. "job" carries a full job
+// snapshot (last one wins on replay), "remove" drops an item, "order" records
+// an explicit reorder and "settings" the queue-wide pause/concurrency state.
+type downloadQueueJournalEntry struct {
+	Op          string            `json:"op"`
+	Job         *downloadQueueJob `json:"job,omitempty"`
+	ItemID      string            `json:"item_id,omitempty"`
+	Order       []string          `json:"order,omitempty"`
+	Paused      *bool             `json:"paused,omitempty"`
+	Concurrency int               `json:"concurrency,omitempty"`
+}
+
+type downloadQueueSnapshot struct {
+	Paused      bool                `json:"paused"`
+	Started     bool                `json:"started"`
+	Concurrency int                 `json:"concurrency"`
+	Running     int                 `json:"running"`
+	Revision    int64               `json:"revision"`
+	Jobs        []*downloadQueueJob `json:"jobs"`
+}
+
+type downloadQueueEnqueueResult struct {
+	Enqueued []string                   `json:"enqueued"`
+	Skipped  []downloadQueueSkippedItem `json:"skipped,omitempty"`
+}
+
+type downloadQueueSkippedItem struct {
+	ItemID string `json:"item_id,omitempty"`
+	Reason string `json:"reason"`
+}
+
+type downloadQueue struct {
+	mu          sync.Mutex
+	journal     jsonlJournal[downloadQueueJournalEntry]
+	jobs        map[string]*downloadQueueJob
+	order       []string
+	paused      bool
+	started     bool
+	concurrency int
+	running     int
+	// inFlight holds item IDs whose runJob has not returned yet. A paused
+	// item resumed before its cancelled run winds down stays queued until
+	// then, so the old run's cancel flag cannot abort the new one.
+	inFlight  map[string]bool
+	revision  int64
+	idCounter int64
+	run       func(req DownloadRequest) *DownloadResponse
+}
+
+var (
+	globalDownloadQueue     *downloadQueue
+	globalDownloadQueueOnce sync.Once
+)
+
+func getDownloadQueue() *downloadQueue {
+	globalDownloadQueueOnce.Do(func() {
+		globalDownloadQueue = newDownloadQueue(runQueuedDownload)
+	})
+	return globalDownloadQueue
+}
+
+func newDownloadQueue(run func(req DownloadRequest) *DownloadResponse) *downloadQueue {
+	return &downloadQueue{
+		jobs:        make(map[string]*downloadQueueJob),
+		inFlight:    make(map[string]bool),
+		concurrency: downloadQueueDefaultConcurrency,
+		run:         run,
+	}
+}
+
+// runQueuedDownload feeds a queued request through the same entry point the
+// host uses for single downloads, so queued and direct downloads share the
+// provider fallback, progress and cancellation paths.
+func runQueuedDownload(req DownloadRequest) *DownloadResponse {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return &DownloadResponse{Success: false, Error: "Invalid request: " + err.Error(), ErrorType: "unknown"}
+	}
+	respJSON, err := DownloadByStrategy(string(payload))
+	if err != nil {
+		return &DownloadResponse{Success: false, Error: err.Error(), ErrorType: classifyDownloadErrorType(err.Error())}
+	}
+	var resp DownloadResponse
+	if err := json.Unmarshal([]byte(respJSON), &resp); err != nil {
+		return &DownloadResponse{Success: false, Error: "Invalid download response: " + err.Error(), ErrorType: "unknown"}
+	}
+	return &resp
+}
+
+// open loads (or creates) the journal under dataDir and recovers jobs that
+// were running when the previous process died. Reopening the same dir is a
+// no-op so repeated InitExtensionSystem calls do not replay twice.
+func (q *downloadQueue) open(dataDir string) error {
+	dataDir = strings.TrimSpace(dataDir)
+	if dataDir == "" {
+		return fmt.Errorf("download queue data dir is empty")
+	}
+	journalPath := filepath.Join(dataDir, downloadQueueJournalName)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.journal.path == journalPath && q.journal.file != nil {
+		return nil
+	}
+	if q.running > 0 {
+		return fmt.Errorf("download queue is busy; cannot switch data dir")
+	}
+	q.journal.close()
+
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return fmt.Errorf("failed to create download queue directory: %w", err)
+	}
+
+	q.journal = jsonlJournal[downloadQueueJournalEntry]{path: journalPath}
+	q.jobs = make(map[string]*downloadQueueJob)
+	q.order = nil
+	q.paused = false
+	q.started = false
+	q.concurrency = downloadQueueDefaultConcurrency
+	err := q.journal.replay("DownloadQueue", func(entry downloadQueueJournalEntry) bool {
+		q.applyJournalEntryLocked(entry)
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read download queue journal: %w", err)
+	}
+
+	recovered := 0
+	now := time.Now().UnixMilli()
+	for _, job := range q.jobs {
+		if job.Status == queueJobStatusRunning {
+			job.Status = queueJobStatusQueued
+			job.UpdatedAt = now
+			recovered++
+		}
+	}
+	if recovered > 0 {
+		GoLog("[DownloadQueue] Recovered %d interrupted download(s) from journal\n", recovered)
+	}
+
+	// Always start from a compacted journal: it drops superseded lines from
+	// the previous session and persists the recovered statuses.
+	if err := q.compactLocked(); err != nil {
+		return err
+	}
+	q.revision++
+	return nil
+}
+
+func (q *downloadQueue) applyJournalEntryLocked(entry downloadQueueJournalEntry) {
+	switch entry.Op {
+	case "job":
+		if entry.Job == nil || strings.TrimSpace(entry.Job.ItemID) == "" {
+			return
+		}
+		job := *entry.Job
+		if _, exists := q.jobs[job.ItemID]; !exists {
+			q.order = append(q.order, job.ItemID)
+		}
+		q.jobs[job.ItemID] = &job
+	case "remove":
+		if _, exists := q.jobs[entry.ItemID]; exists {
+			delete(q.jobs, entry.ItemID)
+			q.order = removeQueueOrderID(q.order, entry.ItemID)
+		}
+	case "order":
+		q.order = mergeQueueOrder(q.order, entry.Order)
+	case "settings":
+		if entry.Paused != nil {
+			q.paused = *entry.Paused
+		}
+		if entry.Concurrency > 0 {
+			q.concurrency = clampQueueConcurrency(entry.Concurrency)
+		}
+	}
+}
+
+func (q *downloadQueue) appendJournalLocked(entry downloadQueueJournalEntry) {
+	q.revision++
+	if q.journal.path == "" {
+		return
+	}
+	// fsync per entry: entries are written on state transitions only (not per
+	// progress tick), and surviving an OOM kill is the point of the journal.
+	if err := q.journal.append(entry); err != nil {
+		GoLog("[DownloadQueue] Failed to append journal entry: %v\n", err)
+		return
+	}
+
+	if q.journal.lines > len(q.jobs)+downloadQueueCompactSlack {
+		if err := q.compactLocked(); err != nil {
+			GoLog("[DownloadQueue] Journal compaction failed: %v\n", err)
+		}
+	}
+}
+
+// compactLocked rewrites the journal as one settings line plus one line per
+// live job in queue order.
+func (q *downloadQueue) compactLocked() error {
+	if q.journal.path == "" {
+		return nil
+	}
+	paused := q.paused
+	entries := []downloadQueueJournalEntry{{Op: "settings", Paused: &paused, Concurrency: q.concurrency}}
+	for _, itemID := range q.order {
+		if job, ok := q.jobs[itemID]; ok {
+			entries = append(entries, downloadQueueJournalEntry{Op: "job", Job: job})
+		}
+	}
+	if err := q.journal.compact(entries); err != nil {
+		return fmt.Errorf("failed to write download queue journal: %w", err)
+	}
+	return nil
+}
+
+func (q *downloadQueue) persistJobLocked(job *downloadQueueJob) {
+	job.UpdatedAt = time.Now().UnixMilli()
+	snapshot := *job
+	q.appendJournalLocked(downloadQueueJournalEntry{Op: "job", Job: &snapshot})
+}
+
+func (q *downloadQueue) persistSettingsLocked() {
+	paused := q.paused
+	q.appendJournalLocked(downloadQueueJournalEntry{Op: "settings", Paused: &paused, Concurrency: q.concurrency})
+}
+
+func (q *downloadQueue) nextItemIDLocked() string {
+	for {
+		q.idCounter++
+		id := fmt.Sprintf("queue-%d-%d", time.Now().UnixNano(), q.idCounter)
+		if _, exists := q.jobs[id]; !exists {
+			return id
+		}
+	}
+}
+
+func (q *downloadQueue) enqueue(requests []DownloadRequest) downloadQueueEnqueueResult {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	result := downloadQueueEnqueueResult{Enqueued: make([]string, 0, len(requests))}
+	now := time.Now().UnixMilli()
+	for _, req := range requests {
+		req.ItemID = strings.TrimSpace(req.ItemID)
+		// File descriptors belong to the process that opened them and cannot
+		// be replayed after a restart.
+		if req.OutputFD > 0 {
+			result.Skipped = append(result.Skipped, downloadQueueSkippedItem{
+				ItemID: req.ItemID,
+				Reason: "output_fd is not supported for queued downloads; use output_dir or output_path",
+			})
+			continue
+		}
+		if req.ItemID == "" {
+			req.ItemID = q.nextItemIDLocked()
+		}
+
+		if existing, ok := q.jobs[req.ItemID]; ok {
+			switch existing.Status {
+			case queueJobStatusQueued, queueJobStatusRunning, queueJobStatusPaused:
+				result.Skipped = append(result.Skipped, downloadQueueSkippedItem{
+					ItemID: req.ItemID,
+					Reason: "already queued",
+				})
+				continue
+			}
+			existing.Request = req
+			existing.Status = queueJobStatusQueued
+			existing.Error = ""
+			existing.ErrorType = ""
+			existing.Result = nil
+			q.persistJobLocked(existing)
+			result.Enqueued = append(result.Enqueued, req.ItemID)
+			continue
+		}
+
+		job := &downloadQueueJob{
+			ItemID:     req.ItemID,
+			Request:    req,
+			Status:     queueJobStatusQueued,
+			EnqueuedAt: now,
+		}
+		q.jobs[job.ItemID] = job
+		q.order = append(q.order, job.ItemID)
+		q.persistJobLocked(job)
+		result.Enqueued = append(result.Enqueued, job.ItemID)
+	}
+
+	q.dispatchLocked()
+	return result
+}
+
+// start enables dispatching. It is separate from open because recovered jobs
+// must not run before the host has loaded the extensions that serve them.
+func (q *downloadQueue) start() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.started {
+		q.started = true
+		q.revision++
+	}
+	q.dispatchLocked()
+}
+
+func (q *downloadQueue) setPaused(paused bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.paused == paused {
+		return
+	}
+	q.paused = paused
+	q.persistSettingsLocked()
+	// Pausing the queue only stops new dispatches; in-flight transfers finish
+	// so a brief pause does not throw away partially downloaded files.
+	q.dispatchLocked()
+}
+
+func (q *downloadQueue) setConcurrency(concurrency int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	concurrency = clampQueueConcurrency(concurrency)
+	if q.concurrency == concurrency {
+		return
+	}
+	q.concurrency = concurrency
+	q.persistSettingsLocked()
+	q.dispatchLocked()
+}
+
+func (q *downloadQueue) pauseItem(itemID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[strings.TrimSpace(itemID)]
+	if !ok {
+		return false
+	}
+	switch job.Status {
+	case queueJobStatusQueued:
+	case queueJobStatusRunning:
+		// The worker sees the paused status when the cancelled transfer
+		// returns and keeps it instead of recording a failure.
+		cancelDownload(job.ItemID)
+	default:
+		return false
+	}
+	job.Status = queueJobStatusPaused
+	q.persistJobLocked(job)
+	return true
+}
+
+func (q *downloadQueue) resumeItem(itemID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[strings.TrimSpace(itemID)]
+	if !ok || job.Status != queueJobStatusPaused {
+		return false
+	}
+	job.Status = queueJobStatusQueued
+	q.persistJobLocked(job)
+	q.dispatchLocked()
+	return true
+}
+
+// retry re-queues failed or cancelled jobs. An empty itemID retries every
+// such job in queue order.
+func (q *downloadQueue) retry(itemID string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	itemID = strings.TrimSpace(itemID)
+	retried := 0
+	for _, id := range q.order {
+		if itemID != "" && id != itemID {
+			continue
+		}
+		job := q.jobs[id]
+		if job == nil || (job.Status != queueJobStatusFailed && job.Status != queueJobStatusCancelled) {
+			continue
+		}
+		job.Status = queueJobStatusQueued
+		job.Error = ""
+		job.ErrorType = ""
+		job.Result = nil
+		q.persistJobLocked(job)
+		retried++
+	}
+	if retried > 0 {
+		q.dispatchLocked()
+	}
+	return retried
+}
+
+func (q *downloadQueue) remove(itemID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	itemID = strings.TrimSpace(itemID)
+	job, ok := q.jobs[itemID]
+	if !ok {
+		return false
+	}
+	if job.Status == queueJobStatusRunning {
+		cancelDownload(itemID)
+	}
+	delete(q.jobs, itemID)
+	q.order = removeQueueOrderID(q.order, itemID)
+	q.appendJournalLocked(downloadQueueJournalEntry{Op: "remove", ItemID: itemID})
+	return true
+}
+
+// clearFinished drops completed jobs, keeping failures visible for retry.
+func (q *downloadQueue) clearFinished() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	removed := 0
+	for _, id := range append([]string(nil), q.order...) {
+		job := q.jobs[id]
+		if job == nil || job.Status != queueJobStatusCompleted {
+			continue
+		}
+		delete(q.jobs, id)
+		q.order = removeQueueOrderID(q.order, id)
+		removed++
+	}
+	if removed > 0 {
+		if err := q.compactLocked(); err != nil {
+			GoLog("[DownloadQueue] Journal compaction failed: %v\n", err)
+		}
+		q.revision++
+	}
+	return removed
+}
+
+// reorder moves the given items to the front in the given order; items not
+// listed keep their relative order behind them.
+func (q *downloadQueue) reorder(itemIDs []string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.order = mergeQueueOrder(q.order, itemIDs)
+	q.appendJournalLocked(downloadQueueJournalEntry{Op: "order", Order: append([]string(nil), q.order...)})
+	q.dispatchLocked()
+}
+
+func (q *downloadQueue) snapshot() downloadQueueSnapshot {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]*downloadQueueJob, 0, len(q.order))
+	for _, id := range q.order {
+		if job, ok := q.jobs[id]; ok {
+			snapshot := *job
+			jobs = append(jobs, &snapshot)
+		}
+	}
+	return downloadQueueSnapshot{
+		Paused:      q.paused,
+		Started:     q.started,
+		Concurrency: q.concurrency,
+		Running:     q.running,
+		Revision:    q.revision,
+		Jobs:        jobs,
+	}
+}
+
+func (q *downloadQueue) dispatchLocked() {
+	if !q.started || q.paused {
+		return
+	}
+	for _, id := range q.order {
+		if q.running >= q.concurrency {
+			return
+		}
+		job := q.jobs[id]
+		if job == nil || job.Status != queueJobStatusQueued || q.inFlight[id] {
+			continue
+		}
+		job.Status = queueJobStatusRunning
+		job.Attempts++
+		job.Error = ""
+		job.ErrorType = ""
+		q.persistJobLocked(job)
+		q.running++
+		q.inFlight[id] = true
+		// Drop a stale cancel flag (e.g. from a pause in a previous run) while
+		// still holding the queue lock, so a pause issued right after dispatch
+		// cannot be reset away.
+		resetDownloadCancel(job.ItemID)
+		go q.runJob(job.ItemID, job.Request)
+	}
+}
+
+func (q *downloadQueue) runJob(itemID string, req DownloadRequest) {
+	resp := q.run(req)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.running--
+	delete(q.inFlight, itemID)
+	defer q.dispatchLocked()
+
+	job, ok := q.jobs[itemID]
+	if !ok {
+		return
+	}
+	if resp == nil {
+		resp = &DownloadResponse{Success: false, Error: "download returned no response", ErrorType: "unknown"}
+	}
+
+	switch {
+	case resp.Success:
+		job.Status = queueJobStatusCompleted
+		job.Result = resp
+	case job.Status == queueJobStatusPaused:
+		// Cancelled by pauseItem; keep it paused for a later resume.
+	case job.Status == queueJobStatusQueued:
+		// Paused and resumed (or removed and re-enqueued) while this run was
+		// winding down; the deferred dispatch starts the new run.
+	case strings.EqualFold(resp.ErrorType, "cancelled"):
+		job.Status = queueJobStatusCancelled
+		job.Error = resp.Error
+		job.ErrorType = resp.ErrorType
+	default:
+		job.Status = queueJobStatusFailed
+		job.Error = resp.Error
+		job.ErrorType = resp.ErrorType
+		job.Result = resp
+	}
+	q.persistJobLocked(job)
+}
+
+func clampQueueConcurrency(concurrency int) int {
+	if concurrency < 1 {
+		return 1
+	}
+	if concurrency > downloadQueueMaxConcurrency {
+		return downloadQueueMaxConcurrency
+	}
+	return concurrency
+}
+
+func removeQueueOrderID(order []string, itemID string) []string {
+	for i, id := range order {
+		if id == itemID {
+			return append(order[:i:i], order[i+1:]...)
+		}
+	}
+	return order
+}
+
+// mergeQueueOrder returns current reordered so that the known IDs in front
+// come first (in that order) followed by the remaining IDs unchanged.
+func mergeQueueOrder(current, front []string) []string {
+	known := make(map[string]bool, len(current))
+	for _, id := range current {
+		known[id] = true
+	}
+	placed := make(map[string]bool, len(front))
+	result := make([]string, 0, len(current))
+	for _, id := range front {
+		id = strings.TrimSpace(id)
+		if !known[id] || placed[id] {
+			continue
+		}
+		placed[id] = true
+		result = append(result, id)
+	}
+	for _, id := range current {
+		if !placed[id] {
+			result = append(result, id)
+		}
+	}
+	return result
+}
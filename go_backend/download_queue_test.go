@@ -0,0 +1,241 @@
+package gobackend
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func waitForQueueCondition(t *testing.T, q *downloadQueue, cond func(downloadQueueSnapshot) bool) downloadQueueSnapshot {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		snapshot := q.snapshot()
+		if cond(snapshot) {
+			return snapshot
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("queue condition not reached: %+v", snapshot)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func queueJobStatuses(snapshot downloadQueueSnapshot) map[string]string {
+	statuses := make(map[string]string, len(snapshot.Jobs))
+	for _, job := range snapshot.Jobs {
+		statuses[job.ItemID] = job.Status
+	}
+	return statuses
+}
+
+func TestDownloadQueueRunsWithBoundedConcurrency(t *testing.T) {
+	var active, peak int32
+	release := make(chan struct{})
+	q := newDownloadQueue(func(req DownloadRequest) *DownloadResponse {
+		current := atomic.AddInt32(&active, 1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if current <= old || atomic.CompareAndSwapInt32(&peak, old, current) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&active, -1)
+		return &DownloadResponse{Success: true, FilePath: "/music/" + req.ItemID + ".flac"}
+	})
+	if err := q.open(t.TempDir()); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	q.setConcurrency(2)
+
+	result := q.enqueue([]DownloadRequest{{ItemID: "a"}, {ItemID: "b"}, {ItemID: "c"}, {ItemID: "d"}})
+	if len(result.Enqueued) != 4 {
+		t.Fatalf("enqueued = %v", result.Enqueued)
+	}
+	if snapshot := q.snapshot(); snapshot.Running != 0 {
+		t.Fatalf("queue dispatched before start: %+v", snapshot)
+	}
+
+	q.start()
+	waitForQueueCondition(t, q, func(s downloadQueueSnapshot) bool { return s.Running == 2 })
+	close(release)
+	snapshot := waitForQueueCondition(t, q, func(s downloadQueueSnapshot) bool {
+		for _, job := range s.Jobs {
+			if job.Status != queueJobStatusCompleted {
+				return false
+			}
+		}
+		return true
+	})
+	if got := atomic.LoadInt32(&peak); got > 2 {
+		t.Fatalf("peak concurrency = %d, want <= 2", got)
+	}
+	if snapshot.Jobs[0].Result == nil || snapshot.Jobs[0].Result.FilePath != "/music/a.flac" {
+		t.Fatalf("completed job result missing: %+v", snapshot.Jobs[0])
+	}
+}
+
+func TestDownloadQueueRecoversInterruptedJobsFromJournal(t *testing.T) {
+	dir := t.TempDir()
+	block := make(chan struct{})
+	defer close(block)
+	q := newDownloadQueue(func(req DownloadRequest) *DownloadResponse {
+		<-block
+		return &DownloadResponse{Success: true}
+	})
+	if err := q.open(dir); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	q.setConcurrency(1)
+	q.enqueue([]DownloadRequest{
+		{ItemID: "first", TrackName: "One", OutputDir: "/music"},
+		{ItemID: "second", TrackName: "Two", OutputDir: "/music"},
+	})
+	q.reorder([]string{"second"})
+	q.start()
+	waitForQueueCondition(t, q, func(s downloadQueueSnapshot) bool { return s.Running == 1 })
+
+	// Simulate a torn append from a process killed mid-write.
+	journal, err := os.OpenFile(filepath.Join(dir, downloadQueueJournalName), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	journal.WriteString(`{"op":"job","job":{"item_id":"tor`)
+	journal.Close()
+
+	var ran []string
+	var mu sync.Mutex
+	recovered := newDownloadQueue(func(req DownloadRequest) *DownloadResponse {
+		mu.Lock()
+		ran = append(ran, req.ItemID+":"+req.TrackName)
+		mu.Unlock()
+		return &DownloadResponse{Success: true}
+	})
+	if err := recovered.open(dir); err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	snapshot := recovered.snapshot()
+	if len(snapshot.Jobs) != 2 || snapshot.Jobs[0].ItemID != "second" {
+		t.Fatalf("recovered order = %+v", snapshot.Jobs)
+	}
+	if snapshot.Concurrency != 1 {
+		t.Fatalf("recovered concurrency = %d, want 1", snapshot.Concurrency)
+	}
+	for _, job := range snapshot.Jobs {
+		if job.Status != queueJobStatusQueued {
+			t.Fatalf("job %s status = %q, want queued", job.ItemID, job.Status)
+		}
+	}
+	if snapshot.Jobs[0].Attempts != 1 {
+		t.Fatalf("attempts for interrupted job = %d, want 1", snapshot.Jobs[0].Attempts)
+	}
+
+	recovered.start()
+	waitForQueueCondition(t, recovered, func(s downloadQueueSnapshot) bool {
+		statuses := queueJobStatuses(s)
+		return statuses["first"] == queueJobStatusCompleted && statuses["second"] == queueJobStatusCompleted
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ran) != 2 || ran[0] != "second:Two" || ran[1] != "first:One" {
+		t.Fatalf("replayed requests = %v", ran)
+	}
+}
+
+func TestDownloadQueuePauseRetryAndRemove(t *testing.T) {
+	dir := t.TempDir()
+	var fail atomic.Bool
+	fail.Store(true)
+	q := newDownloadQueue(func(req DownloadRequest) *DownloadResponse {
+		if fail.Load() {
+			return &DownloadResponse{Success: false, Error: "All providers failed", ErrorType: "not_found"}
+		}
+		return &DownloadResponse{Success: true}
+	})
+	if err := q.open(dir); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	q.setPaused(true)
+	q.enqueue([]DownloadRequest{{ItemID: "x"}, {ItemID: "y"}, {ItemID: "z", OutputFD: 9}})
+	q.start()
+
+	if !q.pauseItem("y") {
+		t.Fatal("expected queued item to pause")
+	}
+	if q.remove("missing") {
+		t.Fatal("removing an unknown item should report false")
+	}
+	q.setPaused(false)
+	waitForQueueCondition(t, q, func(s downloadQueueSnapshot) bool {
+		return queueJobStatuses(s)["x"] == queueJobStatusFailed
+	})
+	if status := queueJobStatuses(q.snapshot())["y"]; status != queueJobStatusPaused {
+		t.Fatalf("paused item status = %q", status)
+	}
+	if _, ok := queueJobStatuses(q.snapshot())["z"]; ok {
+		t.Fatal("fd-backed request must not be queued")
+	}
+
+	fail.Store(false)
+	if retried := q.retry(""); retried != 1 {
+		t.Fatalf("retried = %d, want 1", retried)
+	}
+	q.resumeItem("y")
+	waitForQueueCondition(t, q, func(s downloadQueueSnapshot) bool {
+		statuses := queueJobStatuses(s)
+		return statuses["x"] == queueJobStatusCompleted && statuses["y"] == queueJobStatusCompleted
+	})
+	if removed := q.clearFinished(); removed != 2 {
+		t.Fatalf("cleared = %d, want 2", removed)
+	}
+
+	reopened := newDownloadQueue(func(req DownloadRequest) *DownloadResponse { return &DownloadResponse{Success: true} })
+	if err := reopened.open(dir); err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if snapshot := reopened.snapshot(); len(snapshot.Jobs) != 0 || snapshot.Paused {
+		t.Fatalf("reopened snapshot = %+v", snapshot)
+	}
+}
+
+func TestDownloadQueuePauseThenImmediateResume(t *testing.T) {
+	var calls atomic.Int32
+	started, windDown := make(chan struct{}), make(chan struct{})
+	q := newDownloadQueue(func(req DownloadRequest) *DownloadResponse {
+		ctx := initDownloadCancel(req.ItemID)
+		defer clearDownloadCancel(req.ItemID)
+		if calls.Add(1) == 1 {
+			close(started)
+			<-ctx.Done()
+			<-windDown // still tearing down when the resume arrives
+			return &DownloadResponse{Success: false, Error: "cancelled", ErrorType: "cancelled"}
+		}
+		if isDownloadCancelled(req.ItemID) {
+			return &DownloadResponse{Success: false, Error: "cancelled", ErrorType: "cancelled"}
+		}
+		return &DownloadResponse{Success: true}
+	})
+	q.enqueue([]DownloadRequest{{ItemID: "pr"}})
+	q.start()
+	<-started
+
+	if !q.pauseItem("pr") || !q.resumeItem("pr") {
+		t.Fatal("pause/resume rejected")
+	}
+	if calls.Load() != 1 {
+		t.Fatal("resume started a second run while the first was in flight")
+	}
+	close(windDown)
+
+	snapshot := waitForQueueCondition(t, q, func(s downloadQueueSnapshot) bool {
+		status := queueJobStatuses(s)["pr"]
+		return status == queueJobStatusCompleted || status == queueJobStatusCancelled || status == queueJobStatusFailed
+	})
+	if status := queueJobStatuses(snapshot)["pr"]; status != queueJobStatusCompleted || calls.Load() != 2 {
+		t.Fatalf("status = %s after %d run(s), want completed after 2", status, calls.Load())
+	}
+}
@@ -0,0 +1,127 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	downloadResumeManifestVersion = 1
+	// downloadResumeCheckpointBytes is how much is streamed between fsync +
+	// manifest rewrites. A killed process loses at most this much.
+	downloadResumeCheckpointBytes = 4 * 1024 * 1024
+)
+
+// downloadResumeManifest is the sidecar written next to a staged download so
+// a later file.download call for the same output can continue with a
+// conditional Range request after the process was killed.
+type downloadResumeManifest struct {
+	Version int    `json:"version"`
+	URL     string `json:"url"`
+	// ResumeKey identifies the remote object when the extension passes one;
+	// signed URLs change between calls, so the URL alone cannot.
+	ResumeKey      string `json:"resume_key,omitempty"`
+	ETag           string `json:"etag,omitempty"`
+	LastModified   string `json:"last_modified,omitempty"`
+	ExpectedLength int64  `json:"expected_length,omitempty"`
+	// BytesWritten counts only bytes fsynced to the staged file.
+	BytesWritten int64 `json:"bytes_written"`
+	UpdatedAt    int64 `json:"updated_at"`
+}
+
+func downloadResumeManifestPath(finalPath string) string {
+	return stagedDownloadPath(finalPath) + ".json"
+}
+
+// validator returns the If-Range value for the manifest. Weak ETags were
+// never recorded, so the ETag wins when present.
+func (m *downloadResumeManifest) validator() string {
+	if m == nil {
+		return ""
+	}
+	if m.ETag != "" {
+		return m.ETag
+	}
+	return m.LastModified
+}
+
+func (m *downloadResumeManifest) matches(urlStr, resumeKey string) bool {
+	if resumeKey != "" || m.ResumeKey != "" {
+		return m.ResumeKey == resumeKey
+	}
+	return m.URL == urlStr
+}
+
+// loadDownloadResumeManifest returns the manifest for finalPath when it
+// belongs to the same remote object and its staged file still holds at least
+// BytesWritten bytes. Anything else is treated as no resume state.
+func loadDownloadResumeManifest(finalPath, urlStr, resumeKey string) *downloadResumeManifest {
+	data, err := os.ReadFile(downloadResumeManifestPath(finalPath))
+	if err != nil {
+		return nil
+	}
+	var manifest downloadResumeManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		GoLog("[DownloadResume] Ignoring unreadable manifest for %s: %v\n", finalPath, err)
+		return nil
+	}
+	if manifest.Version != downloadResumeManifestVersion || manifest.validator() == "" ||
+		manifest.BytesWritten <= 0 || !manifest.matches(urlStr, resumeKey) {
+		return nil
+	}
+	if manifest.ExpectedLength > 0 && manifest.BytesWritten >= manifest.ExpectedLength {
+		return nil
+	}
+	info, err := os.Stat(stagedDownloadPath(finalPath))
+	if err != nil || !info.Mode().IsRegular() || info.Size() < manifest.BytesWritten {
+		return nil
+	}
+	return &manifest
+}
+
+func saveDownloadResumeManifest(finalPath string, manifest *downloadResumeManifest) error {
+	manifest.Version = downloadResumeManifestVersion
+	manifest.UpdatedAt = time.Now().Unix()
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	path := downloadResumeManifestPath(finalPath)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// discardDownloadResumeState removes the staged file and its manifest.
+func discardDownloadResumeState(finalPath string) {
+	os.Remove(stagedDownloadPath(finalPath))
+	os.Remove(downloadResumeManifestPath(finalPath))
+}
+
+// newDownloadResumeManifest captures the identity of a response that can be
+// resumed later, or nil when it carries no usable If-Range validator.
+func newDownloadResumeManifest(urlStr, resumeKey string, h http.Header, expectedLength int64) *downloadResumeManifest {
+	manifest := &downloadResumeManifest{
+		URL:            urlStr,
+		ResumeKey:      resumeKey,
+		LastModified:   strings.TrimSpace(h.Get("Last-Modified")),
+		ExpectedLength: expectedLength,
+	}
+	if etag := strings.TrimSpace(h.Get("ETag")); etag != "" && !strings.HasPrefix(etag, "W/") {
+		manifest.ETag = etag
+	}
+	if manifest.validator() == "" {
+		return nil
+	}
+	return manifest
+}
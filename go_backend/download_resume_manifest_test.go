@@ -0,0 +1,206 @@
+package gobackend
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dop251/goja"
+)
+
+// failingReader returns data and then a network error instead of EOF.
+type failingReader struct {
+	r io.Reader
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset by peer")
+	}
+	return n, err
+}
+
+// restartServer serves body with a strong ETag. While failing is set, full
+// responses break after cutAt bytes and Range requests answer 503, which is
+// what a killed process looks like from the next call's point of view.
+type restartServer struct {
+	body    []byte
+	etag    string
+	cutAt   int
+	failing bool
+	ranges  []string
+}
+
+func (s *restartServer) roundTrip(req *http.Request) (*http.Response, error) {
+	header := make(http.Header)
+	header.Set("ETag", s.etag)
+	rangeHeader := req.Header.Get("Range")
+	if rangeHeader != "" {
+		s.ranges = append(s.ranges, rangeHeader)
+		if s.failing {
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Header: header, Body: io.NopCloser(bytes.NewReader(nil)), Request: req}, nil
+		}
+		var start int
+		if _, err := fmt.Sscanf(rangeHeader, "bytes=%d-", &start); err != nil {
+			return nil, err
+		}
+		if req.Header.Get("If-Range") == s.etag {
+			header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(s.body)-1, len(s.body)))
+			return &http.Response{
+				StatusCode:    http.StatusPartialContent,
+				Header:        header,
+				Body:          io.NopCloser(bytes.NewReader(s.body[start:])),
+				ContentLength: int64(len(s.body) - start),
+				Request:       req,
+			}, nil
+		}
+	}
+	var body io.Reader = bytes.NewReader(s.body)
+	if s.failing {
+		body = &failingReader{r: bytes.NewReader(s.body[:s.cutAt])}
+	}
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        header,
+		Body:          io.NopCloser(body),
+		ContentLength: int64(len(s.body)),
+		Request:       req,
+	}, nil
+}
+
+func newResumeTestRuntime(t *testing.T, server *restartServer) (*extensionRuntime, *goja.Runtime, string) {
+	t.Helper()
+	vm := goja.New()
+	dir := t.TempDir()
+	SetAllowedDownloadDirs(nil)
+	t.Cleanup(func() { SetAllowedDownloadDirs(nil) })
+	runtime := &extensionRuntime{
+		extensionID: "resume-ext",
+		manifest: &ExtensionManifest{
+			Name:        "resume-ext",
+			Permissions: ExtensionPermissions{File: true, Network: []string{"files.example.com"}},
+		},
+		dataDir:    dir,
+		vm:         vm,
+		httpClient: &http.Client{Transport: roundTripFunc(server.roundTrip)},
+	}
+	runtime.downloadClient = runtime.httpClient
+	return runtime, vm, dir
+}
+
+func TestFileDownloadResumesStagedBytesOnNextCall(t *testing.T) {
+	server := &restartServer{
+		body:    parallelTestBody(downloadResumeCheckpointBytes + 300*1024),
+		etag:    `"object-v1"`,
+		cutAt:   downloadResumeCheckpointBytes + 100*1024,
+		failing: true,
+	}
+	runtime, vm, dir := newResumeTestRuntime(t, server)
+	download := func(url string) map[string]any {
+		return runtime.fileDownload(goja.FunctionCall{Arguments: []goja.Value{
+			vm.ToValue(url),
+			vm.ToValue("downloads/album/track.flac"),
+			vm.ToValue(map[string]any{"resume": true}),
+		}}).Export().(map[string]any)
+	}
+	finalPath := filepath.Join(dir, "downloads/album/track.flac")
+
+	if first := download("https://files.example.com/track"); first["success"] != false {
+		t.Fatalf("interrupted download = %#v", first)
+	}
+	manifest := loadDownloadResumeManifest(finalPath, "https://files.example.com/track", "")
+	if manifest == nil {
+		t.Fatal("interrupted download left no resume manifest")
+	}
+	if manifest.BytesWritten != downloadResumeCheckpointBytes+100*1024 || manifest.ETag != server.etag ||
+		manifest.ExpectedLength != int64(len(server.body)) {
+		t.Fatalf("manifest = %+v", manifest)
+	}
+
+	server.failing = false
+	server.ranges = nil
+	second := download("https://files.example.com/track")
+	if second["success"] != true || second["resumed"] != true {
+		t.Fatalf("resumed download = %#v", second)
+	}
+	want := fmt.Sprintf("bytes=%d-", manifest.BytesWritten)
+	if len(server.ranges) != 1 || server.ranges[0] != want {
+		t.Fatalf("range requests = %v, want [%s]", server.ranges, want)
+	}
+	data, err := os.ReadFile(finalPath)
+	if err != nil || !bytes.Equal(data, server.body) {
+		t.Fatalf("resumed file mismatch: %d bytes, err=%v", len(data), err)
+	}
+	for _, leftover := range []string{stagedDownloadPath(finalPath), downloadResumeManifestPath(finalPath)} {
+		if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+			t.Fatalf("%s left behind: %v", leftover, err)
+		}
+	}
+}
+
+func TestFileDownloadIgnoresResumeStateForOtherObject(t *testing.T) {
+	server := &restartServer{
+		body:    parallelTestBody(downloadResumeCheckpointBytes + 64*1024),
+		etag:    `"object-v1"`,
+		cutAt:   downloadResumeCheckpointBytes + 1024,
+		failing: true,
+	}
+	runtime, vm, dir := newResumeTestRuntime(t, server)
+	download := func(url string) map[string]any {
+		return runtime.fileDownload(goja.FunctionCall{Arguments: []goja.Value{
+			vm.ToValue(url),
+			vm.ToValue("track.flac"),
+			vm.ToValue(map[string]any{"resume": true}),
+		}}).Export().(map[string]any)
+	}
+	download("https://files.example.com/a")
+
+	server.failing = false
+	server.ranges = nil
+	server.etag = `"object-v2"`
+	result := download("https://files.example.com/b")
+	if result["success"] != true || result["resumed"] != false {
+		t.Fatalf("download = %#v", result)
+	}
+	if len(server.ranges) != 0 {
+		t.Fatalf("resumed another URL's staged bytes: %v", server.ranges)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "track.flac"))
+	if err != nil || !bytes.Equal(data, server.body) {
+		t.Fatalf("file mismatch: %d bytes, err=%v", len(data), err)
+	}
+}
+
+func TestDownloadResumeManifestMatching(t *testing.T) {
+	dir := t.TempDir()
+	finalPath := filepath.Join(dir, "song.flac")
+	if err := os.WriteFile(stagedDownloadPath(finalPath), make([]byte, 10), 0644); err != nil {
+		t.Fatal(err)
+	}
+	manifest := &downloadResumeManifest{URL: "https://cdn/a?sig=1", ResumeKey: "track-1:lossless", ETag: `"e"`, ExpectedLength: 20, BytesWritten: 10}
+	if err := saveDownloadResumeManifest(finalPath, manifest); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if loadDownloadResumeManifest(finalPath, "https://cdn/a?sig=2", "track-1:lossless") == nil {
+		t.Fatal("resume key should match across re-signed URLs")
+	}
+	if loadDownloadResumeManifest(finalPath, "https://cdn/a?sig=1", "") != nil {
+		t.Fatal("manifest with a resume key matched a call without one")
+	}
+	manifest.BytesWritten = 11
+	if err := saveDownloadResumeManifest(finalPath, manifest); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if loadDownloadResumeManifest(finalPath, "", "track-1:lossless") != nil {
+		t.Fatal("manifest claiming more bytes than staged was accepted")
+	}
+	if !isLibraryStagingFile(downloadResumeManifestPath(finalPath)) {
+		t.Fatal("resume manifest should be treated as a staging file")
+	}
+}
@@ -0,0 +1,402 @@
+package gobackend
+
+// DSD support for the two common containers: Sony's DSF and Philips' DSDIFF
+// (.dff). Both carry their tags as an ID3v2 tag, so reading goes through
+// readID3v2FromBytes and writing through buildID3v24Tag like WAV/AIFF.
+//
+// DSF puts the tag at the end of the file, addressed by the metadata pointer
+// in the "DSD " header. DSDIFF has no official tag chunk; the de facto
+// standard is a top-level "ID3 " chunk, which is what other taggers write.
+// DSDIFF sizes are 64-bit big-endian, so it is rewritten with
+// writeID3ChunkSized.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DSDQuality describes a DSD stream. SampleRate is the 1-bit rate (2822400
+// for DSD64); DSDRate is its multiple of 44.1 kHz (or 48 kHz) as a label.
+// Compressed is set for DST-compressed DSDIFF.
+type DSDQuality struct {
+	SampleRate   int
+	BitDepth     int
+	Channels     int
+	Duration     int
+	TotalSamples int64
+	DSDRate      string
+	Compressed   bool
+}
+
+const (
+	dsfHeaderSize  = 28
+	dsfFmtSize     = 52
+	dffFormHeader  = 16
+	dffChunkHeader = 12
+	id3ChunkDFF    = "ID3 "
+)
+
+type dsdProbe struct {
+	sampleRate  int
+	channels    int
+	sampleCount int64 // per channel
+	compressed  bool
+	// DST streams only give a frame count at 75 frames per second.
+	dstFrames    int64
+	dstFrameRate int
+	id3          []byte
+}
+
+// dsdRateLabel names a 1-bit rate as a multiple of 44.1 kHz ("DSD64"),
+// falling back to 48 kHz multiples for the rarer 48k family.
+func dsdRateLabel(sampleRate int) string {
+	switch {
+	case sampleRate <= 0:
+		return ""
+	case sampleRate%44100 == 0:
+		return fmt.Sprintf("DSD%d", sampleRate/44100)
+	case sampleRate%48000 == 0:
+		return fmt.Sprintf("DSD%d", sampleRate/48000)
+	}
+	return fmt.Sprintf("DSD (%d Hz)", sampleRate)
+}
+
+// streamProbeDSF reads the "DSD " and "fmt " chunks and the trailing ID3v2
+// tag, if the metadata pointer names one.
+func streamProbeDSF(f *os.File) (*dsdProbe, error) {
+	header := make([]byte, dsfHeaderSize)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return nil, err
+	}
+	if string(header[0:4]) != "DSD " {
+		return nil, fmt.Errorf("not a DSF file")
+	}
+	metaOffset := int64(binary.LittleEndian.Uint64(header[20:28]))
+
+	fmtChunk := make([]byte, dsfFmtSize)
+	if _, err := io.ReadFull(f, fmtChunk); err != nil {
+		return nil, err
+	}
+	if string(fmtChunk[0:4]) != "fmt " {
+		return nil, fmt.Errorf("DSF fmt chunk not found")
+	}
+	p := &dsdProbe{
+		channels:    int(binary.LittleEndian.Uint32(fmtChunk[24:28])),
+		sampleRate:  int(binary.LittleEndian.Uint32(fmtChunk[28:32])),
+		sampleCount: int64(binary.LittleEndian.Uint64(fmtChunk[36:44])),
+	}
+
+	if metaOffset > 0 {
+		if info, err := f.Stat(); err == nil {
+			size := info.Size() - metaOffset
+			if size > 10 && size <= wavMaxMetaChunk {
+				buf := make([]byte, size)
+				if _, err := f.ReadAt(buf, metaOffset); err == nil {
+					p.id3 = buf
+				}
+			}
+		}
+	}
+	return p, nil
+}
+
+// streamProbeDFF walks the top-level FRM8 chunks, descending into PROP for
+// the sound properties and buffering only the "ID3 " chunk.
+func streamProbeDFF(f *os.File) (*dsdProbe, error) {
+	header := make([]byte, dffFormHeader)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return nil, err
+	}
+	if string(header[0:4]) != "FRM8" || string(header[12:16]) != "DSD " {
+		return nil, fmt.Errorf("not a DSDIFF file")
+	}
+
+	p := &dsdProbe{}
+	hdr := make([]byte, dffChunkHeader)
+	for {
+		if _, err := io.ReadFull(f, hdr); err != nil {
+			break
+		}
+		id := string(hdr[0:4])
+		size := int64(binary.BigEndian.Uint64(hdr[4:12]))
+		pad := size & 1
+
+		switch id {
+		case "PROP":
+			if size < 4 || size > wavMaxMetaChunk {
+				return nil, fmt.Errorf("bad DSDIFF PROP chunk")
+			}
+			buf := make([]byte, size)
+			if _, err := io.ReadFull(f, buf); err != nil {
+				return nil, err
+			}
+			parseDFFProperties(buf, p)
+			f.Seek(pad, io.SeekCurrent)
+		case "DSD ":
+			if p.channels > 0 {
+				p.sampleCount = size * 8 / int64(p.channels)
+			}
+			f.Seek(size+pad, io.SeekCurrent)
+		case "DST ":
+			p.compressed = true
+			frte := make([]byte, dffChunkHeader+6)
+			if size >= int64(len(frte)) {
+				if _, err := io.ReadFull(f, frte); err == nil && string(frte[0:4]) == "FRTE" {
+					p.dstFrames = int64(binary.BigEndian.Uint32(frte[12:16]))
+					p.dstFrameRate = int(binary.BigEndian.Uint16(frte[16:18]))
+				}
+				f.Seek(size+pad-int64(len(frte)), io.SeekCurrent)
+			} else {
+				f.Seek(size+pad, io.SeekCurrent)
+			}
+		case id3ChunkDFF:
+			if size > 0 && size <= wavMaxMetaChunk {
+				buf := make([]byte, size)
+				if _, err := io.ReadFull(f, buf); err == nil {
+					p.id3 = buf
+				}
+				f.Seek(pad, io.SeekCurrent)
+			} else {
+				f.Seek(size+pad, io.SeekCurrent)
+			}
+		default:
+			f.Seek(size+pad, io.SeekCurrent)
+		}
+	}
+	if p.sampleRate == 0 {
+		return nil, fmt.Errorf("DSDIFF sample rate not found")
+	}
+	return p, nil
+}
+
+// parseDFFProperties reads the FS, CHNL and CMPR chunks of a PROP "SND "
+// chunk.
+func parseDFFProperties(buf []byte, p *dsdProbe) {
+	if string(buf[0:4]) != "SND " {
+		return
+	}
+	pos := 4
+	for pos+dffChunkHeader <= len(buf) {
+		id := string(buf[pos : pos+4])
+		size := int(binary.BigEndian.Uint64(buf[pos+4 : pos+12]))
+		pos += dffChunkHeader
+		if size < 0 || pos+size > len(buf) {
+			break
+		}
+		data := buf[pos : pos+size]
+		switch id {
+		case "FS  ":
+			if len(data) >= 4 {
+				p.sampleRate = int(binary.BigEndian.Uint32(data[0:4]))
+			}
+		case "CHNL":
+			if len(data) >= 2 {
+				p.channels = int(binary.BigEndian.Uint16(data[0:2]))
+			}
+		case "CMPR":
+			if len(data) >= 4 && string(data[0:4]) == "DST " {
+				p.compressed = true
+			}
+		}
+		pos += size + size&1
+	}
+}
+
+func isDFFPath(filePath string) bool {
+	return strings.EqualFold(filepath.Ext(filePath), ".dff")
+}
+
+func probeDSDFile(filePath string) (*dsdProbe, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if isDFFPath(filePath) {
+		return streamProbeDFF(f)
+	}
+	return streamProbeDSF(f)
+}
+
+// GetDSDQuality probes a DSF or DSDIFF file, picked by extension.
+func GetDSDQuality(filePath string) (*DSDQuality, error) {
+	p, err := probeDSDFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	q := &DSDQuality{
+		SampleRate:   p.sampleRate,
+		BitDepth:     1,
+		Channels:     p.channels,
+		TotalSamples: p.sampleCount,
+		DSDRate:      dsdRateLabel(p.sampleRate),
+		Compressed:   p.compressed,
+	}
+	switch {
+	case p.compressed && p.dstFrameRate > 0:
+		q.Duration = int(p.dstFrames / int64(p.dstFrameRate))
+		q.TotalSamples = p.dstFrames * int64(p.sampleRate) / int64(p.dstFrameRate)
+	case p.sampleRate > 0:
+		q.Duration = int(p.sampleCount / int64(p.sampleRate))
+	}
+	return q, nil
+}
+
+// ReadDSDTags reads the ID3v2 tag of a DSF or DSDIFF file.
+func ReadDSDTags(filePath string) (*AudioMetadata, error) {
+	p, err := probeDSDFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.id3) == 0 {
+		return nil, fmt.Errorf("no DSD tags found")
+	}
+	return readID3v2FromBytes(p.id3)
+}
+
+// WriteDSDTags writes/merges tags into a DSF trailing tag or a DSDIFF
+// "ID3 " chunk.
+func WriteDSDTags(filePath string, fields map[string]string) error {
+	existing, _ := ReadDSDTags(filePath)
+	meta := mergeEditFieldsOntoExisting(existing, fields)
+
+	coverData, coverMIME, err := loadCoverForTag(fields)
+	if err != nil {
+		return err
+	}
+	if coverData == nil {
+		if p, perr := probeDSDFile(filePath); perr == nil && len(p.id3) > 0 {
+			coverData, coverMIME = extractAPICFromID3(p.id3)
+		}
+	}
+
+	tag := buildID3v24Tag(meta, coverData, coverMIME)
+	if isDFFPath(filePath) {
+		return writeID3ChunkSized(filePath, "FRM8", id3ChunkDFF, false, 8, tag)
+	}
+	return writeDSFTag(filePath, tag)
+}
+
+// writeDSFTag rewrites filePath with id3 as its trailing tag: the header,
+// fmt and data chunks are copied, any old tag is dropped and the file size
+// and metadata pointer are patched.
+func writeDSFTag(filePath string, id3 []byte) error {
+	in, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	header := make([]byte, dsfHeaderSize)
+	if _, err := io.ReadFull(in, header); err != nil {
+		return err
+	}
+	if string(header[0:4]) != "DSD " {
+		return fmt.Errorf("unexpected container magic %q", string(header[0:4]))
+	}
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	// The audio ends after the data chunk; the tag, if any, follows it.
+	audioEnd := int64(dsfHeaderSize)
+	hdr := make([]byte, dffChunkHeader)
+	for audioEnd+dffChunkHeader <= info.Size() {
+		if _, err := in.ReadAt(hdr, audioEnd); err != nil {
+			return err
+		}
+		size := int64(binary.LittleEndian.Uint64(hdr[4:12]))
+		if size < dffChunkHeader || audioEnd+size > info.Size() {
+			return fmt.Errorf("bad DSF %q chunk", string(hdr[0:4]))
+		}
+		audioEnd += size
+		if string(hdr[0:4]) == "data" {
+			break
+		}
+	}
+
+	tmpPath := filePath + ".tagtmp"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	cleanup := func() {
+		out.Close()
+		os.Remove(tmpPath)
+	}
+
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return err
+	}
+	if _, err := io.CopyN(out, in, audioEnd); err != nil {
+		cleanup()
+		return err
+	}
+	if _, err := out.Write(id3); err != nil {
+		cleanup()
+		return err
+	}
+
+	// Patch the total size (bytes 12..20) and metadata pointer (20..28).
+	sizes := make([]byte, 16)
+	binary.LittleEndian.PutUint64(sizes[0:8], uint64(audioEnd+int64(len(id3))))
+	binary.LittleEndian.PutUint64(sizes[8:16], uint64(audioEnd))
+	if _, err := out.WriteAt(sizes, 12); err != nil {
+		cleanup()
+		return err
+	}
+
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	in.Close()
+
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	syncDir(filepath.Dir(filePath))
+	return nil
+}
+
+// extractDSDCover returns the embedded cover art from a DSF or DSDIFF tag.
+func extractDSDCover(filePath string) ([]byte, string, error) {
+	p, err := probeDSDFile(filePath)
+	if err != nil {
+		return nil, "", err
+	}
+	data, mime := extractAPICFromID3(p.id3)
+	if len(data) == 0 {
+		return nil, "", fmt.Errorf("no embedded cover")
+	}
+	return data, mime, nil
+}
+
+func scanDSDFile(filePath string, result *LibraryScanResult, displayNameHint string) (*LibraryScanResult, error) {
+	if metadata, err := ReadDSDTags(filePath); err == nil && metadata != nil {
+		applyAudioMetadataToScan(metadata, result)
+	}
+	if quality, err := GetDSDQuality(filePath); err == nil {
+		result.BitDepth = quality.BitDepth
+		result.SampleRate = quality.SampleRate
+		result.Duration = quality.Duration
+	} else {
+		GoLog("[LibraryScan] DSD header error for %s: %v\n", filePath, err)
+	}
+	result.Bitrate = 0 // lossless 1-bit
+	result.Format = strings.TrimPrefix(strings.ToLower(filepath.Ext(filePath)), ".")
+	applyDefaultLibraryMetadata(filePath, displayNameHint, result)
+	return result, nil
+}
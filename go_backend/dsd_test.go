@@ -0,0 +1,182 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestDSF writes a stereo DSD64 DSF with one second of audio.
+func writeTestDSF(t *testing.T, path string) {
+	t.Helper()
+	const sampleRate = 2822400
+	audio := make([]byte, 2*sampleRate/8)
+
+	var out bytes.Buffer
+	out.WriteString("DSD ")
+	_ = binary.Write(&out, binary.LittleEndian, uint64(dsfHeaderSize))
+	_ = binary.Write(&out, binary.LittleEndian, uint64(dsfHeaderSize+dsfFmtSize+12+len(audio)))
+	_ = binary.Write(&out, binary.LittleEndian, uint64(0))
+
+	fmtChunk := make([]byte, dsfFmtSize)
+	copy(fmtChunk[0:4], "fmt ")
+	binary.LittleEndian.PutUint64(fmtChunk[4:12], dsfFmtSize)
+	binary.LittleEndian.PutUint32(fmtChunk[12:16], 1)
+	binary.LittleEndian.PutUint32(fmtChunk[20:24], 2)
+	binary.LittleEndian.PutUint32(fmtChunk[24:28], 2)
+	binary.LittleEndian.PutUint32(fmtChunk[28:32], sampleRate)
+	binary.LittleEndian.PutUint32(fmtChunk[32:36], 1)
+	binary.LittleEndian.PutUint64(fmtChunk[36:44], sampleRate)
+	binary.LittleEndian.PutUint32(fmtChunk[44:48], 4096)
+	out.Write(fmtChunk)
+
+	out.WriteString("data")
+	_ = binary.Write(&out, binary.LittleEndian, uint64(12+len(audio)))
+	out.Write(audio)
+	if err := os.WriteFile(path, out.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTestDFF writes a stereo DSD128 DSDIFF with two seconds of audio.
+func writeTestDFF(t *testing.T, path string) {
+	t.Helper()
+	const sampleRate = 5644800
+	chunk := func(out *bytes.Buffer, id string, data []byte) {
+		out.WriteString(id)
+		_ = binary.Write(out, binary.BigEndian, uint64(len(data)))
+		out.Write(data)
+		if len(data)&1 == 1 {
+			out.WriteByte(0)
+		}
+	}
+
+	var snd bytes.Buffer
+	snd.WriteString("SND ")
+	fs := make([]byte, 4)
+	binary.BigEndian.PutUint32(fs, sampleRate)
+	chunk(&snd, "FS  ", fs)
+	chunk(&snd, "CHNL", []byte{0, 2, 'S', 'L', 'F', 'T', 'S', 'R', 'G', 'T'})
+	chunk(&snd, "CMPR", []byte("DSD \x0enot compressed"))
+
+	var body bytes.Buffer
+	body.WriteString("DSD ")
+	chunk(&body, "FVER", []byte{1, 5, 0, 0})
+	chunk(&body, "PROP", snd.Bytes())
+	chunk(&body, "DSD ", make([]byte, 2*2*sampleRate/8))
+
+	var out bytes.Buffer
+	out.WriteString("FRM8")
+	_ = binary.Write(&out, binary.BigEndian, uint64(body.Len()))
+	out.Write(body.Bytes())
+	if err := os.WriteFile(path, out.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetDSDQuality(t *testing.T) {
+	dir := t.TempDir()
+	dsf := filepath.Join(dir, "track.dsf")
+	dff := filepath.Join(dir, "track.dff")
+	writeTestDSF(t, dsf)
+	writeTestDFF(t, dff)
+
+	quality, err := GetDSDQuality(dsf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quality.SampleRate != 2822400 || quality.BitDepth != 1 || quality.Channels != 2 || quality.Duration != 1 || quality.DSDRate != "DSD64" {
+		t.Fatalf("DSF quality = %+v", quality)
+	}
+
+	quality, err = GetDSDQuality(dff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quality.SampleRate != 5644800 || quality.Channels != 2 || quality.Duration != 2 || quality.DSDRate != "DSD128" || quality.Compressed {
+		t.Fatalf("DFF quality = %+v", quality)
+	}
+
+	if got := dsdRateLabel(12288000); got != "DSD256" {
+		t.Fatalf("dsdRateLabel(12288000) = %q", got)
+	}
+	if container, err := sniffAudioContainer(dff); err != nil || container != "dff" {
+		t.Fatalf("sniff DFF = %q, %v", container, err)
+	}
+}
+
+func TestDSDMetadataRoundTrip(t *testing.T) {
+	cover := []byte{0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a, 1, 2, 3}
+	formats := []struct {
+		ext   string
+		write func(*testing.T, string)
+	}{
+		{ext: ".dsf", write: writeTestDSF},
+		{ext: ".dff", write: writeTestDFF},
+	}
+	for _, format := range formats {
+		t.Run(format.ext, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "track"+format.ext)
+			coverPath := filepath.Join(dir, "cover.png")
+			format.write(t, path)
+			if err := os.WriteFile(coverPath, cover, 0600); err != nil {
+				t.Fatal(err)
+			}
+			before, err := GetDSDQuality(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			metadataJSON, _ := json.Marshal(map[string]string{
+				"title":        "Judul",
+				"artist":       "Artis",
+				"album":        "Album",
+				"track_number": "4",
+				"cover_path":   coverPath,
+			})
+			responseJSON, err := EditFileMetadata(path, string(metadataJSON))
+			if err != nil {
+				t.Fatalf("EditFileMetadata: %v", err)
+			}
+			if !bytes.Contains([]byte(responseJSON), []byte(`"native_dsd"`)) {
+				t.Fatalf("EditFileMetadata response = %s", responseJSON)
+			}
+
+			// A second partial edit replaces the tag instead of stacking one.
+			if err := WriteDSDTags(path, map[string]string{"title": "Judul Baru"}); err != nil {
+				t.Fatal(err)
+			}
+			meta, err := ReadDSDTags(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if meta.Title != "Judul Baru" || meta.Artist != "Artis" || meta.Album != "Album" || meta.TrackNumber != 4 {
+				t.Fatalf("tags = %+v", meta)
+			}
+			extracted, mime, err := extractDSDCover(path)
+			if err != nil || mime != "image/png" || !bytes.Equal(extracted, cover) {
+				t.Fatalf("cover = %q %x, err=%v", mime, extracted, err)
+			}
+
+			after, err := GetDSDQuality(path)
+			if err != nil || *after != *before {
+				t.Fatalf("quality after tagging = %+v, want %+v (err=%v)", after, before, err)
+			}
+			if container, err := sniffAudioContainer(path); err != nil || checkAudioStream(path, container) != nil {
+				t.Fatalf("tagged file fails header check: %q, %v", container, err)
+			}
+
+			result, err := scanAudioFileWithKnownModTime(path, "", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.TrackName != "Judul Baru" || result.BitDepth != 1 || result.Format != format.ext[1:] {
+				t.Fatalf("scan = %+v", result)
+			}
+		})
+	}
+}
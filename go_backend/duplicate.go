@@ -7,6 +7,8 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -19,10 +21,17 @@ type isrcFileEntry struct {
 	size    int64
 	modTime int64  // UnixNano
 	isrc    string // uppercase; empty when the file carries no ISRC tag
+
+	// Secondary keys for files without (or with a different) ISRC.
+	artist      string            // normalizeLooseArtistName
+	title       string            // normalizeLooseTitle
+	durationSec int               // 0 when unknown
+	providerIDs map[string]string // "spotify"/"deezer"/"tidal"/"qobuz" -> track ID
 }
 
 type ISRCIndex struct {
 	index     map[string]string        // ISRC (uppercase) -> file path
+	secondary map[string]string        // secondary duplicate key -> file path
 	files     map[string]isrcFileEntry // file path -> cached parse result
 	outputDir string
 	buildTime atomic.Int64 // UnixNano of the last build or write
@@ -34,42 +43,177 @@ var (
 	isrcIndexCacheMu sync.RWMutex
 	isrcBuildingMu   sync.Map // Per-directory build lock to prevent concurrent builds
 	isrcIndexTTL     = 5 * time.Minute
+	// isrcIndexInvalidated holds directories whose next lookup must walk the
+	// disk instead of trusting the persisted index.
+	isrcIndexInvalidated sync.Map
 
 	isrcIndexBuildWorkers = 4
 )
 
+const (
+	// Artist+title keys carry the duration in buckets of this many seconds;
+	// lookups probe the neighbouring buckets too.
+	duplicateDurationBucketSec = 2
+	// duplicateDurationToleranceSec is the largest duration difference that
+	// still counts as the same recording (provider edits, leading silence).
+	duplicateDurationToleranceSec = 3
+)
+
+// Match kinds reported by CheckFilesExistParallel. Provider ID matches are
+// reported as "<provider>_id".
+const (
+	duplicateMatchISRC                = "isrc"
+	duplicateMatchArtistTitleDuration = "artist_title_duration"
+	duplicateMatchArtistTitle         = "artist_title"
+)
+
+var duplicateProviders = []string{"spotify", "deezer", "tidal", "qobuz"}
+
+func providerDuplicateKey(provider, id string) string {
+	return "id:" + provider + ":" + id
+}
+
+func artistTitleDuplicateKey(artist, title string) string {
+	return "at:" + artist + "\x00" + title
+}
+
+func artistTitleDurationDuplicateKey(artist, title string, bucket int) string {
+	return "atd:" + artist + "\x00" + title + "\x00" + strconv.Itoa(bucket)
+}
+
+// secondaryKeys lists every non-ISRC key the file can be found under.
+func (e isrcFileEntry) secondaryKeys() []string {
+	var keys []string
+	for _, provider := range duplicateProviders {
+		if id := e.providerIDs[provider]; id != "" {
+			keys = append(keys, providerDuplicateKey(provider, id))
+		}
+	}
+	if e.artist != "" && e.title != "" {
+		keys = append(keys, artistTitleDuplicateKey(e.artist, e.title))
+		if e.durationSec > 0 {
+			keys = append(keys, artistTitleDurationDuplicateKey(e.artist, e.title, e.durationSec/duplicateDurationBucketSec))
+		}
+	}
+	return keys
+}
+
+// indexEntryLocked records entry under all of its keys. Callers hold idx.mu
+// for writing, or own idx exclusively during a build.
+func (idx *ISRCIndex) indexEntryLocked(path string, entry isrcFileEntry) {
+	if entry.isrc != "" {
+		idx.index[entry.isrc] = path
+	}
+	keys := entry.secondaryKeys()
+	if len(keys) > 0 && idx.secondary == nil {
+		idx.secondary = make(map[string]string)
+	}
+	for _, key := range keys {
+		idx.secondary[key] = path
+	}
+}
+
 func (idx *ISRCIndex) isFresh() bool {
 	return time.Since(time.Unix(0, idx.buildTime.Load())) < isrcIndexTTL
 }
 
-func GetISRCIndex(outputDir string) *ISRCIndex {
+func cachedISRCIndex(outputDir string) (*ISRCIndex, bool) {
 	isrcIndexCacheMu.RLock()
 	idx, exists := isrcIndexCache[outputDir]
 	isrcIndexCacheMu.RUnlock()
+	return idx, exists
+}
+
+func isrcBuildLock(outputDir string) *sync.Mutex {
+	buildLock, _ := isrcBuildingMu.LoadOrStore(outputDir, &sync.Mutex{})
+	return buildLock.(*sync.Mutex)
+}
 
-	if exists && idx.isFresh() {
+// GetISRCIndex returns the index for outputDir. A stale index is still
+// returned while a background walk picks up changes: on a large SD-card
+// library the walk alone takes long enough to stall the download screen.
+// Only the first lookup without a persisted index waits for a build.
+func GetISRCIndex(outputDir string) *ISRCIndex {
+	if idx, exists := cachedISRCIndex(outputDir); exists {
+		if !idx.isFresh() {
+			refreshISRCIndexAsync(outputDir)
+		}
 		return idx
 	}
 
-	buildLock, _ := isrcBuildingMu.LoadOrStore(outputDir, &sync.Mutex{})
-	mu := buildLock.(*sync.Mutex)
+	idx, restored := restoreOrBuildISRCIndex(outputDir, true)
+	if restored {
+		refreshISRCIndexAsync(outputDir)
+	}
+	return idx
+}
+
+// restoreOrBuildISRCIndex loads the persisted index for outputDir, falling
+// back to a full build when there is none (or, with build unset, returning
+// nil). restored reports that the index came from disk and still needs a
+// walk for changes made while the app was not running.
+func restoreOrBuildISRCIndex(outputDir string, build bool) (idx *ISRCIndex, restored bool) {
+	mu := isrcBuildLock(outputDir)
 	mu.Lock()
 	defer mu.Unlock()
 
-	isrcIndexCacheMu.RLock()
-	idx, exists = isrcIndexCache[outputDir]
-	isrcIndexCacheMu.RUnlock()
+	if idx, exists := cachedISRCIndex(outputDir); exists {
+		return idx, false
+	}
+	if _, invalidated := isrcIndexInvalidated.Load(outputDir); !invalidated {
+		if idx := restoreISRCIndex(outputDir); idx != nil {
+			return idx, true
+		}
+	}
+	if !build {
+		return nil, false
+	}
+	return buildISRCIndex(outputDir), false
+}
 
-	if exists && idx.isFresh() {
-		return idx
+// restoreISRCIndex publishes the persisted index for outputDir without
+// touching the library. Its build time is left at zero so the first lookup
+// schedules a refresh.
+func restoreISRCIndex(outputDir string) *ISRCIndex {
+	files := loadPersistedISRCFiles(outputDir)
+	if files == nil {
+		return nil
 	}
+	idx := &ISRCIndex{
+		index:     make(map[string]string),
+		secondary: make(map[string]string),
+		files:     files,
+		outputDir: outputDir,
+	}
+	for path, entry := range files {
+		idx.indexEntryLocked(path, entry)
+	}
+
+	isrcIndexCacheMu.Lock()
+	isrcIndexCache[outputDir] = idx
+	isrcIndexCacheMu.Unlock()
+
+	GoLog("[ISRCIndex] Restored persisted index for %s: %d files\n", outputDir, len(files))
+	return idx
+}
 
-	return buildISRCIndex(outputDir)
+// refreshISRCIndexAsync rebuilds the index for outputDir in the background
+// unless a build is already running.
+func refreshISRCIndexAsync(outputDir string) {
+	mu := isrcBuildLock(outputDir)
+	if !mu.TryLock() {
+		return
+	}
+	go func() {
+		defer mu.Unlock()
+		buildISRCIndex(outputDir)
+	}()
 }
 
 func buildISRCIndex(outputDir string) *ISRCIndex {
 	idx := &ISRCIndex{
 		index:     make(map[string]string),
+		secondary: make(map[string]string),
 		files:     make(map[string]isrcFileEntry),
 		outputDir: outputDir,
 	}
@@ -92,6 +236,11 @@ func buildISRCIndex(outputDir string) *ISRCIndex {
 		prev.mu.RUnlock()
 	}
 	isrcIndexCacheMu.RUnlock()
+	if len(prevFiles) == 0 {
+		if persisted := loadPersistedISRCFiles(outputDir); persisted != nil {
+			prevFiles = persisted
+		}
+	}
 
 	startTime := time.Now()
 	type parseTask struct {
@@ -116,9 +265,7 @@ func buildISRCIndex(outputDir string) *ISRCIndex {
 		modTime := info.ModTime().UnixNano()
 		if entry, ok := prevFiles[path]; ok && entry.size == size && entry.modTime == modTime {
 			idx.files[path] = entry
-			if entry.isrc != "" {
-				idx.index[entry.isrc] = path
-			}
+			idx.indexEntryLocked(path, entry)
 			reused++
 			return nil
 		}
@@ -127,9 +274,9 @@ func buildISRCIndex(outputDir string) *ISRCIndex {
 	})
 
 	if len(toParse) > 0 {
-		// New/changed files: read only their Vorbis comment block, in
+		// New/changed files: read only their tag blocks and duration, in
 		// parallel. Embedded cover art (megabytes per file) is never loaded.
-		isrcs := make([]string, len(toParse))
+		entries := make([]isrcFileEntry, len(toParse))
 		workerCount := isrcIndexBuildWorkers
 		if len(toParse) < workerCount {
 			workerCount = len(toParse)
@@ -141,7 +288,7 @@ func buildISRCIndex(outputDir string) *ISRCIndex {
 			go func() {
 				defer wg.Done()
 				for i := range tasks {
-					isrcs[i] = strings.ToUpper(readFileISRC(toParse[i].path))
+					entries[i] = readFileDuplicateEntry(toParse[i].path, toParse[i].size, toParse[i].modTime)
 				}
 			}()
 		}
@@ -152,20 +299,41 @@ func buildISRCIndex(outputDir string) *ISRCIndex {
 		wg.Wait()
 
 		for i, task := range toParse {
-			entry := isrcFileEntry{size: task.size, modTime: task.modTime, isrc: isrcs[i]}
-			idx.files[task.path] = entry
-			if entry.isrc != "" {
-				idx.index[entry.isrc] = task.path
-			}
+			idx.files[task.path] = entries[i]
+			idx.indexEntryLocked(task.path, entries[i])
 		}
 	}
 
 	fmt.Printf("[ISRCIndex] Built index for %s: %d files (%d parsed, %d cached) in %v\n",
 		outputDir, len(idx.files), len(toParse), reused, time.Since(startTime).Round(time.Millisecond))
 
+	// Downloads finishing during the walk were added to the previous index
+	// and may sit in a directory the walk had already passed.
+	adopted := 0
 	isrcIndexCacheMu.Lock()
+	if prev, ok := isrcIndexCache[outputDir]; ok {
+		prev.mu.RLock()
+		for path, entry := range prev.files {
+			if _, known := prevFiles[path]; known {
+				continue
+			}
+			if _, walked := idx.files[path]; !walked {
+				idx.files[path] = entry
+				idx.indexEntryLocked(path, entry)
+				adopted++
+			}
+		}
+		prev.mu.RUnlock()
+	}
 	isrcIndexCache[outputDir] = idx
 	isrcIndexCacheMu.Unlock()
+	isrcIndexInvalidated.Delete(outputDir)
+
+	if len(toParse) > 0 || adopted > 0 || len(idx.files) != len(prevFiles) {
+		if err := persistISRCIndex(idx); err != nil {
+			GoLog("[ISRCIndex] Failed to persist index for %s: %v\n", outputDir, err)
+		}
+	}
 
 	return idx
 }
@@ -180,72 +348,166 @@ var isrcIndexExts = map[string]bool{
 	".opus": true,
 }
 
+// readFileTags reads the tags using the native reader for the format.
+// Returns nil for unsupported formats, unreadable files, or missing tags.
+func readFileTags(path string) *AudioMetadata {
+	var meta *AudioMetadata
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".flac":
+		payload := readFlacVorbisPayload(path)
+		if payload == nil {
+			return nil
+		}
+		meta = &AudioMetadata{}
+		parseVorbisComments(payload, meta)
+		// parseVorbisComments stops after 100 comments; ISRC is the
+		// primary key, so find it however long the block is.
+		if meta.ISRC == "" {
+			meta.ISRC = vorbisCommentISRC(payload)
+		}
+	case ".mp3":
+		meta, err = ReadID3Tags(path)
+	case ".m4a":
+		meta, err = ReadM4ATags(path)
+	case ".ogg", ".opus":
+		meta, err = ReadOggVorbisComments(path)
+	}
+	if err != nil {
+		return nil
+	}
+	return meta
+}
+
 // readFileISRC reads the ISRC tag using the native reader for the format.
 // Returns "" for unsupported formats, unreadable files, or missing tags.
 func readFileISRC(path string) string {
+	if meta := readFileTags(path); meta != nil {
+		return strings.TrimSpace(meta.ISRC)
+	}
+	return ""
+}
+
+// readFileDurationSec reads the stream duration from the format headers;
+// 0 when unknown.
+func readFileDurationSec(path string) int {
 	switch strings.ToLower(filepath.Ext(path)) {
-	case ".flac":
-		return readFlacISRC(path)
-	case ".mp3":
-		if meta, err := ReadID3Tags(path); err == nil && meta != nil {
-			return strings.TrimSpace(meta.ISRC)
+	case ".flac", ".m4a":
+		if quality, err := GetAudioQuality(path); err == nil {
+			return quality.Duration
 		}
-	case ".m4a":
-		if meta, err := ReadM4ATags(path); err == nil && meta != nil {
-			return strings.TrimSpace(meta.ISRC)
+	case ".mp3":
+		if quality, err := GetMP3Quality(path); err == nil && quality != nil {
+			return quality.Duration
 		}
 	case ".ogg", ".opus":
-		if meta, err := ReadOggVorbisComments(path); err == nil && meta != nil {
-			return strings.TrimSpace(meta.ISRC)
+		if quality, err := GetOggQuality(path); err == nil && quality != nil {
+			return quality.Duration
 		}
 	}
-	return ""
+	return 0
+}
+
+// readFileDuplicateEntry reads every duplicate key of one file.
+func readFileDuplicateEntry(path string, size, modTime int64) isrcFileEntry {
+	entry := isrcFileEntry{size: size, modTime: modTime}
+	meta := readFileTags(path)
+	if meta == nil {
+		return entry
+	}
+	entry.isrc = strings.ToUpper(strings.TrimSpace(meta.ISRC))
+	entry.artist = normalizeLooseArtistName(meta.Artist)
+	entry.title = normalizeLooseTitle(meta.Title)
+	ids := map[string]string{
+		"spotify": strings.TrimSpace(meta.SpotifyID),
+		"deezer":  strings.TrimSpace(meta.DeezerID),
+		"tidal":   strings.TrimSpace(meta.TidalID),
+		"qobuz":   strings.TrimSpace(meta.QobuzID),
+	}
+	for provider, id := range ids {
+		if id == "" {
+			continue
+		}
+		if entry.providerIDs == nil {
+			entry.providerIDs = make(map[string]string)
+		}
+		entry.providerIDs[provider] = id
+	}
+	if entry.artist != "" && entry.title != "" {
+		entry.durationSec = readFileDurationSec(path)
+	}
+	return entry
 }
 
-// readFlacISRC extracts the ISRC Vorbis comment from a FLAC file by walking
-// the metadata block headers and reading only the VORBIS_COMMENT payload;
-// picture and padding blocks are seeked past, never loaded. Returns "" when
-// the file is not FLAC or carries no ISRC tag.
+// readFlacISRC extracts the ISRC Vorbis comment from a FLAC file. Returns ""
+// when the file is not FLAC or carries no ISRC tag.
 func readFlacISRC(path string) string {
+	payload := readFlacVorbisPayload(path)
+	if payload == nil {
+		return ""
+	}
+	return vorbisCommentISRC(payload)
+}
+
+// readFlacVorbisPayload walks the FLAC metadata block headers and reads only
+// the VORBIS_COMMENT payload; picture and padding blocks are seeked past,
+// never loaded. Returns nil when the file is not FLAC or has no comments.
+func readFlacVorbisPayload(path string) []byte {
+	return readFlacMetadataPayloads(path, 4)[4] // VORBIS_COMMENT
+}
+
+// readFlacMetadataPayloads reads the payloads of the requested metadata block
+// types, seeking past everything else, and stops once all have been seen.
+// Returns nil when the file is not FLAC.
+func readFlacMetadataPayloads(path string, blockTypes ...byte) map[byte][]byte {
 	f, err := os.Open(path)
 	if err != nil {
-		return ""
+		return nil
 	}
 	defer f.Close()
 
 	magic := make([]byte, 4)
 	if _, err := io.ReadFull(f, magic); err != nil || string(magic) != "fLaC" {
-		return ""
+		return nil
 	}
 
+	payloads := make(map[byte][]byte, len(blockTypes))
 	header := make([]byte, 4)
 	for {
 		if _, err := io.ReadFull(f, header); err != nil {
-			return ""
+			return payloads
 		}
 		last := header[0]&0x80 != 0
 		blockType := header[0] & 0x7F
 		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
-		if blockType == 4 { // VORBIS_COMMENT
+		if _, seen := payloads[blockType]; !seen && slices.Contains(blockTypes, blockType) {
 			if length > 16<<20 {
-				return ""
+				return payloads
 			}
 			payload := make([]byte, length)
 			if _, err := io.ReadFull(f, payload); err != nil {
-				return ""
+				return payloads
 			}
-			return vorbisCommentISRC(payload)
+			payloads[blockType] = payload
+			if len(payloads) == len(blockTypes) {
+				return payloads
+			}
+		} else if _, err := f.Seek(length, io.SeekCurrent); err != nil {
+			return payloads
 		}
 		if last {
-			return ""
-		}
-		if _, err := f.Seek(length, io.SeekCurrent); err != nil {
-			return ""
+			return payloads
 		}
 	}
 }
 
 func vorbisCommentISRC(payload []byte) string {
+	return vorbisCommentValue(payload, "ISRC")
+}
+
+// vorbisCommentValue returns the first comment named key (case-insensitive)
+// in a raw VORBIS_COMMENT payload.
+func vorbisCommentValue(payload []byte, key string) string {
 	if len(payload) < 8 {
 		return ""
 	}
@@ -267,7 +529,7 @@ func vorbisCommentISRC(payload []byte) string {
 		comment := payload[offset : offset+commentLen]
 		offset += commentLen
 		eq := strings.IndexByte(string(comment), '=')
-		if eq > 0 && strings.EqualFold(string(comment[:eq]), "ISRC") {
+		if eq > 0 && strings.EqualFold(string(comment[:eq]), key) {
 			return strings.TrimSpace(string(comment[eq+1:]))
 		}
 	}
@@ -297,46 +559,78 @@ func (idx *ISRCIndex) remove(isrc string) {
 	delete(idx.index, strings.ToUpper(isrc))
 }
 
+// removeFile drops filePath and every key that resolves to it.
+func (idx *ISRCIndex) removeFile(filePath string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	delete(idx.files, filePath)
+	for key, path := range idx.index {
+		if path == filePath {
+			delete(idx.index, key)
+		}
+	}
+	for key, path := range idx.secondary {
+		if path == filePath {
+			delete(idx.secondary, key)
+		}
+	}
+}
+
 func (idx *ISRCIndex) Lookup(isrc string) (string, error) {
 	path, _ := idx.lookup(isrc)
 	return path, nil
 }
 
+// Add indexes a newly written file under isrc and under the secondary keys
+// read from its tags. isrc may be empty for files that only have those.
 func (idx *ISRCIndex) Add(isrc, filePath string) {
-	if isrc == "" || filePath == "" {
+	if filePath == "" {
 		return
 	}
 
-	upper := strings.ToUpper(isrc)
+	upper := strings.ToUpper(strings.TrimSpace(isrc))
 	var entry *isrcFileEntry
 	if info, err := os.Stat(filePath); err == nil {
-		entry = &isrcFileEntry{
-			size:    info.Size(),
-			modTime: info.ModTime().UnixNano(),
-			isrc:    upper,
+		read := readFileDuplicateEntry(filePath, info.Size(), info.ModTime().UnixNano())
+		if upper != "" {
+			read.isrc = upper
 		}
+		entry = &read
+	} else if upper == "" {
+		return
 	}
 
 	idx.mu.Lock()
-	idx.index[upper] = filePath
+	if upper != "" {
+		idx.index[upper] = filePath
+	}
 	if entry != nil {
 		if idx.files == nil {
 			idx.files = make(map[string]isrcFileEntry)
 		}
 		idx.files[filePath] = *entry
+		idx.indexEntryLocked(filePath, *entry)
 	}
 	idx.mu.Unlock()
 
+	if entry != nil {
+		appendPersistedISRCFile(idx.outputDir, filePath, *entry)
+	}
+
 	// The index is write-maintained after every successful download;
 	// refreshing the timestamp keeps the TTL from forcing a full rebuild in
 	// the middle of the exact workload the index exists to serve.
 	idx.buildTime.Store(time.Now().UnixNano())
 }
 
+// InvalidateISRCCache drops the in-memory index so the next lookup walks the
+// library. The persisted per-file entries stay usable for that walk.
 func InvalidateISRCCache(outputDir string) {
 	isrcIndexCacheMu.Lock()
 	delete(isrcIndexCache, outputDir)
 	isrcIndexCacheMu.Unlock()
+	isrcIndexInvalidated.Store(outputDir, true)
 }
 
 func checkISRCExistsInternal(outputDir, isrc string) (string, bool) {
@@ -373,19 +667,90 @@ func CheckFileExists(filePath string) bool {
 }
 
 type FileExistenceResult struct {
+	ISRC       string  `json:"isrc"`
+	Exists     bool    `json:"exists"`
+	FilePath   string  `json:"file_path,omitempty"`
+	TrackName  string  `json:"track_name,omitempty"`
+	ArtistName string  `json:"artist_name,omitempty"`
+	MatchedBy  string  `json:"matched_by,omitempty"`
+	Confidence float64 `json:"confidence,omitempty"`
+}
+
+type duplicateQuery struct {
 	ISRC       string `json:"isrc"`
-	Exists     bool   `json:"exists"`
-	FilePath   string `json:"file_path,omitempty"`
-	TrackName  string `json:"track_name,omitempty"`
-	ArtistName string `json:"artist_name,omitempty"`
+	TrackName  string `json:"track_name"`
+	ArtistName string `json:"artist_name"`
+	DurationMS int    `json:"duration_ms,omitempty"`
+	SpotifyID  string `json:"spotify_id,omitempty"`
+	DeezerID   string `json:"deezer_id,omitempty"`
+	TidalID    string `json:"tidal_id,omitempty"`
+	QobuzID    string `json:"qobuz_id,omitempty"`
 }
 
-func CheckFilesExistParallel(outputDir string, tracksJSON string) (string, error) {
-	var tracks []struct {
-		ISRC       string `json:"isrc"`
-		TrackName  string `json:"track_name"`
-		ArtistName string `json:"artist_name"`
+// matchLocked tries each key from strongest to weakest: ISRC, provider IDs,
+// then artist+title with a duration within duplicateDurationToleranceSec.
+// Artist+title alone only matches when either side has no duration, since a
+// differing duration usually means a different version. Callers hold idx.mu.
+func (idx *ISRCIndex) matchLocked(q duplicateQuery) (path, matchedBy string, confidence float64) {
+	if isrc := strings.ToUpper(strings.TrimSpace(q.ISRC)); isrc != "" {
+		if path, ok := idx.index[isrc]; ok {
+			return path, duplicateMatchISRC, 1
+		}
+	}
+
+	ids := downloadRequestProviderIDs(DownloadRequest{
+		SpotifyID: q.SpotifyID,
+		DeezerID:  q.DeezerID,
+		TidalID:   q.TidalID,
+		QobuzID:   q.QobuzID,
+	})
+	for _, provider := range duplicateProviders {
+		if id := ids[provider]; id != "" {
+			if path, ok := idx.secondary[providerDuplicateKey(provider, id)]; ok {
+				return path, provider + "_id", 0.98
+			}
+		}
 	}
+
+	artist := normalizeLooseArtistName(q.ArtistName)
+	title := normalizeLooseTitle(q.TrackName)
+	if artist == "" || title == "" {
+		return "", "", 0
+	}
+	durationSec := (q.DurationMS + 500) / 1000
+	if durationSec > 0 {
+		bucket := durationSec / duplicateDurationBucketSec
+		bestDiff := duplicateDurationToleranceSec + 1
+		for b := bucket - 1; b <= bucket+1; b++ {
+			candidate, ok := idx.secondary[artistTitleDurationDuplicateKey(artist, title, b)]
+			if !ok {
+				continue
+			}
+			diff := absInt(idx.files[candidate].durationSec - durationSec)
+			if diff < bestDiff {
+				path, bestDiff = candidate, diff
+			}
+		}
+		if path != "" {
+			return path, duplicateMatchArtistTitleDuration, 0.9 - 0.05*float64(bestDiff)
+		}
+	}
+	if candidate, ok := idx.secondary[artistTitleDuplicateKey(artist, title)]; ok {
+		if durationSec == 0 || idx.files[candidate].durationSec == 0 {
+			return candidate, duplicateMatchArtistTitle, 0.6
+		}
+	}
+	return "", "", 0
+}
+
+// CheckFilesExistParallel reports, per track, the library file it duplicates
+// and which key matched. Confidence is 1 for ISRC, 0.98 for a provider ID,
+// 0.75-0.9 for artist+title by duration difference and 0.6 for artist+title
+// without a duration to compare. Exists is only set from
+// duplicateMinConfidence up; weaker matches are reported as candidates with
+// their file path and confidence so the caller can ask the user.
+func CheckFilesExistParallel(outputDir string, tracksJSON string) (string, error) {
+	var tracks []duplicateQuery
 	if err := json.Unmarshal([]byte(tracksJSON), &tracks); err != nil {
 		return "", fmt.Errorf("failed to parse tracks JSON: %w", err)
 	}
@@ -394,7 +759,7 @@ func CheckFilesExistParallel(outputDir string, tracksJSON string) (string, error
 
 	isrcIdx := GetISRCIndex(outputDir)
 
-	// A lookup is a single map read. Holding one read lock for the batch avoids
+	// A lookup is a few map reads. Holding one read lock for the batch avoids
 	// one goroutine and one lock/unlock pair per track, which was slower and
 	// could create thousands of goroutines for large playlists.
 	isrcIdx.mu.RLock()
@@ -404,11 +769,11 @@ func CheckFilesExistParallel(outputDir string, tracksJSON string) (string, error
 			TrackName:  track.TrackName,
 			ArtistName: track.ArtistName,
 		}
-		if track.ISRC != "" {
-			if filePath, exists := isrcIdx.index[strings.ToUpper(track.ISRC)]; exists {
-				result.Exists = true
-				result.FilePath = filePath
-			}
+		if filePath, matchedBy, confidence := isrcIdx.matchLocked(track); filePath != "" {
+			result.Exists = confidence >= duplicateMinConfidence
+			result.FilePath = filePath
+			result.MatchedBy = matchedBy
+			result.Confidence = confidence
 		}
 		results[i] = result
 	}
@@ -422,25 +787,50 @@ func CheckFilesExistParallel(outputDir string, tracksJSON string) (string, error
 	return string(resultJSON), nil
 }
 
+// PreBuildISRCIndex restores the persisted index for outputDir, which only
+// reads the journal, and starts a background walk for changes. Lookups made
+// before the walk finishes use the restored index.
 func PreBuildISRCIndex(outputDir string) error {
 	if outputDir == "" {
 		return fmt.Errorf("output directory is required")
 	}
 
-	buildISRCIndex(outputDir)
+	restoreOrBuildISRCIndex(outputDir, false)
+	refreshISRCIndexAsync(outputDir)
 	return nil
 }
 
 func AddToISRCIndex(outputDir, isrc, filePath string) {
-	if outputDir == "" || isrc == "" || filePath == "" {
+	if outputDir == "" || filePath == "" {
 		return
 	}
 
-	isrcIndexCacheMu.RLock()
-	idx, exists := isrcIndexCache[outputDir]
-	isrcIndexCacheMu.RUnlock()
-
-	if exists {
+	if idx, exists := cachedISRCIndex(outputDir); exists {
 		idx.Add(isrc, filePath)
+		return
+	}
+
+	// No lookup has loaded the index this session: record the file in the
+	// persisted index so the next restore knows about it without a walk.
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return
+	}
+	entry := readFileDuplicateEntry(filePath, info.Size(), info.ModTime().UnixNano())
+	if upper := strings.ToUpper(strings.TrimSpace(isrc)); upper != "" {
+		entry.isrc = upper
+	}
+	appendPersistedISRCFile(outputDir, filePath, entry)
+}
+
+// RemoveFromISRCIndex forgets a file that was deleted or replaced, in memory
+// and in the persisted index.
+func RemoveFromISRCIndex(outputDir, filePath string) {
+	if outputDir == "" || filePath == "" {
+		return
+	}
+	if idx, exists := cachedISRCIndex(outputDir); exists {
+		idx.removeFile(filePath)
 	}
+	appendPersistedISRCRemoval(outputDir, filePath)
 }
@@ -0,0 +1,199 @@
+package gobackend
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// The duplicate index is persisted per output directory as a JSON-lines
+// journal in the app data dir: a header line, then one "file" line per
+// indexed file. A rebuild rewrites the journal; AddToISRCIndex and
+// RemoveFromISRCIndex append "file"/"remove" lines to it with an fsync so a
+// download indexed right before the app is killed is still known on the next
+// start. Later lines for a path replace earlier ones.
+const (
+	duplicateIndexDirName = "duplicate_index"
+	duplicateIndexVersion = 1
+)
+
+var (
+	duplicateIndexDataDir   string
+	duplicateIndexDataDirMu sync.RWMutex
+	// duplicateIndexFileMu serializes journal appends and rewrites.
+	duplicateIndexFileMu sync.Mutex
+)
+
+type duplicateIndexRecord struct {
+	Op        string `json:"op"`
+	Version   int    `json:"version,omitempty"`
+	OutputDir string `json:"output_dir,omitempty"`
+
+	Path        string            `json:"path,omitempty"`
+	Size        int64             `json:"size,omitempty"`
+	ModTime     int64             `json:"mod_time,omitempty"`
+	ISRC        string            `json:"isrc,omitempty"`
+	Artist      string            `json:"artist,omitempty"`
+	Title       string            `json:"title,omitempty"`
+	DurationSec int               `json:"duration_sec,omitempty"`
+	ProviderIDs map[string]string `json:"provider_ids,omitempty"`
+}
+
+func setDuplicateIndexDataDir(dataDir string) {
+	duplicateIndexDataDirMu.Lock()
+	duplicateIndexDataDir = strings.TrimSpace(dataDir)
+	duplicateIndexDataDirMu.Unlock()
+}
+
+// duplicateIndexPath returns the journal for outputDir, or "" when no data
+// dir is configured and the index lives in memory only.
+func duplicateIndexPath(outputDir string) string {
+	duplicateIndexDataDirMu.RLock()
+	dataDir := duplicateIndexDataDir
+	duplicateIndexDataDirMu.RUnlock()
+	if dataDir == "" || outputDir == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(outputDir))
+	return filepath.Join(dataDir, duplicateIndexDirName, hex.EncodeToString(sum[:8])+".jsonl")
+}
+
+func duplicateIndexRecordFor(path string, entry isrcFileEntry) duplicateIndexRecord {
+	return duplicateIndexRecord{
+		Op:          "file",
+		Path:        path,
+		Size:        entry.size,
+		ModTime:     entry.modTime,
+		ISRC:        entry.isrc,
+		Artist:      entry.artist,
+		Title:       entry.title,
+		DurationSec: entry.durationSec,
+		ProviderIDs: entry.providerIDs,
+	}
+}
+
+// loadPersistedISRCFiles reads the journal for outputDir. A missing journal,
+// a different version or a journal written for another directory (hash
+// collision) all yield nil, which just means a full parse.
+func loadPersistedISRCFiles(outputDir string) map[string]isrcFileEntry {
+	journalPath := duplicateIndexPath(outputDir)
+	if journalPath == "" {
+		return nil
+	}
+
+	duplicateIndexFileMu.Lock()
+	defer duplicateIndexFileMu.Unlock()
+
+	var files map[string]isrcFileEntry
+	journal := jsonlJournal[duplicateIndexRecord]{path: journalPath}
+	err := journal.replay("ISRCIndex", func(record duplicateIndexRecord) bool {
+		switch record.Op {
+		case "header":
+			if record.Version != duplicateIndexVersion || record.OutputDir != outputDir {
+				files = nil
+				return false
+			}
+			files = make(map[string]isrcFileEntry)
+		case "file":
+			if files != nil && record.Path != "" {
+				files[record.Path] = isrcFileEntry{
+					size:        record.Size,
+					modTime:     record.ModTime,
+					isrc:        record.ISRC,
+					artist:      record.Artist,
+					title:       record.Title,
+					durationSec: record.DurationSec,
+					providerIDs: record.ProviderIDs,
+				}
+			}
+		case "remove":
+			if files != nil {
+				delete(files, record.Path)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		GoLog("[ISRCIndex] Failed to read persisted index for %s: %v\n", outputDir, err)
+		return nil
+	}
+	return files
+}
+
+// persistISRCIndex rewrites the journal for idx via temp file + rename so a
+// crash mid-write leaves the previous journal intact. The files are copied
+// under the journal lock and written without holding idx.mu: an Add that
+// misses the copy waits for the lock and appends to the new journal.
+func persistISRCIndex(idx *ISRCIndex) error {
+	outputDir := idx.outputDir
+	journalPath := duplicateIndexPath(outputDir)
+	if journalPath == "" {
+		return nil
+	}
+
+	duplicateIndexFileMu.Lock()
+	defer duplicateIndexFileMu.Unlock()
+
+	idx.mu.RLock()
+	files := maps.Clone(idx.files)
+	idx.mu.RUnlock()
+
+	if err := os.MkdirAll(filepath.Dir(journalPath), 0755); err != nil {
+		return fmt.Errorf("failed to create duplicate index directory: %w", err)
+	}
+	records := make([]duplicateIndexRecord, 0, len(files)+1)
+	records = append(records, duplicateIndexRecord{Op: "header", Version: duplicateIndexVersion, OutputDir: outputDir})
+	for path, entry := range files {
+		records = append(records, duplicateIndexRecordFor(path, entry))
+	}
+	journal := jsonlJournal[duplicateIndexRecord]{path: journalPath}
+	if err := journal.compact(records); err != nil {
+		return fmt.Errorf("failed to write duplicate index: %w", err)
+	}
+	return nil
+}
+
+func appendPersistedISRCFile(outputDir, path string, entry isrcFileEntry) {
+	appendPersistedISRCRecord(outputDir, duplicateIndexRecordFor(path, entry))
+}
+
+func appendPersistedISRCRemoval(outputDir, path string) {
+	appendPersistedISRCRecord(outputDir, duplicateIndexRecord{Op: "remove", Path: path})
+}
+
+// appendPersistedISRCRecord appends one line to the journal. A "file" record
+// starts a journal when there is none yet, so a download indexed before the
+// first build is still known after a restart; the restored index is
+// refreshed by a walk like any other. A removal needs no new journal.
+func appendPersistedISRCRecord(outputDir string, record duplicateIndexRecord) {
+	journalPath := duplicateIndexPath(outputDir)
+	if journalPath == "" {
+		return
+	}
+
+	duplicateIndexFileMu.Lock()
+	defer duplicateIndexFileMu.Unlock()
+
+	records := []duplicateIndexRecord{record}
+	if info, err := os.Stat(journalPath); err != nil || info.Size() == 0 {
+		if record.Op != "file" {
+			return
+		}
+		if err := os.MkdirAll(filepath.Dir(journalPath), 0755); err != nil {
+			GoLog("[ISRCIndex] Failed to create duplicate index directory: %v\n", err)
+			return
+		}
+		header := duplicateIndexRecord{Op: "header", Version: duplicateIndexVersion, OutputDir: outputDir}
+		records = append([]duplicateIndexRecord{header}, records...)
+	}
+	journal := jsonlJournal[duplicateIndexRecord]{path: journalPath}
+	defer journal.close()
+	if err := journal.append(records...); err != nil {
+		GoLog("[ISRCIndex] Failed to append to persisted index: %v\n", err)
+	}
+}
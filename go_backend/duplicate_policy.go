@@ -0,0 +1,389 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Values of DownloadRequest.DuplicatePolicy. An empty policy keeps the
+// original behaviour: only a finished file at the exact output path is
+// reused, and the library index is left to CheckDuplicatesBatch.
+const (
+	duplicatePolicySkip            = "skip"
+	duplicatePolicyKeepBoth        = "keep_both"
+	duplicatePolicyReplaceIfBetter = "replace_if_better"
+)
+
+// duplicateMinConfidence keeps weak artist+title matches (no duration to
+// compare) from ever skipping a download or deleting a library file.
+const duplicateMinConfidence = 0.75
+
+// Quality tiers, ordered so a higher tier is always better.
+const (
+	qualityTierUnknown = iota
+	qualityTierLossy
+	qualityTierLossless
+	qualityTierHiRes
+	// DSD masters sit above any PCM: converting one to FLAC is never an
+	// upgrade, whatever bit depth the PCM side reports.
+	qualityTierDSD
+)
+
+type audioQualityRank struct {
+	tier       int
+	bitDepth   int
+	sampleRate int // Hz
+	bitrate    int // kbps, lossy only
+}
+
+// betterThan reports whether r is a clear upgrade over existing. Anything
+// unknown on either side counts as not better: replacing deletes a file.
+func (r audioQualityRank) betterThan(existing audioQualityRank) bool {
+	if r.tier == qualityTierUnknown || existing.tier == qualityTierUnknown {
+		return false
+	}
+	if r.tier != existing.tier {
+		return r.tier > existing.tier
+	}
+	if r.tier == qualityTierLossy {
+		return r.bitrate > 0 && existing.bitrate > 0 && r.bitrate > existing.bitrate
+	}
+	if r.tier == qualityTierDSD {
+		return r.sampleRate > 0 && existing.sampleRate > 0 && r.sampleRate > existing.sampleRate
+	}
+	if r.bitDepth > 0 && existing.bitDepth > 0 && r.bitDepth != existing.bitDepth {
+		return r.bitDepth > existing.bitDepth
+	}
+	return r.sampleRate > 0 && existing.sampleRate > 0 && r.sampleRate > existing.sampleRate
+}
+
+func (r audioQualityRank) String() string {
+	switch r.tier {
+	case qualityTierLossy:
+		return fmt.Sprintf("lossy %dkbps", r.bitrate)
+	case qualityTierLossless, qualityTierHiRes:
+		return fmt.Sprintf("lossless %d-bit/%dHz", r.bitDepth, r.sampleRate)
+	case qualityTierDSD:
+		return fmt.Sprintf("dsd %dHz", r.sampleRate)
+	}
+	return "unknown"
+}
+
+func losslessQualityRank(bitDepth, sampleRate int) audioQualityRank {
+	tier := qualityTierLossless
+	if bitDepth > 16 || sampleRate > 48000 {
+		tier = qualityTierHiRes
+	}
+	return audioQualityRank{tier: tier, bitDepth: bitDepth, sampleRate: sampleRate}
+}
+
+// existingFileQualityRank probes a library file with the same readers the
+// download pipeline uses to report actual quality.
+func existingFileQualityRank(path string) audioQualityRank {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".flac", ".m4a", ".mp4", ".m4b":
+		quality, err := GetAudioQuality(path)
+		if err != nil {
+			return audioQualityRank{}
+		}
+		switch quality.Codec {
+		case "", "flac", "alac":
+			return losslessQualityRank(quality.BitDepth, quality.SampleRate)
+		default:
+			return audioQualityRank{tier: qualityTierLossy, bitrate: quality.Bitrate}
+		}
+	case ".mp3":
+		if quality, err := GetMP3Quality(path); err == nil && quality != nil {
+			return audioQualityRank{tier: qualityTierLossy, bitrate: quality.Bitrate / 1000}
+		}
+	case ".ogg", ".opus":
+		if quality, err := GetOggQuality(path); err == nil && quality != nil {
+			return audioQualityRank{tier: qualityTierLossy, bitrate: quality.Bitrate / 1000}
+		}
+	case ".wav":
+		if quality, err := GetWAVQuality(path); err == nil && quality != nil {
+			return losslessQualityRank(quality.BitDepth, quality.SampleRate)
+		}
+	case ".aiff", ".aif", ".aifc":
+		if quality, err := GetAIFFQuality(path); err == nil && quality != nil {
+			return losslessQualityRank(quality.BitDepth, quality.SampleRate)
+		}
+	case ".wv":
+		if quality, err := GetWavPackQuality(path); err == nil {
+			if quality.Mode == "lossless" || quality.HasCorrection {
+				return losslessQualityRank(quality.BitDepth, quality.SampleRate)
+			}
+			return audioQualityRank{tier: qualityTierLossy, bitrate: averageBitrateKbps(path, quality.Duration)}
+		}
+	case ".mpc":
+		if quality, err := GetMusepackQuality(path); err == nil {
+			return audioQualityRank{tier: qualityTierLossy, bitrate: averageBitrateKbps(path, quality.Duration)}
+		}
+	case ".dsf", ".dff":
+		if quality, err := GetDSDQuality(path); err == nil {
+			return audioQualityRank{tier: qualityTierDSD, bitDepth: quality.BitDepth, sampleRate: quality.SampleRate}
+		}
+	}
+	return audioQualityRank{}
+}
+
+// extensionQualityText is the provider quality token followed by the label
+// and description the extension declares for it, since tokens themselves are
+// provider-defined.
+func extensionQualityText(ext *loadedExtension, quality string) (label, text string) {
+	text = quality
+	if ext != nil && ext.Manifest != nil {
+		for _, opt := range ext.Manifest.QualityOptions {
+			if strings.EqualFold(strings.TrimSpace(opt.ID), strings.TrimSpace(quality)) {
+				return opt.Label, text + " " + opt.Label + " " + opt.Description
+			}
+		}
+	}
+	return "", text
+}
+
+var lossyQualityMarkers = []string{"MP3", "AAC", "OGG", "OPUS", "VORBIS", "LOSSY", "KBPS"}
+
+// advertisedQualityRank reads what a provider promises for a quality token.
+func advertisedQualityRank(ext *loadedExtension, quality string) audioQualityRank {
+	_, text := extensionQualityText(ext, quality)
+	bitDepth, sampleRateKHz := parseBitDepthSampleRate(text)
+	sampleRate := int(sampleRateKHz*1000 + 0.5)
+	for _, trait := range albumAudioTraitsFromTracks([]ExtTrackMetadata{{AudioQuality: text}}) {
+		switch trait {
+		case "hi_res_lossless":
+			rank := losslessQualityRank(bitDepth, sampleRate)
+			rank.tier = qualityTierHiRes
+			return rank
+		case "lossless":
+			return losslessQualityRank(bitDepth, sampleRate)
+		}
+	}
+
+	upper := strings.ToUpper(text)
+	lossy := false
+	for _, marker := range lossyQualityMarkers {
+		if strings.Contains(upper, marker) {
+			lossy = true
+			break
+		}
+	}
+	bitrate := parseAdvertisedBitrate(upper)
+	if !lossy && bitrate == 0 {
+		return audioQualityRank{}
+	}
+	return audioQualityRank{tier: qualityTierLossy, bitrate: bitrate}
+}
+
+// parseAdvertisedBitrate finds a bitrate such as "320", "MP3_320" or
+// "256kbps" in a quality label.
+func parseAdvertisedBitrate(text string) int {
+	for _, field := range strings.FieldsFunc(text, func(r rune) bool { return r < '0' || r > '9' }) {
+		if n, err := strconv.Atoi(field); err == nil && n >= 64 && n <= 512 {
+			return n
+		}
+	}
+	return 0
+}
+
+// duplicatePolicyDecision is what a download attempt does about a track the
+// library may already have.
+type duplicatePolicyDecision struct {
+	// keepExisting, when set, is reported as the result without downloading.
+	keepExisting string
+	// outputPath is where the provider writes the download.
+	outputPath string
+	// replacePath is the library file the download replaces once it succeeds.
+	replacePath string
+}
+
+// findRequestDuplicate returns a library file for req: the output path
+// itself, else the best index match that clears minConfidence.
+func findRequestDuplicate(req DownloadRequest, outputPath string, minConfidence float64) string {
+	if shouldReuseExistingOutput(req, outputPath) {
+		return outputPath
+	}
+	outputDir := strings.TrimSpace(req.OutputDir)
+	if outputDir == "" {
+		return ""
+	}
+	idx := GetISRCIndex(outputDir)
+	idx.mu.RLock()
+	path, _, confidence := idx.matchLocked(duplicateQuery{
+		ISRC:       req.ISRC,
+		TrackName:  req.TrackName,
+		ArtistName: req.ArtistName,
+		DurationMS: req.DurationMS,
+		SpotifyID:  req.SpotifyID,
+		DeezerID:   req.DeezerID,
+		TidalID:    req.TidalID,
+		QobuzID:    req.QobuzID,
+	})
+	idx.mu.RUnlock()
+	if path == "" || confidence < minConfidence {
+		return ""
+	}
+	if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+		return ""
+	}
+	return path
+}
+
+// resolveDuplicatePolicy applies req.DuplicatePolicy before a provider
+// attempt. quality is the provider's quality token for the attempt.
+func resolveDuplicatePolicy(req DownloadRequest, ext *loadedExtension, quality, outputPath string) duplicatePolicyDecision {
+	policy := strings.ToLower(strings.TrimSpace(req.DuplicatePolicy))
+	// Quality variants and SAF descriptors are written somewhere the library
+	// index cannot see, so only the plain output-path check applies.
+	if req.AllowQualityVariant || isFDOutput(req.OutputFD) {
+		policy = ""
+	}
+
+	switch policy {
+	case duplicatePolicySkip, duplicatePolicyReplaceIfBetter:
+	case duplicatePolicyKeepBoth:
+		if shouldReuseExistingOutput(req, outputPath) {
+			return duplicatePolicyDecision{outputPath: nextFreeOutputPath(outputPath)}
+		}
+		return duplicatePolicyDecision{outputPath: outputPath}
+	default:
+		if shouldReuseExistingOutput(req, outputPath) {
+			return duplicatePolicyDecision{keepExisting: outputPath, outputPath: outputPath}
+		}
+		return duplicatePolicyDecision{outputPath: outputPath}
+	}
+
+	existing := findRequestDuplicate(req, outputPath, duplicateMinConfidence)
+	if existing == "" {
+		return duplicatePolicyDecision{outputPath: outputPath}
+	}
+	if policy == duplicatePolicySkip {
+		return duplicatePolicyDecision{keepExisting: existing, outputPath: outputPath}
+	}
+	existingRank := existingFileQualityRank(existing)
+	offered := advertisedQualityRank(ext, quality)
+	if !offered.betterThan(existingRank) {
+		GoLog("[DuplicatePolicy] Keeping %s (%s); %s offers %s\n", existing, existingRank, quality, offered)
+		return duplicatePolicyDecision{keepExisting: existing, outputPath: outputPath}
+	}
+	GoLog("[DuplicatePolicy] Replacing %s (%s) with %s (%s)\n", existing, existingRank, quality, offered)
+	decision := duplicatePolicyDecision{outputPath: outputPath, replacePath: existing}
+	if shouldReuseExistingOutput(req, outputPath) {
+		// Never write over the file being replaced: if the download fails,
+		// the library copy must still be intact.
+		decision.outputPath = nextFreeOutputPath(outputPath)
+	}
+	return decision
+}
+
+// nextFreeOutputPath returns "name (2).ext", "name (3).ext", ... for the
+// first name not taken next to path.
+func nextFreeOutputPath(path string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, n, ext)
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+// preservedTagFields lists the existing file's tags in EditFileMetadata
+// form. ReplayGain is left out: it describes the old master, not the new one.
+func preservedTagFields(meta *AudioMetadata) map[string]string {
+	if meta == nil {
+		return nil
+	}
+	fields := map[string]string{
+		"title":        meta.Title,
+		"artist":       meta.Artist,
+		"album":        meta.Album,
+		"album_artist": meta.AlbumArtist,
+		"date":         meta.Date,
+		"genre":        meta.Genre,
+		"isrc":         meta.ISRC,
+		"lyrics":       meta.Lyrics,
+		"label":        meta.Label,
+		"copyright":    meta.Copyright,
+		"composer":     meta.Composer,
+		"comment":      meta.Comment,
+		"spotify_id":   meta.SpotifyID,
+		"deezer_id":    meta.DeezerID,
+		"tidal_id":     meta.TidalID,
+		"qobuz_id":     meta.QobuzID,
+	}
+	if fields["date"] == "" {
+		fields["date"] = meta.Year
+	}
+	for key, n := range map[string]int{
+		"track_number": meta.TrackNumber,
+		"track_total":  meta.TotalTracks,
+		"disc_number":  meta.DiscNumber,
+		"disc_total":   meta.TotalDiscs,
+	} {
+		if n > 0 {
+			fields[key] = strconv.Itoa(n)
+		}
+	}
+	for key, value := range fields {
+		if strings.TrimSpace(value) == "" {
+			delete(fields, key)
+		}
+	}
+	return fields
+}
+
+// replaceDuplicateFile copies the tags of oldPath onto the finished download
+// at newPath, then puts the download in oldPath's place: a rename over
+// oldPath when the format is unchanged, otherwise a rename to oldPath's name
+// with the new extension followed by removing oldPath. The library copy is
+// only removed once the replacement is complete under its final name.
+func replaceDuplicateFile(newPath, oldPath string) (string, error) {
+	if !filepath.IsAbs(newPath) || !filepath.IsAbs(oldPath) {
+		return "", fmt.Errorf("replacement needs local files: %s, %s", newPath, oldPath)
+	}
+	if fields := preservedTagFields(readFileTags(oldPath)); len(fields) > 0 {
+		fieldsJSON, err := json.Marshal(fields)
+		if err != nil {
+			return "", err
+		}
+		raw, err := EditFileMetadata(newPath, string(fieldsJSON))
+		if err != nil {
+			return "", fmt.Errorf("failed to carry tags over: %w", err)
+		}
+		var resp struct {
+			Method string `json:"method"`
+		}
+		if err := json.Unmarshal([]byte(raw), &resp); err == nil && resp.Method == "ffmpeg" {
+			return "", fmt.Errorf("no native tag editor for %s", filepath.Ext(newPath))
+		}
+	}
+
+	finalPath := strings.TrimSuffix(oldPath, filepath.Ext(oldPath)) + filepath.Ext(newPath)
+	if !strings.EqualFold(finalPath, oldPath) {
+		if _, err := os.Stat(finalPath); err == nil && finalPath != newPath {
+			// Another file already has that name; leave the download where
+			// the provider wrote it.
+			finalPath = newPath
+		}
+	} else {
+		finalPath = oldPath
+	}
+	if finalPath != newPath {
+		if err := os.Rename(newPath, finalPath); err != nil {
+			return "", fmt.Errorf("failed to move replacement into place: %w", err)
+		}
+	}
+	if finalPath != oldPath {
+		if err := os.Remove(oldPath); err != nil && !os.IsNotExist(err) {
+			GoLog("[DuplicatePolicy] Replacement stored as %s but %s could not be removed: %v\n", finalPath, oldPath, err)
+		}
+	}
+	syncDir(filepath.Dir(finalPath))
+	return finalPath, nil
+}
@@ -0,0 +1,184 @@
+package gobackend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTest320MP3 writes an ID3v2.3 tag followed by MPEG-1 Layer III frames at
+// 320 kbps / 44.1 kHz.
+func writeTest320MP3(t *testing.T, path string, frames ...[]byte) {
+	t.Helper()
+	data := buildID3v23Tag(frames...)
+	frame := make([]byte, 1044) // 144 * 320000 / 44100
+	copy(frame, []byte{0xFF, 0xFB, 0xE0, 0x00})
+	for i := 0; i < 40; i++ {
+		data = append(data, frame...)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAdvertisedQualityRankUpgrades(t *testing.T) {
+	ext := newTestLoadedExtension(t, ExtensionTypeDownloadProvider)
+	ext.Manifest.QualityOptions = []QualityOption{
+		{ID: "HI_RES", Label: "Hi-Res", Description: "24bit/96kHz FLAC"},
+		{ID: "HIGH", Label: "AAC 320kbps"},
+	}
+	mp3 := audioQualityRank{tier: qualityTierLossy, bitrate: 320}
+	cd := losslessQualityRank(16, 44100)
+
+	cases := []struct {
+		quality  string
+		existing audioQualityRank
+		better   bool
+	}{
+		{"LOSSLESS", mp3, true},
+		{"HI_RES", cd, true},
+		{"LOSSLESS", cd, false}, // bit depth not advertised: not provably better
+		{"HIGH", mp3, false},
+		{"MP3_320", audioQualityRank{tier: qualityTierLossy, bitrate: 128}, true},
+		{"whatever", mp3, false},
+	}
+	for _, c := range cases {
+		offered := advertisedQualityRank(ext, c.quality)
+		if got := offered.betterThan(c.existing); got != c.better {
+			t.Errorf("%s (%s) better than %s = %v", c.quality, offered, c.existing, got)
+		}
+	}
+}
+
+func TestResolveDuplicatePolicy(t *testing.T) {
+	dir := t.TempDir()
+	defer InvalidateISRCCache(dir)
+	existing := filepath.Join(dir, "Old Name.mp3")
+	writeTest320MP3(t, existing, id3TextFrame("TIT2", "Song"), id3TextFrame("TSRC", "USAA00000001"))
+	if rank := existingFileQualityRank(existing); rank.tier != qualityTierLossy || rank.bitrate != 320 {
+		t.Fatalf("mp3 rank = %+v", rank)
+	}
+
+	ext := newTestLoadedExtension(t, ExtensionTypeDownloadProvider)
+	outputPath := filepath.Join(dir, "Song.flac")
+	req := DownloadRequest{OutputDir: dir, ISRC: "USAA00000001"}
+
+	req.DuplicatePolicy = duplicatePolicySkip
+	if d := resolveDuplicatePolicy(req, ext, "LOSSLESS", outputPath); d.keepExisting != existing {
+		t.Fatalf("skip = %+v", d)
+	}
+	req.DuplicatePolicy = duplicatePolicyReplaceIfBetter
+	if d := resolveDuplicatePolicy(req, ext, "MP3_320", outputPath); d.keepExisting != existing {
+		t.Fatalf("replace with equal quality = %+v", d)
+	}
+	if d := resolveDuplicatePolicy(req, ext, "LOSSLESS", outputPath); d.replacePath != existing || d.outputPath != outputPath {
+		t.Fatalf("replace with lossless = %+v", d)
+	}
+	// Without a policy only the exact output path counts.
+	req.DuplicatePolicy = ""
+	if d := resolveDuplicatePolicy(req, ext, "LOSSLESS", outputPath); d.keepExisting != "" {
+		t.Fatalf("legacy = %+v", d)
+	}
+	req.DuplicatePolicy = duplicatePolicyKeepBoth
+	if d := resolveDuplicatePolicy(req, ext, "LOSSLESS", existing); d.outputPath != filepath.Join(dir, "Old Name (2).mp3") {
+		t.Fatalf("keep both = %+v", d)
+	}
+}
+
+func TestSkipPolicyIgnoresWeakTitleMatch(t *testing.T) {
+	dir := t.TempDir()
+	defer InvalidateISRCCache(dir)
+	// No decodable frames: the library copy has no duration to compare.
+	unknown, _ := writeTestMP3(t, dir, id3TextFrame("TIT2", "Song"), id3TextFrame("TPE1", "Artist"))
+	short := filepath.Join(dir, "Short.mp3")
+	writeTest320MP3(t, short, id3TextFrame("TIT2", "Other"), id3TextFrame("TPE1", "Artist"))
+
+	ext := newTestLoadedExtension(t, ExtensionTypeDownloadProvider)
+	req := DownloadRequest{
+		OutputDir:       dir,
+		ArtistName:      "Artist",
+		DurationMS:      240000,
+		DuplicatePolicy: duplicatePolicySkip,
+	}
+	for _, title := range []string{"Song", "Other"} {
+		req.TrackName = title
+		if d := resolveDuplicatePolicy(req, ext, "LOSSLESS", filepath.Join(dir, title+".flac")); d.keepExisting != "" {
+			t.Fatalf("%s: skipped for a different-length track: %+v (library copy %s)", title, d, unknown)
+		}
+	}
+	req.TrackName, req.DurationMS = "Other", 1000
+	if d := resolveDuplicatePolicy(req, ext, "LOSSLESS", filepath.Join(dir, "Other.flac")); d.keepExisting != short {
+		t.Fatalf("same length = %+v", d)
+	}
+}
+
+func TestReplaceIfBetterKeepsDSDMaster(t *testing.T) {
+	dir := t.TempDir()
+	defer InvalidateISRCCache(dir)
+	existing := filepath.Join(dir, "Song.dsf")
+	writeTestDSF(t, existing)
+	rank := existingFileQualityRank(existing)
+	if rank.tier != qualityTierDSD {
+		t.Fatalf("dsf rank = %+v", rank)
+	}
+	if hiRes := losslessQualityRank(24, 96000); hiRes.betterThan(rank) {
+		t.Fatalf("%s offered over %s", hiRes, rank)
+	}
+
+	ext := newTestLoadedExtension(t, ExtensionTypeDownloadProvider)
+	ext.Manifest.QualityOptions = []QualityOption{{ID: "HI_RES", Label: "Hi-Res", Description: "24bit/96kHz FLAC"}}
+	req := DownloadRequest{OutputDir: dir, DuplicatePolicy: duplicatePolicyReplaceIfBetter}
+	if d := resolveDuplicatePolicy(req, ext, "HI_RES", existing); d.keepExisting != existing || d.replacePath != "" {
+		t.Fatalf("24/96 offer replaced the DSD master: %+v", d)
+	}
+}
+
+func TestReplaceDuplicateFilePreservesTags(t *testing.T) {
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "Song.mp3")
+	writeTest320MP3(t, oldPath,
+		id3TextFrame("TIT2", "Song (my edit)"),
+		id3TextFrame("TPE1", "Artist"),
+		id3TextFrame("TCON", "Shoegaze"),
+	)
+	download := writeSineFLAC(t, "download.flac", 440, 0.25, 0, 1)
+	newPath := filepath.Join(dir, "Song (2).flac")
+	if err := os.Rename(download, newPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := EditFlacFields(newPath, map[string]string{"title": "Song", "genre": "Rock", "replaygain_track_gain": "-3.00 dB"}); err != nil {
+		t.Fatal(err)
+	}
+
+	finalPath, err := replaceDuplicateFile(newPath, oldPath)
+	if err != nil {
+		t.Fatalf("replaceDuplicateFile: %v", err)
+	}
+	if finalPath != filepath.Join(dir, "Song.flac") {
+		t.Fatalf("final path = %s", finalPath)
+	}
+	for _, gone := range []string{oldPath, newPath} {
+		if _, err := os.Stat(gone); !os.IsNotExist(err) {
+			t.Fatalf("%s still exists", gone)
+		}
+	}
+	meta, err := ReadMetadata(finalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Title != "Song (my edit)" || meta.Genre != "Shoegaze" || meta.Artist != "Artist" {
+		t.Fatalf("tags not carried over: %+v", meta)
+	}
+	if meta.ReplayGainTrackGain != "-3.00 dB" {
+		t.Fatalf("download's own replaygain lost: %q", meta.ReplayGainTrackGain)
+	}
+
+	// Same format: the download is renamed over the old file.
+	again := writeSineFLAC(t, "again.flac", 880, 0.25, 0, 1)
+	if finalPath, err = replaceDuplicateFile(again, filepath.Join(dir, "Song.flac")); err != nil || finalPath != filepath.Join(dir, "Song.flac") {
+		t.Fatalf("same-format replace = %s/%v", finalPath, err)
+	}
+	if meta, _ := ReadMetadata(finalPath); meta == nil || meta.Title != "Song (my edit)" {
+		t.Fatalf("same-format tags = %+v", meta)
+	}
+}
@@ -0,0 +1,171 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckFilesExistParallelMatchesWithoutISRC(t *testing.T) {
+	dir := t.TempDir()
+	tagged := filepath.Join(dir, "tagged.flac")
+	if err := os.Rename(writeSineFLAC(t, "tagged.flac", 440, 0.25, 0, 20), tagged); err != nil {
+		t.Fatal(err)
+	}
+	if err := EditFlacFields(tagged, map[string]string{
+		"artist":    "The Artist",
+		"title":     "Song (Remastered)",
+		"deezer_id": "3135556",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	withISRC := filepath.Join(dir, "isrc.flac")
+	writeTestFlacWithISRC(t, withISRC, "USAA00000011")
+	defer InvalidateISRCCache(dir)
+
+	tracks, _ := json.Marshal([]map[string]any{
+		{"isrc": "USAA00000011", "deezer_id": "3135556", "track_name": "x", "artist_name": "y"},
+		{"spotify_id": "deezer:3135556", "track_name": "Other", "artist_name": "Other"},
+		{"track_name": "Song - Remastered", "artist_name": "the artist", "duration_ms": 21400},
+		{"track_name": "Song (Remastered)", "artist_name": "The Artist", "duration_ms": 25000},
+		{"track_name": "song remastered", "artist_name": "The Artist"},
+	})
+	raw, err := CheckFilesExistParallel(dir, string(tracks))
+	if err != nil {
+		t.Fatalf("CheckFilesExistParallel: %v", err)
+	}
+	var results []FileExistenceResult
+	if err := json.Unmarshal([]byte(raw), &results); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		path      string
+		matchedBy string
+	}{
+		{withISRC, duplicateMatchISRC},
+		{tagged, "deezer_id"},
+		{tagged, duplicateMatchArtistTitleDuration},
+		{"", ""},                            // 5 s longer: a different version
+		{tagged, duplicateMatchArtistTitle}, // a candidate only: no duration
+	}
+	for i, w := range want {
+		got := results[i]
+		exists := w.path != "" && w.matchedBy != duplicateMatchArtistTitle
+		if got.FilePath != w.path || got.MatchedBy != w.matchedBy || got.Exists != exists {
+			t.Fatalf("track %d = %+v, want %s by %q", i, got, w.path, w.matchedBy)
+		}
+	}
+	if results[0].Confidence != 1 || results[2].Confidence <= results[4].Confidence {
+		t.Fatalf("confidences = %v/%v/%v", results[0].Confidence, results[2].Confidence, results[4].Confidence)
+	}
+
+	// A download without an ISRC is indexed by its other keys.
+	added := filepath.Join(dir, "added.flac")
+	if err := os.Rename(writeSineFLAC(t, "added.flac", 220, 0.25, 0, 1), added); err != nil {
+		t.Fatal(err)
+	}
+	if err := EditFlacFields(added, map[string]string{"spotify_id": "4uLU6hMCjMI75M1A2tKUQC"}); err != nil {
+		t.Fatal(err)
+	}
+	AddToISRCIndex(dir, "", added)
+	raw, err = CheckFilesExistParallel(dir, `[{"spotify_id":"4uLU6hMCjMI75M1A2tKUQC"}]`)
+	if err != nil || !strings.Contains(raw, `"matched_by":"spotify_id"`) {
+		t.Fatalf("after AddToISRCIndex = %s/%v", raw, err)
+	}
+}
+
+func TestISRCIndexPersistsAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+	setDuplicateIndexDataDir(t.TempDir())
+	defer setDuplicateIndexDataDir("")
+	defer InvalidateISRCCache(dir)
+	restart := func() {
+		isrcIndexCacheMu.Lock()
+		delete(isrcIndexCache, dir)
+		isrcIndexCacheMu.Unlock()
+		isrcIndexInvalidated.Delete(dir)
+	}
+
+	trackA := filepath.Join(dir, "a.flac")
+	trackB := filepath.Join(dir, "b.flac")
+	writeTestFlacWithISRC(t, trackA, "USAA00000001")
+	writeTestFlacWithISRC(t, trackB, "USBB00000002")
+	buildISRCIndex(dir)
+	restart()
+
+	// A download finishing before any lookup is appended to the journal.
+	trackC := filepath.Join(dir, "c.flac")
+	writeTestFlacWithISRC(t, trackC, "USCC00000003")
+	AddToISRCIndex(dir, "", trackC)
+	journal := duplicateIndexPath(dir)
+	f, err := os.OpenFile(journal, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"op":"file","path":"torn`) // killed mid-append
+	f.Close()
+	restart()
+
+	// Same size and mtime: the persisted entry is trusted without a read.
+	info, _ := os.Stat(trackA)
+	writeTestFlacWithISRC(t, trackA, "USAA00000009")
+	if err := os.Chtimes(trackA, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(trackB); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PreBuildISRCIndex(dir); err != nil {
+		t.Fatal(err)
+	}
+	restored, ok := cachedISRCIndex(dir)
+	if !ok {
+		t.Fatal("expected PreBuildISRCIndex to restore the persisted index")
+	}
+	if path, ok := restored.lookup("USCC00000003"); !ok || path != trackC {
+		t.Fatalf("appended entry lookup = %q/%v", path, ok)
+	}
+	lock := isrcBuildLock(dir)
+	lock.Lock() // wait for the background walk
+	lock.Unlock()
+
+	idx := GetISRCIndex(dir)
+	if idx == restored || !idx.isFresh() {
+		t.Fatal("expected the background walk to publish a fresh index")
+	}
+	if path, ok := idx.lookup("USAA00000001"); !ok || path != trackA {
+		t.Fatalf("cached entry lookup = %q/%v", path, ok)
+	}
+	if _, ok := idx.lookup("USBB00000002"); ok {
+		t.Fatal("expected deleted file to leave the index")
+	}
+	restart()
+	if files := loadPersistedISRCFiles(dir); len(files) != 2 || files[trackC].isrc != "USCC00000003" {
+		t.Fatalf("persisted files = %+v", files)
+	}
+}
+
+func TestISRCIndexJournalStartsOnFirstAdd(t *testing.T) {
+	dir := t.TempDir()
+	setDuplicateIndexDataDir(t.TempDir())
+	defer setDuplicateIndexDataDir("")
+	defer InvalidateISRCCache(dir)
+
+	// Removing from a library that was never indexed writes nothing.
+	RemoveFromISRCIndex(dir, filepath.Join(dir, "gone.flac"))
+	if _, err := os.Stat(duplicateIndexPath(dir)); !os.IsNotExist(err) {
+		t.Fatalf("removal created a journal: %v", err)
+	}
+
+	track := filepath.Join(dir, "first.flac")
+	writeTestFlacWithISRC(t, track, "USFF00000001")
+	AddToISRCIndex(dir, "", track)
+	files := loadPersistedISRCFiles(dir)
+	if len(files) != 1 || files[track].isrc != "USFF00000001" {
+		t.Fatalf("persisted files after first add = %+v", files)
+	}
+}
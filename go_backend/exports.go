@@ -88,6 +88,24 @@ func CheckDuplicatesBatch(outputDir, tracksJSON string) (string, error) {
 	return CheckFilesExistParallel(outputDir, tracksJSON)
 }
 
+// FindAcousticDuplicatesJSON returns clusters of near-identical recordings
+// under folderPath, matched by audio fingerprint rather than tags.
+func FindAcousticDuplicatesJSON(folderPath string) (string, error) {
+	return FindAcousticDuplicates(folderPath)
+}
+
+func GetAcousticDuplicateProgressJSON() string {
+	return GetAcousticDuplicateProgress()
+}
+
+func CancelAcousticDuplicateJobJSON() {
+	CancelAcousticDuplicateJob()
+}
+
+func CompareAudioFingerprintsJSON(pathA, pathB string) (string, error) {
+	return CompareAudioFingerprints(pathA, pathB)
+}
+
 func PreBuildDuplicateIndex(outputDir string) error {
 	return PreBuildISRCIndex(outputDir)
 }
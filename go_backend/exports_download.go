@@ -53,6 +53,17 @@ type DownloadRequest struct {
 	AllowQualityVariant         bool   `json:"allow_quality_variant,omitempty"`
 	QualityVariant              string `json:"quality_variant,omitempty"`
 	SongLinkRegion              string `json:"songlink_region,omitempty"`
+	// VerifyIntegrity checks the finished FLAC/MP4 for truncation before it
+	// is finalized; a failed check moves on to the next provider.
+	VerifyIntegrity bool `json:"verify_integrity,omitempty"`
+	// DuplicatePolicy decides what happens when the library already has the
+	// track: "skip", "keep_both" or "replace_if_better". Empty only reuses a
+	// finished file at the exact output path.
+	DuplicatePolicy string `json:"duplicate_policy,omitempty"`
+	// AnalyzeReplayGain has the backend measure and tag track ReplayGain on
+	// local FLAC downloads. Hosts that scan with FFmpeg after the download
+	// (EmbedReplayGain) leave it unset, or every file is analyzed twice.
+	AnalyzeReplayGain bool `json:"analyze_replaygain,omitempty"`
 }
 
 type DownloadResponse struct {
@@ -63,8 +74,11 @@ type DownloadResponse struct {
 	ErrorType                   string                  `json:"error_type,omitempty"`
 	RetryAfterSeconds           int                     `json:"retry_after_seconds,omitempty"`
 	AlreadyExists               bool                    `json:"already_exists,omitempty"`
+	ReplacedFilePath            string                  `json:"replaced_file_path,omitempty"`
 	ActualBitDepth              int                     `json:"actual_bit_depth,omitempty"`
 	ActualSampleRate            int                     `json:"actual_sample_rate,omitempty"`
+	ReplayGainTrackGain         string                  `json:"replaygain_track_gain,omitempty"`
+	ReplayGainTrackPeak         string                  `json:"replaygain_track_peak,omitempty"`
 	AudioCodec                  string                  `json:"audio_codec,omitempty"`
 	ActualExtension             string                  `json:"actual_extension,omitempty"`
 	ActualContainer             string                  `json:"actual_container,omitempty"`
@@ -89,6 +103,9 @@ type DownloadResponse struct {
 	LyricsLRC                   string                  `json:"lyrics_lrc,omitempty"`
 	DecryptionKey               string                  `json:"decryption_key,omitempty"`
 	Decryption                  *DownloadDecryptionInfo `json:"decryption,omitempty"`
+	// Attempts lists every provider DownloadWithExtensionFallback considered,
+	// in order, including skipped ones.
+	Attempts []DownloadAttempt `json:"attempts,omitempty"`
 }
 
 type DownloadResult struct {
@@ -435,6 +452,8 @@ func classifyDownloadErrorType(msg string) string {
 		return "isp_blocked"
 	} else if strings.Contains(lowerMsg, "cancel") {
 		return "cancelled"
+	} else if strings.Contains(lowerMsg, "integrity check failed") {
+		return downloadIntegrityErrorType
 	} else if strings.Contains(lowerMsg, "verification_required") ||
 		strings.Contains(lowerMsg, "session is not authenticated") ||
 		strings.Contains(lowerMsg, "signed session is not authenticated") ||
@@ -0,0 +1,91 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// EnqueueDownloadsJSON adds a JSON array of DownloadRequest objects to the
+// persistent download queue. Requests without an item_id get a generated one.
+// Returns {"enqueued": [itemID...], "skipped": [{"item_id","reason"}...]}.
+func EnqueueDownloadsJSON(requestsJSON string) (string, error) {
+	var requests []DownloadRequest
+	if err := json.Unmarshal([]byte(requestsJSON), &requests); err != nil {
+		return "", fmt.Errorf("invalid requests: %w", err)
+	}
+	return marshalJSONString(getDownloadQueue().enqueue(requests))
+}
+
+// StartDownloadQueue begins dispatching queued jobs, including jobs recovered
+// from the journal. Call it after the extensions have been loaded.
+func StartDownloadQueue() {
+	getDownloadQueue().start()
+}
+
+// PauseDownloadQueue stops dispatching new jobs; running transfers finish.
+// The paused state is persisted across restarts.
+func PauseDownloadQueue() {
+	getDownloadQueue().setPaused(true)
+}
+
+func ResumeDownloadQueue() {
+	getDownloadQueue().setPaused(false)
+}
+
+// PauseQueuedDownload pauses one queued or running job. A running transfer
+// is cancelled and the job waits for ResumeQueuedDownload.
+func PauseQueuedDownload(itemID string) bool {
+	return getDownloadQueue().pauseItem(itemID)
+}
+
+func ResumeQueuedDownload(itemID string) bool {
+	return getDownloadQueue().resumeItem(itemID)
+}
+
+// RetryQueuedDownload re-queues a failed or cancelled job; an empty itemID
+// retries all of them. Returns the number of jobs re-queued.
+func RetryQueuedDownload(itemID string) int {
+	return getDownloadQueue().retry(itemID)
+}
+
+// ReorderDownloadQueueJSON moves the item IDs in the JSON array to the front
+// of the queue in that order.
+func ReorderDownloadQueueJSON(itemIDsJSON string) error {
+	var itemIDs []string
+	if err := json.Unmarshal([]byte(itemIDsJSON), &itemIDs); err != nil {
+		return err
+	}
+	getDownloadQueue().reorder(itemIDs)
+	return nil
+}
+
+func RemoveQueuedDownload(itemID string) bool {
+	return getDownloadQueue().remove(itemID)
+}
+
+// ClearFinishedQueuedDownloads drops completed jobs and returns how many were
+// removed.
+func ClearFinishedQueuedDownloads() int {
+	return getDownloadQueue().clearFinished()
+}
+
+func SetDownloadQueueConcurrency(concurrency int) {
+	getDownloadQueue().setConcurrency(concurrency)
+}
+
+// GetDownloadQueueJSON returns the queue state and all jobs in queue order.
+// "revision" changes on every state transition so the host can skip
+// re-rendering unchanged snapshots.
+func GetDownloadQueueJSON() (string, error) {
+	return marshalJSONString(getDownloadQueue().snapshot())
+}
+
+func initDownloadQueue(dataDir string) {
+	if strings.TrimSpace(dataDir) == "" {
+		return
+	}
+	if err := getDownloadQueue().open(dataDir); err != nil {
+		GoLog("[DownloadQueue] Failed to open journal: %v\n", err)
+	}
+}
@@ -286,6 +286,11 @@ func InitExtensionSystem(extensionsDir, dataDir string) error {
 		return err
 	}
 
+	// A broken queue journal must not keep extensions from loading.
+	initDownloadQueue(dataDir)
+	setDuplicateIndexDataDir(dataDir)
+	initLibraryStore(dataDir)
+
 	return nil
 }
 
@@ -380,6 +385,26 @@ func GetProviderPriorityJSON() (string, error) {
 	return marshalJSONString(priority)
 }
 
+// SetDownloadLimitsJSON configures per-provider download concurrency and the
+// global bandwidth cap, e.g. {"max_concurrent_per_provider": 2,
+// "provider_max_concurrent": {"some-ext": 1}, "max_bytes_per_second": 0}.
+// An empty string clears all limits.
+func SetDownloadLimitsJSON(limitsJSON string) error {
+	var limits DownloadLimits
+	if strings.TrimSpace(limitsJSON) != "" {
+		if err := json.Unmarshal([]byte(limitsJSON), &limits); err != nil {
+			return err
+		}
+	}
+
+	setDownloadLimits(limits)
+	return nil
+}
+
+func GetDownloadLimitsJSON() (string, error) {
+	return marshalJSONString(getDownloadLimits())
+}
+
 func SetExtensionFallbackProviderIDsJSON(providerIDsJSON string) error {
 	if strings.TrimSpace(providerIDsJSON) == "" {
 		SetExtensionFallbackProviderIDs(nil)
@@ -560,6 +585,34 @@ func DownloadWithExtensionsJSON(requestJSON string) (string, error) {
 	return marshalJSONString(result)
 }
 
+// PlanDownloadJSON runs the DownloadWithExtensionFallback provider walk for a
+// DownloadRequest without downloading: priority ordering, source preflight,
+// availability checks and track matching all run, and the result names the
+// provider and track the real download would pick.
+func PlanDownloadJSON(requestJSON string) (string, error) {
+	var req DownloadRequest
+	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
+		return "", fmt.Errorf("invalid request: %w", err)
+	}
+	applySongLinkRegionFromRequest(&req)
+
+	req.TrackName = strings.TrimSpace(req.TrackName)
+	req.ArtistName = strings.TrimSpace(req.ArtistName)
+	req.AlbumName = strings.TrimSpace(req.AlbumName)
+	req.AlbumArtist = strings.TrimSpace(req.AlbumArtist)
+	req.OutputDir = strings.TrimSpace(req.OutputDir)
+	req.OutputPath = strings.TrimSpace(req.OutputPath)
+	req.OutputExt = strings.TrimSpace(req.OutputExt)
+	// Plans must not touch the progress or cancel state of a real item.
+	req.ItemID = ""
+
+	plan, err := planDownload(req)
+	if err != nil {
+		return "", err
+	}
+	return marshalJSONString(plan)
+}
+
 func CleanupExtensions() {
 	manager := getExtensionManager()
 	manager.UnloadAllExtensions()
@@ -31,3 +31,63 @@ func ReadAudioMetadataJSON(filePath string) (string, error) {
 func ReadAudioMetadataWithHintAndCoverCacheKeyJSON(filePath, displayName, coverCacheKey string) (string, error) {
 	return ReadAudioMetadataWithDisplayNameAndCoverCacheKey(filePath, displayName, coverCacheKey)
 }
+
+func RunAlbumReplayGainJobJSON(folderPath string, overwriteExisting bool) (string, error) {
+	return RunAlbumReplayGainJob(folderPath, overwriteExisting)
+}
+
+func GetAlbumReplayGainProgressJSON() string {
+	return GetAlbumReplayGainProgress()
+}
+
+func CancelAlbumReplayGainJobJSON() {
+	CancelAlbumReplayGainJob()
+}
+
+func ScanLibraryFolderToStoreJSON(folderPath string) (string, error) {
+	return ScanLibraryFolderToStore(folderPath)
+}
+
+func QueryLibraryJSON(queryJSON string) (string, error) {
+	return QueryLibrary(queryJSON)
+}
+
+func GetLibraryCountsJSON(queryJSON, groupBy string) (string, error) {
+	return GetLibraryCounts(queryJSON, groupBy)
+}
+
+func ClearLibraryStoreJSON() {
+	ClearLibraryStore()
+}
+
+func StartLibraryWatchJSON(rootsJSON string) (string, error) {
+	return StartLibraryWatch(rootsJSON)
+}
+
+func StopLibraryWatchJSON() {
+	StopLibraryWatch()
+}
+
+func GetLibraryWatchStatusJSON() string {
+	return GetLibraryWatchStatus()
+}
+
+func GetLibraryChangesDeltaJSON(sinceSeq int64) string {
+	return GetLibraryChangesDelta(sinceSeq)
+}
+
+func AnalyzeLibraryHealthJSON(folderPath string) (string, error) {
+	return AnalyzeLibraryHealth(folderPath)
+}
+
+func GetLibraryHealthProgressJSON() string {
+	return GetLibraryHealthProgress()
+}
+
+func CancelLibraryHealthJobJSON() {
+	CancelLibraryHealthJob()
+}
+
+func GetLibraryAlbumsJSON(queryJSON string) (string, error) {
+	return GetLibraryAlbums(queryJSON)
+}
@@ -2,6 +2,7 @@ package gobackend
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -33,6 +34,27 @@ func applyAudioMetadataToResult(result map[string]any, meta *AudioMetadata) {
 	result["replaygain_track_peak"] = meta.ReplayGainTrackPeak
 	result["replaygain_album_gain"] = meta.ReplayGainAlbumGain
 	result["replaygain_album_peak"] = meta.ReplayGainAlbumPeak
+
+	// ID3v2-only frames are reported only when the tag carries them.
+	if meta.SyncedLyrics != "" {
+		result["synced_lyrics"] = meta.SyncedLyrics
+	}
+	if meta.Rating > 0 || meta.PlayCount > 0 {
+		result["rating"] = meta.Rating
+		result["play_count"] = meta.PlayCount
+	}
+	if meta.MusicBrainzTrackID != "" {
+		result["musicbrainz_trackid"] = meta.MusicBrainzTrackID
+	}
+	if len(meta.Chapters) > 0 {
+		result["chapters"] = meta.Chapters
+	}
+	if len(meta.InvolvedPeople) > 0 {
+		result["involved_people"] = meta.InvolvedPeople
+	}
+	if len(meta.MusicianCredits) > 0 {
+		result["musician_credits"] = meta.MusicianCredits
+	}
 }
 
 func successMethodJSON(method string) (string, error) {
@@ -50,6 +72,7 @@ func ReadFileMetadata(filePath string) (string, error) {
 	isMpc := strings.HasSuffix(lower, ".mpc")
 	isWav := strings.HasSuffix(lower, ".wav")
 	isAiff := strings.HasSuffix(lower, ".aiff") || strings.HasSuffix(lower, ".aif") || strings.HasSuffix(lower, ".aifc")
+	isDsd := strings.HasSuffix(lower, ".dsf") || strings.HasSuffix(lower, ".dff")
 
 	result := map[string]any{
 		"title":        "",
@@ -218,6 +241,27 @@ func ReadFileMetadata(filePath string) (string, error) {
 				applyAudioMetadataToResult(result, meta)
 			}
 		}
+		if isWv {
+			if quality, err := GetWavPackQuality(filePath); err == nil {
+				result["audio_codec"] = "wavpack"
+				result["bit_depth"] = quality.BitDepth
+				result["sample_rate"] = quality.SampleRate
+				result["channels"] = quality.Channels
+				result["duration"] = quality.Duration
+				result["bitrate"] = averageBitrateKbps(filePath, quality.Duration)
+				result["wavpack_mode"] = quality.Mode
+				result["lossless"] = quality.Mode == "lossless" || quality.HasCorrection
+			}
+		} else if isMpc {
+			if quality, err := GetMusepackQuality(filePath); err == nil {
+				result["audio_codec"] = "musepack"
+				result["sample_rate"] = quality.SampleRate
+				result["channels"] = quality.Channels
+				result["duration"] = quality.Duration
+				result["bitrate"] = averageBitrateKbps(filePath, quality.Duration)
+				result["stream_version"] = quality.StreamVersion
+			}
+		}
 	} else if isWav || isAiff {
 		var meta *AudioMetadata
 		var quality *WAVQuality
@@ -241,6 +285,22 @@ func ReadFileMetadata(filePath string) (string, error) {
 			result["sample_rate"] = quality.SampleRate
 			result["duration"] = quality.Duration
 		}
+	} else if isDsd {
+		result["format"] = strings.TrimPrefix(filepath.Ext(lower), ".")
+		result["audio_codec"] = "dsd"
+		if meta, err := ReadDSDTags(filePath); err == nil {
+			applyAudioMetadataToResult(result, meta)
+		}
+		if quality, err := GetDSDQuality(filePath); err == nil {
+			if quality.Compressed {
+				result["audio_codec"] = "dst"
+			}
+			result["bit_depth"] = quality.BitDepth
+			result["sample_rate"] = quality.SampleRate
+			result["channels"] = quality.Channels
+			result["duration"] = quality.Duration
+			result["dsd_rate"] = quality.DSDRate
+		}
 	} else {
 		return "", fmt.Errorf("unsupported file format: %s", filePath)
 	}
@@ -255,6 +315,48 @@ func ParseCueSheet(cuePath string, audioDir string) (string, error) {
 	return ParseCueFileJSON(cuePath, audioDir)
 }
 
+// ParseCueSheetWithGapMode is ParseCueSheet with a choice of where INDEX 00
+// gaps go: "discard" (default), "append" to the previous track or "prepend"
+// to the next. Append mode reports hidden track one audio as hidden_track.
+func ParseCueSheetWithGapMode(cuePath, audioDir, gapMode string) (string, error) {
+	return ParseCueFileJSONWithGapMode(cuePath, audioDir, gapMode)
+}
+
+// ParseCueSheetWithGapModeAndEncoding also takes the .cue charset (a WHATWG
+// label such as "shift_jis", "gbk" or "windows-1251"); empty detects it.
+func ParseCueSheetWithGapModeAndEncoding(cuePath, audioDir, gapMode, encoding string) (string, error) {
+	return ParseCueFileJSONWithGapModeAndEncoding(cuePath, audioDir, gapMode, encoding)
+}
+
+// SplitCueSheet splits the FLAC image(s) a .cue file references into tagged
+// per-track FLACs in outputDir without FFmpeg. optionsJSON may set
+// "granularity" to "sample" (default) or "frame", and "gap_mode" and
+// "encoding" as in ParseCueSheetWithGapModeAndEncoding.
+func SplitCueSheet(cuePath, audioDir, outputDir, optionsJSON string) (string, error) {
+	return SplitCueFLACJSON(cuePath, audioDir, outputDir, optionsJSON)
+}
+
+// GenerateCueSheet returns CUE text for a JSON-encoded CueSheet (snake_case
+// fields as in ParseCueFile's sheet).
+func GenerateCueSheet(sheetJSON string) (string, error) {
+	return FormatCueSheetJSON(sheetJSON)
+}
+
+// ExtractFlacCueSheet returns the cuesheet embedded in a FLAC image (CUESHEET
+// comment or native block) as CUE text.
+func ExtractFlacCueSheet(flacPath string) (string, error) {
+	return ReadFLACCueSheetText(flacPath)
+}
+
+// EmbedCueSheetInFlac stores the .cue at cuePath inside the FLAC image so the
+// library scanner splits it without the sidecar.
+func EmbedCueSheetInFlac(flacPath, cuePath string) (string, error) {
+	if err := EmbedFLACCueSheet(flacPath, cuePath); err != nil {
+		return "", err
+	}
+	return successMethodJSON("native_cuesheet")
+}
+
 // ScanCueSheetForLibrary parses a .cue file and returns a JSON array of
 // LibraryScanResult entries (one per track). This is the SAF-friendly variant:
 //   - audioDir overrides where the referenced audio file is resolved
@@ -274,13 +376,20 @@ func ScanCueSheetForLibrary(cuePath, audioDir, virtualPathPrefix string, fileMod
 }
 
 func ScanCueSheetForLibraryWithCoverCacheKey(cuePath, audioDir, virtualPathPrefix string, fileModTime int64, coverCacheKey string) (string, error) {
+	return ScanCueSheetForLibraryWithCoverCacheKeyAndEncoding(cuePath, audioDir, virtualPathPrefix, fileModTime, coverCacheKey, "")
+}
+
+// ScanCueSheetForLibraryWithCoverCacheKeyAndEncoding reads the .cue in the
+// given charset instead of detecting it (see ParseCueSheetWithGapModeAndEncoding).
+func ScanCueSheetForLibraryWithCoverCacheKeyAndEncoding(cuePath, audioDir, virtualPathPrefix string, fileModTime int64, coverCacheKey, encoding string) (string, error) {
 	scanTime := time.Now().UTC().Format(time.RFC3339)
-	results, err := ScanCueFileForLibraryExtWithCoverCacheKey(
+	results, err := ScanCueFileForLibraryExtWithCoverCacheKeyAndEncoding(
 		cuePath,
 		audioDir,
 		virtualPathPrefix,
 		fileModTime,
 		coverCacheKey,
+		encoding,
 		scanTime,
 	)
 	if err != nil {
@@ -293,6 +402,23 @@ func ScanCueSheetForLibraryWithCoverCacheKey(cuePath, audioDir, virtualPathPrefi
 	return string(jsonBytes), nil
 }
 
+// ScanEmbeddedCueSheetForLibrary returns per-track LibraryScanResult entries
+// for a FLAC image carrying an embedded cuesheet, or "[]" when the file should
+// be scanned as a single track. virtualPathPrefix and fileModTime work as in
+// ScanCueSheetForLibrary.
+func ScanEmbeddedCueSheetForLibrary(filePath, virtualPathPrefix string, fileModTime int64, coverCacheKey string) (string, error) {
+	scanTime := time.Now().UTC().Format(time.RFC3339)
+	results := scanEmbeddedCueForLibrary(filePath, virtualPathPrefix, fileModTime, coverCacheKey, scanTime)
+	if results == nil {
+		return "[]", nil
+	}
+	jsonBytes, err := json.Marshal(results)
+	if err != nil {
+		return "[]", fmt.Errorf("failed to marshal cue scan results: %w", err)
+	}
+	return string(jsonBytes), nil
+}
+
 // WriteM4AFreeformTags writes ISRC and label into an M4A/MP4 file as iTunes
 // freeform atoms. FFmpeg's MP4 muxer ignores these keys, so they must be
 // written natively after the FFmpeg metadata pass for the values to persist.
@@ -346,6 +472,7 @@ func EditFileMetadata(filePath, metadataJSON string) (string, error) {
 	isM4AFile := strings.HasSuffix(lower, ".m4a") || strings.HasSuffix(lower, ".mp4") || strings.HasSuffix(lower, ".m4b")
 	isWavFile := strings.HasSuffix(lower, ".wav")
 	isAiffFile := strings.HasSuffix(lower, ".aiff") || strings.HasSuffix(lower, ".aif") || strings.HasSuffix(lower, ".aifc")
+	isDsdFile := strings.HasSuffix(lower, ".dsf") || strings.HasSuffix(lower, ".dff")
 	coverPath := strings.TrimSpace(fields["cover_path"])
 
 	if hasOnlyM4AReplayGainFields(fields) && (isM4AFile || isMP4ContainerFile(filePath)) {
@@ -373,7 +500,7 @@ func EditFileMetadata(filePath, metadataJSON string) (string, error) {
 		return successMethodJSON("native")
 	}
 
-	// WAV / AIFF: write tags into an embedded ID3v2.4 chunk natively.
+	// WAV / AIFF / DSF / DFF: write tags into an embedded ID3v2.4 chunk natively.
 	if isWavFile {
 		if err := WriteWAVTags(filePath, fields); err != nil {
 			return "", fmt.Errorf("failed to write WAV metadata: %w", err)
@@ -386,6 +513,12 @@ func EditFileMetadata(filePath, metadataJSON string) (string, error) {
 		}
 		return successMethodJSON("native_aiff")
 	}
+	if isDsdFile {
+		if err := WriteDSDTags(filePath, fields); err != nil {
+			return "", fmt.Errorf("failed to write DSD metadata: %w", err)
+		}
+		return successMethodJSON("native_dsd")
+	}
 
 	if isApeFile {
 		meta := audioMetadataFromEditFields(fields)
@@ -441,17 +574,21 @@ func EditFileMetadata(filePath, metadataJSON string) (string, error) {
 	}
 
 	// MP3, Ogg/Opus, and M4A have native editors that preserve foreign
-	// tags and skip the ffmpeg remux. Any failure falls back to the ffmpeg
-	// response so callers keep the old behavior for exotic files.
+	// tags and skip the ffmpeg remux. Other failures fall back to the ffmpeg
+	// response so callers keep the old behavior for exotic files; invalid
+	// field values are returned, since ffmpeg cannot write them either.
 	isMp3 := strings.HasSuffix(lower, ".mp3")
 	isOggFile := strings.HasSuffix(lower, ".opus") || strings.HasSuffix(lower, ".ogg")
 
 	if isMp3 {
-		if err := EditMP3Fields(filePath, fields); err != nil {
-			GoLog("[Metadata] Native MP3 edit failed, falling back to ffmpeg: %v\n", err)
-		} else {
+		err := EditMP3Fields(filePath, fields)
+		if err == nil {
 			return successMethodJSON("native_mp3")
 		}
+		if errors.Is(err, errInvalidID3Field) {
+			return "", err
+		}
+		GoLog("[Metadata] Native MP3 edit failed, falling back to ffmpeg: %v\n", err)
 	}
 	if isOggFile {
 		if err := EditOggFields(filePath, fields); err != nil {
@@ -571,6 +708,8 @@ func ExtractCoverToFile(audioPath string, outputPath string) error {
 		strings.HasSuffix(lower, ".aif") ||
 		strings.HasSuffix(lower, ".aifc") {
 		coverData, _, err = extractWAVAIFFCover(audioPath)
+	} else if strings.HasSuffix(lower, ".dsf") || strings.HasSuffix(lower, ".dff") {
+		coverData, _, err = extractDSDCover(audioPath)
 	} else {
 		return fmt.Errorf("unsupported audio format for cover extraction")
 	}
@@ -586,3 +725,18 @@ func ExtractCoverToFile(audioPath string, outputPath string) error {
 	GoLog("[Cover] Extracted cover art to: %s (%d KB)\n", outputPath, len(coverData)/1024)
 	return nil
 }
+
+// ComputeReplayGainJSON measures ReplayGain 2.0 track values for each FLAC
+// path in pathsJSON (a JSON array) and album values across all of them. Tags
+// in the result can be passed straight to EditFileMetadata.
+func ComputeReplayGainJSON(pathsJSON string) (string, error) {
+	var paths []string
+	if err := json.Unmarshal([]byte(pathsJSON), &paths); err != nil {
+		return "", fmt.Errorf("invalid paths JSON: %w", err)
+	}
+	result, err := computeReplayGain(paths, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	return marshalJSONString(result)
+}
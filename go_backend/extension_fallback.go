@@ -15,6 +15,7 @@ import (
 // (leaving them untouched when neither branch applies) so callers can keep
 // their own verification_required/stop-fallback handling and error messages.
 // cancelledOuter true means the caller must return (nil, ErrDownloadCancelled).
+// attempt, when non-nil, receives the match verdict and outcome.
 func attemptExtensionDownload(
 	req DownloadRequest,
 	ext *loadedExtension,
@@ -24,23 +25,30 @@ func attemptExtensionDownload(
 	lastErr *error,
 	lastErrType *string,
 	lastRetryAfterSeconds *int,
+	attempt *DownloadAttempt,
 ) (resp *DownloadResponse, cancelledOuter bool) {
-	outputPath := buildOutputPathForExtension(req, ext)
-	if shouldReuseExistingOutput(req, outputPath) {
-		result := DownloadResult{FilePath: outputPath}
+	if attempt != nil {
+		attempt.TrackID = trackID
+		attempt.Quality = quality
+	}
+	duplicate := resolveDuplicatePolicy(req, ext, quality, buildOutputPathForExtension(req, ext))
+	outputPath := duplicate.outputPath
+	if duplicate.keepExisting != "" {
+		result := DownloadResult{FilePath: duplicate.keepExisting}
 		enrichResultQualityFromFile(&result)
 		built := buildDownloadSuccessResponse(
 			req,
 			result,
 			providerLabel,
 			"File already exists",
-			outputPath,
+			duplicate.keepExisting,
 			true,
 		)
 		if req.ItemID != "" {
 			CompleteItemProgress(req.ItemID)
 		}
-		GoLog("[DownloadWithExtensionFallback] Keeping existing output instead of replacing it: %s\n", outputPath)
+		GoLog("[DownloadWithExtensionFallback] Keeping existing output instead of replacing it: %s\n", duplicate.keepExisting)
+		attempt.finish(attemptOutcomeAlreadyExists, nil, "")
 		return &built, false
 	}
 	if req.ItemID != "" {
@@ -70,17 +78,33 @@ func attemptExtensionDownload(
 			SkipNameVerification: strings.EqualFold(strings.TrimSpace(req.Source), strings.TrimSpace(providerLabel)) ||
 				ext.Manifest.HasCustomMatching(),
 		}
-		if !trackMatchesRequest(req, resolved, "Extension "+providerLabel) {
+		verdict := evaluateTrackMatch(req, resolved, "Extension "+providerLabel)
+		if attempt != nil {
+			attempt.MatchVerdict = verdict
+		}
+		if !trackMatchVerdictAccepted(verdict) {
 			discardRejectedExtensionOutput(result, outputPath)
 			*lastErr = fmt.Errorf("provider %s returned a different track", providerLabel)
 			*lastErrType = "not_found"
+			attempt.finish(attemptOutcomeTrackMismatch, *lastErr, *lastErrType)
 			return nil, false
 		}
+		if req.VerifyIntegrity {
+			if integrityErr := verifyExtensionDownloadIntegrity(result); integrityErr != nil {
+				GoLog("[DownloadWithExtensionFallback] %s output rejected: %v\n", providerLabel, integrityErr)
+				discardRejectedExtensionOutput(result, outputPath)
+				*lastErr = integrityErr
+				*lastErrType = downloadIntegrityErrorType
+				attempt.finish(attemptOutcomeCorrupt, *lastErr, *lastErrType)
+				return nil, false
+			}
+		}
 	}
 	if req.ItemID != "" && downloadSucceeded {
 		SetItemFinalizing(req.ItemID)
 	}
 	if shouldAbortCancelledFallback(req.ItemID, err) {
+		attempt.finish(attemptOutcomeCancelled, nil, "cancelled")
 		return nil, true
 	}
 
@@ -128,13 +152,28 @@ func attemptExtensionDownload(
 		}
 
 		embedExtensionDownloadMetadata(built, req, alreadyExists)
+		embedExtensionDownloadReplayGain(&built, req, alreadyExists)
+
+		if duplicate.replacePath != "" && !alreadyExists {
+			finalPath, err := replaceDuplicateFile(strings.TrimSpace(built.FilePath), duplicate.replacePath)
+			if err != nil {
+				// Both files stay: nothing was lost, the user can clean up.
+				GoLog("[DuplicatePolicy] Keeping both %s and %s: %v\n", built.FilePath, duplicate.replacePath, err)
+			} else {
+				if finalPath != duplicate.replacePath {
+					RemoveFromISRCIndex(req.OutputDir, duplicate.replacePath)
+				}
+				built.FilePath = finalPath
+				built.ReplacedFilePath = duplicate.replacePath
+			}
+		}
 
 		if !alreadyExists && !isFDOutput(req.OutputFD) && strings.TrimSpace(req.OutputDir) != "" {
 			indexISRC := strings.TrimSpace(built.ISRC)
 			if indexISRC == "" {
 				indexISRC = strings.TrimSpace(req.ISRC)
 			}
-			if indexISRC != "" && strings.TrimSpace(built.FilePath) != "" {
+			if strings.TrimSpace(built.FilePath) != "" {
 				AddToISRCIndex(req.OutputDir, indexISRC, built.FilePath)
 			}
 		}
@@ -142,11 +181,17 @@ func attemptExtensionDownload(
 		if req.ItemID != "" {
 			CompleteItemProgress(req.ItemID)
 		}
+		if alreadyExists {
+			attempt.finish(attemptOutcomeAlreadyExists, nil, "")
+		} else {
+			attempt.finish(attemptOutcomeSuccess, nil, "")
+		}
 		return &built, false
 	}
 
 	if err != nil {
 		if errors.Is(err, ErrDownloadCancelled) {
+			attempt.finish(attemptOutcomeCancelled, err, "cancelled")
 			return &DownloadResponse{
 				Success:   false,
 				Error:     "Download cancelled",
@@ -156,13 +201,18 @@ func attemptExtensionDownload(
 		}
 		*lastErr = err
 		*lastErrType = ""
+		attempt.finish(attemptOutcomeFailed, err, "")
 	} else if result != nil && result.ErrorMessage != "" {
 		*lastErr = fmt.Errorf("%s", result.ErrorMessage)
 		*lastErrType = normalizeExtensionDownloadErrorType(result.ErrorType, result.ErrorMessage)
 		*lastRetryAfterSeconds = result.RetryAfterSeconds
+		attempt.finish(attemptOutcomeFailed, *lastErr, *lastErrType)
 	} else if result == nil {
 		*lastErr = fmt.Errorf("extension returned no download result")
 		*lastErrType = "extension_error"
+		attempt.finish(attemptOutcomeFailed, *lastErr, *lastErrType)
+	} else {
+		attempt.finish(attemptOutcomeFailed, nil, "extension_error")
 	}
 	return nil, false
 }
@@ -175,6 +225,7 @@ func attemptVerifiedResumeBeforeMetadata(
 	req DownloadRequest,
 	selectedProvider string,
 	extManager *extensionManager,
+	trace *downloadAttemptTrace,
 ) (*DownloadResponse, bool) {
 	selectedProvider = strings.TrimSpace(selectedProvider)
 	if selectedProvider == "" || extManager == nil {
@@ -197,6 +248,8 @@ func attemptVerifiedResumeBeforeMetadata(
 	}
 
 	provider := newExtensionProviderWrapper(ext)
+	attempt := trace.begin(selectedProvider, "verified_resume")
+	attempt.bind(provider)
 	var availability *ExtAvailabilityResult
 	trackID := ""
 	if strings.EqualFold(sourceProvider, selectedProvider) {
@@ -213,10 +266,13 @@ func attemptVerifiedResumeBeforeMetadata(
 			req.DurationMS,
 			req.ItemID,
 		)
+		attempt.recordAvailability(availability, err)
 		if shouldAbortCancelledFallback(req.ItemID, err) {
+			attempt.finish(attemptOutcomeCancelled, nil, "cancelled")
 			return nil, true
 		}
 		if err != nil {
+			attempt.finish(attemptOutcomeFailed, err, "")
 			if strings.EqualFold(classifyDownloadErrorType(err.Error()), "verification_required") {
 				return &DownloadResponse{
 					Success:   false,
@@ -228,6 +284,7 @@ func attemptVerifiedResumeBeforeMetadata(
 			return nil, false
 		}
 		if availability == nil || !availability.Available {
+			attempt.finish(attemptOutcomeNotAvailable, nil, "")
 			if shouldStopProviderFallback(availability) {
 				return buildExtensionFallbackStoppedResponse(selectedProvider, availability, nil), false
 			}
@@ -250,6 +307,7 @@ func attemptVerifiedResumeBeforeMetadata(
 		&lastErr,
 		&lastErrType,
 		&lastRetryAfterSeconds,
+		attempt,
 	)
 	if cancelled || resp != nil {
 		return resp, cancelled
@@ -303,7 +361,32 @@ func buildOutputStorageFailureResponse(
 	}
 }
 
+// DownloadWithExtensionFallback walks the provider priority for req and
+// returns the first successful download. Every provider considered is listed
+// in the response's Attempts, in order; the response is returned alongside
+// an error too, so a cancelled walk keeps its trace.
 func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, error) {
+	trace := &downloadAttemptTrace{}
+	resp, err := downloadWithExtensionFallback(req, trace, nil)
+	if resp == nil {
+		resp = &DownloadResponse{
+			Success:   false,
+			Error:     "No extension download providers available",
+			ErrorType: "not_found",
+		}
+		if err != nil {
+			resp.Error = "Download failed: " + err.Error()
+			resp.ErrorType = classifyDownloadErrorType(err.Error())
+		}
+	}
+	resp.Attempts = trace.list()
+	return resp, err
+}
+
+// downloadWithExtensionFallback is the fallback walk shared by real downloads
+// and PlanDownloadJSON. A non-nil planner replaces each provider download with
+// a dry-run match and leaves verification state alone.
+func downloadWithExtensionFallback(req DownloadRequest, trace *downloadAttemptTrace, planner *downloadPlanner) (*DownloadResponse, error) {
 	pipelineStartedAt := time.Now()
 	defer func() {
 		LogDebug(
@@ -314,10 +397,18 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 			extensionDurationMs(time.Since(pipelineStartedAt)),
 		)
 	}()
+	tryProvider := attemptExtensionDownload
 	preparationKey := downloadPreparationKey(req)
+	rememberPreparedRequest := func(req DownloadRequest) {
+		if planner == nil {
+			cachePreparedDownloadRequest(preparationKey, req)
+		}
+	}
 	metadataPrepared := false
 	resumedAfterVerification := false
-	if prepared, preparedMetadata, ok := takePreparedDownloadRequest(preparationKey, req); ok {
+	if planner != nil {
+		tryProvider = planner.attempt
+	} else if prepared, preparedMetadata, ok := takePreparedDownloadRequest(preparationKey, req); ok {
 		req = prepared
 		metadataPrepared = preparedMetadata
 		resumedAfterVerification = true
@@ -380,7 +471,7 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 
 	if resumedAfterVerification && !metadataPrepared {
 		GoLog("[DownloadWithExtensionFallback] Trying verified provider %s before optional metadata enrichment\n", selectedProvider)
-		resp, cancelled := attemptVerifiedResumeBeforeMetadata(req, selectedProvider, extManager)
+		resp, cancelled := attemptVerifiedResumeBeforeMetadata(req, selectedProvider, extManager, trace)
 		if cancelled {
 			return nil, ErrDownloadCancelled
 		}
@@ -396,10 +487,21 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 		ext, err := extManager.GetExtension(req.Source)
 		if err == nil && ext.Enabled && ext.Error == "" && ext.Manifest.IsDownloadProvider() {
 			provider := newExtensionProviderWrapper(ext)
+			attempt := trace.begin(req.Source, "source_preflight")
+			attempt.bind(provider)
 			availability, availErr := provider.CheckAvailabilityForItemID(req.ISRC, req.TrackName, req.ArtistName, req.SpotifyID, req.DeezerID, req.TidalID, req.QobuzID, req.DurationMS, req.ItemID)
+			attempt.recordAvailability(availability, availErr)
 			if shouldAbortCancelledFallback(req.ItemID, availErr) {
 				return nil, ErrDownloadCancelled
 			}
+			switch {
+			case availErr != nil:
+				attempt.finish(attemptOutcomeFailed, availErr, "")
+			case availability != nil && availability.Available:
+				attempt.finish(attemptOutcomeAvailable, nil, "")
+			default:
+				attempt.finish(attemptOutcomeNotAvailable, nil, "")
+			}
 			if availErr != nil {
 				GoLog("[DownloadWithExtensionFallback] Source extension %s preflight failed (non-fatal): %v\n", req.Source, availErr)
 			} else if shouldStopProviderFallback(availability) {
@@ -535,12 +637,14 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 			stopProviderFallback = ext.Manifest.StopsProviderFallback()
 
 			provider := newExtensionProviderWrapper(ext)
+			attempt := trace.begin(req.Source, "source")
+			attempt.bind(provider)
 
 			trackID := resolvePreferredTrackIDForExtension(ext, req, sourceExtensionTrackID)
 
 			GoLog("[DownloadWithExtensionFallback] Downloading from source extension with trackID: %s (stopProviderFallback: %v)\n", trackID, stopProviderFallback)
 
-			resp, cancelledOuter := attemptExtensionDownload(req, ext, provider, trackID, req.Quality, req.Source, true, &lastErr, &lastErrType, &lastRetryAfterSeconds)
+			resp, cancelledOuter := tryProvider(req, ext, provider, trackID, req.Quality, req.Source, true, &lastErr, &lastErrType, &lastRetryAfterSeconds, attempt)
 			if cancelledOuter {
 				return nil, ErrDownloadCancelled
 			}
@@ -563,7 +667,7 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 			}
 			if strings.EqualFold(sourceErrType, "verification_required") {
 				GoLog("[DownloadWithExtensionFallback] Source extension %s requires verification, not trying other providers\n", req.Source)
-				cachePreparedDownloadRequest(preparationKey, req)
+				rememberPreparedRequest(req)
 				return &DownloadResponse{
 					Success:   false,
 					Error:     "Download failed: " + lastErr.Error(),
@@ -588,6 +692,7 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 			}
 		} else {
 			GoLog("[DownloadWithExtensionFallback] Source extension %s not available or not a download provider\n", req.Source)
+			trace.skip(req.Source, "source", "source extension not available or not a download provider")
 		}
 	}
 
@@ -595,8 +700,11 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 	if strings.TrimSpace(healthProtectedProvider) == "" {
 		healthProtectedProvider = req.Source
 	}
-	priority = prioritizeFallbackProvidersByHealth(priority, extManager, healthProtectedProvider)
-	priority = moveProviderToFront(priority, selectedProvider)
+	healthOrdered := prioritizeFallbackProvidersByHealth(priority, extManager, healthProtectedProvider)
+	for _, providerID := range droppedFallbackProviders(priority, healthOrdered) {
+		trace.skip(providerID, "fallback", "service health offline")
+	}
+	priority = moveProviderToFront(healthOrdered, selectedProvider)
 
 	for _, providerID := range priority {
 		if isDownloadCancelled(req.ItemID) {
@@ -615,6 +723,7 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 
 		if providerID != selectedProvider && !isExtensionFallbackAllowed(providerID) {
 			GoLog("[DownloadWithExtensionFallback] Skipping extension provider %s (not enabled for fallback)\n", providerID)
+			trace.skip(providerID, "fallback", "not enabled for fallback")
 			continue
 		}
 
@@ -624,27 +733,37 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 			ext, err := extManager.GetExtension(providerID)
 			if err != nil || !ext.Enabled || ext.Error != "" {
 				GoLog("[DownloadWithExtensionFallback] Extension %s not available\n", providerID)
+				trace.skip(providerID, "fallback", "extension not loaded, disabled or in error state")
 				continue
 			}
 
 			if !ext.Manifest.IsDownloadProvider() {
+				trace.skip(providerID, "fallback", "not a download provider")
 				continue
 			}
 
 			provider := newExtensionProviderWrapper(ext)
+			attempt := trace.begin(providerID, "fallback")
+			attempt.bind(provider)
 
 			availability, err := provider.CheckAvailabilityForItemID(req.ISRC, req.TrackName, req.ArtistName, req.SpotifyID, req.DeezerID, req.TidalID, req.QobuzID, req.DurationMS, req.ItemID)
+			attempt.recordAvailability(availability, err)
 			if shouldAbortCancelledFallback(req.ItemID, err) {
 				return nil, ErrDownloadCancelled
 			}
 			terminalAvailability := shouldStopProviderFallback(availability)
 			if err != nil || !availability.Available {
 				GoLog("[DownloadWithExtensionFallback] %s: not available\n", providerID)
+				if err != nil {
+					attempt.finish(attemptOutcomeFailed, err, "")
+				} else {
+					attempt.finish(attemptOutcomeNotAvailable, nil, "")
+				}
 				if err != nil {
 					lastErr = err
 					if strings.EqualFold(classifyDownloadErrorType(err.Error()), "verification_required") {
 						GoLog("[DownloadWithExtensionFallback] %s requires verification (availability); pausing fallback to open the challenge\n", providerID)
-						cachePreparedDownloadRequest(preparationKey, req)
+						rememberPreparedRequest(req)
 						return &DownloadResponse{
 							Success:   false,
 							Error:     "Download failed: " + err.Error(),
@@ -685,7 +804,7 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 				}
 			}
 
-			resp, cancelledOuter := attemptExtensionDownload(req, ext, provider, availability.TrackID, fallbackQuality, providerID, false, &lastErr, &lastErrType, &lastRetryAfterSeconds)
+			resp, cancelledOuter := tryProvider(req, ext, provider, availability.TrackID, fallbackQuality, providerID, false, &lastErr, &lastErrType, &lastRetryAfterSeconds, attempt)
 			if cancelledOuter {
 				return nil, ErrDownloadCancelled
 			}
@@ -709,7 +828,7 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 				}
 				if strings.EqualFold(effType, "verification_required") {
 					GoLog("[DownloadWithExtensionFallback] %s requires verification; pausing fallback to open the challenge\n", providerID)
-					cachePreparedDownloadRequest(preparationKey, req)
+					rememberPreparedRequest(req)
 					return &DownloadResponse{
 						Success:           false,
 						Error:             "Download failed: " + lastErr.Error(),
@@ -359,6 +359,26 @@ func prioritizeFallbackProvidersByHealth(priority []string, extManager *extensio
 	return result
 }
 
+// droppedFallbackProviders returns the providers in before that
+// prioritizeFallbackProvidersByHealth left out of after.
+func droppedFallbackProviders(before, after []string) []string {
+	kept := make(map[string]struct{}, len(after))
+	for _, providerID := range after {
+		kept[strings.ToLower(strings.TrimSpace(providerID))] = struct{}{}
+	}
+	var dropped []string
+	for _, providerID := range before {
+		providerID = strings.TrimSpace(providerID)
+		if providerID == "" {
+			continue
+		}
+		if _, ok := kept[strings.ToLower(providerID)]; !ok {
+			dropped = append(dropped, providerID)
+		}
+	}
+	return dropped
+}
+
 // moveProviderToFront preserves the user's explicit provider selection after
 // health-based fallback sorting. Health may order the remaining fallback
 // candidates, but it must never silently replace the provider the user picked.
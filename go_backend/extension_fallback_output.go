@@ -154,6 +154,11 @@ func embedExtensionDownloadMetadata(resp DownloadResponse, req DownloadRequest,
 	if req.EmbedLyrics {
 		metadata.Lyrics = resp.LyricsLRC
 	}
+	ids := downloadRequestProviderIDs(req)
+	metadata.SpotifyID = ids["spotify"]
+	metadata.DeezerID = ids["deezer"]
+	metadata.TidalID = ids["tidal"]
+	metadata.QobuzID = ids["qobuz"]
 
 	var err error
 	if len(coverData) > 0 {
@@ -173,6 +178,32 @@ func embedExtensionDownloadMetadata(resp DownloadResponse, req DownloadRequest,
 	}
 }
 
+// downloadRequestProviderIDs collects the request's provider track IDs.
+// SpotifyID carries other providers' IDs with a "deezer:"-style prefix when
+// the track came from that provider's catalog.
+func downloadRequestProviderIDs(req DownloadRequest) map[string]string {
+	ids := map[string]string{
+		"deezer": strings.TrimSpace(req.DeezerID),
+		"tidal":  strings.TrimSpace(req.TidalID),
+		"qobuz":  strings.TrimSpace(req.QobuzID),
+	}
+	spotifyID := strings.TrimSpace(req.SpotifyID)
+	for _, provider := range []string{"deezer", "tidal", "qobuz"} {
+		if trimmed := trimKnownProviderPrefix(spotifyID, provider); trimmed != spotifyID {
+			if ids[provider] == "" {
+				ids[provider] = trimmed
+			}
+			spotifyID = ""
+			break
+		}
+	}
+	// Extension-specific IDs ("provider:id") are not Spotify IDs.
+	if spotifyID = trimKnownProviderPrefix(spotifyID, "spotify"); !strings.Contains(spotifyID, ":") {
+		ids["spotify"] = spotifyID
+	}
+	return ids
+}
+
 func firstPositiveInt(values ...int) int {
 	for _, value := range values {
 		if value > 0 {
@@ -16,16 +16,37 @@ type extensionCallPerf struct {
 	parseMs      float64
 	items        int
 	payloadBytes int
+	logEnabled   bool
+	sink         func(ExtensionCallTiming)
+}
+
+// ExtensionCallTiming is the finished breakdown of one extension call, handed
+// to a perf sink (e.g. the download attempt trace) independent of logging.
+type ExtensionCallTiming struct {
+	Operation string  `json:"operation"`
+	TotalMs   float64 `json:"total_ms"`
+	InitMs    float64 `json:"init_ms"`
+	JSMs      float64 `json:"js_ms"`
+	ParseMs   float64 `json:"parse_ms"`
 }
 
 func newExtensionCallPerf(extensionID, operation string) *extensionCallPerf {
-	if !GetLogBuffer().IsLoggingEnabled() {
+	return newExtensionCallPerfWithSink(extensionID, operation, nil)
+}
+
+// newExtensionCallPerfWithSink returns nil (a no-op tracker) only when
+// logging is off and nobody consumes the timings.
+func newExtensionCallPerfWithSink(extensionID, operation string, sink func(ExtensionCallTiming)) *extensionCallPerf {
+	logEnabled := GetLogBuffer().IsLoggingEnabled()
+	if !logEnabled && sink == nil {
 		return nil
 	}
 	return &extensionCallPerf{
 		extensionID: extensionID,
 		operation:   operation,
 		startedAt:   time.Now(),
+		logEnabled:  logEnabled,
+		sink:        sink,
 	}
 }
 
@@ -81,12 +102,25 @@ func (p *extensionCallPerf) finish() {
 	if p == nil {
 		return
 	}
+	totalMs := extensionDurationMs(time.Since(p.startedAt))
+	if p.sink != nil {
+		p.sink(ExtensionCallTiming{
+			Operation: p.operation,
+			TotalMs:   totalMs,
+			InitMs:    p.initMs,
+			JSMs:      p.jsMs,
+			ParseMs:   p.parseMs,
+		})
+	}
+	if !p.logEnabled {
+		return
+	}
 	LogDebug(
 		"ExtensionPerf",
 		"extension=%s op=%s totalMs=%.1f initMs=%.1f jsMs=%.1f parseMs=%.1f items=%d payloadBytes=%d",
 		p.extensionID,
 		p.operation,
-		extensionDurationMs(time.Since(p.startedAt)),
+		totalMs,
 		p.initMs,
 		p.jsMs,
 		p.parseMs,
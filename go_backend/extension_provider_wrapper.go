@@ -13,6 +13,9 @@ import (
 type extensionProviderWrapper struct {
 	extension *loadedExtension
 	vm        *goja.Runtime
+	// perfSink, when set, receives the timing breakdown of every call made
+	// through this wrapper (used by the download attempt trace).
+	perfSink func(ExtensionCallTiming)
 }
 
 func newExtensionProviderWrapper(ext *loadedExtension) *extensionProviderWrapper {
@@ -59,7 +62,7 @@ type extCallOpts struct {
 func callExtension[T any](p *extensionProviderWrapper, opts extCallOpts, parse func(perf *extensionCallPerf, result goja.Value) (T, error)) (T, error) {
 	var zero T
 
-	perf := newExtensionCallPerf(p.extension.ID, opts.perfName)
+	perf := newExtensionCallPerfWithSink(p.extension.ID, opts.perfName, p.perfSink)
 	defer perf.finish()
 	initStartedAt := time.Now()
 	if err := p.lockReadyVM(); err != nil {
@@ -445,7 +448,7 @@ func (p *extensionProviderWrapper) EnrichTrackForItemID(track *ExtTrackMetadata,
 	if !p.extension.Enabled {
 		return track, nil
 	}
-	perf := newExtensionCallPerf(p.extension.ID, "enrichTrack")
+	perf := newExtensionCallPerfWithSink(p.extension.ID, "enrichTrack", p.perfSink)
 	defer perf.finish()
 	initStartedAt := time.Now()
 	if err := p.lockReadyVM(); err != nil {
@@ -570,8 +573,19 @@ func (p *extensionProviderWrapper) Download(trackID, quality, outputPath, itemID
 	if !p.extension.Enabled {
 		return nil, fmt.Errorf("extension '%s' is disabled", p.extension.ID)
 	}
-	perf := newExtensionCallPerf(p.extension.ID, "download")
+	perf := newExtensionCallPerfWithSink(p.extension.ID, "download", p.perfSink)
 	defer perf.finish()
+	if itemID != "" {
+		initDownloadCancel(itemID)
+		defer clearDownloadCancel(itemID)
+	}
+	// Wait for a provider slot before taking an isolated runtime so queued
+	// downloads do not each pin a VM while they wait.
+	releaseSlot, err := acquireProviderDownloadSlot(p.extension.ID, itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseSlot()
 	initStartedAt := time.Now()
 	vm, runtime, err := acquireIsolatedExtensionRuntime(p.extension)
 	perf.recordInit(time.Since(initStartedAt))
@@ -592,8 +606,6 @@ func (p *extensionProviderWrapper) Download(trackID, quality, outputPath, itemID
 		defer runtime.clearActiveDownloadItemID()
 	}
 	if itemID != "" {
-		initDownloadCancel(itemID)
-		defer clearDownloadCancel(itemID)
 		SetItemPreparing(itemID)
 	}
 
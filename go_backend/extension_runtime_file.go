@@ -130,6 +130,8 @@ func (r *extensionRuntime) fileDownload(call goja.FunctionCall) goja.Value {
 	var headers map[string]string
 	var chunkedDownload bool
 	var resumeDownload bool
+	var resumeKey string
+	var parallelSegments int
 	trackItemBytes := true
 	var chunkSize int64
 	if len(call.Arguments) > 2 && !goja.IsUndefined(call.Arguments[2]) && !goja.IsNull(call.Arguments[2]) {
@@ -176,6 +178,12 @@ func (r *extensionRuntime) fileDownload(call goja.FunctionCall) goja.Value {
 					resumeDownload = v
 				}
 			}
+			if key, ok := opts["resumeKey"].(string); ok {
+				resumeKey = strings.TrimSpace(key)
+			}
+			if parallel, ok := opts["parallel"]; ok {
+				parallelSegments = parseParallelSegmentsOption(parallel)
+			}
 		}
 	}
 
@@ -199,10 +207,20 @@ func (r *extensionRuntime) fileDownload(call goja.FunctionCall) goja.Value {
 		ua = h
 	}
 
+	if parallelSegments > 1 {
+		return r.fileDownloadParallel(client, urlStr, fullPath, headers, ua, chunkSize, parallelSegments, onProgress, trackItemBytes, resumeDownload, resumeKey)
+	}
 	if chunkedDownload {
 		return r.fileDownloadChunked(client, urlStr, fullPath, headers, ua, chunkSize, onProgress, trackItemBytes)
 	}
+	return r.fileDownloadStream(client, urlStr, fullPath, headers, onProgress, trackItemBytes, resumeDownload, resumeKey)
+}
 
+// fileDownloadStream downloads a URL as a single streamed response, with
+// optional If-Range resumes after mid-body network errors. With resume
+// enabled it also checkpoints a sidecar manifest so a call after a process
+// restart continues from the last fsynced byte.
+func (r *extensionRuntime) fileDownloadStream(client *http.Client, urlStr, fullPath string, headers map[string]string, onProgress goja.Callable, trackItemBytes, resumeDownload bool, resumeKey string) goja.Value {
 	unlock := lockDownloadOutputPath(fullPath)
 	defer unlock()
 
@@ -226,7 +244,27 @@ func (r *extensionRuntime) fileDownload(call goja.FunctionCall) goja.Value {
 		return req, wd, nil
 	}
 
-	req, wd, err := buildReq(0, "")
+	// Mid-body resume is opt-in because switching networks can route a stable
+	// URL to a different CDN object even when its validator is unchanged. The
+	// safe default is to fail and delete the staged partial file. Extensions
+	// that know their origin supports byte-identical Range resumes can request
+	// it explicitly with { resume: true }.
+	_, callerSetRange := headers["Range"]
+	resumable := resumeDownload && !callerSetRange
+	stagedPath := stagedDownloadPath(fullPath)
+	var resumeFrom int64
+	var manifest *downloadResumeManifest
+	if resumable {
+		manifest = loadDownloadResumeManifest(fullPath, urlStr, resumeKey)
+	}
+	if manifest != nil {
+		resumeFrom = manifest.BytesWritten
+		GoLog("[Extension:%s] Resuming staged download of %s at %d bytes\n", r.extensionID, fullPath, resumeFrom)
+	} else {
+		discardDownloadResumeState(fullPath)
+	}
+
+	req, wd, err := buildReq(resumeFrom, manifest.validator())
 	if err != nil {
 		return r.jsError("%s", err.Error())
 	}
@@ -240,6 +278,28 @@ func (r *extensionRuntime) fileDownload(call goja.FunctionCall) goja.Value {
 		return r.jsError("%s", err.Error())
 	}
 
+	if resumeFrom > 0 && (resp.StatusCode == http.StatusRequestedRangeNotSatisfiable ||
+		resp.StatusCode == http.StatusPartialContent && !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", resumeFrom))) {
+		// The stored offset no longer fits the object; start over.
+		GoLog("[Extension:%s] Staged download of %s cannot continue (HTTP %d), restarting\n", r.extensionID, fullPath, resp.StatusCode)
+		resp.Body.Close()
+		wd.stop()
+		discardDownloadResumeState(fullPath)
+		resumeFrom = 0
+		manifest = nil
+		req, wd, err = buildReq(0, "")
+		if err != nil {
+			return r.jsError("%s", err.Error())
+		}
+		resp, err = client.Do(req)
+		if err != nil {
+			if wd.stalled.Load() {
+				return r.stallError()
+			}
+			return r.jsError("%s", err.Error())
+		}
+	}
+
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		resp.Body.Close()
 		return r.jsError("HTTP error: %d", resp.StatusCode)
@@ -248,18 +308,40 @@ func (r *extensionRuntime) fileDownload(call goja.FunctionCall) goja.Value {
 	// Stream into a staged sibling and promote via rename on success so a
 	// killed process can never leave a partial file under the final name
 	// (the duplicate check would then accept it as complete forever).
-	stagedPath := stagedDownloadPath(fullPath)
-	os.Remove(stagedPath)
-	out, err := os.Create(stagedPath)
+	resumed := resumeFrom > 0 && resp.StatusCode == http.StatusPartialContent
+	var out *os.File
+	if resumed {
+		out, err = os.OpenFile(stagedPath, os.O_WRONLY, 0644)
+		if err == nil {
+			if err = out.Truncate(resumeFrom); err == nil {
+				_, err = out.Seek(resumeFrom, io.SeekStart)
+			}
+		}
+	} else {
+		if resumeFrom > 0 {
+			// 200 to a conditional Range: the object changed, so the staged
+			// bytes are stale.
+			discardDownloadResumeState(fullPath)
+			manifest = nil
+		}
+		out, err = os.Create(stagedPath)
+	}
 	if err != nil {
 		resp.Body.Close()
+		if out != nil {
+			out.Close()
+		}
+		discardDownloadResumeState(fullPath)
 		return r.jsError("failed to create file: %v", err)
 	}
 	promoted := false
+	// keepStaged leaves the staged file and manifest for a later call after a
+	// resumable network failure. Cancels and local write errors discard them.
+	keepStaged := false
 	defer func() {
 		out.Close()
-		if !promoted {
-			os.Remove(stagedPath)
+		if !promoted && !keepStaged {
+			discardDownloadResumeState(fullPath)
 		}
 	}()
 
@@ -268,30 +350,53 @@ func (r *extensionRuntime) fileDownload(call goja.FunctionCall) goja.Value {
 		SetItemDownloading(activeItemID)
 	}
 
+	var written int64
 	contentLength := resp.ContentLength
+	if resumed {
+		written = resumeFrom
+		contentLength = contentRangeTotal(resp.Header.Get("Content-Range"))
+	}
 	shouldTrackItemBytes := activeItemID != "" && trackItemBytes
 	if shouldTrackItemBytes && contentLength > 0 {
 		SetItemBytesTotal(activeItemID, contentLength)
 	}
 
 	makeProgressWriter := func() interface{ Write([]byte) (int, error) } {
-		if shouldTrackItemBytes {
-			return NewItemProgressWriter(out, activeItemID)
+		writer := newDownloadOutputWriter(out, activeItemID, shouldTrackItemBytes)
+		if pw, ok := writer.(*ItemProgressWriter); ok && written > 0 {
+			pw.resumeFrom(written)
 		}
-		return out
+		return writer
 	}
 	progressWriter := makeProgressWriter()
 
-	// resumeValidator picks a validator usable with If-Range: a strong ETag or
-	// Last-Modified. Weak ETags (W/...) are not valid for If-Range.
-	resumeValidator := func(h http.Header) string {
-		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
-			return etag
+	validator := downloadResumeValidator(resp.Header)
+	if resumed && validator == "" {
+		validator = manifest.validator()
+	}
+	if resumable && manifest == nil {
+		manifest = newDownloadResumeManifest(urlStr, resumeKey, resp.Header, contentLength)
+	}
+	canResume := resumable && validator != ""
+
+	var lastCheckpoint int64 = written
+	// checkpoint fsyncs the staged bytes and records them in the manifest;
+	// only synced bytes are ever resumed from.
+	checkpoint := func() {
+		if manifest == nil || written <= lastCheckpoint {
+			return
+		}
+		if err := out.Sync(); err != nil {
+			return
 		}
-		return h.Get("Last-Modified")
+		manifest.BytesWritten = written
+		if err := saveDownloadResumeManifest(fullPath, manifest); err != nil {
+			GoLog("[Extension:%s] Failed to save resume manifest for %s: %v\n", r.extensionID, fullPath, err)
+			return
+		}
+		lastCheckpoint = written
 	}
 
-	var written int64
 	var lastProgressNotify int64
 	buf := make([]byte, 32*1024)
 
@@ -312,6 +417,9 @@ func (r *extensionRuntime) fileDownload(call goja.FunctionCall) goja.Value {
 					}
 				}
 				written += int64(nw)
+				// The bandwidth cap may have held this write; do not count
+				// that wait against the stall watchdog.
+				wd.reset()
 				if ew != nil {
 					if ew == ErrDownloadCancelled {
 						return r.jsError("download cancelled"), nil
@@ -321,6 +429,9 @@ func (r *extensionRuntime) fileDownload(call goja.FunctionCall) goja.Value {
 				if nr != nw {
 					return r.jsError("short write"), nil
 				}
+				if written-lastCheckpoint >= downloadResumeCheckpointBytes {
+					checkpoint()
+				}
 
 				// Throttle the JS callback like the native progress writer:
 				// per-read invocation is interpreter work inside the copy loop.
@@ -339,15 +450,6 @@ func (r *extensionRuntime) fileDownload(call goja.FunctionCall) goja.Value {
 		}
 	}
 
-	// Mid-body resume is opt-in because switching networks can route a stable
-	// URL to a different CDN object even when its validator is unchanged. The
-	// safe default is to fail and delete the staged partial file. Extensions
-	// that know their origin supports byte-identical Range resumes can request
-	// it explicitly with { resume: true }.
-	validator := resumeValidator(resp.Header)
-	_, callerSetRange := headers["Range"]
-	canResume := resumeDownload && validator != "" && !callerSetRange
-
 	const maxResumes = 3
 	resumes := 0
 	for {
@@ -360,8 +462,12 @@ func (r *extensionRuntime) fileDownload(call goja.FunctionCall) goja.Value {
 		}
 
 		stalled := wd.stalled.Load()
-		if !canResume || resumes >= maxResumes ||
-			(activeItemID != "" && isDownloadCancelled(activeItemID)) {
+		cancelled := activeItemID != "" && isDownloadCancelled(activeItemID)
+		if !canResume || resumes >= maxResumes || cancelled {
+			if canResume && !cancelled {
+				checkpoint()
+				keepStaged = manifest != nil
+			}
 			if stalled {
 				return r.stallError()
 			}
@@ -379,6 +485,8 @@ func (r *extensionRuntime) fileDownload(call goja.FunctionCall) goja.Value {
 		}
 		resp, err = client.Do(resumeReq)
 		if err != nil {
+			checkpoint()
+			keepStaged = manifest != nil
 			if wd.stalled.Load() {
 				return r.stallError()
 			}
@@ -404,6 +512,7 @@ func (r *extensionRuntime) fileDownload(call goja.FunctionCall) goja.Value {
 				return r.jsError("failed to restart download: %v", err)
 			}
 			written = 0
+			lastCheckpoint = 0
 			progressWriter = makeProgressWriter()
 			if resp.ContentLength > 0 {
 				contentLength = resp.ContentLength
@@ -411,15 +520,25 @@ func (r *extensionRuntime) fileDownload(call goja.FunctionCall) goja.Value {
 					SetItemBytesTotal(activeItemID, contentLength)
 				}
 			}
-			validator = resumeValidator(resp.Header)
-			canResume = resumeDownload && validator != ""
+			validator = downloadResumeValidator(resp.Header)
+			canResume = resumable && validator != ""
+			manifest = nil
+			if canResume {
+				manifest = newDownloadResumeManifest(urlStr, resumeKey, resp.Header, contentLength)
+			}
 		default:
 			code := resp.StatusCode
 			resp.Body.Close()
+			checkpoint()
+			keepStaged = manifest != nil
 			return r.jsError("resume failed: HTTP %d at %d bytes", code, written)
 		}
 	}
 
+	if contentLength > 0 && written != contentLength {
+		return r.jsError("download incomplete: received %d of %d bytes", written, contentLength)
+	}
+
 	if shouldTrackItemBytes {
 		if contentLength > 0 {
 			SetItemProgress(activeItemID, float64(written)/float64(contentLength), written, contentLength)
@@ -440,16 +559,27 @@ func (r *extensionRuntime) fileDownload(call goja.FunctionCall) goja.Value {
 		return r.jsError("failed to publish file: %v", err)
 	}
 	promoted = true
+	os.Remove(downloadResumeManifestPath(fullPath))
 	syncDir(filepath.Dir(fullPath))
 
 	GoLog("[Extension:%s] Downloaded %d bytes to %s\n", r.extensionID, written, fullPath)
 
 	return r.jsSuccess(map[string]any{
-		"path": fullPath,
-		"size": written,
+		"path":    fullPath,
+		"size":    written,
+		"resumed": resumed,
 	})
 }
 
+// downloadResumeValidator picks a validator usable with If-Range: a strong
+// ETag or Last-Modified. Weak ETags (W/...) are not valid for If-Range.
+func downloadResumeValidator(h http.Header) string {
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return h.Get("Last-Modified")
+}
+
 // fileDownloadChunked downloads a URL using sequential Range requests.
 // This is needed for servers (like YouTube's googlevideo CDN) that reject
 // non-ranged or large-range requests with 403 and require small chunk downloads.
@@ -534,10 +664,7 @@ func (r *extensionRuntime) fileDownloadChunked(client *http.Client, urlStr, full
 		SetItemBytesTotal(activeItemID, totalSize)
 	}
 
-	var progressWriter interface{ Write([]byte) (int, error) } = out
-	if shouldTrackItemBytes {
-		progressWriter = NewItemProgressWriter(out, activeItemID)
-	}
+	progressWriter := newDownloadOutputWriter(out, activeItemID, shouldTrackItemBytes)
 
 	var totalWritten int64
 	var lastProgressNotify int64
@@ -610,6 +737,7 @@ func (r *extensionRuntime) fileDownloadChunked(client *http.Client, urlStr, full
 				}
 				chunkWritten += int64(nw)
 				totalWritten += int64(nw)
+				wd.reset()
 				if ew != nil {
 					chunkResp.Body.Close()
 					if ew == ErrDownloadCancelled {
@@ -0,0 +1,429 @@
+package gobackend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+const (
+	defaultParallelSegments = 4
+	maxParallelSegments     = 8
+	// minParallelSegmentSize keeps small files from being split into ranges
+	// whose request overhead outweighs the extra connections.
+	minParallelSegmentSize = 1024 * 1024
+	parallelSegmentRetries = 3
+)
+
+// errParallelRangeUnsupported means the origin stopped honoring Range (200 or
+// 416) partway through, so the download restarts as a single stream.
+var errParallelRangeUnsupported = errors.New("range requests not honored")
+
+func parseParallelSegmentsOption(value any) int {
+	var n int64
+	switch v := value.(type) {
+	case bool:
+		if v {
+			n = defaultParallelSegments
+		}
+	case int64:
+		n = v
+	case float64:
+		n = int64(v)
+	}
+	if n <= 1 {
+		return 0
+	}
+	if n > maxParallelSegments {
+		return maxParallelSegments
+	}
+	return int(n)
+}
+
+type downloadSegment struct {
+	start, end int64 // inclusive
+}
+
+// splitDownloadSegments cuts [0,total) into ranges of segmentSize, or of
+// total/connections (at least minParallelSegmentSize) when segmentSize is 0.
+func splitDownloadSegments(total, segmentSize int64, connections int) []downloadSegment {
+	if total <= 0 {
+		return nil
+	}
+	if segmentSize <= 0 {
+		segmentSize = (total + int64(connections) - 1) / int64(connections)
+		if segmentSize < minParallelSegmentSize {
+			segmentSize = minParallelSegmentSize
+		}
+	}
+	segments := make([]downloadSegment, 0, (total+segmentSize-1)/segmentSize)
+	for start := int64(0); start < total; start += segmentSize {
+		end := start + segmentSize - 1
+		if end >= total {
+			end = total - 1
+		}
+		segments = append(segments, downloadSegment{start: start, end: end})
+	}
+	return segments
+}
+
+// fileDownloadParallel downloads a URL as concurrent Range requests written
+// into a preallocated staged file. Origins that do not return 206 with a
+// known size fall back to fileDownloadStream.
+func (r *extensionRuntime) fileDownloadParallel(client *http.Client, urlStr, fullPath string, headers map[string]string, ua string, segmentSize int64, connections int, onProgress goja.Callable, trackItemBytes, resumeDownload bool, resumeKey string) goja.Value {
+	probeReq, err := http.NewRequest("GET", urlStr, nil)
+	if err != nil {
+		return r.jsError("parallel: probe request error: %v", err)
+	}
+	probeReq = r.bindDownloadCancelContext(probeReq)
+	probeReq, probeWd := bindStallWatchdog(probeReq, downloadStallTimeout)
+	probeReq.Header.Set("User-Agent", ua)
+	for k, v := range headers {
+		if k != "Range" {
+			probeReq.Header.Set(k, v)
+		}
+	}
+	probeReq.Header.Set("Range", "bytes=0-1")
+
+	probeResp, err := client.Do(probeReq)
+	if err != nil {
+		stalled := probeWd.stalled.Load()
+		probeWd.stop()
+		if stalled {
+			return r.stallError()
+		}
+		return r.jsError("parallel: probe error: %v", err)
+	}
+	io.Copy(io.Discard, probeResp.Body)
+	probeResp.Body.Close()
+	probeWd.stop()
+
+	var totalSize int64
+	if probeResp.StatusCode == http.StatusPartialContent {
+		totalSize = contentRangeTotal(probeResp.Header.Get("Content-Range"))
+	}
+	switch {
+	case probeResp.StatusCode == http.StatusOK || probeResp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		GoLog("[Extension:%s] Parallel download: probe HTTP %d, falling back to a single stream\n", r.extensionID, probeResp.StatusCode)
+		return r.fileDownloadStream(client, urlStr, fullPath, headers, onProgress, trackItemBytes, resumeDownload, resumeKey)
+	case probeResp.StatusCode != http.StatusPartialContent:
+		return r.jsError("parallel: probe HTTP %d", probeResp.StatusCode)
+	case totalSize <= 0:
+		GoLog("[Extension:%s] Parallel download: unknown total size, falling back to a single stream\n", r.extensionID)
+		return r.fileDownloadStream(client, urlStr, fullPath, headers, onProgress, trackItemBytes, resumeDownload, resumeKey)
+	}
+
+	segments := splitDownloadSegments(totalSize, segmentSize, connections)
+	if len(segments) < connections {
+		connections = len(segments)
+	}
+	GoLog("[Extension:%s] Parallel download: %d bytes in %d segments over %d connections\n", r.extensionID, totalSize, len(segments), connections)
+
+	result, fallback := r.downloadSegments(client, urlStr, fullPath, headers, ua, downloadResumeValidator(probeResp.Header), totalSize, segments, connections, onProgress, trackItemBytes)
+	if fallback {
+		GoLog("[Extension:%s] Parallel download: server stopped honoring Range, restarting as a single stream\n", r.extensionID)
+		return r.fileDownloadStream(client, urlStr, fullPath, headers, onProgress, trackItemBytes, resumeDownload, resumeKey)
+	}
+	return result
+}
+
+func contentRangeTotal(contentRange string) int64 {
+	idx := strings.LastIndex(contentRange, "/")
+	if idx < 0 {
+		return 0
+	}
+	var total int64
+	if _, err := fmt.Sscanf(contentRange[idx+1:], "%d", &total); err != nil {
+		return 0
+	}
+	return total
+}
+
+// downloadSegments fetches segments with up to connections workers. One stall
+// watchdog covers the whole transfer: any segment receiving data resets it, so
+// it fires only when every connection has gone quiet. fallback reports that the
+// origin refused a range and nothing was published.
+func (r *extensionRuntime) downloadSegments(client *http.Client, urlStr, fullPath string, headers map[string]string, ua, validator string, totalSize int64, segments []downloadSegment, connections int, onProgress goja.Callable, trackItemBytes bool) (result goja.Value, fallback bool) {
+	unlock := lockDownloadOutputPath(fullPath)
+	defer unlock()
+
+	// Segments are not resumable: drop any single-stream resume state, or a
+	// later attempt would trust a manifest for bytes written here.
+	stagedPath := stagedDownloadPath(fullPath)
+	discardDownloadResumeState(fullPath)
+	out, err := os.Create(stagedPath)
+	if err != nil {
+		return r.jsError("failed to create file: %v", err), false
+	}
+	promoted := false
+	defer func() {
+		out.Close()
+		if !promoted {
+			discardDownloadResumeState(fullPath)
+		}
+	}()
+	if err := out.Truncate(totalSize); err != nil {
+		return r.jsError("failed to preallocate file: %v", err), false
+	}
+
+	activeItemID := r.getActiveDownloadItemID()
+	if activeItemID != "" {
+		SetItemDownloading(activeItemID)
+	}
+	shouldTrackItemBytes := activeItemID != "" && trackItemBytes
+	if shouldTrackItemBytes {
+		SetItemBytesTotal(activeItemID, totalSize)
+	}
+
+	baseReq, err := http.NewRequest("GET", urlStr, nil)
+	if err != nil {
+		return r.jsError("%s", err.Error()), false
+	}
+	baseReq = r.bindDownloadCancelContext(baseReq)
+	baseReq, wd := bindStallWatchdog(baseReq, downloadStallTimeout)
+	defer wd.stop()
+	ctx, abort := context.WithCancel(baseReq.Context())
+	defer abort()
+
+	// Every segment reports through one writer chain so ItemProgressWriter
+	// sees the aggregate byte count and speed, and the bandwidth cap applies
+	// to the sum of all connections.
+	var accountMu sync.Mutex
+	account := newDownloadOutputWriter(io.Discard, activeItemID, shouldTrackItemBytes)
+	var written atomic.Int64
+	onData := func(p []byte) error {
+		accountMu.Lock()
+		defer accountMu.Unlock()
+		wd.reset()
+		_, err := account.Write(p)
+		// The bandwidth cap may have held this write; do not count that wait
+		// against the stall watchdog.
+		wd.reset()
+		written.Add(int64(len(p)))
+		return err
+	}
+
+	jobs := make(chan downloadSegment)
+	var firstErr error
+	var errOnce sync.Once
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			abort()
+		})
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < connections; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, 32*1024)
+			for seg := range jobs {
+				if err := r.fetchDownloadSegment(ctx, client, urlStr, headers, ua, validator, seg, out, buf, onData); err != nil {
+					fail(err)
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, seg := range segments {
+			select {
+			case jobs <- seg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	// goja is single-threaded, so onProgress runs here rather than in the
+	// workers.
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	var lastProgressNotify int64
+	notify := func() {
+		current := written.Load()
+		if onProgress != nil && (current-lastProgressNotify >= progressUpdateThreshold || current >= totalSize) && current != lastProgressNotify {
+			lastProgressNotify = current
+			_, _ = onProgress(goja.Undefined(), r.vm.ToValue(current), r.vm.ToValue(totalSize))
+		}
+	}
+wait:
+	for {
+		select {
+		case <-done:
+			break wait
+		case <-ticker.C:
+			notify()
+		}
+	}
+
+	if firstErr != nil {
+		switch {
+		case errors.Is(firstErr, errParallelRangeUnsupported):
+			return nil, true
+		case activeItemID != "" && isDownloadCancelled(activeItemID), errors.Is(firstErr, ErrDownloadCancelled):
+			return r.jsError("download cancelled"), false
+		case wd.stalled.Load():
+			return r.stallError(), false
+		default:
+			return r.jsError("parallel: %v", firstErr), false
+		}
+	}
+
+	total := written.Load()
+	info, err := out.Stat()
+	if err != nil {
+		return r.jsError("failed to verify file: %v", err), false
+	}
+	if total != totalSize || info.Size() != totalSize {
+		return r.jsError("parallel: size mismatch: received %d of %d bytes (file %d)", total, totalSize, info.Size()), false
+	}
+	notify()
+
+	if shouldTrackItemBytes {
+		SetItemProgress(activeItemID, 1, total, totalSize)
+	}
+
+	// Sync before the promote rename so a power loss right after the rename
+	// cannot leave a truncated file under the final name.
+	if err := out.Sync(); err != nil {
+		return r.jsError("failed to sync file: %v", err), false
+	}
+	if err := out.Close(); err != nil {
+		return r.jsError("failed to finalize file: %v", err), false
+	}
+	if err := os.Rename(stagedPath, fullPath); err != nil {
+		return r.jsError("failed to publish file: %v", err), false
+	}
+	promoted = true
+	syncDir(filepath.Dir(fullPath))
+
+	GoLog("[Extension:%s] Parallel download complete: %d bytes to %s\n", r.extensionID, total, fullPath)
+
+	return r.jsSuccess(map[string]any{
+		"path": fullPath,
+		"size": total,
+	}), false
+}
+
+// fetchDownloadSegment writes seg into out at its offset, re-requesting the
+// unfinished tail after network errors and 403/429 responses.
+func (r *extensionRuntime) fetchDownloadSegment(ctx context.Context, client *http.Client, urlStr string, headers map[string]string, ua, validator string, seg downloadSegment, out *os.File, buf []byte, onData func([]byte) error) error {
+	pos := seg.start
+	var lastErr error
+	for attempt := 0; attempt < parallelSegmentRetries && pos <= seg.end; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(attempt) * time.Second):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("User-Agent", ua)
+		for k, v := range headers {
+			if k != "Range" {
+				req.Header.Set(k, v)
+			}
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", pos, seg.end))
+		if validator != "" {
+			req.Header.Set("If-Range", validator)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			lastErr = err
+			continue
+		}
+		switch resp.StatusCode {
+		case http.StatusPartialContent:
+		case http.StatusOK, http.StatusRequestedRangeNotSatisfiable:
+			resp.Body.Close()
+			return errParallelRangeUnsupported
+		case http.StatusForbidden, http.StatusTooManyRequests:
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			lastErr = fmt.Errorf("HTTP %d at offset %d", resp.StatusCode, pos)
+			continue
+		default:
+			resp.Body.Close()
+			return fmt.Errorf("HTTP %d at offset %d", resp.StatusCode, pos)
+		}
+		if cr := resp.Header.Get("Content-Range"); !strings.HasPrefix(cr, fmt.Sprintf("bytes %d-", pos)) {
+			resp.Body.Close()
+			return fmt.Errorf("unexpected Content-Range %q at offset %d", cr, pos)
+		}
+
+		// fatal errors (local write failure, cancel) end the segment; readErr
+		// is a network error worth re-requesting the remaining range for.
+		fatal, readErr := func() (fatal, readErr error) {
+			defer resp.Body.Close()
+			for pos <= seg.end {
+				want := int64(len(buf))
+				if remaining := seg.end - pos + 1; remaining < want {
+					want = remaining
+				}
+				nr, er := resp.Body.Read(buf[:want])
+				if nr > 0 {
+					if _, ew := out.WriteAt(buf[:nr], pos); ew != nil {
+						return fmt.Errorf("failed to write file: %w", ew), nil
+					}
+					pos += int64(nr)
+					if ew := onData(buf[:nr]); ew != nil {
+						return ew, nil
+					}
+				}
+				if er == io.EOF {
+					if pos <= seg.end {
+						return nil, io.ErrUnexpectedEOF
+					}
+					return nil, nil
+				}
+				if er != nil {
+					return nil, er
+				}
+			}
+			return nil, nil
+		}()
+		if fatal != nil {
+			return fatal
+		}
+		if readErr == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		lastErr = readErr
+	}
+	if pos > seg.end {
+		return nil
+	}
+	return fmt.Errorf("segment %d-%d failed after %d attempts: %v", seg.start, seg.end, parallelSegmentRetries, lastErr)
+}
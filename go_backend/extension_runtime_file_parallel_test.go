@@ -0,0 +1,222 @@
+package gobackend
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// rangeServer serves body honoring single Range requests. rangeStatus, when
+// non-zero, is returned instead of 206 for ranges starting past rangeFailAt.
+type rangeServer struct {
+	body        []byte
+	rangeStatus int
+	rangeFailAt int64
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+	mu          sync.Mutex
+	fullGets    int // unranged requests, i.e. single-stream downloads
+}
+
+func (s *rangeServer) roundTrip(req *http.Request) (*http.Response, error) {
+	n := s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+	for {
+		max := s.maxInFlight.Load()
+		if n <= max || s.maxInFlight.CompareAndSwap(max, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	header := make(http.Header)
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("ETag", `"v1"`)
+	rangeHeader := req.Header.Get("Range")
+	var start, end int64
+	if rangeHeader == "" || s.rangeStatus == http.StatusOK && s.rangeFailAt == 0 {
+		if rangeHeader == "" {
+			s.mu.Lock()
+			s.fullGets++
+			s.mu.Unlock()
+		}
+		return &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(s.body)),
+			ContentLength: int64(len(s.body)),
+			Request:       req,
+		}, nil
+	}
+	if _, err := fmt.Sscanf(rangeHeader, "bytes=%d-%d", &start, &end); err != nil {
+		return nil, err
+	}
+	if s.rangeStatus != 0 && start > s.rangeFailAt {
+		return &http.Response{StatusCode: s.rangeStatus, Header: header, Body: io.NopCloser(bytes.NewReader(nil)), Request: req}, nil
+	}
+	if end >= int64(len(s.body)) {
+		end = int64(len(s.body)) - 1
+	}
+	header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(s.body)))
+	return &http.Response{
+		StatusCode: http.StatusPartialContent,
+		Header:     header,
+		Body:       io.NopCloser(bytes.NewReader(s.body[start : end+1])),
+		Request:    req,
+	}, nil
+}
+
+func newParallelDownloadRuntime(t *testing.T, server *rangeServer) (*extensionRuntime, *goja.Runtime, string) {
+	t.Helper()
+	vm := goja.New()
+	dir := t.TempDir()
+	SetAllowedDownloadDirs(nil)
+	t.Cleanup(func() { SetAllowedDownloadDirs(nil) })
+	runtime := &extensionRuntime{
+		extensionID: "parallel-ext",
+		manifest: &ExtensionManifest{
+			Name:        "parallel-ext",
+			Permissions: ExtensionPermissions{File: true, Network: []string{"files.example.com"}},
+		},
+		dataDir:    dir,
+		vm:         vm,
+		httpClient: &http.Client{Transport: roundTripFunc(server.roundTrip)},
+	}
+	runtime.downloadClient = runtime.httpClient
+	return runtime, vm, dir
+}
+
+func parallelTestBody(size int) []byte {
+	body := make([]byte, size)
+	for i := range body {
+		body[i] = byte(i * 7)
+	}
+	return body
+}
+
+func TestFileDownloadParallelFetchesRangesConcurrently(t *testing.T) {
+	server := &rangeServer{body: parallelTestBody(200*1024 + 17)}
+	runtime, vm, dir := newParallelDownloadRuntime(t, server)
+
+	var lastWritten, lastTotal int64
+	onProgress := func(written, total int64) {
+		lastWritten, lastTotal = written, total
+	}
+	result := runtime.fileDownload(goja.FunctionCall{Arguments: []goja.Value{
+		vm.ToValue("https://files.example.com/track.flac"),
+		vm.ToValue("downloads/track.flac"),
+		vm.ToValue(map[string]any{"parallel": float64(4), "chunked": float64(16 * 1024), "onProgress": onProgress}),
+	}}).Export().(map[string]any)
+	if result["success"] != true {
+		t.Fatalf("parallel fileDownload = %#v", result)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "downloads/track.flac"))
+	if err != nil || !bytes.Equal(data, server.body) {
+		t.Fatalf("parallel data mismatch: %d bytes, err=%v", len(data), err)
+	}
+	if got := server.maxInFlight.Load(); got < 2 {
+		t.Fatalf("max in-flight requests = %d, want concurrent segments", got)
+	}
+	if server.fullGets != 0 {
+		t.Fatalf("parallel mode issued %d unranged requests", server.fullGets)
+	}
+	if lastWritten != int64(len(server.body)) || lastTotal != int64(len(server.body)) {
+		t.Fatalf("final progress = %d/%d", lastWritten, lastTotal)
+	}
+	if _, err := os.Stat(stagedDownloadPath(filepath.Join(dir, "downloads/track.flac"))); !os.IsNotExist(err) {
+		t.Fatalf("staged file left behind: %v", err)
+	}
+}
+
+func TestFileDownloadParallelFallsBackToSingleStream(t *testing.T) {
+	cases := []struct {
+		name   string
+		server *rangeServer
+	}{
+		{"no range support", &rangeServer{rangeStatus: http.StatusOK}},
+		{"416 mid-download", &rangeServer{rangeStatus: http.StatusRequestedRangeNotSatisfiable, rangeFailAt: 32 * 1024}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.server.body = parallelTestBody(128 * 1024)
+			runtime, vm, dir := newParallelDownloadRuntime(t, tc.server)
+			result := runtime.fileDownload(goja.FunctionCall{Arguments: []goja.Value{
+				vm.ToValue("https://files.example.com/track.flac"),
+				vm.ToValue("downloads/track.flac"),
+				vm.ToValue(map[string]any{"parallel": true, "chunked": float64(16 * 1024)}),
+			}}).Export().(map[string]any)
+			if result["success"] != true {
+				t.Fatalf("fileDownload = %#v", result)
+			}
+			data, err := os.ReadFile(filepath.Join(dir, "downloads/track.flac"))
+			if err != nil || !bytes.Equal(data, tc.server.body) {
+				t.Fatalf("fallback data mismatch: %d bytes, err=%v", len(data), err)
+			}
+			if tc.server.fullGets != 1 {
+				t.Fatalf("single-stream requests = %d, want 1", tc.server.fullGets)
+			}
+		})
+	}
+}
+
+func TestFileDownloadParallelFailureDiscardsResumeState(t *testing.T) {
+	server := &rangeServer{body: parallelTestBody(128 * 1024), rangeStatus: http.StatusInternalServerError, rangeFailAt: 32 * 1024}
+	runtime, vm, dir := newParallelDownloadRuntime(t, server)
+	fullPath := filepath.Join(dir, "downloads/track.flac")
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Left over from an interrupted single-stream attempt.
+	if err := os.WriteFile(stagedDownloadPath(fullPath), []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(downloadResumeManifestPath(fullPath), []byte(`{"url":"https://files.example.com/track.flac"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result := runtime.fileDownload(goja.FunctionCall{Arguments: []goja.Value{
+		vm.ToValue("https://files.example.com/track.flac"),
+		vm.ToValue("downloads/track.flac"),
+		vm.ToValue(map[string]any{"parallel": float64(4), "chunked": float64(16 * 1024)}),
+	}}).Export().(map[string]any)
+	if result["success"] == true {
+		t.Fatalf("fileDownload succeeded against failing ranges: %#v", result)
+	}
+	for _, path := range []string{stagedDownloadPath(fullPath), downloadResumeManifestPath(fullPath)} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("%s left behind: %v", filepath.Base(path), err)
+		}
+	}
+}
+
+func TestSplitDownloadSegmentsCoversFile(t *testing.T) {
+	segments := splitDownloadSegments(10*minParallelSegmentSize+3, 0, 4)
+	if len(segments) != 4 {
+		t.Fatalf("segments = %d, want 4", len(segments))
+	}
+	var next int64
+	for _, seg := range segments {
+		if seg.start != next || seg.end < seg.start {
+			t.Fatalf("segment %+v does not continue at %d", seg, next)
+		}
+		next = seg.end + 1
+	}
+	if next != 10*minParallelSegmentSize+3 {
+		t.Fatalf("segments end at %d", next)
+	}
+	if got := len(splitDownloadSegments(100, 0, 8)); got != 1 {
+		t.Fatalf("small file split into %d segments", got)
+	}
+	if parseParallelSegmentsOption(float64(64)) != maxParallelSegments || parseParallelSegmentsOption(false) != 0 {
+		t.Fatal("parallel option not clamped")
+	}
+}
@@ -0,0 +1,498 @@
+package gobackend
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+)
+
+// flacPCMFrame is one decoded FLAC frame. samples holds one slice per
+// channel, already decorrelated and shifted back by any wasted bits.
+type flacPCMFrame struct {
+	sampleRate    int
+	bitsPerSample int
+	// firstSample is the stream position of samples[*][0].
+	firstSample int64
+	samples     [][]int32
+}
+
+func (f *flacPCMFrame) blockSize() int {
+	if len(f.samples) == 0 {
+		return 0
+	}
+	return len(f.samples[0])
+}
+
+// flacDecoder decodes a FLAC stream one frame at a time:
+//
+//	for {
+//		frame, err := dec.next()
+//		if err == io.EOF { break }
+//		...
+//	}
+//
+// The frame and its sample slices are reused by the following next call.
+type flacDecoder struct {
+	info    flacStreamInfo
+	r       *bufio.Reader
+	br      flacBitReader
+	decoded int64
+	closer  io.Closer
+
+	frame    flacPCMFrame
+	channels [][]int64
+}
+
+func newFLACDecoder(r io.Reader) (*flacDecoder, error) {
+	buffered := bufio.NewReaderSize(r, 256*1024)
+	info, _, err := readFLACMetadata(buffered)
+	if err != nil {
+		return nil, err
+	}
+	return &flacDecoder{
+		info: info,
+		r:    buffered,
+		br:   flacBitReader{r: buffered},
+	}, nil
+}
+
+func openFLACDecoder(path string) (*flacDecoder, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := newFLACDecoder(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	dec.closer = f
+	return dec, nil
+}
+
+// decodeFLACFrame decodes the single complete frame in data, using info for
+// the values its header defers to STREAMINFO.
+func decodeFLACFrame(info flacStreamInfo, data []byte) (*flacPCMFrame, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	info.totalSamples = 0
+	d := &flacDecoder{info: info, r: r, br: flacBitReader{r: r}}
+	return d.next()
+}
+
+func (d *flacDecoder) close() error {
+	if d.closer == nil {
+		return nil
+	}
+	return d.closer.Close()
+}
+
+// next decodes the following frame. It returns io.EOF once STREAMINFO's
+// sample count is reached or the audio ends (a trailing ID3v1 tag included).
+func (d *flacDecoder) next() (*flacPCMFrame, error) {
+	if d.info.totalSamples > 0 && d.decoded >= d.info.totalSamples {
+		return nil, io.EOF
+	}
+	peek, _ := d.r.Peek(flacMaxFrameHeaderSize)
+	if len(peek) == 0 || len(peek) >= 3 && string(peek[:3]) == "TAG" {
+		return nil, io.EOF
+	}
+	header, ok := parseFLACFrameHeader(peek)
+	if !ok {
+		return nil, fmt.Errorf("flac: no valid frame header at sample %d", d.decoded)
+	}
+
+	d.br.crc = 0
+	for _, b := range peek[:header.size] {
+		d.br.crc = flacCRC16Update(d.br.crc, b)
+	}
+	d.r.Discard(header.size)
+
+	if header.sampleRate == 0 {
+		header.sampleRate = d.info.sampleRate
+	}
+	if header.bitsPerSample == 0 {
+		header.bitsPerSample = d.info.bitsPerSample
+	}
+	if err := d.decodeSubframes(header); err != nil {
+		return nil, fmt.Errorf("flac: frame at sample %d: %w", d.decoded, err)
+	}
+
+	d.br.align()
+	if _, err := d.br.readBits(16); err != nil {
+		return nil, fmt.Errorf("flac: frame footer at sample %d: %w", d.decoded, err)
+	}
+	if d.br.crc != 0 {
+		return nil, fmt.Errorf("flac: CRC-16 mismatch in frame at sample %d", d.decoded)
+	}
+
+	d.frame.sampleRate = header.sampleRate
+	d.frame.bitsPerSample = header.bitsPerSample
+	d.frame.firstSample = d.decoded
+	d.decoded += int64(header.blockSize)
+	return &d.frame, nil
+}
+
+func (d *flacDecoder) decodeSubframes(h flacFrameHeader) error {
+	if cap(d.channels) < h.channels {
+		d.channels = make([][]int64, h.channels)
+		d.frame.samples = make([][]int32, h.channels)
+	}
+	d.channels = d.channels[:h.channels]
+	d.frame.samples = d.frame.samples[:h.channels]
+	for ch := range d.channels {
+		if cap(d.channels[ch]) < h.blockSize {
+			d.channels[ch] = make([]int64, h.blockSize)
+			d.frame.samples[ch] = make([]int32, h.blockSize)
+		}
+		d.channels[ch] = d.channels[ch][:h.blockSize]
+		d.frame.samples[ch] = d.frame.samples[ch][:h.blockSize]
+
+		bps := h.bitsPerSample
+		// The side channel carries one extra bit.
+		if h.channelMode == 8 && ch == 1 || h.channelMode == 9 && ch == 0 || h.channelMode == 10 && ch == 1 {
+			bps++
+		}
+		if err := d.decodeSubframe(d.channels[ch], bps); err != nil {
+			return fmt.Errorf("channel %d: %w", ch, err)
+		}
+	}
+
+	switch h.channelMode {
+	case 8: // left/side
+		left, side := d.channels[0], d.channels[1]
+		for i := range side {
+			side[i] = left[i] - side[i]
+		}
+	case 9: // side/right
+		side, right := d.channels[0], d.channels[1]
+		for i := range side {
+			side[i] += right[i]
+		}
+	case 10: // mid/side
+		mid, side := d.channels[0], d.channels[1]
+		for i := range mid {
+			m := mid[i]<<1 | side[i]&1
+			mid[i] = (m + side[i]) >> 1
+			side[i] = (m - side[i]) >> 1
+		}
+	}
+	for ch, samples := range d.channels {
+		out := d.frame.samples[ch]
+		for i, s := range samples {
+			out[i] = int32(s)
+		}
+	}
+	return nil
+}
+
+func (d *flacDecoder) decodeSubframe(out []int64, bps int) error {
+	br := &d.br
+	header, err := br.readBits(8)
+	if err != nil {
+		return err
+	}
+	if header&0x80 != 0 {
+		return errors.New("subframe padding bit set")
+	}
+	wasted := 0
+	if header&0x01 != 0 {
+		k, err := br.readUnary()
+		if err != nil {
+			return err
+		}
+		wasted = k + 1
+		bps -= wasted
+		if bps <= 0 {
+			return fmt.Errorf("%d wasted bits exceed sample size", wasted)
+		}
+	}
+
+	kind := int(header>>1) & 0x3F
+	switch {
+	case kind == 0:
+		v, err := br.readSigned(bps)
+		if err != nil {
+			return err
+		}
+		for i := range out {
+			out[i] = v
+		}
+	case kind == 1:
+		for i := range out {
+			if out[i], err = br.readSigned(bps); err != nil {
+				return err
+			}
+		}
+	case kind >= 8 && kind <= 12:
+		if err := d.decodeFixedSubframe(out, bps, kind&0x07); err != nil {
+			return err
+		}
+	case kind >= 32:
+		if err := d.decodeLPCSubframe(out, bps, kind&0x1F+1); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("reserved subframe type %d", kind)
+	}
+
+	if wasted > 0 {
+		for i := range out {
+			out[i] <<= wasted
+		}
+	}
+	return nil
+}
+
+func (d *flacDecoder) readWarmup(out []int64, bps, order int) error {
+	if order > len(out) {
+		return fmt.Errorf("predictor order %d exceeds block size %d", order, len(out))
+	}
+	for i := 0; i < order; i++ {
+		v, err := d.br.readSigned(bps)
+		if err != nil {
+			return err
+		}
+		out[i] = v
+	}
+	return nil
+}
+
+func (d *flacDecoder) decodeFixedSubframe(out []int64, bps, order int) error {
+	if err := d.readWarmup(out, bps, order); err != nil {
+		return err
+	}
+	if err := d.br.readResidual(out, order); err != nil {
+		return err
+	}
+	for i := order; i < len(out); i++ {
+		switch order {
+		case 1:
+			out[i] += out[i-1]
+		case 2:
+			out[i] += 2*out[i-1] - out[i-2]
+		case 3:
+			out[i] += 3*out[i-1] - 3*out[i-2] + out[i-3]
+		case 4:
+			out[i] += 4*out[i-1] - 6*out[i-2] + 4*out[i-3] - out[i-4]
+		}
+	}
+	return nil
+}
+
+func (d *flacDecoder) decodeLPCSubframe(out []int64, bps, order int) error {
+	br := &d.br
+	if err := d.readWarmup(out, bps, order); err != nil {
+		return err
+	}
+	precisionBits, err := br.readBits(4)
+	if err != nil {
+		return err
+	}
+	if precisionBits == 0x0F {
+		return errors.New("invalid LPC coefficient precision")
+	}
+	precision := int(precisionBits) + 1
+	shift, err := br.readSigned(5)
+	if err != nil {
+		return err
+	}
+	if shift < 0 {
+		return fmt.Errorf("negative LPC shift %d", shift)
+	}
+	var coefs [32]int64
+	for i := 0; i < order; i++ {
+		if coefs[i], err = br.readSigned(precision); err != nil {
+			return err
+		}
+	}
+	if err := br.readResidual(out, order); err != nil {
+		return err
+	}
+	for i := order; i < len(out); i++ {
+		var sum int64
+		for j := 0; j < order; j++ {
+			sum += coefs[j] * out[i-1-j]
+		}
+		out[i] += sum >> uint(shift)
+	}
+	return nil
+}
+
+// flacBitReader reads MSB-first bits and keeps a CRC-16 of every byte it
+// consumes, so the frame footer can be checked without a second pass.
+type flacBitReader struct {
+	r     *bufio.Reader
+	cache uint64
+	n     uint
+	crc   uint16
+}
+
+func (b *flacBitReader) fill() error {
+	c, err := b.r.ReadByte()
+	if err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	b.crc = flacCRC16Update(b.crc, c)
+	b.cache = b.cache<<8 | uint64(c)
+	b.n += 8
+	return nil
+}
+
+// readBits returns the next n (<= 56) bits.
+func (b *flacBitReader) readBits(n uint) (uint64, error) {
+	for b.n < n {
+		if err := b.fill(); err != nil {
+			return 0, err
+		}
+	}
+	b.n -= n
+	v := b.cache >> b.n
+	b.cache &= 1<<b.n - 1
+	return v, nil
+}
+
+func (b *flacBitReader) readSigned(n int) (int64, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	v, err := b.readBits(uint(n))
+	if err != nil {
+		return 0, err
+	}
+	shift := 64 - uint(n)
+	return int64(v<<shift) >> shift, nil
+}
+
+// readUnary counts zero bits up to and including the terminating one.
+func (b *flacBitReader) readUnary() (int, error) {
+	count := 0
+	for {
+		if b.n == 0 {
+			if err := b.fill(); err != nil {
+				return 0, err
+			}
+		}
+		aligned := b.cache << (64 - b.n)
+		if aligned == 0 {
+			count += int(b.n)
+			b.n = 0
+			b.cache = 0
+			continue
+		}
+		zeros := bits.LeadingZeros64(aligned)
+		count += zeros
+		b.n -= uint(zeros) + 1
+		b.cache &= 1<<b.n - 1
+		return count, nil
+	}
+}
+
+// align drops the padding bits up to the next byte boundary.
+func (b *flacBitReader) align() {
+	b.n -= b.n % 8
+	b.cache &= 1<<b.n - 1
+}
+
+// readResidual adds the Rice-coded residual into out[order:].
+func (b *flacBitReader) readResidual(out []int64, order int) error {
+	method, err := b.readBits(2)
+	if err != nil {
+		return err
+	}
+	if method > 1 {
+		return fmt.Errorf("reserved residual coding method %d", method)
+	}
+	paramBits, escape := uint(4), uint64(0x0F)
+	if method == 1 {
+		paramBits, escape = 5, 0x1F
+	}
+	partitionOrder, err := b.readBits(4)
+	if err != nil {
+		return err
+	}
+	partitions := 1 << partitionOrder
+	partitionSize := len(out) >> partitionOrder
+	if partitionSize<<partitionOrder != len(out) || partitionSize < order {
+		return fmt.Errorf("partition order %d does not fit block size %d", partitionOrder, len(out))
+	}
+
+	i := order
+	for p := 0; p < partitions; p++ {
+		end := (p + 1) * partitionSize
+		param, err := b.readBits(paramBits)
+		if err != nil {
+			return err
+		}
+		if param == escape {
+			rawBits, err := b.readBits(5)
+			if err != nil {
+				return err
+			}
+			for ; i < end; i++ {
+				v, err := b.readSigned(int(rawBits))
+				if err != nil {
+					return err
+				}
+				out[i] = v
+			}
+			continue
+		}
+		for ; i < end; i++ {
+			q, err := b.readUnary()
+			if err != nil {
+				return err
+			}
+			r, err := b.readBits(uint(param))
+			if err != nil {
+				return err
+			}
+			v := uint64(q)<<param | r
+			out[i] = int64(v>>1) ^ -int64(v&1)
+		}
+	}
+	return nil
+}
+
+// flacAudioMD5 decodes path and hashes its samples the way STREAMINFO's MD5
+// is defined: interleaved, little-endian, in whole bytes per sample.
+func flacAudioMD5(path string) ([16]byte, error) {
+	var sum [16]byte
+	dec, err := openFLACDecoder(path)
+	if err != nil {
+		return sum, err
+	}
+	defer dec.close()
+
+	hash := md5.New()
+	var buf []byte
+	for {
+		frame, err := dec.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return sum, err
+		}
+		bytesPerSample := (frame.bitsPerSample + 7) / 8
+		buf = buf[:0]
+		for i := 0; i < frame.blockSize(); i++ {
+			for _, channel := range frame.samples {
+				v := channel[i]
+				for b := 0; b < bytesPerSample; b++ {
+					buf = append(buf, byte(v>>(8*b)))
+				}
+			}
+		}
+		hash.Write(buf)
+	}
+	copy(sum[:], hash.Sum(nil))
+	return sum, nil
+}
@@ -0,0 +1,384 @@
+package gobackend
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"io"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// flacTestWriter is a minimal MSB-first bit writer used to build FLAC streams
+// for the decoder tests.
+type flacTestWriter struct {
+	buf []byte
+	acc uint64
+	n   uint
+}
+
+func (w *flacTestWriter) write(v uint64, n uint) {
+	for n > 0 {
+		take := min(n, 8)
+		n -= take
+		w.acc = w.acc<<take | v>>n&(1<<take-1)
+		w.n += take
+		if w.n >= 8 {
+			w.n -= 8
+			w.buf = append(w.buf, byte(w.acc>>w.n))
+		}
+	}
+}
+
+func (w *flacTestWriter) writeSigned(v int64, n uint) {
+	w.write(uint64(v)&(1<<n-1), n)
+}
+
+func (w *flacTestWriter) writeUnary(q uint64) {
+	for ; q > 0; q-- {
+		w.write(0, 1)
+	}
+	w.write(1, 1)
+}
+
+func (w *flacTestWriter) align() {
+	if w.n > 0 {
+		w.write(0, 8-w.n)
+	}
+}
+
+// flacTestSubframe describes how one channel of a test frame is encoded.
+type flacTestSubframe struct {
+	kind      string // "constant", "verbatim", "fixed", "lpc"
+	order     int
+	coefs     []int64
+	precision uint
+	shift     uint
+	wasted    uint
+	escape    bool
+}
+
+func (w *flacTestWriter) writeResidual(residual []int64, escape bool) {
+	w.write(0, 2) // 4-bit Rice parameters
+	w.write(0, 4) // one partition
+	if escape {
+		w.write(0x0F, 4)
+		w.write(20, 5)
+		for _, r := range residual {
+			w.writeSigned(r, 20)
+		}
+		return
+	}
+	var maxAbs uint64
+	for _, r := range residual {
+		if a := uint64(max(r, -r)); a > maxAbs {
+			maxAbs = a
+		}
+	}
+	param := uint(max(bits.Len64(maxAbs)-1, 0))
+	param = min(param, 14)
+	w.write(uint64(param), 4)
+	for _, r := range residual {
+		u := uint64(r<<1) ^ uint64(r>>63)
+		w.writeUnary(u >> param)
+		w.write(u&(1<<param-1), param)
+	}
+}
+
+func (w *flacTestWriter) writeSubframe(samples []int64, bps uint, sf flacTestSubframe) {
+	wastedFlag := uint64(0)
+	if sf.wasted > 0 {
+		wastedFlag = 1
+	}
+	shifted := make([]int64, len(samples))
+	for i, s := range samples {
+		shifted[i] = s >> sf.wasted
+	}
+	bps -= sf.wasted
+	writeHeader := func(kind uint64) {
+		w.write(kind<<1|wastedFlag, 8)
+		if sf.wasted > 0 {
+			w.writeUnary(uint64(sf.wasted - 1))
+		}
+	}
+
+	switch sf.kind {
+	case "constant":
+		writeHeader(0)
+		w.writeSigned(shifted[0], bps)
+	case "verbatim":
+		writeHeader(1)
+		for _, s := range shifted {
+			w.writeSigned(s, bps)
+		}
+	case "fixed":
+		writeHeader(uint64(8 + sf.order))
+		residual := make([]int64, 0, len(shifted))
+		for i, s := range shifted {
+			if i < sf.order {
+				w.writeSigned(s, bps)
+				continue
+			}
+			var pred int64
+			switch sf.order {
+			case 1:
+				pred = shifted[i-1]
+			case 2:
+				pred = 2*shifted[i-1] - shifted[i-2]
+			case 3:
+				pred = 3*shifted[i-1] - 3*shifted[i-2] + shifted[i-3]
+			case 4:
+				pred = 4*shifted[i-1] - 6*shifted[i-2] + 4*shifted[i-3] - shifted[i-4]
+			}
+			residual = append(residual, s-pred)
+		}
+		w.writeResidual(residual, sf.escape)
+	case "lpc":
+		order := len(sf.coefs)
+		writeHeader(uint64(32 + order - 1))
+		for _, s := range shifted[:order] {
+			w.writeSigned(s, bps)
+		}
+		w.write(uint64(sf.precision-1), 4)
+		w.writeSigned(int64(sf.shift), 5)
+		for _, c := range sf.coefs {
+			w.writeSigned(c, sf.precision)
+		}
+		residual := make([]int64, 0, len(shifted))
+		for i := order; i < len(shifted); i++ {
+			var sum int64
+			for j, c := range sf.coefs {
+				sum += c * shifted[i-1-j]
+			}
+			residual = append(residual, shifted[i]-sum>>sf.shift)
+		}
+		w.writeResidual(residual, sf.escape)
+	}
+}
+
+type flacTestFrame struct {
+	channelMode int
+	subframes   []flacTestSubframe
+}
+
+// encodeTestFLAC writes a 44.1 kHz stream with one frame per entry of frames,
+// each holding blockSize samples of left/right (or more channels).
+func encodeTestFLAC(t *testing.T, bps uint, blockSize int, channels [][]int64, frames []flacTestFrame) []byte {
+	t.Helper()
+	sizeCodes := map[uint]byte{8: 1, 12: 2, 16: 4, 20: 5, 24: 6, 32: 7}
+	total := len(channels[0])
+
+	hash := md5.New()
+	bytesPerSample := int(bps+7) / 8
+	for i := 0; i < total; i++ {
+		for _, ch := range channels {
+			for b := 0; b < bytesPerSample; b++ {
+				hash.Write([]byte{byte(ch[i] >> (8 * b))})
+			}
+		}
+	}
+	streamInfo := make([]byte, 34)
+	binary.BigEndian.PutUint16(streamInfo[0:], uint16(blockSize))
+	binary.BigEndian.PutUint16(streamInfo[2:], uint16(blockSize))
+	binary.BigEndian.PutUint64(streamInfo[10:], uint64(44100)<<44|uint64(len(channels)-1)<<41|uint64(bps-1)<<36|uint64(total))
+	copy(streamInfo[18:], hash.Sum(nil))
+
+	out := append([]byte("fLaC\x80\x00\x00\x22"), streamInfo...)
+	for index, frame := range frames {
+		start := index * blockSize
+		end := min(start+blockSize, total)
+		w := &flacTestWriter{}
+		w.write(0xFFF8, 16)
+		w.write(0x79, 8) // 16-bit block size follows, 44.1 kHz
+		w.write(uint64(frame.channelMode)<<4|uint64(sizeCodes[bps])<<1, 8)
+		for _, b := range encodeFLACCodedNumber(uint64(index)) {
+			w.write(uint64(b), 8)
+		}
+		w.write(uint64(end-start-1), 16)
+		w.write(uint64(flacCRC8(w.buf)), 8)
+
+		block := make([][]int64, len(channels))
+		for ch := range channels {
+			block[ch] = channels[ch][start:end]
+		}
+		switch frame.channelMode {
+		case 8, 9, 10:
+			left, right := block[0], block[1]
+			side := make([]int64, len(left))
+			mid := make([]int64, len(left))
+			for i := range left {
+				side[i] = left[i] - right[i]
+				mid[i] = (left[i] + right[i]) >> 1
+			}
+			switch frame.channelMode {
+			case 8:
+				block = [][]int64{left, side}
+			case 9:
+				block = [][]int64{side, right}
+			case 10:
+				block = [][]int64{mid, side}
+			}
+		}
+		for ch, samples := range block {
+			sampleBits := bps
+			if frame.channelMode == 8 && ch == 1 || frame.channelMode == 9 && ch == 0 || frame.channelMode == 10 && ch == 1 {
+				sampleBits++
+			}
+			w.writeSubframe(samples, sampleBits, frame.subframes[ch])
+		}
+		w.align()
+		var crc uint16
+		for _, b := range w.buf {
+			crc = flacCRC16Update(crc, b)
+		}
+		out = binary.BigEndian.AppendUint16(append(out, w.buf...), crc)
+	}
+	return out
+}
+
+// writeTestSignalFLAC writes channel as both sides of a 16-bit stereo
+// 44.1 kHz FLAC of verbatim frames at dir/name.
+func writeTestSignalFLAC(t *testing.T, dir, name string, channel []int64) string {
+	t.Helper()
+	const blockSize = 4096
+	frames := make([]flacTestFrame, (len(channel)+blockSize-1)/blockSize)
+	for i := range frames {
+		frames[i] = flacTestFrame{channelMode: 1, subframes: []flacTestSubframe{{kind: "verbatim"}, {kind: "verbatim"}}}
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, encodeTestFLAC(t, 16, blockSize, [][]int64{channel, channel}, frames), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func flacTestSignal(n int, bps uint, phase float64) []int64 {
+	amplitude := float64(int64(1)<<(bps-1)-1) * 0.9
+	samples := make([]int64, n)
+	for i := range samples {
+		v := math.Sin(float64(i)*0.031+phase)*0.7 + math.Sin(float64(i)*0.17+phase*2)*0.3
+		samples[i] = int64(v * amplitude)
+	}
+	return samples
+}
+
+func decodeAllFLAC(t *testing.T, data []byte) [][]int64 {
+	t.Helper()
+	dec, err := newFLACDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("newFLACDecoder: %v", err)
+	}
+	decoded := make([][]int64, dec.info.channels)
+	for {
+		frame, err := dec.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("next: %v", err)
+		}
+		for ch, samples := range frame.samples {
+			for _, s := range samples {
+				decoded[ch] = append(decoded[ch], int64(s))
+			}
+		}
+	}
+	return decoded
+}
+
+func assertFLACSamples(t *testing.T, got, want [][]int64) {
+	t.Helper()
+	for ch := range want {
+		if len(got[ch]) != len(want[ch]) {
+			t.Fatalf("channel %d: decoded %d samples, want %d", ch, len(got[ch]), len(want[ch]))
+		}
+		for i := range want[ch] {
+			if got[ch][i] != want[ch][i] {
+				t.Fatalf("channel %d sample %d = %d, want %d", ch, i, got[ch][i], want[ch][i])
+			}
+		}
+	}
+}
+
+func TestFLACDecoderSubframeTypesAndStereoModes(t *testing.T) {
+	const blockSize = 1152
+	left := flacTestSignal(blockSize*5, 16, 0)
+	right := flacTestSignal(blockSize*5, 16, 1.3)
+	for i := 3 * blockSize; i < 4*blockSize; i++ {
+		left[i] &^= 0x0F // give the wasted-bits frame something to drop
+		right[i] = 1234
+	}
+	lpc := flacTestSubframe{kind: "lpc", coefs: []int64{1900, -905}, precision: 13, shift: 10}
+	frames := []flacTestFrame{
+		{channelMode: 1, subframes: []flacTestSubframe{{kind: "fixed", order: 2}, lpc}},
+		{channelMode: 10, subframes: []flacTestSubframe{{kind: "verbatim"}, {kind: "fixed", order: 1}}},
+		{channelMode: 8, subframes: []flacTestSubframe{lpc, {kind: "fixed", order: 4, escape: true}}},
+		{channelMode: 1, subframes: []flacTestSubframe{{kind: "verbatim", wasted: 4}, {kind: "constant"}}},
+		{channelMode: 9, subframes: []flacTestSubframe{{kind: "fixed", order: 3}, {kind: "fixed", order: 0}}},
+	}
+	data := encodeTestFLAC(t, 16, blockSize, [][]int64{left, right}, frames)
+
+	assertFLACSamples(t, decodeAllFLAC(t, data), [][]int64{left, right})
+
+	path := filepath.Join(t.TempDir(), "stereo.flac")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyDownloadedAudioIntegrity(path); err != nil {
+		t.Fatalf("integrity check with decoded MD5: %v", err)
+	}
+}
+
+func TestFLACDecoderHighBitDepths(t *testing.T) {
+	for _, bps := range []uint{24, 32} {
+		const blockSize = 512
+		left := flacTestSignal(blockSize*2, bps, 0.4)
+		right := flacTestSignal(blockSize*2, bps, 2.1)
+		right[10] = -left[10] // widest possible side value
+		frames := []flacTestFrame{
+			{channelMode: 9, subframes: []flacTestSubframe{{kind: "verbatim"}, {kind: "verbatim"}}},
+			{channelMode: 10, subframes: []flacTestSubframe{{kind: "verbatim"}, {kind: "verbatim"}}},
+		}
+		if bps == 24 {
+			frames[1].subframes[0] = flacTestSubframe{kind: "lpc", coefs: []int64{3800, -1810}, precision: 14, shift: 11}
+		}
+		data := encodeTestFLAC(t, bps, blockSize, [][]int64{left, right}, frames)
+		assertFLACSamples(t, decodeAllFLAC(t, data), [][]int64{left, right})
+
+		path := filepath.Join(t.TempDir(), "hires.flac")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		sum, err := flacAudioMD5(path)
+		if err != nil {
+			t.Fatalf("%d-bit flacAudioMD5: %v", bps, err)
+		}
+		if !bytes.Equal(sum[:], data[8+18:8+34]) {
+			t.Fatalf("%d-bit decoded MD5 does not match STREAMINFO", bps)
+		}
+	}
+}
+
+func TestFLACDecoderDetectsCorruptFrame(t *testing.T) {
+	const blockSize = 256
+	mono := flacTestSignal(blockSize*2, 16, 0)
+	data := encodeTestFLAC(t, 16, blockSize, [][]int64{mono}, []flacTestFrame{
+		{channelMode: 0, subframes: []flacTestSubframe{{kind: "fixed", order: 2}}},
+		{channelMode: 0, subframes: []flacTestSubframe{{kind: "fixed", order: 2}}},
+	})
+	data[len(data)-40] ^= 0x10
+
+	dec, err := newFLACDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dec.next(); err != nil {
+		t.Fatalf("first frame: %v", err)
+	}
+	if _, err := dec.next(); err == nil {
+		t.Fatal("corrupted frame decoded without error")
+	}
+}
@@ -0,0 +1,366 @@
+package gobackend
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// FLAC frame-level primitives shared by the integrity check and the decoder.
+
+var errMissingFLACMarker = errors.New("missing fLaC marker")
+
+var (
+	flacCRC8Table  [256]uint8
+	flacCRC16Table [256]uint16
+)
+
+func init() {
+	for i := 0; i < 256; i++ {
+		crc8 := uint8(i)
+		crc16 := uint16(i) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc8&0x80 != 0 {
+				crc8 = crc8<<1 ^ 0x07
+			} else {
+				crc8 <<= 1
+			}
+			if crc16&0x8000 != 0 {
+				crc16 = crc16<<1 ^ 0x8005
+			} else {
+				crc16 <<= 1
+			}
+		}
+		flacCRC8Table[i] = crc8
+		flacCRC16Table[i] = crc16
+	}
+}
+
+func flacCRC8(data []byte) uint8 {
+	var crc uint8
+	for _, b := range data {
+		crc = flacCRC8Table[crc^b]
+	}
+	return crc
+}
+
+func flacCRC16Update(crc uint16, b byte) uint16 {
+	return crc<<8 ^ flacCRC16Table[byte(crc>>8)^b]
+}
+
+// flacMaxFrameHeaderSize covers sync, codes, a 7-byte coded number, explicit
+// block size and sample rate, and the CRC-8.
+const flacMaxFrameHeaderSize = 16
+
+type flacFrameHeader struct {
+	variableBlockSize bool
+	blockSize         int
+	// sampleRate and bitsPerSample are 0 when the frame defers to STREAMINFO.
+	sampleRate    int
+	channels      int
+	channelMode   int
+	bitsPerSample int
+	// number is the frame index for fixed block sizes, else the first sample.
+	number uint64
+	size   int
+}
+
+var flacSampleRates = [...]int{0, 88200, 176400, 192000, 8000, 16000, 22050, 24000, 32000, 44100, 48000, 96000}
+
+var flacSampleSizes = [...]int{0, 8, 12, 0, 16, 20, 24, 32}
+
+// parseFLACFrameHeader decodes a frame header at the start of b, verifying
+// its CRC-8. ok is false for anything that is not a valid header.
+func parseFLACFrameHeader(b []byte) (flacFrameHeader, bool) {
+	var h flacFrameHeader
+	if len(b) < 6 || b[0] != 0xFF || b[1]&0xFE != 0xF8 {
+		return h, false
+	}
+	h.variableBlockSize = b[1]&0x01 != 0
+	blockCode := int(b[2] >> 4)
+	rateCode := int(b[2] & 0x0F)
+	h.channelMode = int(b[3] >> 4)
+	sizeCode := int(b[3]>>1) & 0x07
+	if blockCode == 0 || rateCode == 0x0F || h.channelMode > 10 || sizeCode == 3 || b[3]&0x01 != 0 {
+		return h, false
+	}
+	switch {
+	case h.channelMode < 8:
+		h.channels = h.channelMode + 1
+	default:
+		h.channels = 2
+	}
+	h.bitsPerSample = flacSampleSizes[sizeCode]
+
+	pos := 4
+	number, n, ok := decodeFLACCodedNumber(b[pos:])
+	if !ok || (!h.variableBlockSize && n > 6) {
+		return h, false
+	}
+	h.number = number
+	pos += n
+
+	switch {
+	case blockCode == 1:
+		h.blockSize = 192
+	case blockCode <= 5:
+		h.blockSize = 576 << (blockCode - 2)
+	case blockCode == 6:
+		if len(b) < pos+1 {
+			return h, false
+		}
+		h.blockSize = int(b[pos]) + 1
+		pos++
+	case blockCode == 7:
+		if len(b) < pos+2 {
+			return h, false
+		}
+		h.blockSize = int(binary.BigEndian.Uint16(b[pos:])) + 1
+		pos += 2
+	default:
+		h.blockSize = 256 << (blockCode - 8)
+	}
+
+	switch {
+	case rateCode < len(flacSampleRates):
+		h.sampleRate = flacSampleRates[rateCode]
+	case rateCode == 12:
+		if len(b) < pos+1 {
+			return h, false
+		}
+		h.sampleRate = int(b[pos]) * 1000
+		pos++
+	case rateCode == 13:
+		if len(b) < pos+2 {
+			return h, false
+		}
+		h.sampleRate = int(binary.BigEndian.Uint16(b[pos:]))
+		pos += 2
+	case rateCode == 14:
+		if len(b) < pos+2 {
+			return h, false
+		}
+		h.sampleRate = int(binary.BigEndian.Uint16(b[pos:])) * 10
+		pos += 2
+	}
+
+	if len(b) < pos+1 || flacCRC8(b[:pos]) != b[pos] {
+		return h, false
+	}
+	h.size = pos + 1
+	return h, true
+}
+
+// decodeFLACCodedNumber reads the UTF-8-style frame/sample number.
+func decodeFLACCodedNumber(b []byte) (uint64, int, bool) {
+	if len(b) == 0 {
+		return 0, 0, false
+	}
+	first := b[0]
+	if first&0x80 == 0 {
+		return uint64(first), 1, true
+	}
+	n := 0
+	for mask := byte(0x80); mask != 0 && first&mask != 0; mask >>= 1 {
+		n++
+	}
+	if n < 2 || n > 7 || len(b) < n {
+		return 0, 0, false
+	}
+	value := uint64(first & (0xFF >> (n + 1)))
+	for _, c := range b[1:n] {
+		if c&0xC0 != 0x80 {
+			return 0, 0, false
+		}
+		value = value<<6 | uint64(c&0x3F)
+	}
+	return value, n, true
+}
+
+// encodeFLACCodedNumber is the inverse of decodeFLACCodedNumber, for values
+// up to 36 bits.
+func encodeFLACCodedNumber(v uint64) []byte {
+	if v < 0x80 {
+		return []byte{byte(v)}
+	}
+	n := 2
+	for v >= 1<<(5*n+1) && n < 7 {
+		n++
+	}
+	out := make([]byte, n)
+	for i := n - 1; i > 0; i-- {
+		out[i] = 0x80 | byte(v&0x3F)
+		v >>= 6
+	}
+	out[0] = byte(0xFF<<(8-n)) | byte(v)
+	return out
+}
+
+func flacCRC16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc = flacCRC16Update(crc, b)
+	}
+	return crc
+}
+
+type flacStreamInfo struct {
+	minBlockSize  int
+	maxBlockSize  int
+	sampleRate    int
+	channels      int
+	bitsPerSample int
+	totalSamples  int64
+	md5           [16]byte
+}
+
+func parseFLACStreamInfo(block []byte) (flacStreamInfo, bool) {
+	var info flacStreamInfo
+	if len(block) < 34 {
+		return info, false
+	}
+	info.minBlockSize = int(binary.BigEndian.Uint16(block[0:2]))
+	info.maxBlockSize = int(binary.BigEndian.Uint16(block[2:4]))
+	info.bitsPerSample, info.sampleRate, info.totalSamples = parseFLACStreamInfoQuality(block)
+	info.channels = int(block[12]>>1&0x07) + 1
+	copy(info.md5[:], block[18:34])
+	return info, info.sampleRate > 0
+}
+
+// readFLACLayout returns STREAMINFO and the offset of the first audio frame,
+// skipping an ID3v2 tag some taggers put before the fLaC marker.
+func readFLACLayout(f *os.File) (flacStreamInfo, int64, error) {
+	return readFLACMetadata(io.NewSectionReader(f, 0, math.MaxInt64))
+}
+
+// readFLACMetadata consumes everything up to the first audio frame and
+// returns STREAMINFO with the number of bytes read.
+func readFLACMetadata(r io.Reader) (flacStreamInfo, int64, error) {
+	var info flacStreamInfo
+	var offset int64
+	marker := make([]byte, 4)
+	if _, err := io.ReadFull(r, marker); err != nil {
+		return info, 0, errMissingFLACMarker
+	}
+	offset += 4
+	if string(marker[:3]) == "ID3" {
+		rest := make([]byte, 6)
+		if _, err := io.ReadFull(r, rest); err != nil {
+			return info, 0, errMissingFLACMarker
+		}
+		tagSize := int64(rest[2]&0x7F)<<21 | int64(rest[3]&0x7F)<<14 |
+			int64(rest[4]&0x7F)<<7 | int64(rest[5]&0x7F)
+		if rest[1]&0x10 != 0 {
+			tagSize += 10
+		}
+		if _, err := io.CopyN(io.Discard, r, tagSize); err != nil {
+			return info, 0, errMissingFLACMarker
+		}
+		if _, err := io.ReadFull(r, marker); err != nil {
+			return info, 0, errMissingFLACMarker
+		}
+		offset += 6 + tagSize + 4
+	}
+	if string(marker) != "fLaC" {
+		return info, 0, errMissingFLACMarker
+	}
+
+	haveStreamInfo := false
+	blockHeader := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, blockHeader); err != nil {
+			return info, 0, fmt.Errorf("metadata block header at %d: %w", offset, err)
+		}
+		last := blockHeader[0]&0x80 != 0
+		blockType := blockHeader[0] & 0x7F
+		length := int64(blockHeader[1])<<16 | int64(blockHeader[2])<<8 | int64(blockHeader[3])
+		if blockType == 0 {
+			block := make([]byte, length)
+			if _, err := io.ReadFull(r, block); err != nil {
+				return info, 0, fmt.Errorf("STREAMINFO: %w", err)
+			}
+			parsed, ok := parseFLACStreamInfo(block)
+			if !ok {
+				return info, 0, errors.New("invalid STREAMINFO block")
+			}
+			info = parsed
+			haveStreamInfo = true
+		} else if _, err := io.CopyN(io.Discard, r, length); err != nil {
+			return info, 0, fmt.Errorf("metadata block at %d: %w", offset, err)
+		}
+		offset += 4 + length
+		if last {
+			break
+		}
+	}
+	if !haveStreamInfo {
+		return info, 0, errors.New("missing STREAMINFO block")
+	}
+	return info, offset, nil
+}
+
+// scanFLACFrames walks every frame in r without decoding subframes. A frame
+// ends where the running CRC-16 reaches zero and a header with a valid CRC-8
+// and the next expected frame/sample number follows, so a boundary cannot be
+// faked by audio data. It returns the frame and sample counts.
+func scanFLACFrames(r *bufio.Reader) (frames int, samples int64, err error) {
+	return walkFLACFrames(r, nil)
+}
+
+// walkFLACFrames is scanFLACFrames calling visit, when non-nil, with each
+// complete frame's header and byte length.
+func walkFLACFrames(r *bufio.Reader, visit func(header flacFrameHeader, length int)) (frames int, samples int64, err error) {
+	peekHeader := func() (flacFrameHeader, bool) {
+		b, _ := r.Peek(flacMaxFrameHeaderSize)
+		return parseFLACFrameHeader(b)
+	}
+	current, ok := peekHeader()
+	if !ok {
+		return 0, 0, errors.New("no frame header at start of audio")
+	}
+	if current.number != 0 {
+		return 0, 0, fmt.Errorf("first frame starts at %d, want 0", current.number)
+	}
+
+	var crc uint16
+	frameLen := 0
+	for {
+		if crc == 0 && frameLen >= current.size+2 {
+			if next, ok := peekHeader(); ok && next.variableBlockSize == current.variableBlockSize {
+				want := uint64(frames + 1)
+				if next.variableBlockSize {
+					want = uint64(samples) + uint64(current.blockSize)
+				}
+				if next.number == want {
+					if visit != nil {
+						visit(current, frameLen)
+					}
+					frames++
+					samples += int64(current.blockSize)
+					current = next
+					crc = 0
+					frameLen = 0
+				}
+			}
+		}
+		b, readErr := r.ReadByte()
+		if readErr == io.EOF {
+			if crc != 0 || frameLen < current.size+2 {
+				return frames, samples, fmt.Errorf("frame %d is truncated or fails CRC-16", frames)
+			}
+			if visit != nil {
+				visit(current, frameLen)
+			}
+			return frames + 1, samples + int64(current.blockSize), nil
+		}
+		if readErr != nil {
+			return frames, samples, readErr
+		}
+		crc = flacCRC16Update(crc, b)
+		frameLen++
+	}
+}
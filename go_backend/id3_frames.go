@@ -0,0 +1,333 @@
+package gobackend
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Structured ID3v2 frames beyond plain text: chapters (CHAP/CTOC), synced
+// lyrics (SYLT), ratings (POPM), unique file IDs (UFID) and credit lists
+// (TIPL/TMCL, IPLS in v2.3). The reader in audio_metadata.go and the editor in
+// mp3_id3_write.go share these parsers and builders.
+
+// ID3Chapter is one CHAP frame, with times in milliseconds.
+type ID3Chapter struct {
+	ID      string `json:"id,omitempty"`
+	StartMs int64  `json:"start_ms"`
+	EndMs   int64  `json:"end_ms,omitempty"`
+	Title   string `json:"title,omitempty"`
+}
+
+// ID3Credit is one role/name pair of a TIPL or TMCL frame.
+type ID3Credit struct {
+	Role string `json:"role"`
+	Name string `json:"name"`
+}
+
+// musicBrainzUFIDOwner is the UFID owner Picard writes recording IDs under.
+const musicBrainzUFIDOwner = "http://musicbrainz.org"
+
+// id3TOCElementID names the top-level CTOC frame the editor writes.
+const id3TOCElementID = "toc"
+
+// errInvalidID3Field wraps editor input that is wrong in itself, such as
+// malformed JSON or conflicting chapters. EditFileMetadata returns it instead
+// of falling back to ffmpeg, which could not write the value either.
+var errInvalidID3Field = errors.New("invalid ID3 field")
+
+// cutID3String splits a terminated string off the front of data: one NUL for
+// ISO-8859-1/UTF-8, an aligned NUL pair for UTF-16. Without a terminator the
+// whole input is the string.
+func cutID3String(data []byte, encoding byte) (value, rest []byte) {
+	if encoding == 1 || encoding == 2 {
+		for i := 0; i+1 < len(data); i += 2 {
+			if data[i] == 0 && data[i+1] == 0 {
+				return data[:i], data[i+2:]
+			}
+		}
+		return data, nil
+	}
+	if idx := bytes.IndexByte(data, 0); idx >= 0 {
+		return data[:idx], data[idx+1:]
+	}
+	return data, nil
+}
+
+func decodeID3String(encoding byte, raw []byte) string {
+	return extractTextFrame(append([]byte{encoding}, raw...))
+}
+
+// extractTextFrameValues decodes every NUL-separated value of a text frame;
+// ID3v2.4 stores multiple artists, genres and credit pairs this way.
+func extractTextFrameValues(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	encoding, rest := data[0], data[1:]
+	var values []string
+	for len(rest) > 0 {
+		var raw []byte
+		raw, rest = cutID3String(rest, encoding)
+		if value := strings.TrimSpace(decodeID3String(encoding, raw)); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// id3TextValuesPayload encodes a UTF-8 text frame holding several values.
+func id3TextValuesPayload(values ...string) []byte {
+	payload := []byte{0x03}
+	for i, value := range values {
+		if i > 0 {
+			payload = append(payload, 0x00)
+		}
+		payload = append(payload, []byte(value)...)
+	}
+	return payload
+}
+
+// id3CreditPairs turns TIPL/TMCL values (role, name, role, name...) into
+// credits. A dangling role without a name is dropped.
+func id3CreditPairs(values []string) []ID3Credit {
+	var credits []ID3Credit
+	for i := 0; i+1 < len(values); i += 2 {
+		credits = append(credits, ID3Credit{Role: values[i], Name: values[i+1]})
+	}
+	return credits
+}
+
+func id3CreditsPayload(credits []ID3Credit) []byte {
+	var values []string
+	for _, credit := range credits {
+		role, name := strings.TrimSpace(credit.Role), strings.TrimSpace(credit.Name)
+		if role == "" || name == "" {
+			continue
+		}
+		values = append(values, role, name)
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return id3TextValuesPayload(values...)
+}
+
+// parseID3Chapter reads a CHAP frame. Embedded frames use the enclosing tag's
+// version; only TIT2 is read from them.
+func parseID3Chapter(payload []byte, version byte) (ID3Chapter, bool) {
+	id, rest := cutID3String(payload, 0)
+	if len(rest) < 16 {
+		return ID3Chapter{}, false
+	}
+	chapter := ID3Chapter{
+		ID:      string(id),
+		StartMs: int64(binary.BigEndian.Uint32(rest[0:4])),
+		EndMs:   int64(binary.BigEndian.Uint32(rest[4:8])),
+	}
+	for _, sub := range parseID3v2xRawFrames(rest[16:], version, false) {
+		if sub.id == "TIT2" {
+			chapter.Title = firstTextValue(extractTextFrame(sub.payload))
+		}
+	}
+	return chapter, true
+}
+
+// id3EmbeddedFramesOffset returns where the embedded frames of a CHAP or CTOC
+// payload start, or -1 for other frames and malformed payloads.
+func id3EmbeddedFramesOffset(id string, payload []byte) int {
+	_, rest := cutID3String(payload, 0)
+	switch id {
+	case "CHAP":
+		if len(rest) < 16 {
+			return -1
+		}
+		return len(payload) - len(rest) + 16
+	case "CTOC":
+		if len(rest) < 2 {
+			return -1
+		}
+		count := int(rest[1])
+		rest = rest[2:]
+		for i := 0; i < count && len(rest) > 0; i++ {
+			_, rest = cutID3String(rest, 0)
+		}
+		return len(payload) - len(rest)
+	}
+	return -1
+}
+
+// upgradeID3v23EmbeddedFrames re-encodes the frames inside a v2.3 CHAP or
+// CTOC with v2.4 (synchsafe) sizes, so the payload stays valid once the
+// editor writes it into a v2.4 tag.
+func upgradeID3v23EmbeddedFrames(id string, payload []byte) []byte {
+	offset := id3EmbeddedFramesOffset(id, payload)
+	if offset < 0 || offset >= len(payload) {
+		return payload
+	}
+	embedded := parseID3v2xRawFrames(payload[offset:], 3, false)
+	return append(append([]byte(nil), payload[:offset]...), serializeID3v24Frames(embedded)...)
+}
+
+// id3ChapterFrames builds the CHAP frames for chapters plus an ordered,
+// top-level CTOC listing them. A missing end time runs to the next chapter's
+// start, or to durationMs for the last chapter; with no known duration the
+// last chapter needs an explicit end.
+func id3ChapterFrames(chapters []ID3Chapter, durationMs int64) ([]id3RawFrame, error) {
+	if len(chapters) > 255 {
+		return nil, fmt.Errorf("%w: too many chapters: %d (max 255)", errInvalidID3Field, len(chapters))
+	}
+	sorted := slices.Clone(chapters)
+	slices.SortStableFunc(sorted, func(a, b ID3Chapter) int {
+		return cmp.Compare(a.StartMs, b.StartMs)
+	})
+
+	toc := append([]byte(id3TOCElementID), 0x00, 0x03, byte(len(sorted))) // top-level | ordered
+	var frames []id3RawFrame
+	seen := map[string]bool{id3TOCElementID: true}
+	for i, chapter := range sorted {
+		if chapter.StartMs < 0 {
+			return nil, fmt.Errorf("%w: chapter %d starts before the file", errInvalidID3Field, i+1)
+		}
+		id := strings.TrimSpace(chapter.ID)
+		if id == "" {
+			id = fmt.Sprintf("chp%d", i)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("%w: duplicate chapter id: %s", errInvalidID3Field, id)
+		}
+		seen[id] = true
+
+		end := chapter.EndMs
+		if end <= chapter.StartMs {
+			switch {
+			case i+1 < len(sorted):
+				end = sorted[i+1].StartMs
+			case durationMs > chapter.StartMs:
+				end = durationMs
+			default:
+				return nil, fmt.Errorf("%w: chapter %s has no end time and the file duration is unknown", errInvalidID3Field, id)
+			}
+		}
+
+		payload := append([]byte(id), 0x00)
+		payload = binary.BigEndian.AppendUint32(payload, uint32(chapter.StartMs))
+		payload = binary.BigEndian.AppendUint32(payload, uint32(end))
+		payload = append(payload, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF) // no byte offsets
+		if title := strings.TrimSpace(chapter.Title); title != "" {
+			payload = append(payload, serializeID3v24Frames([]id3RawFrame{{id: "TIT2", payload: id3TextPayload(title)}})...)
+		}
+		frames = append(frames, id3RawFrame{id: "CHAP", payload: payload})
+		toc = append(append(toc, []byte(id)...), 0x00)
+	}
+	if len(frames) == 0 {
+		return nil, nil
+	}
+	return append([]id3RawFrame{{id: "CTOC", payload: toc}}, frames...), nil
+}
+
+// parseID3SyncedLyrics renders a SYLT frame as LRC. Only millisecond
+// timestamps are supported; MPEG-frame timestamps would need the stream's
+// frame rate and are skipped.
+func parseID3SyncedLyrics(payload []byte) string {
+	const timestampMs = 2
+	if len(payload) < 6 || payload[4] != timestampMs {
+		return ""
+	}
+	encoding := payload[0]
+	_, rest := cutID3String(payload[6:], encoding) // content descriptor
+
+	var lines []string
+	for len(rest) > 0 {
+		raw, next := cutID3String(rest, encoding)
+		if len(next) < 4 {
+			break
+		}
+		ms := int64(binary.BigEndian.Uint32(next[:4]))
+		rest = next[4:]
+		if text := strings.TrimSpace(decodeID3String(encoding, raw)); text != "" {
+			lines = append(lines, msToLRCTimestamp(ms)+text)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// id3SyncedLyricsPayload builds a UTF-8 SYLT frame with millisecond
+// timestamps from LRC text. Returns nil when the text has no timed lines.
+func id3SyncedLyricsPayload(lrc string) []byte {
+	lines := parseSyncedLyrics(lrc)
+	if len(lines) == 0 {
+		return nil
+	}
+	payload := []byte{0x03}
+	payload = append(payload, []byte("eng")...)
+	payload = append(payload, 0x02, 0x01, 0x00) // ms timestamps, lyrics, empty descriptor
+	for _, line := range lines {
+		payload = append(payload, []byte(line.Words)...)
+		payload = append(payload, 0x00)
+		payload = binary.BigEndian.AppendUint32(payload, uint32(line.StartTimeMs))
+	}
+	return payload
+}
+
+// id3Popularimeter is a POPM frame: a rater, a 0-255 rating and an optional
+// play counter.
+type id3Popularimeter struct {
+	email     string
+	rating    int
+	playCount int64
+}
+
+func parseID3Popularimeter(payload []byte) (id3Popularimeter, bool) {
+	email, rest := cutID3String(payload, 0)
+	if len(rest) < 1 {
+		return id3Popularimeter{}, false
+	}
+	popm := id3Popularimeter{email: string(email), rating: int(rest[0])}
+	for _, b := range rest[1:] {
+		popm.playCount = popm.playCount<<8 | int64(b)
+	}
+	return popm, true
+}
+
+func (p id3Popularimeter) payload() []byte {
+	payload := append([]byte(p.email), 0x00, byte(p.rating))
+	if p.playCount > 0 {
+		payload = binary.BigEndian.AppendUint32(payload, uint32(min(p.playCount, 0xFFFFFFFF)))
+	}
+	return payload
+}
+
+func parseID3UniqueFileID(payload []byte) (owner, identifier string) {
+	rawOwner, rest := cutID3String(payload, 0)
+	return string(rawOwner), string(rest)
+}
+
+func id3UniqueFileIDPayload(owner, identifier string) []byte {
+	return append(append([]byte(owner), 0x00), []byte(identifier)...)
+}
+
+// parseID3ChaptersField decodes the editor's "chapters" value, a JSON array
+// of ID3Chapter.
+func parseID3ChaptersField(value string) ([]ID3Chapter, error) {
+	var chapters []ID3Chapter
+	if err := json.Unmarshal([]byte(value), &chapters); err != nil {
+		return nil, fmt.Errorf("%w: chapters JSON: %w", errInvalidID3Field, err)
+	}
+	return chapters, nil
+}
+
+// parseID3CreditsField decodes the editor's "involved_people" and
+// "musician_credits" values, JSON arrays of ID3Credit.
+func parseID3CreditsField(key, value string) ([]ID3Credit, error) {
+	var credits []ID3Credit
+	if err := json.Unmarshal([]byte(value), &credits); err != nil {
+		return nil, fmt.Errorf("%w: %s JSON: %w", errInvalidID3Field, key, err)
+	}
+	return credits, nil
+}
@@ -0,0 +1,208 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// v23Chapter builds a v2.3 CHAP frame whose TIT2 sub-frame uses v2.3 sizes.
+func v23Chapter(id string, startMs, endMs uint32, title string) []byte {
+	payload := append([]byte(id), 0)
+	payload = binary.BigEndian.AppendUint32(payload, startMs)
+	payload = binary.BigEndian.AppendUint32(payload, endMs)
+	payload = append(payload, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+	payload = append(payload, id3TextFrame("TIT2", title)...)
+	return id3v23Frame("CHAP", payload)
+}
+
+func TestReadID3ExtendedFrames(t *testing.T) {
+	dir := t.TempDir()
+
+	sylt := []byte{3, 'e', 'n', 'g', 2, 1, 0}
+	for _, line := range []struct {
+		text string
+		ms   uint32
+	}{{"First line", 1500}, {"Second line", 62250}} {
+		sylt = append(append(sylt, line.text...), 0)
+		sylt = binary.BigEndian.AppendUint32(sylt, line.ms)
+	}
+	// UTF-16 with a BOM per value, as ID3v2.4 taggers write multi-value frames.
+	utf16Artists := []byte{1, 0xFF, 0xFE, 'A', 0, 0, 0, 0xFF, 0xFE, 'B', 0, 0, 0}
+
+	path, _ := writeTestMP3(t, dir,
+		id3TextFrame("TIT2", "Episode"),
+		id3v23Frame("TPE1", utf16Artists),
+		id3TextFrame("TPE2", "Host\x00Guest"),
+		id3v23Frame("SYLT", sylt),
+		id3v23Frame("POPM", append([]byte("rater@example.com\x00"), 196, 0, 0, 1, 0)),
+		id3v23Frame("UFID", []byte("http://musicbrainz.org\x00mbid-123")),
+		v23Chapter("chp1", 60000, 120000, "Second"),
+		v23Chapter("chp0", 0, 60000, "Intro"),
+		id3TextFrame("IPLS", "producer\x00Rick\x00mixer\x00Andy"),
+	)
+
+	meta, err := ReadID3Tags(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Artist != "A, B" || meta.AlbumArtist != "Host, Guest" {
+		t.Errorf("artists = %q / %q", meta.Artist, meta.AlbumArtist)
+	}
+	if meta.SyncedLyrics != "[00:01.50]First line\n[01:02.25]Second line" || meta.Lyrics != meta.SyncedLyrics {
+		t.Errorf("synced lyrics = %q, lyrics = %q", meta.SyncedLyrics, meta.Lyrics)
+	}
+	if meta.Rating != 196 || meta.PlayCount != 256 || meta.MusicBrainzTrackID != "mbid-123" {
+		t.Errorf("rating %d, play count %d, mbid %q", meta.Rating, meta.PlayCount, meta.MusicBrainzTrackID)
+	}
+	wantChapters := []ID3Chapter{
+		{ID: "chp0", StartMs: 0, EndMs: 60000, Title: "Intro"},
+		{ID: "chp1", StartMs: 60000, EndMs: 120000, Title: "Second"},
+	}
+	if !reflect.DeepEqual(meta.Chapters, wantChapters) {
+		t.Errorf("chapters = %+v", meta.Chapters)
+	}
+	if !reflect.DeepEqual(meta.InvolvedPeople, []ID3Credit{{"producer", "Rick"}, {"mixer", "Andy"}}) {
+		t.Errorf("involved people = %+v", meta.InvolvedPeople)
+	}
+
+	// Rewriting the v2.3 tag as v2.4 must re-encode the chapter sub-frames
+	// and rename IPLS, or the preserved frames stop parsing.
+	if err := EditMP3Fields(path, map[string]string{"title": "Renamed"}); err != nil {
+		t.Fatal(err)
+	}
+	raw := mustReadFile(t, path)
+	if raw[3] != 4 || bytes.Contains(raw, []byte("IPLS")) {
+		t.Fatal("tag not upgraded to v2.4 with TIPL")
+	}
+	after, err := ReadID3Tags(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(after.Chapters, wantChapters) || len(after.InvolvedPeople) != 2 || after.Rating != 196 {
+		t.Errorf("after rewrite: chapters %+v, credits %+v, rating %d", after.Chapters, after.InvolvedPeople, after.Rating)
+	}
+}
+
+func TestEditMP3FieldsExtendedFrames(t *testing.T) {
+	dir := t.TempDir()
+	path, audio := writeTestMP3(t, dir,
+		id3TextFrame("TIT2", "Mix"),
+		id3v23Frame("POPM", append([]byte("rater@example.com\x00"), 10, 0, 0, 0, 7)),
+		id3v23Frame("POPM", append([]byte("other@example.com\x00"), 64)),
+		id3v23Frame("UFID", []byte("http://example.org\x00keep-me")),
+	)
+
+	// The test audio has no decodable frames, so the last chapter's end must
+	// be explicit.
+	chapters, _ := json.Marshal([]ID3Chapter{
+		{StartMs: 90000, EndMs: 150000, Title: "Second"},
+		{StartMs: 0, Title: "First"},
+	})
+	credits, _ := json.Marshal([]ID3Credit{{Role: "guitar", Name: "Jimmy"}, {Role: "drums", Name: "John"}})
+	err := EditMP3Fields(path, map[string]string{
+		"artist":              "Artist A feat. Artist B",
+		"artist_tag_mode":     artistTagModeSplitVorbis,
+		"synced_lyrics":       "[00:05.00]Hello\n[00:10.50]World",
+		"rating":              "255",
+		"musicbrainz_trackid": "mbid-456",
+		"chapters":            string(chapters),
+		"musician_credits":    string(credits),
+	})
+	if err != nil {
+		t.Fatalf("EditMP3Fields: %v", err)
+	}
+
+	raw := mustReadFile(t, path)
+	if !bytes.Contains(raw, []byte("Artist A\x00Artist B")) {
+		t.Error("split artists not stored as NUL-separated values")
+	}
+	if !bytes.Contains(raw, []byte("keep-me")) || !bytes.Contains(raw, []byte("other@example.com")) {
+		t.Error("foreign UFID or POPM frame dropped")
+	}
+	if !bytes.HasSuffix(raw, audio) {
+		t.Error("audio bytes were modified")
+	}
+
+	meta, err := ReadID3Tags(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Artist != "Artist A, Artist B" || meta.MusicBrainzTrackID != "mbid-456" {
+		t.Errorf("artist %q, mbid %q", meta.Artist, meta.MusicBrainzTrackID)
+	}
+	// The first POPM is rewritten in place, keeping its rater and play count.
+	if meta.Rating != 255 || meta.PlayCount != 7 || !bytes.Contains(raw, []byte("rater@example.com\x00\xff")) {
+		t.Errorf("rating %d, play count %d", meta.Rating, meta.PlayCount)
+	}
+	if meta.SyncedLyrics != "[00:05.00]Hello\n[00:10.50]World" {
+		t.Errorf("SYLT = %q", meta.SyncedLyrics)
+	}
+	if len(meta.Chapters) != 2 || meta.Chapters[0].Title != "First" || meta.Chapters[0].EndMs != 90000 ||
+		meta.Chapters[1].StartMs != 90000 || meta.Chapters[1].EndMs != 150000 {
+		t.Errorf("chapters = %+v", meta.Chapters)
+	}
+	if !bytes.Contains(raw, []byte("CTOC")) || !bytes.Contains(raw, []byte("toc\x00\x03\x02chp0\x00chp1\x00")) {
+		t.Error("ordered top-level CTOC missing")
+	}
+	if !reflect.DeepEqual(meta.MusicianCredits, []ID3Credit{{"guitar", "Jimmy"}, {"drums", "John"}}) {
+		t.Errorf("musician credits = %+v", meta.MusicianCredits)
+	}
+
+	out, err := ReadFileMetadata(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result map[string]any
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"synced_lyrics", "rating", "musicbrainz_trackid", "chapters", "musician_credits"} {
+		if _, ok := result[key]; !ok {
+			t.Errorf("ReadFileMetadata missing %s", key)
+		}
+	}
+
+	// Clearing removes the frames; lyrics edits, even cleared or LRC ones,
+	// leave SYLT alone.
+	if err := EditMP3Fields(path, map[string]string{"chapters": "", "musician_credits": "", "lyrics": "Plain"}); err != nil {
+		t.Fatal(err)
+	}
+	raw = mustReadFile(t, path)
+	if bytes.Contains(raw, []byte("CHAP")) || bytes.Contains(raw, []byte("CTOC")) || bytes.Contains(raw, []byte("TMCL")) {
+		t.Error("cleared frames still present")
+	}
+	if meta, _ := ReadID3Tags(path); meta.Lyrics != "Plain" || meta.SyncedLyrics == "" {
+		t.Errorf("lyrics %q, synced %q", meta.Lyrics, meta.SyncedLyrics)
+	}
+	for _, lyrics := range []string{"", "[00:01.00]Other"} {
+		if err := EditMP3Fields(path, map[string]string{"lyrics": lyrics}); err != nil {
+			t.Fatal(err)
+		}
+		if meta, _ := ReadID3Tags(path); meta.SyncedLyrics != "[00:05.00]Hello\n[00:10.50]World" {
+			t.Errorf("lyrics %q replaced SYLT: %q", lyrics, meta.SyncedLyrics)
+		}
+	}
+	if err := EditMP3Fields(path, map[string]string{"synced_lyrics": ""}); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(mustReadFile(t, path), []byte("SYLT")) {
+		t.Error("cleared synced_lyrics left SYLT")
+	}
+
+	// Invalid values are reported to the caller, never handed to ffmpeg.
+	openEnded, _ := json.Marshal([]ID3Chapter{{StartMs: 0, Title: "Only"}})
+	duplicateIDs, _ := json.Marshal([]ID3Chapter{{ID: "a", StartMs: 0, EndMs: 1}, {ID: "a", StartMs: 1, EndMs: 2}})
+	for _, value := range []string{"{", string(openEnded), string(duplicateIDs)} {
+		fieldsJSON, _ := json.Marshal(map[string]string{"chapters": value})
+		if out, err := EditFileMetadata(path, string(fieldsJSON)); !errors.Is(err, errInvalidID3Field) {
+			t.Errorf("chapters %s: EditFileMetadata = %s, %v", value, out, err)
+		}
+	}
+	if meta, _ := ReadID3Tags(path); len(meta.Chapters) != 0 {
+		t.Errorf("rejected edit wrote chapters: %+v", meta.Chapters)
+	}
+}
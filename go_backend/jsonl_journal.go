@@ -0,0 +1,138 @@
+package gobackend
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// jsonlJournalMaxLine bounds one journal line; a library track with long
+// lyrics is the largest record written.
+const jsonlJournalMaxLine = 16 << 20
+
+// jsonlJournal is the JSON-lines file behind the download queue, the library
+// store and the duplicate index. A store replays it into memory on open,
+// appends one line per change with an fsync, and compacts it to one line per
+// live record via temp file + rename so a crash mid-compaction leaves the
+// previous journal intact. Callers serialize access.
+type jsonlJournal[T any] struct {
+	path string
+	file *os.File
+	// lines counts the lines in the file, superseded ones included, so the
+	// owner can decide when to compact.
+	lines int
+}
+
+// replay passes every readable line to apply in order until apply returns
+// false. A missing file is an empty journal.
+func (j *jsonlJournal[T]) replay(logTag string, apply func(entry T) bool) error {
+	file, err := os.Open(j.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), jsonlJournalMaxLine)
+	lines, skipped := 0, 0
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		lines++
+		var entry T
+		if err := json.Unmarshal(line, &entry); err != nil {
+			// A torn final line is the expected result of dying mid-append.
+			skipped++
+			continue
+		}
+		if !apply(entry) {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if skipped > 0 {
+		GoLog("[%s] Skipped %d unreadable journal line(s)\n", logTag, skipped)
+	}
+	j.lines = lines
+	return nil
+}
+
+// append writes entries with a single fsync, creating the file on first use.
+func (j *jsonlJournal[T]) append(entries ...T) error {
+	if j.file == nil {
+		file, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		j.file = file
+	}
+	writer := bufio.NewWriter(j.file)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	_ = j.file.Sync()
+	j.lines += len(entries)
+	return nil
+}
+
+// compact replaces the journal with entries.
+func (j *jsonlJournal[T]) compact(entries []T) error {
+	j.close()
+
+	tmpPath := j.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	var writeErr error
+	for _, entry := range entries {
+		if writeErr = encoder.Encode(entry); writeErr != nil {
+			break
+		}
+	}
+	if writeErr == nil {
+		writeErr = writer.Flush()
+	}
+	if writeErr == nil {
+		writeErr = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); writeErr == nil {
+		writeErr = closeErr
+	}
+	if writeErr != nil {
+		os.Remove(tmpPath)
+		return writeErr
+	}
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("publish: %w", err)
+	}
+	syncDir(filepath.Dir(j.path))
+	j.lines = len(entries)
+	return nil
+}
+
+func (j *jsonlJournal[T]) close() {
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+}
@@ -0,0 +1,65 @@
+package gobackend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testJournalEntry struct {
+	Key   string `json:"key"`
+	Value int    `json:"value"`
+}
+
+func TestJSONLJournalReplaysAroundTornTailAndCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.jsonl")
+	journal := jsonlJournal[testJournalEntry]{path: path}
+	if err := journal.append(testJournalEntry{"a", 1}, testJournalEntry{"b", 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.append(testJournalEntry{"a", 3}); err != nil {
+		t.Fatal(err)
+	}
+	journal.close()
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"key":"c","val`)
+	file.Close()
+
+	replay := func() map[string]int {
+		t.Helper()
+		values := make(map[string]int)
+		reopened := jsonlJournal[testJournalEntry]{path: path}
+		if err := reopened.replay("Test", func(entry testJournalEntry) bool {
+			values[entry.Key] = entry.Value
+			return true
+		}); err != nil {
+			t.Fatalf("replay: %v", err)
+		}
+		return values
+	}
+	if values := replay(); len(values) != 2 || values["a"] != 3 || values["b"] != 2 {
+		t.Fatalf("replayed = %v", values)
+	}
+
+	if err := journal.compact([]testJournalEntry{{"a", 3}}); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	if journal.lines != 1 {
+		t.Fatalf("lines after compact = %d", journal.lines)
+	}
+	if values := replay(); len(values) != 1 || values["a"] != 3 {
+		t.Fatalf("after compact = %v", values)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temp file left behind: %v", err)
+	}
+
+	missing := jsonlJournal[testJournalEntry]{path: filepath.Join(t.TempDir(), "none.jsonl")}
+	if err := missing.replay("Test", func(testJournalEntry) bool { return true }); err != nil {
+		t.Fatalf("missing journal: %v", err)
+	}
+}
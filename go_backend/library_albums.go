@@ -0,0 +1,335 @@
+package gobackend
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Albums are derived from the stored tracks rather than stored themselves,
+// so they can never drift from the files. A track belongs to the album keyed
+// by its album artist (falling back to the track artist), album title, year
+// and release folder. Per-disc subfolders ("CD1", "Disc 2") and per-disc
+// title suffixes ("Title (Disc 2)") fold into one release.
+
+// libraryDiscFolderPattern matches the per-disc subfolders of one release
+// ("CD1", "Disc 2", "disk_3"), which are not a split album.
+var libraryDiscFolderPattern = regexp.MustCompile(`(?i)^(cd|disc|disk)[\s_-]*\d+\b`)
+
+// libraryDiscTitleSuffix matches a disc marker at the end of an album title.
+var libraryDiscTitleSuffix = regexp.MustCompile(`(?i)\s*[\(\[]\s*(cd|disc|disk)\s*\d+\s*[\)\]]\s*$`)
+
+var libraryFolderCoverNames = []string{"cover", "folder", "front", "albumart", "album"}
+
+type LibraryAlbum struct {
+	ID          string `json:"id"`
+	AlbumName   string `json:"albumName"`
+	AlbumArtist string `json:"albumArtist"`
+	Year        string `json:"year,omitempty"`
+	Folder      string `json:"folder"`
+	TrackCount  int    `json:"trackCount"`
+	// ExpectedTracks sums the tagged TotalTracks of every disc up to the
+	// tagged disc total or highest disc number; 0 when any disc's total is
+	// unknown, including a disc with no tracks on disk.
+	ExpectedTracks int     `json:"expectedTracks,omitempty"`
+	DiscCount      int     `json:"discCount"`
+	TotalDiscs     int     `json:"totalDiscs,omitempty"`
+	Complete       bool    `json:"complete"`
+	Completeness   float64 `json:"completeness,omitempty"`
+	Duration       int     `json:"duration"`
+	DominantFormat string  `json:"dominantFormat,omitempty"`
+	CoverPath      string  `json:"coverPath,omitempty"`
+	DateAdded      int64   `json:"dateAdded,omitempty"`
+	// TrackIDs are the LibraryScanResult IDs in disc/track order.
+	TrackIDs []string `json:"trackIds"`
+
+	// trackFolder is the first track's directory, the second place
+	// resolveFolderCover looks.
+	trackFolder string
+}
+
+// findFolderCover returns the cover image stored beside the tracks in dir
+// (cover.jpg, folder.png, ...), or "".
+func findFolderCover(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := strings.ToLower(entry.Name())
+		ext := filepath.Ext(name)
+		if ext != ".jpg" && ext != ".jpeg" && ext != ".png" && ext != ".webp" {
+			continue
+		}
+		base := strings.TrimSuffix(name, ext)
+		for _, coverName := range libraryFolderCoverNames {
+			if base == coverName {
+				return filepath.Join(dir, entry.Name())
+			}
+		}
+	}
+	return ""
+}
+
+func libraryTrackYear(result *LibraryScanResult) string {
+	date := strings.TrimSpace(result.ReleaseDate)
+	if len(date) >= 4 {
+		return date[:4]
+	}
+	return date
+}
+
+// libraryAlbumArtist is the album artist the library groups and displays
+// a track under.
+func libraryAlbumArtist(result *LibraryScanResult) string {
+	if artist := strings.TrimSpace(result.AlbumArtist); artist != "" {
+		return artist
+	}
+	return strings.TrimSpace(result.ArtistName)
+}
+
+// libraryReleaseFolder maps a per-disc subfolder to the release folder.
+func libraryReleaseFolder(dir string) string {
+	if libraryDiscFolderPattern.MatchString(filepath.Base(dir)) {
+		return filepath.Dir(dir)
+	}
+	return dir
+}
+
+func libraryAlbumTitle(result *LibraryScanResult) string {
+	return strings.TrimSpace(libraryDiscTitleSuffix.ReplaceAllString(result.AlbumName, ""))
+}
+
+// libraryAlbumKey returns the grouping key for result. It is the one album
+// identity shared by album listings, health checks and album ReplayGain.
+// Tracks without a tagged album (the scanner's placeholder or a folder name
+// guessed from the path) get "": pooling them would invent an album.
+func libraryAlbumKey(result *LibraryScanResult) string {
+	if result.MetadataFromFilename {
+		return ""
+	}
+	album := strings.ToLower(libraryAlbumTitle(result))
+	if album == "" || album == "unknown album" {
+		return ""
+	}
+	return strings.Join([]string{
+		strings.ToLower(libraryAlbumArtist(result)),
+		album,
+		libraryTrackYear(result),
+		libraryReleaseFolder(filepath.Dir(result.FilePath)),
+	}, "\x00")
+}
+
+func libraryAlbumID(key string) string {
+	return fmt.Sprintf("alb_%x", hashString(key))
+}
+
+// groupLibraryAlbums builds albums from tracks in first-seen order. Tracks
+// without an album key are left out.
+func groupLibraryAlbums(tracks []*LibraryStoreTrack) []LibraryAlbum {
+	byKey := make(map[string][]*LibraryStoreTrack)
+	var order []string
+	for _, track := range tracks {
+		key := libraryAlbumKey(&track.LibraryScanResult)
+		if key == "" {
+			continue
+		}
+		if _, ok := byKey[key]; !ok {
+			order = append(order, key)
+		}
+		byKey[key] = append(byKey[key], track)
+	}
+
+	albums := make([]LibraryAlbum, 0, len(order))
+	for _, key := range order {
+		albums = append(albums, buildLibraryAlbum(key, byKey[key]))
+	}
+	return albums
+}
+
+func buildLibraryAlbum(key string, tracks []*LibraryStoreTrack) LibraryAlbum {
+	sort.SliceStable(tracks, func(i, j int) bool {
+		a, b := tracks[i], tracks[j]
+		if a.DiscNumber != b.DiscNumber {
+			return a.DiscNumber < b.DiscNumber
+		}
+		if a.TrackNumber != b.TrackNumber {
+			return a.TrackNumber < b.TrackNumber
+		}
+		return a.FilePath < b.FilePath
+	})
+	first := &tracks[0].LibraryScanResult
+	album := LibraryAlbum{
+		ID:          libraryAlbumID(key),
+		AlbumName:   libraryAlbumTitle(first),
+		AlbumArtist: libraryAlbumArtist(first),
+		Year:        libraryTrackYear(first),
+		Folder:      libraryReleaseFolder(filepath.Dir(first.FilePath)),
+		TrackCount:  len(tracks),
+		TrackIDs:    make([]string, 0, len(tracks)),
+		trackFolder: filepath.Dir(first.FilePath),
+	}
+
+	discTotals := make(map[int]int)
+	positions := make(map[[2]int]bool)
+	formats := make(map[string]int)
+	for _, track := range tracks {
+		disc := max(track.DiscNumber, 1)
+		discTotals[disc] = max(discTotals[disc], track.TotalTracks)
+		if track.TrackNumber > 0 {
+			positions[[2]int{disc, track.TrackNumber}] = true
+		}
+		album.TotalDiscs = max(album.TotalDiscs, track.TotalDiscs)
+		album.Duration += track.Duration
+		if format := strings.ToLower(track.Format); format != "" {
+			formats[format]++
+		}
+		if album.CoverPath == "" {
+			album.CoverPath = track.CoverPath
+		}
+		if album.DateAdded == 0 || (track.DateAdded > 0 && track.DateAdded < album.DateAdded) {
+			album.DateAdded = track.DateAdded
+		}
+		album.TrackIDs = append(album.TrackIDs, track.ID)
+	}
+	album.DiscCount = len(discTotals)
+
+	// A disc with no tracks on disk has no known total, so the album's
+	// expected count is unknown rather than the sum of the discs present.
+	expectedDiscs := album.TotalDiscs
+	for disc := range discTotals {
+		expectedDiscs = max(expectedDiscs, disc)
+	}
+	for disc := 1; disc <= expectedDiscs; disc++ {
+		total := discTotals[disc]
+		if total == 0 {
+			album.ExpectedTracks = 0
+			break
+		}
+		album.ExpectedTracks += total
+	}
+	if album.ExpectedTracks > 0 {
+		album.Completeness = min(float64(len(positions))/float64(album.ExpectedTracks), 1)
+		album.Complete = len(positions) >= album.ExpectedTracks
+	}
+
+	for format, count := range formats {
+		if count > formats[album.DominantFormat] || (count == formats[album.DominantFormat] && format < album.DominantFormat) {
+			album.DominantFormat = format
+		}
+	}
+
+	return album
+}
+
+// resolveFolderCover falls back to a cover image beside the tracks when none
+// of them has an embedded or cached one. It reads the folder, so albums()
+// only calls it for the page it returns.
+func (a *LibraryAlbum) resolveFolderCover() {
+	if a.CoverPath == "" {
+		a.CoverPath = findFolderCover(a.Folder)
+	}
+	if a.CoverPath == "" && a.trackFolder != a.Folder {
+		a.CoverPath = findFolderCover(a.trackFolder)
+	}
+}
+
+type LibraryAlbumsResult struct {
+	Total  int            `json:"total"`
+	Offset int            `json:"offset"`
+	Albums []LibraryAlbum `json:"albums"`
+	Seq    int64          `json:"seq"`
+}
+
+func libraryAlbumCompare(sortBy string) (func(a, b *LibraryAlbum) int, error) {
+	switch sortBy {
+	case "", "artist":
+		return func(a, b *LibraryAlbum) int { return compareFold(a.AlbumArtist, b.AlbumArtist) }, nil
+	case "album":
+		return func(a, b *LibraryAlbum) int { return compareFold(a.AlbumName, b.AlbumName) }, nil
+	case "year":
+		return func(a, b *LibraryAlbum) int { return strings.Compare(a.Year, b.Year) }, nil
+	case "date_added":
+		return func(a, b *LibraryAlbum) int { return compareInt64(a.DateAdded, b.DateAdded) }, nil
+	}
+	return nil, fmt.Errorf("unsupported album sort field: %s", sortBy)
+}
+
+// albums groups the tracks matching q into albums and returns one page of
+// them. Sort accepts "artist", "album", "year" or "date_added".
+func (s *libraryStore) albums(q LibraryQuery) (*LibraryAlbumsResult, error) {
+	primary, err := libraryAlbumCompare(strings.ToLower(strings.TrimSpace(q.Sort)))
+	if err != nil {
+		return nil, err
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = libraryQueryDefaultLimit
+	}
+	limit = min(limit, libraryQueryMaxLimit)
+	offset := max(q.Offset, 0)
+
+	s.mu.RLock()
+	matched := make([]*LibraryStoreTrack, 0, len(s.tracks))
+	for _, path := range sortedLibraryStorePaths(s.tracks) {
+		if track := s.tracks[path]; q.matches(track) {
+			matched = append(matched, track)
+		}
+	}
+	seq := s.seq
+	// Tracks are immutable once stored (apply replaces the pointer), so
+	// grouping can run outside the lock.
+	s.mu.RUnlock()
+
+	albums := groupLibraryAlbums(matched)
+	sort.SliceStable(albums, func(i, j int) bool {
+		a, b := &albums[i], &albums[j]
+		c := primary(a, b)
+		if q.Descending {
+			c = -c
+		}
+		if c == 0 {
+			c = compareFold(a.AlbumArtist, b.AlbumArtist)
+		}
+		if c == 0 {
+			c = compareFold(a.AlbumName, b.AlbumName)
+		}
+		if c == 0 {
+			c = strings.Compare(a.Year, b.Year)
+		}
+		if c == 0 {
+			c = strings.Compare(a.Folder, b.Folder)
+		}
+		return c < 0
+	})
+
+	result := &LibraryAlbumsResult{Total: len(albums), Offset: offset, Albums: []LibraryAlbum{}, Seq: seq}
+	if offset < len(albums) {
+		result.Albums = albums[offset:min(offset+limit, len(albums))]
+	}
+	for i := range result.Albums {
+		result.Albums[i].resolveFolderCover()
+	}
+	return result, nil
+}
+
+// GetLibraryAlbums returns one page of the albums formed by the stored
+// tracks matching queryJSON (a LibraryQuery). Tracks of one album are listed
+// with QueryLibrary and {"album_id": ...}.
+func GetLibraryAlbums(queryJSON string) (string, error) {
+	q, err := parseLibraryQuery(queryJSON)
+	if err != nil {
+		return "", err
+	}
+	result, err := getLibraryStore().albums(q)
+	if err != nil {
+		return "", err
+	}
+	return marshalJSONString(result)
+}
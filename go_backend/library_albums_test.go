@@ -0,0 +1,107 @@
+package gobackend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGroupLibraryAlbumsMergesDiscFolders(t *testing.T) {
+	root := t.TempDir()
+	release := filepath.Join(root, "Band - Record")
+	if err := os.MkdirAll(release, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cover := filepath.Join(release, "Folder.jpg")
+	if err := os.WriteFile(cover, []byte{0xFF, 0xD8, 0xFF}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	track := func(path, album string, disc, number, total int, format string) *LibraryStoreTrack {
+		return &LibraryStoreTrack{LibraryScanResult: LibraryScanResult{
+			ID: generateLibraryID(path), FilePath: path, TrackName: filepath.Base(path),
+			ArtistName: "Band", AlbumName: album, ReleaseDate: "1999-05-01",
+			DiscNumber: disc, TotalDiscs: 2, TrackNumber: number, TotalTracks: total,
+			Duration: 100, Format: format,
+		}}
+	}
+	tracks := []*LibraryStoreTrack{
+		track(filepath.Join(release, "CD2", "01.flac"), "Record (Disc 2)", 2, 1, 1, "flac"),
+		track(filepath.Join(release, "CD1", "02.flac"), "Record", 1, 2, 2, "flac"),
+		track(filepath.Join(release, "CD1", "01.mp3"), "Record [CD1]", 1, 1, 2, "mp3"),
+		track(filepath.Join(root, "Other", "01.flac"), "Record", 1, 1, 9, "flac"),
+		{LibraryScanResult: LibraryScanResult{FilePath: filepath.Join(root, "loose.mp3"), MetadataFromFilename: true}},
+	}
+	tracks[3].TotalDiscs = 1
+
+	albums := groupLibraryAlbums(tracks)
+	if len(albums) != 2 {
+		t.Fatalf("albums = %+v", albums)
+	}
+	album := albums[0]
+	if album.AlbumName != "Record" || album.AlbumArtist != "Band" || album.Year != "1999" || album.Folder != release {
+		t.Fatalf("album identity = %+v", album)
+	}
+	if album.TrackCount != 3 || album.DiscCount != 2 || album.ExpectedTracks != 3 || !album.Complete || album.Duration != 300 {
+		t.Fatalf("album counts = %+v", album)
+	}
+	if album.DominantFormat != "flac" || album.CoverPath != "" {
+		t.Fatalf("album format/cover = %+v", album)
+	}
+	// Folder covers are looked up per returned page, not while grouping.
+	album.resolveFolderCover()
+	if album.CoverPath != cover {
+		t.Fatalf("folder cover = %q, want %q", album.CoverPath, cover)
+	}
+	if want := generateLibraryID(filepath.Join(release, "CD1", "01.mp3")); album.TrackIDs[0] != want {
+		t.Fatalf("track order = %v", album.TrackIDs)
+	}
+	if other := albums[1]; other.Complete || other.Completeness <= 0 || other.Completeness >= 1 || other.Folder == release {
+		t.Fatalf("incomplete album = %+v", other)
+	}
+}
+
+func TestGroupLibraryAlbumsMissingDiscIsIncomplete(t *testing.T) {
+	track := func(name string, disc, number, totalDiscs int) *LibraryStoreTrack {
+		return &LibraryStoreTrack{LibraryScanResult: LibraryScanResult{
+			FilePath: filepath.Join("/music/Band - Record", name), ArtistName: "Band", AlbumName: "Record",
+			DiscNumber: disc, TotalDiscs: totalDiscs, TrackNumber: number, TotalTracks: 2,
+		}}
+	}
+	for _, tracks := range [][]*LibraryStoreTrack{
+		{track("1-01.flac", 1, 1, 2), track("1-02.flac", 1, 2, 2)},
+		{track("2-01.flac", 2, 1, 0), track("2-02.flac", 2, 2, 0)},
+	} {
+		album := groupLibraryAlbums(tracks)[0]
+		if album.Complete || album.ExpectedTracks != 0 || album.Completeness != 0 {
+			t.Fatalf("album missing a disc = %+v", album)
+		}
+	}
+}
+
+func TestLibraryStoreAlbumsQuery(t *testing.T) {
+	store := &libraryStore{tracks: make(map[string]*LibraryStoreTrack)}
+	store.apply([]LibraryScanResult{
+		{ID: "a1", FilePath: "/m/A/1.flac", ArtistName: "Zed", AlbumName: "Alpha", TrackNumber: 1, Format: "flac"},
+		{ID: "a2", FilePath: "/m/A/2.flac", ArtistName: "Zed", AlbumName: "Alpha", TrackNumber: 2, Format: "flac"},
+		{ID: "b1", FilePath: "/m/B/1.mp3", ArtistName: "Amy", AlbumName: "Beta", TrackNumber: 1, Format: "mp3"},
+	}, nil)
+
+	result, err := store.albums(LibraryQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 2 || result.Albums[0].AlbumArtist != "Amy" || result.Albums[1].TrackCount != 2 {
+		t.Fatalf("albums = %+v", result)
+	}
+	tracks, err := store.query(LibraryQuery{AlbumID: result.Albums[1].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tracks.Total != 2 || tracks.Tracks[0].ID != "a1" {
+		t.Fatalf("album tracks = %+v", tracks)
+	}
+	if _, err := store.albums(LibraryQuery{Sort: "bit_depth"}); err == nil {
+		t.Fatal("expected unsupported album sort")
+	}
+}
@@ -0,0 +1,619 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Library health issue kinds.
+const (
+	libraryHealthUnreadableHeader  = "unreadable_header"
+	libraryHealthExtensionMismatch = "extension_mismatch"
+	libraryHealthMixedAlbumArtist  = "mixed_album_artist"
+	libraryHealthMixedYear         = "mixed_year"
+	libraryHealthMissingISRC       = "missing_isrc"
+	libraryHealthMissingCover      = "missing_cover"
+	libraryHealthNumberingGap      = "numbering_gap"
+	libraryHealthSplitAlbum        = "split_album"
+)
+
+type LibraryHealthProgress struct {
+	TotalFiles     int     `json:"total_files"`
+	ProcessedFiles int     `json:"processed_files"`
+	CurrentFile    string  `json:"current_file"`
+	ProgressPct    float64 `json:"progress_pct"`
+	IsComplete     bool    `json:"is_complete"`
+	IsCancelled    bool    `json:"is_cancelled,omitempty"`
+}
+
+// LibraryHealthIssue is one finding. File-level issues set Path; album-level
+// ones set Album, AlbumArtist and the album's Paths. Values carries the
+// conflicting values, missing numbers or folders, depending on Kind.
+type LibraryHealthIssue struct {
+	Kind        string   `json:"kind"`
+	Path        string   `json:"path,omitempty"`
+	Album       string   `json:"album,omitempty"`
+	AlbumArtist string   `json:"album_artist,omitempty"`
+	Paths       []string `json:"paths,omitempty"`
+	Values      []string `json:"values,omitempty"`
+	Detail      string   `json:"detail"`
+}
+
+type LibraryHealthReport struct {
+	TotalFiles int                  `json:"total_files"`
+	Issues     []LibraryHealthIssue `json:"issues"`
+	Counts     map[string]int       `json:"counts"`
+}
+
+var (
+	libraryHealthProgress   LibraryHealthProgress
+	libraryHealthProgressMu sync.RWMutex
+	libraryHealthCancel     chan struct{}
+	libraryHealthCancelMu   sync.Mutex
+
+	// libraryHealthFileHook, when set, is called with each file before it is
+	// checked. Tests use it to act at a known point of a run.
+	libraryHealthFileHook func(path string)
+)
+
+// libraryExpectedContainers lists the containers a file with the extension
+// may legitimately hold.
+var libraryExpectedContainers = map[string][]string{
+	".flac": {"flac"},
+	".m4a":  {"mp4"},
+	".mp4":  {"mp4"},
+	".aac":  {"aac", "mp4"},
+	".mp3":  {"mp3"},
+	".ogg":  {"ogg"},
+	".opus": {"ogg"},
+	".ape":  {"ape"},
+	".wv":   {"wavpack"},
+	".mpc":  {"musepack"},
+	".wav":  {"wav"},
+	".aiff": {"aiff"},
+	".aif":  {"aiff"},
+	".dsf":  {"dsf"},
+	".dff":  {"dff"},
+}
+
+// sniffAudioContainer identifies the container from the file's leading
+// bytes, skipping ID3v2 tags. It returns "" when nothing is recognized.
+func sniffAudioContainer(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var offset int64
+	header := make([]byte, 4096)
+	for range 4 {
+		n, err := f.ReadAt(header, offset)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		buf := header[:n]
+		if len(buf) >= 10 && string(buf[0:3]) == "ID3" {
+			offset += 10 + int64(synchsafeDecode(buf[6:10]))
+			if buf[5]&0x10 != 0 {
+				offset += 10 // footer
+			}
+			continue
+		}
+		return sniffAudioContainerBytes(buf), nil
+	}
+	return "", nil
+}
+
+func sniffAudioContainerBytes(buf []byte) string {
+	if len(buf) < 4 {
+		return ""
+	}
+	switch string(buf[0:4]) {
+	case "fLaC":
+		return "flac"
+	case "OggS":
+		return "ogg"
+	case "MAC ":
+		return "ape"
+	case "wvpk":
+		return "wavpack"
+	case "MPCK":
+		return "musepack"
+	case "DSD ":
+		return "dsf"
+	}
+	if string(buf[0:3]) == "MP+" {
+		return "musepack"
+	}
+	if len(buf) >= 12 {
+		if string(buf[0:4]) == "RIFF" && string(buf[8:12]) == "WAVE" {
+			return "wav"
+		}
+		if string(buf[0:4]) == "FORM" && (string(buf[8:12]) == "AIFF" || string(buf[8:12]) == "AIFC") {
+			return "aiff"
+		}
+	}
+	if len(buf) >= 16 && string(buf[0:4]) == "FRM8" && string(buf[12:16]) == "DSD " {
+		return "dff"
+	}
+	if len(buf) >= 8 && string(buf[4:8]) == "ftyp" {
+		return "mp4"
+	}
+	if buf[0] == 0xFF && buf[1]&0xF6 == 0xF0 {
+		return "aac" // ADTS: MPEG sync with layer 0
+	}
+	// A lone sync word is common in random data, so MPEG audio must start
+	// right here and a second frame header must follow the first frame.
+	if frameLen := mpegAudioFrameLength(buf); frameLen > 0 {
+		if len(buf) == frameLen || (len(buf) >= frameLen+4 && mpegAudioFrameLength(buf[frameLen:]) > 0) {
+			return "mp3"
+		}
+	}
+	return ""
+}
+
+var (
+	mpeg1Bitrates = [3][15]int{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448}, // layer I
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},    // layer II
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},     // layer III
+	}
+	mpeg2Bitrates = [3][15]int{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	}
+	mpeg1SampleRates = [3]int{44100, 48000, 32000}
+)
+
+// mpegAudioFrameLength returns the byte length of the MPEG audio frame whose
+// header starts buf, or 0 when buf does not start with a valid header.
+// Free-format frames (bitrate index 0) are rejected: their length is not in
+// the header.
+func mpegAudioFrameLength(buf []byte) int {
+	if len(buf) < 4 || buf[0] != 0xFF || buf[1]&0xE0 != 0xE0 {
+		return 0
+	}
+	version := (buf[1] >> 3) & 0x03 // 0: MPEG-2.5, 2: MPEG-2, 3: MPEG-1
+	layer := (buf[1] >> 1) & 0x03   // 1: III, 2: II, 3: I
+	bitrateIndex := buf[2] >> 4
+	sampleRateIndex := (buf[2] >> 2) & 0x03
+	if version == 1 || layer == 0 || bitrateIndex == 0 || bitrateIndex == 0x0F || sampleRateIndex == 0x03 {
+		return 0
+	}
+	padding := int(buf[2]>>1) & 0x01
+	layerIndex := 3 - int(layer) // 0: I, 1: II, 2: III
+	sampleRate := mpeg1SampleRates[sampleRateIndex]
+	bitrate := mpeg1Bitrates[layerIndex][bitrateIndex] * 1000
+	if version != 3 {
+		sampleRate /= 2
+		if version == 0 {
+			sampleRate /= 2
+		}
+		bitrate = mpeg2Bitrates[layerIndex][bitrateIndex] * 1000
+	}
+	switch {
+	case layerIndex == 0:
+		return (12*bitrate/sampleRate + padding) * 4
+	case layerIndex == 2 && version != 3:
+		return 72*bitrate/sampleRate + padding
+	default:
+		return 144*bitrate/sampleRate + padding
+	}
+}
+
+// checkAudioStream runs the format's own header parser over the file.
+func checkAudioStream(path, container string) error {
+	switch container {
+	case "flac":
+		f, err := parseFlacFile(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = audioQualityFromParsedFlac(f)
+		return err
+	case "mp4":
+		_, err := GetM4AQuality(path)
+		return err
+	case "mp3":
+		_, err := GetMP3Quality(path)
+		return err
+	case "ogg":
+		_, err := GetOggQuality(path)
+		return err
+	case "wav":
+		_, err := GetWAVQuality(path)
+		return err
+	case "aiff":
+		_, err := GetAIFFQuality(path)
+		return err
+	case "wavpack":
+		_, err := GetWavPackQuality(path)
+		return err
+	case "musepack":
+		_, err := GetMusepackQuality(path)
+		return err
+	case "dsf", "dff":
+		_, err := GetDSDQuality(path)
+		return err
+	}
+	return nil
+}
+
+// checkLibraryFileHeader returns the header issue for path, if any.
+func checkLibraryFileHeader(path string) *LibraryHealthIssue {
+	ext := strings.ToLower(filepath.Ext(path))
+	container, err := sniffAudioContainer(path)
+	if err != nil {
+		return &LibraryHealthIssue{Kind: libraryHealthUnreadableHeader, Path: path, Detail: err.Error()}
+	}
+	if container == "" {
+		return &LibraryHealthIssue{Kind: libraryHealthUnreadableHeader, Path: path, Detail: "no known audio container signature"}
+	}
+	expected := libraryExpectedContainers[ext]
+	matches := false
+	for _, want := range expected {
+		if want == container {
+			matches = true
+			break
+		}
+	}
+	if !matches {
+		return &LibraryHealthIssue{
+			Kind:   libraryHealthExtensionMismatch,
+			Path:   path,
+			Values: []string{ext, container},
+			Detail: fmt.Sprintf("%s file contains %s data", ext, container),
+		}
+	}
+	if err := checkAudioStream(path, container); err != nil {
+		return &LibraryHealthIssue{Kind: libraryHealthUnreadableHeader, Path: path, Detail: err.Error()}
+	}
+	return nil
+}
+
+func hasEmbeddedCover(path string) bool {
+	data, _, err := extractAnyCoverArtWithHint(path, "")
+	return err == nil && len(data) > 0
+}
+
+// distinctFoldValues returns the distinct values case-insensitively, in
+// first-seen spelling.
+func distinctFoldValues(values []string) []string {
+	seen := make(map[string]bool)
+	var distinct []string
+	for _, value := range values {
+		key := strings.ToLower(value)
+		if !seen[key] {
+			seen[key] = true
+			distinct = append(distinct, value)
+		}
+	}
+	return distinct
+}
+
+// missingNumbers lists the numbers in 1..upTo absent from present.
+func missingNumbers(present map[int]bool, upTo int) []string {
+	var missing []string
+	for n := 1; n <= upTo; n++ {
+		if !present[n] {
+			missing = append(missing, strconv.Itoa(n))
+		}
+	}
+	return missing
+}
+
+func libraryResultPaths(results []*LibraryScanResult) []string {
+	paths := make([]string, len(results))
+	for i, result := range results {
+		paths[i] = result.FilePath
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// analyzeLibraryAlbums reports tag inconsistencies between tracks. Mixed
+// album artist and year are checked per folder and album title, since those
+// are exactly the tags that keep a release from grouping; numbering gaps per
+// album as the library groups it (libraryAlbumKey), and folder splits across
+// albums whose keys differ only in the release folder. Gaps are only reported
+// below the highest disc and track number present: a tagged total alone
+// would flag every partial album and single-track download.
+func analyzeLibraryAlbums(results []*LibraryScanResult) []LibraryHealthIssue {
+	var issues []LibraryHealthIssue
+
+	byFolder := make(map[string][]*LibraryScanResult)
+	var folderOrder []string
+	for _, result := range results {
+		if result.MetadataFromFilename || strings.TrimSpace(result.AlbumName) == "" {
+			continue
+		}
+		key := filepath.Dir(result.FilePath) + "\x00" + strings.ToLower(strings.TrimSpace(result.AlbumName))
+		if _, ok := byFolder[key]; !ok {
+			folderOrder = append(folderOrder, key)
+		}
+		byFolder[key] = append(byFolder[key], result)
+	}
+	for _, key := range folderOrder {
+		tracks := byFolder[key]
+		var artists, years []string
+		for _, track := range tracks {
+			artists = append(artists, strings.TrimSpace(track.AlbumArtist))
+			years = append(years, libraryTrackYear(track))
+		}
+		album := strings.TrimSpace(tracks[0].AlbumName)
+		if distinct := distinctFoldValues(artists); len(distinct) > 1 {
+			issues = append(issues, LibraryHealthIssue{
+				Kind:   libraryHealthMixedAlbumArtist,
+				Album:  album,
+				Paths:  libraryResultPaths(tracks),
+				Values: distinct,
+				Detail: fmt.Sprintf("%d different album artist values", len(distinct)),
+			})
+		}
+		if distinct := distinctFoldValues(years); len(distinct) > 1 {
+			issues = append(issues, LibraryHealthIssue{
+				Kind:        libraryHealthMixedYear,
+				Album:       album,
+				AlbumArtist: libraryAlbumArtist(tracks[0]),
+				Paths:       libraryResultPaths(tracks),
+				Values:      distinct,
+				Detail:      fmt.Sprintf("%d different year values", len(distinct)),
+			})
+		}
+	}
+
+	byAlbum := make(map[string][]*LibraryScanResult)
+	var albumOrder []string
+	for _, result := range results {
+		key := libraryAlbumKey(result)
+		if key == "" {
+			continue
+		}
+		if _, ok := byAlbum[key]; !ok {
+			albumOrder = append(albumOrder, key)
+		}
+		byAlbum[key] = append(byAlbum[key], result)
+	}
+	releaseFolders := make(map[string][]string)
+	var releaseOrder []string
+	for _, key := range albumOrder {
+		tracks := byAlbum[key]
+		album := strings.TrimSpace(tracks[0].AlbumName)
+		albumArtist := libraryAlbumArtist(tracks[0])
+		albumIssue := func(kind, detail string, values []string) LibraryHealthIssue {
+			return LibraryHealthIssue{
+				Kind:        kind,
+				Album:       album,
+				AlbumArtist: albumArtist,
+				Paths:       libraryResultPaths(tracks),
+				Values:      values,
+				Detail:      detail,
+			}
+		}
+
+		discs := make(map[int]bool)
+		maxDisc := 0
+		trackNumbers := make(map[int]map[int]bool)
+		maxTrack := make(map[int]int)
+		for _, track := range tracks {
+			disc := max(track.DiscNumber, 1)
+			if track.DiscNumber > 0 {
+				discs[track.DiscNumber] = true
+			}
+			maxDisc = max(maxDisc, track.DiscNumber)
+			if track.TrackNumber <= 0 {
+				continue
+			}
+			if trackNumbers[disc] == nil {
+				trackNumbers[disc] = make(map[int]bool)
+			}
+			trackNumbers[disc][track.TrackNumber] = true
+			maxTrack[disc] = max(maxTrack[disc], track.TrackNumber)
+		}
+		if len(discs) > 0 {
+			if missing := missingNumbers(discs, maxDisc); len(missing) > 0 {
+				issues = append(issues, albumIssue(libraryHealthNumberingGap,
+					"missing disc "+strings.Join(missing, ", "), missing))
+			}
+		}
+		discOrder := make([]int, 0, len(trackNumbers))
+		for disc := range trackNumbers {
+			discOrder = append(discOrder, disc)
+		}
+		sort.Ints(discOrder)
+		for _, disc := range discOrder {
+			if missing := missingNumbers(trackNumbers[disc], maxTrack[disc]); len(missing) > 0 {
+				issues = append(issues, albumIssue(libraryHealthNumberingGap,
+					fmt.Sprintf("disc %d: missing track %s", disc, strings.Join(missing, ", ")), missing))
+			}
+		}
+
+		// Album keys that differ only in the release folder are one release
+		// spread over several folders.
+		folder := libraryReleaseFolder(filepath.Dir(tracks[0].FilePath))
+		release := strings.TrimSuffix(key, folder)
+		if _, ok := releaseFolders[release]; !ok {
+			releaseOrder = append(releaseOrder, release)
+		}
+		releaseFolders[release] = append(releaseFolders[release], key)
+	}
+	for _, release := range releaseOrder {
+		keys := releaseFolders[release]
+		if len(keys) < 2 {
+			continue
+		}
+		var tracks []*LibraryScanResult
+		values := make([]string, 0, len(keys))
+		for _, key := range keys {
+			tracks = append(tracks, byAlbum[key]...)
+			values = append(values, libraryReleaseFolder(filepath.Dir(byAlbum[key][0].FilePath)))
+		}
+		sort.Strings(values)
+		issues = append(issues, LibraryHealthIssue{
+			Kind:        libraryHealthSplitAlbum,
+			Album:       strings.TrimSpace(tracks[0].AlbumName),
+			AlbumArtist: libraryAlbumArtist(tracks[0]),
+			Paths:       libraryResultPaths(tracks),
+			Values:      values,
+			Detail:      fmt.Sprintf("album spread over %d folders", len(values)),
+		})
+	}
+	return issues
+}
+
+func updateLibraryHealthProgress(update func(p *LibraryHealthProgress)) {
+	libraryHealthProgressMu.Lock()
+	update(&libraryHealthProgress)
+	if libraryHealthProgress.TotalFiles > 0 {
+		libraryHealthProgress.ProgressPct = float64(libraryHealthProgress.ProcessedFiles) / float64(libraryHealthProgress.TotalFiles) * 100
+	}
+	libraryHealthProgressMu.Unlock()
+}
+
+// finishLibraryHealthJob marks the progress terminal, so a UI polling
+// GetLibraryHealthProgress stops after a cancel as well as a normal run.
+func finishLibraryHealthJob(cancelled bool) {
+	updateLibraryHealthProgress(func(p *LibraryHealthProgress) {
+		if !cancelled {
+			p.ProcessedFiles = p.TotalFiles
+		}
+		p.CurrentFile = ""
+		p.IsComplete = true
+		p.IsCancelled = cancelled
+	})
+}
+
+// AnalyzeLibraryHealth checks every audio file under folderPath and reports
+// broken or mislabeled containers, tracks without ISRC or cover art (neither
+// embedded nor a cover image in the folder), and album-level tag problems.
+// CUE sheets are skipped; the image they point at is checked as a file.
+func AnalyzeLibraryHealth(folderPath string) (string, error) {
+	if folderPath == "" {
+		return "", fmt.Errorf("folder path is empty")
+	}
+	info, err := os.Stat(folderPath)
+	if err != nil {
+		return "", fmt.Errorf("folder not found: %w", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("path is not a folder: %s", folderPath)
+	}
+
+	libraryHealthProgressMu.Lock()
+	libraryHealthProgress = LibraryHealthProgress{}
+	libraryHealthProgressMu.Unlock()
+
+	libraryHealthCancelMu.Lock()
+	if libraryHealthCancel != nil {
+		close(libraryHealthCancel)
+	}
+	libraryHealthCancel = make(chan struct{})
+	cancelCh := libraryHealthCancel
+	libraryHealthCancelMu.Unlock()
+
+	errCancelled := fmt.Errorf("library health job cancelled")
+	fileInfos, err := collectLibraryAudioFiles(folderPath, cancelCh)
+	if err != nil {
+		select {
+		case <-cancelCh:
+			finishLibraryHealthJob(true)
+			return "", errCancelled
+		default:
+		}
+		return "", err
+	}
+	updateLibraryHealthProgress(func(p *LibraryHealthProgress) {
+		p.TotalFiles = len(fileInfos)
+	})
+
+	report := LibraryHealthReport{Issues: []LibraryHealthIssue{}, Counts: make(map[string]int)}
+	scanTime := time.Now().UTC().Format(time.RFC3339)
+	folderCovers := make(map[string]bool)
+	var scanned []*LibraryScanResult
+	for i, fileInfo := range fileInfos {
+		select {
+		case <-cancelCh:
+			finishLibraryHealthJob(true)
+			return "", errCancelled
+		default:
+		}
+		updateLibraryHealthProgress(func(p *LibraryHealthProgress) {
+			p.ProcessedFiles = i
+			p.CurrentFile = filepath.Base(fileInfo.path)
+		})
+		if libraryHealthFileHook != nil {
+			libraryHealthFileHook(fileInfo.path)
+		}
+		if strings.EqualFold(filepath.Ext(fileInfo.path), ".cue") {
+			continue
+		}
+		report.TotalFiles++
+
+		if issue := checkLibraryFileHeader(fileInfo.path); issue != nil {
+			report.Issues = append(report.Issues, *issue)
+			if issue.Kind == libraryHealthUnreadableHeader {
+				continue
+			}
+		}
+		result, err := scanAudioFileWithKnownModTime(fileInfo.path, scanTime, fileInfo.modTime)
+		if err != nil {
+			report.Issues = append(report.Issues, LibraryHealthIssue{Kind: libraryHealthUnreadableHeader, Path: fileInfo.path, Detail: err.Error()})
+			continue
+		}
+		scanned = append(scanned, result)
+
+		if strings.TrimSpace(result.ISRC) == "" {
+			report.Issues = append(report.Issues, LibraryHealthIssue{Kind: libraryHealthMissingISRC, Path: fileInfo.path, Detail: "no ISRC tag"})
+		}
+		if !hasEmbeddedCover(fileInfo.path) {
+			dir := filepath.Dir(fileInfo.path)
+			hasCover, checked := folderCovers[dir]
+			if !checked {
+				hasCover = findFolderCover(dir) != ""
+				folderCovers[dir] = hasCover
+			}
+			if !hasCover {
+				report.Issues = append(report.Issues, LibraryHealthIssue{Kind: libraryHealthMissingCover, Path: fileInfo.path, Detail: "no embedded or folder cover art"})
+			}
+		}
+	}
+
+	report.Issues = append(report.Issues, analyzeLibraryAlbums(scanned)...)
+	for _, issue := range report.Issues {
+		report.Counts[issue.Kind]++
+	}
+
+	finishLibraryHealthJob(false)
+	GoLog("[LibraryHealth] %d files checked, %d issues\n", report.TotalFiles, len(report.Issues))
+
+	return marshalJSONString(report)
+}
+
+func GetLibraryHealthProgress() string {
+	libraryHealthProgressMu.RLock()
+	defer libraryHealthProgressMu.RUnlock()
+
+	jsonBytes, _ := json.Marshal(libraryHealthProgress)
+	return string(jsonBytes)
+}
+
+func CancelLibraryHealthJob() {
+	libraryHealthCancelMu.Lock()
+	defer libraryHealthCancelMu.Unlock()
+
+	if libraryHealthCancel != nil {
+		close(libraryHealthCancel)
+		libraryHealthCancel = nil
+	}
+}
@@ -0,0 +1,195 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeHealthTestFlac(t *testing.T, path string, fields map[string]string) {
+	t.Helper()
+	src := writeSineFLAC(t, filepath.Base(path), 440, 0.25, 0, 1)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(src, path); err != nil {
+		t.Fatal(err)
+	}
+	if err := EditFlacFields(path, fields); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSniffAudioContainerBytes(t *testing.T) {
+	cases := map[string][]byte{
+		"flac":     []byte("fLaC\x00\x00\x00\x22"),
+		"mp4":      []byte("\x00\x00\x00\x20ftypM4A "),
+		"wav":      []byte("RIFF\x00\x00\x00\x00WAVEfmt "),
+		"aac":      {0xFF, 0xF1, 0x50, 0x80},
+		"musepack": []byte("MPCKSH"),
+		"":         []byte("not audio at all"),
+	}
+	for want, data := range cases {
+		if got := sniffAudioContainerBytes(data); got != want {
+			t.Errorf("sniff(%q) = %q, want %q", data, got, want)
+		}
+	}
+
+	// Two 320 kbps / 44.1 kHz MPEG-1 Layer III frames of 1044 bytes.
+	frame := make([]byte, 1044)
+	copy(frame, []byte{0xFF, 0xFB, 0xE0, 0x00})
+	mp3 := append(append([]byte{}, frame...), frame...)
+	if got := sniffAudioContainerBytes(mp3); got != "mp3" {
+		t.Errorf("sniff(mp3 frames) = %q", got)
+	}
+	noise := make([]byte, 4096)
+	copy(noise[100:], frame[:4])
+	for name, data := range map[string][]byte{
+		"sync after junk":      append([]byte{0x00, 0x00}, mp3...),
+		"sync inside noise":    noise,
+		"no second frame":      append(append([]byte{}, frame...), make([]byte, 8)...),
+		"free-format bitrate":  {0xFF, 0xFB, 0x00, 0x00, 0xFF, 0xFB, 0x00, 0x00},
+		"reserved sample rate": append([]byte{0xFF, 0xFB, 0xEC, 0x00}, make([]byte, 2000)...),
+	} {
+		if got := sniffAudioContainerBytes(data); got != "" {
+			t.Errorf("%s: sniff = %q, want unrecognized", name, got)
+		}
+	}
+}
+
+func TestAnalyzeLibraryHealth(t *testing.T) {
+	root := t.TempDir()
+	album := filepath.Join(root, "Album")
+	writeHealthTestFlac(t, filepath.Join(album, "01.flac"), map[string]string{
+		"title": "One", "album": "Record", "album_artist": "Band", "date": "2020",
+		"track_number": "1", "track_total": "3", "isrc": "USAA00000001",
+	})
+	writeHealthTestFlac(t, filepath.Join(album, "03.flac"), map[string]string{
+		"title": "Three", "album": "Record", "album_artist": "Band", "date": "2021",
+		"track_number": "3", "track_total": "3",
+	})
+	elsewhere := filepath.Join(root, "Elsewhere")
+	writeHealthTestFlac(t, filepath.Join(elsewhere, "04.flac"), map[string]string{
+		"title": "Four", "album": "Record", "album_artist": "Band", "date": "2020",
+		"track_number": "4", "isrc": "USAA00000004",
+	})
+	if err := os.WriteFile(filepath.Join(elsewhere, "cover.jpg"), []byte{0xFF, 0xD8, 0xFF}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mislabeled := filepath.Join(album, "fake.flac")
+	if err := os.WriteFile(mislabeled, []byte("\x00\x00\x00\x18ftypM4A \x00\x00\x00\x00M4A mp42"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	broken := filepath.Join(album, "broken.mp3")
+	if err := os.WriteFile(broken, []byte("this is not an mp3"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	jsonText, err := AnalyzeLibraryHealth(root)
+	if err != nil {
+		t.Fatalf("AnalyzeLibraryHealth: %v", err)
+	}
+	var report LibraryHealthReport
+	if err := json.Unmarshal([]byte(jsonText), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.TotalFiles != 5 {
+		t.Fatalf("total files = %d", report.TotalFiles)
+	}
+
+	byKind := make(map[string][]LibraryHealthIssue)
+	for _, issue := range report.Issues {
+		byKind[issue.Kind] = append(byKind[issue.Kind], issue)
+	}
+	expect := func(kind string, count int) []LibraryHealthIssue {
+		t.Helper()
+		if len(byKind[kind]) != count || report.Counts[kind] != count {
+			t.Fatalf("%s issues = %+v (count %d), want %d", kind, byKind[kind], report.Counts[kind], count)
+		}
+		return byKind[kind]
+	}
+
+	if issue := expect(libraryHealthExtensionMismatch, 1)[0]; issue.Path != mislabeled || issue.Values[1] != "mp4" {
+		t.Fatalf("mismatch = %+v", issue)
+	}
+	if issue := expect(libraryHealthUnreadableHeader, 1)[0]; issue.Path != broken {
+		t.Fatalf("unreadable = %+v", issue)
+	}
+	if issue := expect(libraryHealthMissingISRC, 2)[0]; issue.Path == "" {
+		t.Fatalf("missing isrc = %+v", issue)
+	}
+	// The mislabeled file still gets tag checks; only the Elsewhere track
+	// has a folder cover.
+	expect(libraryHealthMissingCover, 3)
+	if issue := expect(libraryHealthMixedYear, 1)[0]; len(issue.Values) != 2 || len(issue.Paths) != 2 {
+		t.Fatalf("mixed year = %+v", issue)
+	}
+	expect(libraryHealthMixedAlbumArtist, 0)
+	// Gaps follow the albums the library shows: the 2021 track and the
+	// Elsewhere copy are albums of their own.
+	if gaps := expect(libraryHealthNumberingGap, 2); gaps[0].Detail != "disc 1: missing track 1, 2" ||
+		gaps[1].Detail != "disc 1: missing track 1, 2, 3" {
+		t.Fatalf("numbering gaps = %+v", gaps)
+	}
+	if issue := expect(libraryHealthSplitAlbum, 1)[0]; len(issue.Values) != 2 || issue.Album != "Record" {
+		t.Fatalf("split album = %+v", issue)
+	}
+}
+
+func TestAnalyzeLibraryAlbumsIgnoresTaggedTotals(t *testing.T) {
+	track := func(name string, disc, totalDiscs, number, total int) *LibraryScanResult {
+		return &LibraryScanResult{
+			FilePath: filepath.Join("/music/Band - Record", name), ArtistName: "Band", AlbumName: "Record",
+			DiscNumber: disc, TotalDiscs: totalDiscs, TrackNumber: number, TotalTracks: total,
+		}
+	}
+	// Tracks 1-2 of a 12-track disc 1 of 2: a partial download, not a gap.
+	issues := analyzeLibraryAlbums([]*LibraryScanResult{
+		track("01.flac", 1, 2, 1, 12),
+		track("02.flac", 1, 2, 2, 12),
+	})
+	if len(issues) != 0 {
+		t.Fatalf("partial album issues = %+v", issues)
+	}
+	issues = analyzeLibraryAlbums([]*LibraryScanResult{
+		track("01.flac", 1, 3, 1, 12),
+		track("05.flac", 1, 3, 5, 12),
+		track("3-01.flac", 3, 3, 1, 12),
+	})
+	if len(issues) != 2 || issues[0].Detail != "missing disc 2" || issues[1].Detail != "disc 1: missing track 2, 3, 4" {
+		t.Fatalf("gap issues = %+v", issues)
+	}
+}
+
+func TestAnalyzeLibraryHealthCancelIsTerminal(t *testing.T) {
+	root := t.TempDir()
+	for i := range 3 {
+		writeHealthTestFlac(t, filepath.Join(root, fmt.Sprintf("%d.flac", i)), map[string]string{"title": fmt.Sprint(i)})
+	}
+
+	libraryHealthFileHook = func(string) { CancelLibraryHealthJobJSON() }
+	t.Cleanup(func() { libraryHealthFileHook = nil })
+	if _, err := AnalyzeLibraryHealthJSON(root); err == nil {
+		t.Fatal("cancelled job reported success")
+	}
+
+	var progress LibraryHealthProgress
+	if err := json.Unmarshal([]byte(GetLibraryHealthProgressJSON()), &progress); err != nil {
+		t.Fatal(err)
+	}
+	if !progress.IsComplete || !progress.IsCancelled || progress.TotalFiles != 3 || progress.ProcessedFiles >= 3 {
+		t.Fatalf("progress after cancel = %+v", progress)
+	}
+}
+
+func TestLibraryReleaseFolderTreatsDiscFoldersAsOneRelease(t *testing.T) {
+	results := []*LibraryScanResult{
+		{FilePath: "/music/Album/CD1/01.flac", AlbumName: "Album", AlbumArtist: "Band", DiscNumber: 1, TrackNumber: 1},
+		{FilePath: "/music/Album/Disc 2/01.flac", AlbumName: "Album", AlbumArtist: "Band", DiscNumber: 2, TrackNumber: 1},
+	}
+	for _, issue := range analyzeLibraryAlbums(results) {
+		t.Fatalf("unexpected issue %+v", issue)
+	}
+}
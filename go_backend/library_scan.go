@@ -78,6 +78,8 @@ var supportedAudioFormats = map[string]bool{
 	".wav":  true,
 	".aiff": true,
 	".aif":  true,
+	".dsf":  true,
+	".dff":  true,
 	".cue":  true,
 }
 
@@ -106,7 +108,8 @@ type libraryScanTaskResult struct {
 
 func isLibraryStagingFile(path string) bool {
 	name := strings.ToLower(filepath.Base(path))
-	if strings.HasSuffix(name, ".partial") {
+	// ".partial.json" is the resume manifest beside a staged download.
+	if strings.HasSuffix(name, ".partial") || strings.HasSuffix(name, ".partial.json") {
 		return true
 	}
 	for ext := range supportedAudioFormats {
@@ -194,6 +197,28 @@ func updateLibraryScanProgress(scannedFiles, totalFiles int, currentPath string)
 	libraryScanProgressMu.Unlock()
 }
 
+// scanLibraryAudioTask scans one audio file. A FLAC image with an embedded
+// cuesheet expands into one entry per cue track instead of a single long one.
+func scanLibraryAudioTask(task libraryScanTask, scanTime string) ([]LibraryScanResult, error) {
+	coverCacheKey := libraryAudioCoverCacheKey(task.info)
+	if results := scanEmbeddedCueForLibrary(task.info.path, "", task.info.modTime, coverCacheKey, scanTime); results != nil {
+		return results, nil
+	}
+	result, err := scanAudioFileWithKnownModTimeAndDisplayNameAndCoverCacheKey(
+		task.info.path,
+		"",
+		coverCacheKey,
+		scanTime,
+		task.info.modTime,
+	)
+	if err != nil || result == nil {
+		return nil, err
+	}
+	return []LibraryScanResult{*result}, nil
+}
+
+// scanLibraryAudioTasksParallel scans tasks on a small worker pool. A nil
+// completed counter skips progress reporting.
 func scanLibraryAudioTasksParallel(tasks []libraryScanTask, scanTime string, cancelCh <-chan struct{}, totalFiles int, completed *int) (map[int][]LibraryScanResult, int, error) {
 	resultsByIndex := make(map[int][]LibraryScanResult, len(tasks))
 	if len(tasks) == 0 {
@@ -209,21 +234,17 @@ func scanLibraryAudioTasksParallel(tasks []libraryScanTask, scanTime string, can
 				return resultsByIndex, errorCount, fmt.Errorf("scan cancelled")
 			default:
 			}
-			result, err := scanAudioFileWithKnownModTimeAndDisplayNameAndCoverCacheKey(
-				task.info.path,
-				"",
-				libraryAudioCoverCacheKey(task.info),
-				scanTime,
-				task.info.modTime,
-			)
-			*completed++
-			updateLibraryScanProgress(*completed, totalFiles, task.info.path)
+			results, err := scanLibraryAudioTask(task, scanTime)
+			if completed != nil {
+				*completed++
+				updateLibraryScanProgress(*completed, totalFiles, task.info.path)
+			}
 			if err != nil {
 				errorCount++
 				GoLog("[LibraryScan] Error scanning %s: %v\n", task.info.path, err)
 				continue
 			}
-			resultsByIndex[task.index] = []LibraryScanResult{*result}
+			resultsByIndex[task.index] = results
 		}
 		return resultsByIndex, errorCount, nil
 	}
@@ -242,20 +263,12 @@ func scanLibraryAudioTasksParallel(tasks []libraryScanTask, scanTime string, can
 					return
 				default:
 				}
-				result, err := scanAudioFileWithKnownModTimeAndDisplayNameAndCoverCacheKey(
-					task.info.path,
-					"",
-					libraryAudioCoverCacheKey(task.info),
-					scanTime,
-					task.info.modTime,
-				)
+				results, err := scanLibraryAudioTask(task, scanTime)
 				taskResult := libraryScanTaskResult{
-					index: task.index,
-					path:  task.info.path,
-					err:   err,
-				}
-				if err == nil && result != nil {
-					taskResult.results = []LibraryScanResult{*result}
+					index:   task.index,
+					path:    task.info.path,
+					results: results,
+					err:     err,
 				}
 				select {
 				case <-cancelCh:
@@ -284,8 +297,10 @@ func scanLibraryAudioTasksParallel(tasks []libraryScanTask, scanTime string, can
 
 	errorCount := 0
 	for taskResult := range resultCh {
-		*completed++
-		updateLibraryScanProgress(*completed, totalFiles, taskResult.path)
+		if completed != nil {
+			*completed++
+			updateLibraryScanProgress(*completed, totalFiles, taskResult.path)
+		}
 		if taskResult.err != nil {
 			errorCount++
 			GoLog("[LibraryScan] Error scanning %s: %v\n", taskResult.path, taskResult.err)
@@ -371,7 +386,11 @@ func ScanLibraryFolder(folderPath string) (string, error) {
 						sheet:     sheet,
 						audioPath: audioPath,
 					}
-					cueReferencedAudioFiles[audioPath] = true
+					for _, path := range resolveCueFiles(audioPath, sheet) {
+						if path != "" {
+							cueReferencedAudioFiles[path] = true
+						}
+					}
 				}
 			}
 		}
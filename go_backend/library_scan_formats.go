@@ -53,12 +53,18 @@ func scanAudioFileWithKnownModTimeAndDisplayNameAndCoverCacheKey(filePath, displ
 		return scanMP3File(filePath, result, displayNameHint)
 	case ".opus", ".ogg":
 		return scanOggFile(filePath, result, displayNameHint)
-	case ".ape", ".wv", ".mpc":
+	case ".ape":
 		return scanAPEFile(filePath, result, displayNameHint)
+	case ".wv":
+		return scanWavPackFile(filePath, result, displayNameHint)
+	case ".mpc":
+		return scanMusepackFile(filePath, result, displayNameHint)
 	case ".wav":
 		return scanWAVFile(filePath, result, displayNameHint)
 	case ".aiff", ".aif", ".aifc":
 		return scanAIFFFile(filePath, result, displayNameHint)
+	case ".dsf", ".dff":
+		return scanDSDFile(filePath, result, displayNameHint)
 	default:
 		return scanFromFilename(filePath, displayNameHint, result)
 	}
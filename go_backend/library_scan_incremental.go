@@ -48,16 +48,33 @@ func loadExistingFilesSnapshot(snapshotPath string) (map[string]int64, error) {
 }
 
 func scanLibraryFolderIncrementalWithExistingFiles(folderPath string, existingFiles map[string]int64) (string, error) {
+	scanResult, err := scanLibraryFolderIncrementalResult(folderPath, existingFiles)
+	if err != nil {
+		return "{}", err
+	}
+
+	jsonBytes, err := json.Marshal(scanResult)
+	if err != nil {
+		return "{}", fmt.Errorf("failed to marshal results: %w", err)
+	}
+
+	return string(jsonBytes), nil
+}
+
+// scanLibraryFolderIncrementalResult rescans only files that are new or whose
+// mtime differs from existingFiles (path -> FileModTime) and lists the
+// existing paths that are gone.
+func scanLibraryFolderIncrementalResult(folderPath string, existingFiles map[string]int64) (*IncrementalScanResult, error) {
 	if folderPath == "" {
-		return "{}", fmt.Errorf("folder path is empty")
+		return nil, fmt.Errorf("folder path is empty")
 	}
 
 	info, err := os.Stat(folderPath)
 	if err != nil {
-		return "{}", fmt.Errorf("folder not found: %w", err)
+		return nil, fmt.Errorf("folder not found: %w", err)
 	}
 	if !info.IsDir() {
-		return "{}", fmt.Errorf("path is not a folder: %s", folderPath)
+		return nil, fmt.Errorf("path is not a folder: %s", folderPath)
 	}
 
 	GoLog("[LibraryScan] Incremental scan starting, %d existing files in database\n", len(existingFiles))
@@ -76,7 +93,20 @@ func scanLibraryFolderIncrementalWithExistingFiles(folderPath string, existingFi
 
 	currentFiles, err := collectLibraryAudioFiles(folderPath, cancelCh)
 	if err != nil {
-		return "{}", err
+		return nil, err
+	}
+	return scanLibraryFilesIncremental(currentFiles, existingFiles, cancelCh, true)
+}
+
+// scanLibraryFilesIncremental diffs collected files against existingFiles
+// (path -> FileModTime) and scans what is new or changed. reportProgress
+// publishes to the global library scan progress; background rescans leave it
+// to whatever manual scan may be running.
+func scanLibraryFilesIncremental(currentFiles []libraryAudioFileInfo, existingFiles map[string]int64, cancelCh <-chan struct{}, reportProgress bool) (*IncrementalScanResult, error) {
+	updateProgress := func(scannedFiles, totalFiles int, currentPath string) {
+		if reportProgress {
+			updateLibraryScanProgress(scannedFiles, totalFiles, currentPath)
+		}
 	}
 	currentPathSet := make(map[string]bool, len(currentFiles))
 	for _, fileInfo := range currentFiles {
@@ -84,34 +114,39 @@ func scanLibraryFolderIncrementalWithExistingFiles(folderPath string, existingFi
 	}
 
 	totalFiles := len(currentFiles)
-	libraryScanProgressMu.Lock()
-	libraryScanProgress.TotalFiles = totalFiles
-	libraryScanProgressMu.Unlock()
+	if reportProgress {
+		libraryScanProgressMu.Lock()
+		libraryScanProgress.TotalFiles = totalFiles
+		libraryScanProgressMu.Unlock()
+	}
 
 	var filesToScan []libraryAudioFileInfo
 	skippedCount := 0
 	existingCueTrackModTimes := make(map[string]int64)
+	existingPathsByBase := make(map[string][]string)
 	for existingPath, modTime := range existingFiles {
+		basePath := existingPath
 		if idx := strings.LastIndex(existingPath, "#track"); idx > 0 {
-			baseCuePath := existingPath[:idx]
-			if _, exists := existingCueTrackModTimes[baseCuePath]; !exists {
-				existingCueTrackModTimes[baseCuePath] = modTime
+			basePath = existingPath[:idx]
+			if _, exists := existingCueTrackModTimes[basePath]; !exists {
+				existingCueTrackModTimes[basePath] = modTime
 			}
 		}
+		existingPathsByBase[basePath] = append(existingPathsByBase[basePath], existingPath)
 	}
 
 	for _, f := range currentFiles {
 		existingModTime, exists := existingFiles[f.path]
 		if !exists {
-			if strings.ToLower(filepath.Ext(f.path)) == ".cue" {
-				if cueTrackModTime, hasCueTracks := existingCueTrackModTimes[f.path]; hasCueTracks {
-					if f.modTime == cueTrackModTime {
-						skippedCount++
-					} else {
-						filesToScan = append(filesToScan, f)
-					}
-					continue
+			// .cue files and FLAC images with an embedded cuesheet are stored
+			// only as their "#track" entries.
+			if cueTrackModTime, hasCueTracks := existingCueTrackModTimes[f.path]; hasCueTracks {
+				if f.modTime == cueTrackModTime {
+					skippedCount++
+				} else {
+					filesToScan = append(filesToScan, f)
 				}
+				continue
 			}
 			filesToScan = append(filesToScan, f)
 		} else if f.modTime != existingModTime {
@@ -138,20 +173,20 @@ func scanLibraryFolderIncrementalWithExistingFiles(folderPath string, existingFi
 		len(filesToScan), skippedCount, len(deletedPaths))
 
 	if len(filesToScan) == 0 {
-		libraryScanProgressMu.Lock()
-		libraryScanProgress.ScannedFiles = totalFiles
-		libraryScanProgress.IsComplete = true
-		libraryScanProgress.ProgressPct = 100
-		libraryScanProgressMu.Unlock()
+		if reportProgress {
+			libraryScanProgressMu.Lock()
+			libraryScanProgress.ScannedFiles = totalFiles
+			libraryScanProgress.IsComplete = true
+			libraryScanProgress.ProgressPct = 100
+			libraryScanProgressMu.Unlock()
+		}
 
-		result := IncrementalScanResult{
+		return &IncrementalScanResult{
 			Scanned:      []LibraryScanResult{},
 			DeletedPaths: deletedPaths,
 			SkippedCount: skippedCount,
 			TotalFiles:   totalFiles,
-		}
-		jsonBytes, _ := json.Marshal(result)
-		return string(jsonBytes), nil
+		}, nil
 	}
 
 	results := make([]LibraryScanResult, 0, len(filesToScan))
@@ -171,7 +206,11 @@ func scanLibraryFolderIncrementalWithExistingFiles(folderPath string, existingFi
 						sheet:     sheet,
 						audioPath: audioPath,
 					}
-					cueReferencedAudioFilesInc[audioPath] = true
+					for _, path := range resolveCueFiles(audioPath, sheet) {
+						if path != "" {
+							cueReferencedAudioFilesInc[path] = true
+						}
+					}
 				}
 			}
 		}
@@ -184,7 +223,7 @@ func scanLibraryFolderIncrementalWithExistingFiles(folderPath string, existingFi
 	for i, f := range filesToScan {
 		select {
 		case <-cancelCh:
-			return "{}", fmt.Errorf("scan cancelled")
+			return nil, fmt.Errorf("scan cancelled")
 		default:
 		}
 
@@ -192,6 +231,7 @@ func scanLibraryFolderIncrementalWithExistingFiles(folderPath string, existingFi
 
 		if ext == ".cue" {
 			var cueResults []LibraryScanResult
+			var err error
 			cueInfo, ok := parsedCueFiles[f.path]
 			if ok {
 				cueResults, err = scanCueSheetForLibrary(
@@ -210,66 +250,80 @@ func scanLibraryFolderIncrementalWithExistingFiles(folderPath string, existingFi
 				errorCount++
 				GoLog("[LibraryScan] Error scanning cue %s: %v\n", f.path, err)
 				completedFiles++
-				updateLibraryScanProgress(completedFiles, totalFiles, f.path)
+				updateProgress(completedFiles, totalFiles, f.path)
 				continue
 			}
 			resultsByIndex[i] = cueResults
 			completedFiles++
-			updateLibraryScanProgress(completedFiles, totalFiles, f.path)
+			updateProgress(completedFiles, totalFiles, f.path)
 			continue
 		}
 
 		if cueReferencedAudioFilesInc[f.path] {
 			completedFiles++
-			updateLibraryScanProgress(completedFiles, totalFiles, f.path)
+			updateProgress(completedFiles, totalFiles, f.path)
 			continue
 		}
 
 		audioTasks = append(audioTasks, libraryScanTask{index: i, info: f})
 	}
 
+	completedPtr := &completedFiles
+	if !reportProgress {
+		completedPtr = nil
+	}
 	audioResults, audioErrors, err := scanLibraryAudioTasksParallel(
 		audioTasks,
 		scanTime,
 		cancelCh,
 		totalFiles,
-		&completedFiles,
+		completedPtr,
 	)
 	if err != nil {
-		return "{}", err
+		return nil, err
 	}
 	errorCount += audioErrors
 	for index, scanResults := range audioResults {
 		resultsByIndex[index] = scanResults
 	}
 
-	for i := range filesToScan {
+	for i, f := range filesToScan {
 		results = append(results, resultsByIndex[i]...)
+		if len(resultsByIndex[i]) == 0 {
+			continue
+		}
+		// A rescanned file can switch between a single entry and per-track
+		// entries (embedded cuesheet added or removed, tracks renumbered);
+		// drop stored entries the new scan no longer produces.
+		produced := make(map[string]bool, len(resultsByIndex[i]))
+		for _, result := range resultsByIndex[i] {
+			produced[result.FilePath] = true
+		}
+		for _, existingPath := range existingPathsByBase[f.path] {
+			if !produced[existingPath] {
+				deletedPaths = append(deletedPaths, existingPath)
+			}
+		}
 	}
 
-	libraryScanProgressMu.Lock()
-	libraryScanProgress.ErrorCount = errorCount
-	libraryScanProgress.IsComplete = true
-	libraryScanProgress.ScannedFiles = totalFiles
-	libraryScanProgress.ProgressPct = 100
-	libraryScanProgressMu.Unlock()
+	if reportProgress {
+		libraryScanProgressMu.Lock()
+		libraryScanProgress.ErrorCount = errorCount
+		libraryScanProgress.IsComplete = true
+		libraryScanProgress.ScannedFiles = totalFiles
+		libraryScanProgress.ProgressPct = 100
+		libraryScanProgressMu.Unlock()
+	}
 
 	GoLog("[LibraryScan] Incremental scan complete: %d scanned, %d skipped, %d deleted, %d errors\n",
 		len(results), skippedCount, len(deletedPaths), errorCount)
 
-	scanResult := IncrementalScanResult{
+	return &IncrementalScanResult{
 		Scanned:      results,
 		DeletedPaths: deletedPaths,
 		SkippedCount: skippedCount,
 		TotalFiles:   totalFiles,
-	}
-
-	jsonBytes, err := json.Marshal(scanResult)
-	if err != nil {
-		return "{}", fmt.Errorf("failed to marshal results: %w", err)
-	}
-
-	return string(jsonBytes), nil
+	}, nil
 }
 
 func ScanLibraryFolderIncremental(folderPath, existingFilesJSON string) (string, error) {
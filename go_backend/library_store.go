@@ -0,0 +1,630 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The library store keeps scanned tracks on the Go side so the host pages
+// through queries instead of holding the whole library as one JSON array.
+// Like the download queue it is a JSON-lines journal in the data dir: "put"
+// lines carry a full track (last one wins on replay), "delete" lines drop a
+// path, and the journal is compacted to one line per track once superseded
+// lines pile up. Queries run against the in-memory copy.
+//
+// Every batch of changes gets a sequence number so the host can poll for
+// what changed since its last look (GetLibraryChangesDelta) instead of
+// re-querying. Sequences live in memory only; reopening or clearing the
+// store starts a new epoch that tells pollers to re-query.
+
+const (
+	libraryStoreJournalName = "library_store.jsonl"
+	// libraryStoreCompactSlack is how many superseded journal lines may pile
+	// up beyond one line per track before the journal is rewritten.
+	libraryStoreCompactSlack = 1024
+	libraryQueryDefaultLimit = 100
+	libraryQueryMaxLimit     = 1000
+	// libraryStoreMaxTombstones bounds how many deleted paths are remembered
+	// for delta polls; past it older pollers are told to re-query instead.
+	libraryStoreMaxTombstones = 4096
+)
+
+// LibraryStoreTrack is a scan result plus what only the store knows.
+type LibraryStoreTrack struct {
+	LibraryScanResult
+	// DateAdded is when the path first entered the store, Unix milliseconds.
+	// Rescans of a changed file keep it.
+	DateAdded int64 `json:"dateAdded"`
+	seq       int64
+}
+
+type libraryStoreJournalEntry struct {
+	Op    string             `json:"op"`
+	Track *LibraryStoreTrack `json:"track,omitempty"`
+	Path  string             `json:"path,omitempty"`
+}
+
+type libraryStore struct {
+	mu         sync.RWMutex
+	journal    jsonlJournal[libraryStoreJournalEntry]
+	tracks     map[string]*LibraryStoreTrack // FilePath -> track
+	seq        int64
+	resetSeq   int64
+	removedSeq map[string]int64 // deleted FilePath -> seq of the deletion
+}
+
+var (
+	globalLibraryStore     *libraryStore
+	globalLibraryStoreOnce sync.Once
+)
+
+func getLibraryStore() *libraryStore {
+	globalLibraryStoreOnce.Do(func() {
+		globalLibraryStore = &libraryStore{tracks: make(map[string]*LibraryStoreTrack)}
+	})
+	return globalLibraryStore
+}
+
+func initLibraryStore(dataDir string) {
+	if strings.TrimSpace(dataDir) == "" {
+		return
+	}
+	if err := getLibraryStore().open(dataDir); err != nil {
+		GoLog("[LibraryStore] Failed to open journal: %v\n", err)
+	}
+}
+
+func (s *libraryStore) open(dataDir string) error {
+	dataDir = strings.TrimSpace(dataDir)
+	if dataDir == "" {
+		return fmt.Errorf("library store data dir is empty")
+	}
+	journalPath := filepath.Join(dataDir, libraryStoreJournalName)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.journal.path == journalPath && s.journal.file != nil {
+		return nil
+	}
+	s.journal.close()
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return fmt.Errorf("failed to create library store directory: %w", err)
+	}
+
+	s.journal = jsonlJournal[libraryStoreJournalEntry]{path: journalPath}
+	s.tracks = make(map[string]*LibraryStoreTrack)
+	err := s.journal.replay("LibraryStore", func(entry libraryStoreJournalEntry) bool {
+		s.applyJournalEntryLocked(entry)
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read library store journal: %w", err)
+	}
+	GoLog("[LibraryStore] Opened with %d tracks\n", len(s.tracks))
+	if err := s.compactLocked(); err != nil {
+		return err
+	}
+	s.resetLocked()
+	return nil
+}
+
+func (s *libraryStore) applyJournalEntryLocked(entry libraryStoreJournalEntry) {
+	switch entry.Op {
+	case "put":
+		if entry.Track == nil || entry.Track.FilePath == "" {
+			return
+		}
+		track := *entry.Track
+		s.tracks[track.FilePath] = &track
+	case "delete":
+		delete(s.tracks, entry.Path)
+	}
+}
+
+// appendJournalLocked writes a batch of entries with a single fsync: a scan
+// applies thousands of changes at once.
+func (s *libraryStore) appendJournalLocked(entries []libraryStoreJournalEntry) {
+	if s.journal.path == "" || len(entries) == 0 {
+		return
+	}
+	if err := s.journal.append(entries...); err != nil {
+		GoLog("[LibraryStore] Failed to append journal entries: %v\n", err)
+		return
+	}
+
+	if s.journal.lines > len(s.tracks)+libraryStoreCompactSlack {
+		if err := s.compactLocked(); err != nil {
+			GoLog("[LibraryStore] Journal compaction failed: %v\n", err)
+		}
+	}
+}
+
+// compactLocked rewrites the journal as one "put" line per track.
+func (s *libraryStore) compactLocked() error {
+	if s.journal.path == "" {
+		return nil
+	}
+	entries := make([]libraryStoreJournalEntry, 0, len(s.tracks))
+	for _, path := range sortedLibraryStorePaths(s.tracks) {
+		entries = append(entries, libraryStoreJournalEntry{Op: "put", Track: s.tracks[path]})
+	}
+	if err := s.journal.compact(entries); err != nil {
+		return fmt.Errorf("failed to write library store journal: %w", err)
+	}
+	return nil
+}
+
+func sortedLibraryStorePaths(tracks map[string]*LibraryStoreTrack) []string {
+	paths := make([]string, 0, len(tracks))
+	for path := range tracks {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// apply stores scanned results and drops deleted paths. A path already in
+// the store keeps its DateAdded.
+func (s *libraryStore) apply(scanned []LibraryScanResult, deleted []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(scanned) == 0 && len(deleted) == 0 {
+		return
+	}
+	now := time.Now().UnixMilli()
+	seq := s.seq + 1
+	entries := make([]libraryStoreJournalEntry, 0, len(scanned)+len(deleted))
+	for _, path := range deleted {
+		if _, ok := s.tracks[path]; !ok {
+			continue
+		}
+		delete(s.tracks, path)
+		if s.removedSeq == nil {
+			s.removedSeq = make(map[string]int64)
+		}
+		s.removedSeq[path] = seq
+		entries = append(entries, libraryStoreJournalEntry{Op: "delete", Path: path})
+	}
+	for _, result := range scanned {
+		if result.FilePath == "" {
+			continue
+		}
+		track := &LibraryStoreTrack{LibraryScanResult: result, DateAdded: now, seq: seq}
+		if prev, ok := s.tracks[result.FilePath]; ok && prev.DateAdded > 0 {
+			track.DateAdded = prev.DateAdded
+		}
+		s.tracks[result.FilePath] = track
+		delete(s.removedSeq, result.FilePath)
+		entries = append(entries, libraryStoreJournalEntry{Op: "put", Track: track})
+	}
+	if len(entries) == 0 {
+		return
+	}
+	s.seq = seq
+	if len(s.removedSeq) > libraryStoreMaxTombstones {
+		s.removedSeq = nil
+		s.resetSeq = seq
+	}
+	s.appendJournalLocked(entries)
+}
+
+// resetLocked starts a new delta epoch: pollers from before it re-query.
+func (s *libraryStore) resetLocked() {
+	s.seq++
+	s.resetSeq = s.seq
+	s.removedSeq = nil
+}
+
+// modTimesUnder returns path -> FileModTime for tracks inside folderPath, in
+// the form the incremental scanner expects.
+func (s *libraryStore) modTimesUnder(folderPath string) map[string]int64 {
+	prefix := strings.TrimSuffix(folderPath, string(filepath.Separator)) + string(filepath.Separator)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	existing := make(map[string]int64)
+	for path, track := range s.tracks {
+		if strings.HasPrefix(path, prefix) {
+			existing[path] = track.FileModTime
+		}
+	}
+	return existing
+}
+
+func (s *libraryStore) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tracks = make(map[string]*LibraryStoreTrack)
+	s.resetLocked()
+	if err := s.compactLocked(); err != nil {
+		GoLog("[LibraryStore] Failed to clear journal: %v\n", err)
+	}
+}
+
+// LibraryQuery filters, sorts and pages the store. Text filters are
+// case-insensitive exact matches except Search, which matches a substring
+// of title, artist or album. Zero values do not filter.
+type LibraryQuery struct {
+	Artist      string `json:"artist,omitempty"` // track or album artist
+	AlbumArtist string `json:"album_artist,omitempty"`
+	Album       string `json:"album,omitempty"`
+	AlbumID     string `json:"album_id,omitempty"` // LibraryAlbum.ID
+	Genre       string `json:"genre,omitempty"`
+	Format      string `json:"format,omitempty"`
+	BitDepth    int    `json:"bit_depth,omitempty"`
+	MinBitDepth int    `json:"min_bit_depth,omitempty"`
+	// AddedAfter and AddedBefore bound DateAdded (Unix ms, inclusive).
+	AddedAfter  int64  `json:"added_after,omitempty"`
+	AddedBefore int64  `json:"added_before,omitempty"`
+	Search      string `json:"search,omitempty"`
+	// Sort is one of "title", "artist", "album", "genre", "format",
+	// "bit_depth", "date_added" or "release_date"; "" sorts by artist.
+	Sort       string `json:"sort,omitempty"`
+	Descending bool   `json:"descending,omitempty"`
+	Offset     int    `json:"offset,omitempty"`
+	Limit      int    `json:"limit,omitempty"`
+}
+
+type LibraryQueryResult struct {
+	Total  int                 `json:"total"`
+	Offset int                 `json:"offset"`
+	Tracks []LibraryStoreTrack `json:"tracks"`
+	Seq    int64               `json:"seq"`
+}
+
+type LibraryCount struct {
+	Value      string `json:"value"`
+	Count      int    `json:"count"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+type LibraryCountsResult struct {
+	GroupBy     string         `json:"group_by"`
+	TotalTracks int            `json:"total_tracks"`
+	DurationMS  int64          `json:"duration_ms"`
+	Groups      []LibraryCount `json:"groups"`
+}
+
+func (q LibraryQuery) matches(t *LibraryStoreTrack) bool {
+	eq := func(want, got string) bool {
+		return want == "" || strings.EqualFold(strings.TrimSpace(want), strings.TrimSpace(got))
+	}
+	if q.Artist != "" && !eq(q.Artist, t.ArtistName) && !eq(q.Artist, t.AlbumArtist) {
+		return false
+	}
+	if !eq(q.AlbumArtist, t.AlbumArtist) || !eq(q.Album, t.AlbumName) ||
+		!eq(q.Genre, t.Genre) || !eq(q.Format, t.Format) {
+		return false
+	}
+	if q.AlbumID != "" {
+		key := libraryAlbumKey(&t.LibraryScanResult)
+		if key == "" || libraryAlbumID(key) != q.AlbumID {
+			return false
+		}
+	}
+	if (q.BitDepth > 0 && t.BitDepth != q.BitDepth) || t.BitDepth < q.MinBitDepth {
+		return false
+	}
+	if (q.AddedAfter > 0 && t.DateAdded < q.AddedAfter) || (q.AddedBefore > 0 && t.DateAdded > q.AddedBefore) {
+		return false
+	}
+	if search := strings.ToLower(strings.TrimSpace(q.Search)); search != "" {
+		if !strings.Contains(strings.ToLower(t.TrackName), search) &&
+			!strings.Contains(strings.ToLower(t.ArtistName), search) &&
+			!strings.Contains(strings.ToLower(t.AlbumName), search) {
+			return false
+		}
+	}
+	return true
+}
+
+// libraryAlbumOrder is the tie-breaker for every sort: album tracks stay in
+// disc/track order.
+func libraryAlbumOrder(a, b *LibraryStoreTrack) int {
+	if c := compareFold(a.AlbumName, b.AlbumName); c != 0 {
+		return c
+	}
+	if a.DiscNumber != b.DiscNumber {
+		return a.DiscNumber - b.DiscNumber
+	}
+	if a.TrackNumber != b.TrackNumber {
+		return a.TrackNumber - b.TrackNumber
+	}
+	return strings.Compare(a.FilePath, b.FilePath)
+}
+
+// libraryTrackAlbumArtist falls back to the track artist when the file has
+// no album artist tag.
+func libraryTrackAlbumArtist(t *LibraryStoreTrack) string {
+	if t.AlbumArtist != "" {
+		return t.AlbumArtist
+	}
+	return t.ArtistName
+}
+
+func compareFold(a, b string) int {
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func libraryTrackCompare(sortBy string) (func(a, b *LibraryStoreTrack) int, error) {
+	switch sortBy {
+	case "", "artist":
+		return func(a, b *LibraryStoreTrack) int { return compareFold(a.ArtistName, b.ArtistName) }, nil
+	case "title":
+		return func(a, b *LibraryStoreTrack) int { return compareFold(a.TrackName, b.TrackName) }, nil
+	case "album":
+		return func(a, b *LibraryStoreTrack) int {
+			if c := compareFold(a.AlbumName, b.AlbumName); c != 0 {
+				return c
+			}
+			return compareFold(libraryTrackAlbumArtist(a), libraryTrackAlbumArtist(b))
+		}, nil
+	case "genre":
+		return func(a, b *LibraryStoreTrack) int { return compareFold(a.Genre, b.Genre) }, nil
+	case "format":
+		return func(a, b *LibraryStoreTrack) int { return compareFold(a.Format, b.Format) }, nil
+	case "bit_depth":
+		return func(a, b *LibraryStoreTrack) int { return a.BitDepth - b.BitDepth }, nil
+	case "date_added":
+		return func(a, b *LibraryStoreTrack) int { return compareInt64(a.DateAdded, b.DateAdded) }, nil
+	case "release_date":
+		return func(a, b *LibraryStoreTrack) int { return strings.Compare(a.ReleaseDate, b.ReleaseDate) }, nil
+	}
+	return nil, fmt.Errorf("unsupported sort field: %s", sortBy)
+}
+
+func (s *libraryStore) query(q LibraryQuery) (*LibraryQueryResult, error) {
+	primary, err := libraryTrackCompare(strings.ToLower(strings.TrimSpace(q.Sort)))
+	if err != nil {
+		return nil, err
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = libraryQueryDefaultLimit
+	}
+	limit = min(limit, libraryQueryMaxLimit)
+	offset := max(q.Offset, 0)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matched := make([]*LibraryStoreTrack, 0, len(s.tracks))
+	for _, track := range s.tracks {
+		if q.matches(track) {
+			matched = append(matched, track)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		c := primary(matched[i], matched[j])
+		if q.Descending {
+			c = -c
+		}
+		if c == 0 {
+			c = libraryAlbumOrder(matched[i], matched[j])
+		}
+		return c < 0
+	})
+
+	result := &LibraryQueryResult{Total: len(matched), Offset: offset, Tracks: []LibraryStoreTrack{}, Seq: s.seq}
+	if offset < len(matched) {
+		for _, track := range matched[offset:min(offset+limit, len(matched))] {
+			result.Tracks = append(result.Tracks, *track)
+		}
+	}
+	return result, nil
+}
+
+func libraryTrackGroupValue(groupBy string, t *LibraryStoreTrack) (string, error) {
+	switch groupBy {
+	case "artist":
+		return t.ArtistName, nil
+	case "album_artist":
+		return libraryTrackAlbumArtist(t), nil
+	case "album":
+		return t.AlbumName, nil
+	case "genre":
+		return t.Genre, nil
+	case "format":
+		return t.Format, nil
+	case "bit_depth":
+		return strconv.Itoa(t.BitDepth), nil
+	case "sample_rate":
+		return strconv.Itoa(t.SampleRate), nil
+	case "year":
+		if len(t.ReleaseDate) >= 4 {
+			return t.ReleaseDate[:4], nil
+		}
+		return "", nil
+	}
+	return "", fmt.Errorf("unsupported group field: %s", groupBy)
+}
+
+// counts aggregates the tracks matching q by groupBy, largest group first.
+// Text groups merge case variants under the first spelling seen in path
+// order. q's sort and paging fields are ignored.
+func (s *libraryStore) counts(q LibraryQuery, groupBy string) (*LibraryCountsResult, error) {
+	groupBy = strings.ToLower(strings.TrimSpace(groupBy))
+	if _, err := libraryTrackGroupValue(groupBy, &LibraryStoreTrack{}); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := &LibraryCountsResult{GroupBy: groupBy, Groups: []LibraryCount{}}
+	byKey := make(map[string]int)
+	for _, path := range sortedLibraryStorePaths(s.tracks) {
+		track := s.tracks[path]
+		if !q.matches(track) {
+			continue
+		}
+		value, _ := libraryTrackGroupValue(groupBy, track)
+		value = strings.TrimSpace(value)
+		durationMS := int64(track.Duration) * 1000
+		result.TotalTracks++
+		result.DurationMS += durationMS
+
+		key := strings.ToLower(value)
+		i, ok := byKey[key]
+		if !ok {
+			i = len(result.Groups)
+			byKey[key] = i
+			result.Groups = append(result.Groups, LibraryCount{Value: value})
+		}
+		result.Groups[i].Count++
+		result.Groups[i].DurationMS += durationMS
+	}
+	sort.SliceStable(result.Groups, func(i, j int) bool {
+		if result.Groups[i].Count != result.Groups[j].Count {
+			return result.Groups[i].Count > result.Groups[j].Count
+		}
+		return compareFold(result.Groups[i].Value, result.Groups[j].Value) < 0
+	})
+	return result, nil
+}
+
+// LibraryChangesDelta lists the tracks put and the paths deleted after a
+// given sequence. Reset means the caller's sequence predates the current
+// epoch and it should re-query the store instead; no tracks are sent then.
+type LibraryChangesDelta struct {
+	Seq     int64               `json:"seq"`
+	Reset   bool                `json:"reset,omitempty"`
+	Tracks  []LibraryStoreTrack `json:"tracks,omitempty"`
+	Removed []string            `json:"removed,omitempty"`
+}
+
+func (s *libraryStore) changesSince(sinceSeq int64) *LibraryChangesDelta {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if sinceSeq >= s.seq {
+		return nil
+	}
+	delta := &LibraryChangesDelta{Seq: s.seq}
+	if sinceSeq <= 0 || sinceSeq < s.resetSeq {
+		delta.Reset = true
+		return delta
+	}
+	for _, track := range s.tracks {
+		if track.seq > sinceSeq {
+			delta.Tracks = append(delta.Tracks, *track)
+		}
+	}
+	sort.Slice(delta.Tracks, func(i, j int) bool { return delta.Tracks[i].FilePath < delta.Tracks[j].FilePath })
+	for path, seq := range s.removedSeq {
+		if seq > sinceSeq {
+			delta.Removed = append(delta.Removed, path)
+		}
+	}
+	sort.Strings(delta.Removed)
+	return delta
+}
+
+// LibraryStoreScanResult summarizes a scan into the store; the tracks
+// themselves stay in Go and are read back with QueryLibrary.
+type LibraryStoreScanResult struct {
+	Scanned     int `json:"scanned"`
+	Deleted     int `json:"deleted"`
+	Skipped     int `json:"skipped"`
+	TotalFiles  int `json:"total_files"`
+	TotalTracks int `json:"total_tracks"`
+}
+
+// ScanLibraryFolderToStore rescans folderPath against what the store already
+// holds for it (unchanged files are skipped by mtime) and writes the changes
+// into the store. Progress and cancellation are the library scan's.
+func ScanLibraryFolderToStore(folderPath string) (string, error) {
+	store := getLibraryStore()
+	scanResult, err := scanLibraryFolderIncrementalResult(folderPath, store.modTimesUnder(folderPath))
+	if err != nil {
+		return "", err
+	}
+	store.apply(scanResult.Scanned, scanResult.DeletedPaths)
+
+	store.mu.RLock()
+	total := len(store.tracks)
+	store.mu.RUnlock()
+	return marshalJSONString(LibraryStoreScanResult{
+		Scanned:     len(scanResult.Scanned),
+		Deleted:     len(scanResult.DeletedPaths),
+		Skipped:     scanResult.SkippedCount,
+		TotalFiles:  scanResult.TotalFiles,
+		TotalTracks: total,
+	})
+}
+
+func parseLibraryQuery(queryJSON string) (LibraryQuery, error) {
+	var q LibraryQuery
+	if strings.TrimSpace(queryJSON) == "" {
+		return q, nil
+	}
+	if err := json.Unmarshal([]byte(queryJSON), &q); err != nil {
+		return q, fmt.Errorf("invalid library query: %w", err)
+	}
+	return q, nil
+}
+
+// QueryLibrary returns one page of stored tracks matching queryJSON (a
+// LibraryQuery).
+func QueryLibrary(queryJSON string) (string, error) {
+	q, err := parseLibraryQuery(queryJSON)
+	if err != nil {
+		return "", err
+	}
+	result, err := getLibraryStore().query(q)
+	if err != nil {
+		return "", err
+	}
+	return marshalJSONString(result)
+}
+
+// GetLibraryCounts groups the tracks matching queryJSON by groupBy ("artist",
+// "album_artist", "album", "genre", "format", "bit_depth", "sample_rate" or
+// "year") and returns per-group track counts and durations.
+func GetLibraryCounts(queryJSON, groupBy string) (string, error) {
+	q, err := parseLibraryQuery(queryJSON)
+	if err != nil {
+		return "", err
+	}
+	result, err := getLibraryStore().counts(q, groupBy)
+	if err != nil {
+		return "", err
+	}
+	return marshalJSONString(result)
+}
+
+// GetLibraryChangesDelta returns the store changes after sinceSeq (0 for a
+// fresh poller), or "" when nothing changed, like GetMultiProgressDelta.
+func GetLibraryChangesDelta(sinceSeq int64) string {
+	delta := getLibraryStore().changesSince(sinceSeq)
+	if delta == nil {
+		return ""
+	}
+	jsonText, err := marshalJSONString(delta)
+	if err != nil {
+		return ""
+	}
+	return jsonText
+}
+
+// ClearLibraryStore drops every stored track, e.g. when the library folder
+// changes.
+func ClearLibraryStore() {
+	getLibraryStore().clear()
+}
@@ -0,0 +1,104 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLibraryStoreScanQueryAndReopen(t *testing.T) {
+	dataDir := t.TempDir()
+	store := getLibraryStore()
+	if err := store.open(dataDir); err != nil {
+		t.Fatal(err)
+	}
+	defer ClearLibraryStore()
+
+	libDir := t.TempDir()
+	write := func(name, artist, album, genre, track string) string {
+		path := filepath.Join(libDir, name)
+		writeTest320MP3(t, path,
+			id3TextFrame("TIT2", name),
+			id3TextFrame("TPE1", artist),
+			id3TextFrame("TALB", album),
+			id3TextFrame("TCON", genre),
+			id3TextFrame("TRCK", track),
+		)
+		return path
+	}
+	write("b.mp3", "Beta", "Second", "Rock", "2")
+	write("a.mp3", "Beta", "Second", "Rock", "1")
+	gone := write("c.mp3", "Alpha", "First", "Jazz", "1")
+
+	var summary LibraryStoreScanResult
+	jsonText, err := ScanLibraryFolderToStore(libDir)
+	if err != nil {
+		t.Fatalf("ScanLibraryFolderToStore: %v", err)
+	}
+	if err := json.Unmarshal([]byte(jsonText), &summary); err != nil || summary.Scanned != 3 || summary.TotalTracks != 3 {
+		t.Fatalf("first scan = %s (%v)", jsonText, err)
+	}
+
+	result, err := store.query(LibraryQuery{Artist: "beta"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 2 || result.Tracks[0].TrackNumber != 1 || result.Tracks[1].TrackNumber != 2 {
+		t.Fatalf("artist query = %+v", result)
+	}
+	result, _ = store.query(LibraryQuery{Sort: "artist", Descending: true, Limit: 1, Offset: 2})
+	if result.Total != 3 || len(result.Tracks) != 1 || result.Tracks[0].ArtistName != "Alpha" {
+		t.Fatalf("paged query = %+v", result)
+	}
+	// Descending album order reverses albums but keeps each album's tracks
+	// in disc/track order.
+	result, _ = store.query(LibraryQuery{Sort: "album", Descending: true})
+	if result.Total != 3 || result.Tracks[0].AlbumName != "Second" || result.Tracks[0].TrackNumber != 1 ||
+		result.Tracks[1].TrackNumber != 2 || result.Tracks[2].AlbumName != "First" {
+		t.Fatalf("descending album query = %+v", result.Tracks)
+	}
+	if _, err := store.query(LibraryQuery{Sort: "mood"}); err == nil {
+		t.Fatal("expected unsupported sort error")
+	}
+
+	counts, err := store.counts(LibraryQuery{}, "genre")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts.TotalTracks != 3 || len(counts.Groups) != 2 || counts.Groups[0].Value != "Rock" || counts.Groups[0].Count != 2 {
+		t.Fatalf("genre counts = %+v", counts)
+	}
+
+	// A rescan skips unchanged files, keeps DateAdded and drops deleted ones.
+	added := result.Tracks[0].DateAdded
+	if err := os.Remove(gone); err != nil {
+		t.Fatal(err)
+	}
+	if jsonText, err = ScanLibraryFolderToStore(libDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(jsonText), &summary); err != nil || summary.Scanned != 0 || summary.Deleted != 1 || summary.TotalTracks != 2 {
+		t.Fatalf("rescan = %s (%v)", jsonText, err)
+	}
+
+	// Reopening replays the journal.
+	store.mu.Lock()
+	store.tracks = make(map[string]*LibraryStoreTrack)
+	store.journal.close()
+	store.journal = jsonlJournal[libraryStoreJournalEntry]{}
+	store.mu.Unlock()
+	if err := store.open(dataDir); err != nil {
+		t.Fatal(err)
+	}
+	result, _ = store.query(LibraryQuery{Album: "second", Sort: "date_added"})
+	if result.Total != 2 {
+		t.Fatalf("after reopen = %+v", result)
+	}
+	if added == 0 || result.Tracks[0].DateAdded < added {
+		t.Fatalf("date added not kept: %d vs %d", result.Tracks[0].DateAdded, added)
+	}
+	if _, ok := store.modTimesUnder(libDir)[gone]; ok {
+		t.Fatal("deleted track came back after reopen")
+	}
+}
@@ -0,0 +1,430 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The library watcher keeps the library store current without explicit
+// rescans. A backend (inotify where available, directory polling otherwise)
+// reports directories whose audio files may have changed; the watcher
+// debounces those reports, drops directories already covered by a pending
+// ancestor and rescans each remaining subtree with the incremental scanner
+// against what the store holds for it. The host picks the changes up with
+// GetLibraryChangesDelta.
+
+var (
+	// libraryWatchDebounce is the quiet period after the last change before
+	// a rescan; copying an album produces a burst of events.
+	libraryWatchDebounce = 2 * time.Second
+	// libraryWatchMaxDelay caps how long a steady trickle of events can
+	// postpone a rescan.
+	libraryWatchMaxDelay     = 15 * time.Second
+	libraryWatchPollInterval = 60 * time.Second
+)
+
+const (
+	libraryWatchModeInotify = "inotify"
+	libraryWatchModePoll    = "poll"
+)
+
+type libraryWatchBackend interface {
+	// run reports changes until stop is closed (after which close is called).
+	run(stop <-chan struct{}) error
+	close()
+}
+
+type LibraryWatchStatus struct {
+	Running     bool     `json:"running"`
+	Mode        string   `json:"mode,omitempty"`
+	Roots       []string `json:"roots,omitempty"`
+	PendingDirs int      `json:"pending_dirs"`
+	Rescans     int      `json:"rescans"`
+	LastFlushAt int64    `json:"last_flush_at,omitempty"`
+	LastError   string   `json:"last_error,omitempty"`
+}
+
+type libraryWatcher struct {
+	roots   []string
+	mode    string
+	backend libraryWatchBackend
+	stop    chan struct{}
+	wake    chan struct{}
+	wg      sync.WaitGroup
+
+	mu             sync.Mutex
+	pending        map[string]struct{}
+	firstPendingAt time.Time
+	lastEventAt    time.Time
+	rescans        int
+	lastFlushAt    int64
+	lastError      string
+}
+
+var (
+	activeLibraryWatcher   *libraryWatcher
+	activeLibraryWatcherMu sync.Mutex
+)
+
+func isLibraryWatchedFile(path string) bool {
+	return supportedAudioFormats[strings.ToLower(filepath.Ext(path))] && !isLibraryStagingFile(path)
+}
+
+func newLibraryWatcher(roots []string) *libraryWatcher {
+	return &libraryWatcher{
+		roots:   roots,
+		stop:    make(chan struct{}),
+		wake:    make(chan struct{}, 1),
+		pending: make(map[string]struct{}),
+	}
+}
+
+// notify marks dir for a rescan of its subtree.
+func (w *libraryWatcher) notify(dir string) {
+	now := time.Now()
+	w.mu.Lock()
+	if len(w.pending) == 0 {
+		w.firstPendingAt = now
+	}
+	w.pending[filepath.Clean(dir)] = struct{}{}
+	w.lastEventAt = now
+	w.mu.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *libraryWatcher) notifyAllRoots() {
+	for _, root := range w.roots {
+		w.notify(root)
+	}
+}
+
+func (w *libraryWatcher) flushDelay() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delay := libraryWatchDebounce - time.Since(w.lastEventAt)
+	if capped := libraryWatchMaxDelay - time.Since(w.firstPendingAt); capped < delay {
+		delay = capped
+	}
+	return max(delay, 0)
+}
+
+func (w *libraryWatcher) setError(err error) {
+	GoLog("[LibraryWatch] %v\n", err)
+	w.mu.Lock()
+	w.lastError = err.Error()
+	w.mu.Unlock()
+}
+
+func (w *libraryWatcher) loop() {
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-w.wake:
+			timer.Reset(w.flushDelay())
+		case <-timer.C:
+			// Events that arrived after the last wake still need their
+			// full quiet period.
+			if delay := w.flushDelay(); delay > 0 {
+				timer.Reset(delay)
+				continue
+			}
+			w.flush()
+		}
+	}
+}
+
+// coalesceLibraryWatchDirs drops directories inside another listed one:
+// subtree rescans cover them.
+func coalesceLibraryWatchDirs(dirs []string) []string {
+	sort.Strings(dirs)
+	var kept []string
+	for _, dir := range dirs {
+		covered := false
+		for _, parent := range kept {
+			if dir == parent || strings.HasPrefix(dir, strings.TrimSuffix(parent, string(filepath.Separator))+string(filepath.Separator)) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			kept = append(kept, dir)
+		}
+	}
+	return kept
+}
+
+func (w *libraryWatcher) rootOf(dir string) string {
+	for _, root := range w.roots {
+		if dir == root || strings.HasPrefix(dir, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator)) {
+			return root
+		}
+	}
+	return ""
+}
+
+func (w *libraryWatcher) flush() {
+	w.mu.Lock()
+	dirs := make([]string, 0, len(w.pending))
+	for dir := range w.pending {
+		dirs = append(dirs, dir)
+	}
+	w.pending = make(map[string]struct{})
+	w.mu.Unlock()
+
+	store := getLibraryStore()
+	var scanned, deleted int
+	var flushErr error
+	for _, dir := range coalesceLibraryWatchDirs(dirs) {
+		root := w.rootOf(dir)
+		if root == "" {
+			continue
+		}
+		// An unmounted SD card or USB drive looks like an empty library;
+		// keep its tracks until it is back.
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			flushErr = fmt.Errorf("library root unavailable: %s", root)
+			continue
+		}
+		files, err := collectLibraryAudioFiles(dir, w.stop)
+		if err != nil {
+			flushErr = err
+			break
+		}
+		result, err := scanLibraryFilesIncremental(files, store.modTimesUnder(dir), w.stop, false)
+		if err != nil {
+			flushErr = err
+			break
+		}
+		store.apply(result.Scanned, result.DeletedPaths)
+		scanned += len(result.Scanned)
+		deleted += len(result.DeletedPaths)
+	}
+
+	select {
+	case <-w.stop:
+		return
+	default:
+	}
+	if scanned > 0 || deleted > 0 {
+		GoLog("[LibraryWatch] Rescanned %d dir(s): %d updated, %d removed\n", len(dirs), scanned, deleted)
+	}
+	w.mu.Lock()
+	w.rescans++
+	w.lastFlushAt = time.Now().UnixMilli()
+	w.mu.Unlock()
+	if flushErr != nil {
+		w.setError(flushErr)
+	}
+}
+
+func (w *libraryWatcher) status() LibraryWatchStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return LibraryWatchStatus{
+		Running:     true,
+		Mode:        w.mode,
+		Roots:       w.roots,
+		PendingDirs: len(w.pending),
+		Rescans:     w.rescans,
+		LastFlushAt: w.lastFlushAt,
+		LastError:   w.lastError,
+	}
+}
+
+func (w *libraryWatcher) start() {
+	backend, err := newInotifyLibraryBackend(w.roots, w.notify, w.notifyAllRoots)
+	w.mode = libraryWatchModeInotify
+	if err != nil {
+		GoLog("[LibraryWatch] inotify unavailable (%v), polling every %s\n", err, libraryWatchPollInterval)
+		backend = newPollingLibraryBackend(w.roots, w.notify, w.setError)
+		w.mode = libraryWatchModePoll
+	}
+	w.backend = backend
+
+	// Catch up on whatever changed while nobody was watching.
+	w.notifyAllRoots()
+
+	w.wg.Add(2)
+	go func() {
+		defer w.wg.Done()
+		if err := backend.run(w.stop); err != nil {
+			w.setError(fmt.Errorf("watch stopped: %w", err))
+		}
+	}()
+	go func() {
+		defer w.wg.Done()
+		w.loop()
+	}()
+}
+
+func (w *libraryWatcher) shutdown() {
+	close(w.stop)
+	w.backend.close()
+	w.wg.Wait()
+}
+
+// pollingLibraryBackend compares (mtime, size) snapshots of the roots; used
+// where inotify is unavailable or out of watches. A failed snapshot is
+// reported through onError and skipped, keeping the previous one.
+type pollingLibraryBackend struct {
+	roots   []string
+	notify  func(dir string)
+	onError func(err error)
+}
+
+func newPollingLibraryBackend(roots []string, notify func(dir string), onError func(err error)) *pollingLibraryBackend {
+	return &pollingLibraryBackend{roots: roots, notify: notify, onError: onError}
+}
+
+func (b *pollingLibraryBackend) snapshot(stop <-chan struct{}) (map[string]libraryAudioFileInfo, error) {
+	snapshot := make(map[string]libraryAudioFileInfo)
+	for _, root := range b.roots {
+		// An unmounted SD card reads as an empty folder; diffing against it
+		// would report every track as removed.
+		if _, err := os.Stat(root); err != nil {
+			return nil, fmt.Errorf("library root unavailable: %w", err)
+		}
+		files, err := collectLibraryAudioFiles(root, stop)
+		if err != nil {
+			return nil, err
+		}
+		// The walk skips unreadable folders, so a root unmounted mid-walk
+		// also reads as empty.
+		if _, err := os.Stat(root); err != nil {
+			return nil, fmt.Errorf("library root unavailable: %w", err)
+		}
+		for _, file := range files {
+			snapshot[file.path] = file
+		}
+	}
+	return snapshot, nil
+}
+
+func (b *pollingLibraryBackend) run(stop <-chan struct{}) error {
+	// Without a first snapshot every file counts as new once one succeeds,
+	// which rescans whatever was missed.
+	previous, err := b.snapshot(stop)
+	if err != nil {
+		b.reportError(stop, err)
+	}
+	ticker := time.NewTicker(libraryWatchPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+		current, err := b.snapshot(stop)
+		if err != nil {
+			b.reportError(stop, err)
+			continue
+		}
+		for path, file := range current {
+			if old, ok := previous[path]; !ok || old.modTime != file.modTime || old.size != file.size {
+				b.notify(filepath.Dir(path))
+			}
+		}
+		for path := range previous {
+			if _, ok := current[path]; !ok {
+				b.notify(filepath.Dir(path))
+			}
+		}
+		previous = current
+	}
+}
+
+// reportError passes a snapshot failure on, unless it is just the walk
+// stopping for shutdown.
+func (b *pollingLibraryBackend) reportError(stop <-chan struct{}, err error) {
+	select {
+	case <-stop:
+		return
+	default:
+	}
+	if b.onError != nil {
+		b.onError(err)
+	}
+}
+
+func (b *pollingLibraryBackend) close() {}
+
+// StartLibraryWatch watches rootsJSON (a JSON array of folders) and keeps
+// the library store in sync with them, replacing any previous watch. The
+// roots are rescanned once right away.
+func StartLibraryWatch(rootsJSON string) (string, error) {
+	var roots []string
+	if err := json.Unmarshal([]byte(rootsJSON), &roots); err != nil {
+		return "", fmt.Errorf("invalid library roots: %w", err)
+	}
+	var cleaned []string
+	for _, root := range roots {
+		root = strings.TrimSpace(root)
+		if root == "" {
+			continue
+		}
+		root = filepath.Clean(root)
+		info, err := os.Stat(root)
+		if err != nil {
+			return "", fmt.Errorf("folder not found: %w", err)
+		}
+		if !info.IsDir() {
+			return "", fmt.Errorf("path is not a folder: %s", root)
+		}
+		cleaned = append(cleaned, root)
+	}
+	if len(cleaned) == 0 {
+		return "", fmt.Errorf("no library roots to watch")
+	}
+
+	activeLibraryWatcherMu.Lock()
+	defer activeLibraryWatcherMu.Unlock()
+	if activeLibraryWatcher != nil {
+		activeLibraryWatcher.shutdown()
+		activeLibraryWatcher = nil
+	}
+	watcher := newLibraryWatcher(coalesceLibraryWatchDirs(cleaned))
+	watcher.start()
+	activeLibraryWatcher = watcher
+	GoLog("[LibraryWatch] Watching %d root(s) via %s\n", len(watcher.roots), watcher.mode)
+	return marshalJSONString(watcher.status())
+}
+
+func StopLibraryWatch() {
+	activeLibraryWatcherMu.Lock()
+	defer activeLibraryWatcherMu.Unlock()
+	if activeLibraryWatcher != nil {
+		activeLibraryWatcher.shutdown()
+		activeLibraryWatcher = nil
+		GoLog("[LibraryWatch] Stopped\n")
+	}
+}
+
+func GetLibraryWatchStatus() string {
+	activeLibraryWatcherMu.Lock()
+	watcher := activeLibraryWatcher
+	activeLibraryWatcherMu.Unlock()
+	status := LibraryWatchStatus{}
+	if watcher != nil {
+		status = watcher.status()
+	}
+	jsonText, err := marshalJSONString(status)
+	if err != nil {
+		return "{}"
+	}
+	return jsonText
+}
@@ -0,0 +1,137 @@
+//go:build linux
+
+package gobackend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+const inotifyLibraryMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO |
+	syscall.IN_MOVED_FROM | syscall.IN_DELETE | syscall.IN_ONLYDIR
+
+// inotifyLibraryBackend watches every directory under the roots (inotify is
+// not recursive) and adds watches for directories created later.
+type inotifyLibraryBackend struct {
+	fd        int
+	file      *os.File
+	notify    func(dir string)
+	overflow  func()
+	mu        sync.Mutex
+	watches   map[int32]string // watch descriptor -> directory
+	closeOnce sync.Once
+}
+
+func newInotifyLibraryBackend(roots []string, notify func(dir string), overflow func()) (libraryWatchBackend, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify_init1: %w", err)
+	}
+	// A non-blocking fd goes through the runtime poller, so close unblocks
+	// a pending Read. File.Fd would switch it back to blocking; keep fd.
+	b := &inotifyLibraryBackend{
+		fd:       fd,
+		file:     os.NewFile(uintptr(fd), "inotify"),
+		notify:   notify,
+		overflow: overflow,
+		watches:  make(map[int32]string),
+	}
+	for _, root := range roots {
+		if err := b.addTree(root); err != nil {
+			b.close()
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// addTree watches dir and its subdirectories. Running out of watches
+// (ENOSPC) is the one error reported: the caller falls back to polling.
+func (b *inotifyLibraryBackend) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return nil
+		}
+		wd, err := syscall.InotifyAddWatch(b.fd, path, inotifyLibraryMask)
+		if err != nil {
+			if errors.Is(err, syscall.ENOSPC) {
+				return fmt.Errorf("inotify watch limit reached at %s", path)
+			}
+			return nil
+		}
+		b.mu.Lock()
+		b.watches[int32(wd)] = path
+		b.mu.Unlock()
+		return nil
+	})
+}
+
+func (b *inotifyLibraryBackend) run(stop <-chan struct{}) error {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := b.file.Read(buf)
+		if err != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+				return err
+			}
+		}
+		b.handle(buf[:n])
+	}
+}
+
+func (b *inotifyLibraryBackend) handle(buf []byte) {
+	for len(buf) >= syscall.SizeofInotifyEvent {
+		wd := int32(binary.NativeEndian.Uint32(buf[0:4]))
+		mask := binary.NativeEndian.Uint32(buf[4:8])
+		nameLen := int(binary.NativeEndian.Uint32(buf[12:16]))
+		end := min(syscall.SizeofInotifyEvent+nameLen, len(buf))
+		name := string(bytes.TrimRight(buf[syscall.SizeofInotifyEvent:end], "\x00"))
+		buf = buf[end:]
+
+		if mask&syscall.IN_Q_OVERFLOW != 0 {
+			b.overflow()
+			continue
+		}
+		b.mu.Lock()
+		dir, ok := b.watches[wd]
+		if mask&syscall.IN_IGNORED != 0 {
+			delete(b.watches, wd)
+		}
+		b.mu.Unlock()
+		if !ok || name == "" {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		if mask&syscall.IN_ISDIR != 0 {
+			if mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+				if err := b.addTree(path); err != nil {
+					GoLog("[LibraryWatch] %v\n", err)
+				}
+			}
+			// New directories need scanning; for removed ones the rescan
+			// finds nothing and drops their tracks.
+			b.notify(path)
+			continue
+		}
+		if isLibraryWatchedFile(name) {
+			b.notify(dir)
+		}
+	}
+}
+
+func (b *inotifyLibraryBackend) close() {
+	b.closeOnce.Do(func() {
+		b.file.Close()
+	})
+}
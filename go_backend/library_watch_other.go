@@ -0,0 +1,9 @@
+//go:build !linux
+
+package gobackend
+
+import "errors"
+
+func newInotifyLibraryBackend(roots []string, notify func(dir string), overflow func()) (libraryWatchBackend, error) {
+	return nil, errors.New("inotify is not available on this platform")
+}
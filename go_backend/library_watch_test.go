@@ -0,0 +1,172 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCoalesceLibraryWatchDirs(t *testing.T) {
+	got := coalesceLibraryWatchDirs([]string{"/m/a/b", "/m/ab", "/m/a", "/m/a/b/c", "/m/ab"})
+	if want := []string{"/m/a", "/m/ab"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("coalesce = %v, want %v", got, want)
+	}
+}
+
+func withFastLibraryWatch(t *testing.T) {
+	t.Helper()
+	debounce, maxDelay, poll := libraryWatchDebounce, libraryWatchMaxDelay, libraryWatchPollInterval
+	libraryWatchDebounce, libraryWatchMaxDelay, libraryWatchPollInterval = 50*time.Millisecond, 500*time.Millisecond, 50*time.Millisecond
+	t.Cleanup(func() {
+		libraryWatchDebounce, libraryWatchMaxDelay, libraryWatchPollInterval = debounce, maxDelay, poll
+	})
+}
+
+// waitLibraryDelta polls GetLibraryChangesDelta until check accepts a delta.
+func waitLibraryDelta(t *testing.T, sinceSeq int64, check func(*LibraryChangesDelta) bool) int64 {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if jsonText := GetLibraryChangesDelta(sinceSeq); jsonText != "" {
+			var delta LibraryChangesDelta
+			if err := json.Unmarshal([]byte(jsonText), &delta); err != nil {
+				t.Fatal(err)
+			}
+			if check(&delta) {
+				return delta.Seq
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("no matching library delta after seq %d; watch status %s", sinceSeq, GetLibraryWatchStatus())
+	return 0
+}
+
+func TestLibraryWatchPicksUpNewAndDeletedFiles(t *testing.T) {
+	withFastLibraryWatch(t)
+	if err := getLibraryStore().open(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer ClearLibraryStore()
+
+	root := t.TempDir()
+	writeTest320MP3(t, filepath.Join(root, "first.mp3"), id3TextFrame("TIT2", "First"))
+
+	if _, err := StartLibraryWatch(`["` + root + `"]`); err != nil {
+		t.Fatal(err)
+	}
+	defer StopLibraryWatch()
+
+	// The initial catch-up rescan indexes what is already there.
+	seq := waitLibraryDelta(t, 0, func(d *LibraryChangesDelta) bool {
+		result, _ := getLibraryStore().query(LibraryQuery{})
+		return result.Total == 1
+	})
+
+	albumDir := filepath.Join(root, "Album")
+	if err := os.MkdirAll(albumDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	added := filepath.Join(albumDir, "second.mp3")
+	writeTest320MP3(t, added, id3TextFrame("TIT2", "Second"))
+	seq = waitLibraryDelta(t, seq, func(d *LibraryChangesDelta) bool {
+		return len(d.Tracks) == 1 && d.Tracks[0].FilePath == added && d.Tracks[0].TrackName == "Second"
+	})
+
+	if err := os.Remove(added); err != nil {
+		t.Fatal(err)
+	}
+	waitLibraryDelta(t, seq, func(d *LibraryChangesDelta) bool {
+		return len(d.Removed) == 1 && d.Removed[0] == added
+	})
+}
+
+func TestPollingLibraryBackendReportsChangedDirs(t *testing.T) {
+	withFastLibraryWatch(t)
+	root := t.TempDir()
+	writeTest320MP3(t, filepath.Join(root, "a.mp3"))
+
+	changed := make(chan string, 16)
+	backend := newPollingLibraryBackend([]string{root}, func(dir string) { changed <- dir }, nil)
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() { done <- backend.run(stop) }()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	sub := filepath.Join(root, "sub")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTest320MP3(t, filepath.Join(sub, "b.mp3"))
+	select {
+	case dir := <-changed:
+		if dir != sub {
+			t.Fatalf("changed dir = %s, want %s", dir, sub)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("polling backend reported nothing")
+	}
+}
+
+func TestPollingLibraryBackendSurvivesMissingRoot(t *testing.T) {
+	withFastLibraryWatch(t)
+	root := filepath.Join(t.TempDir(), "sdcard")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTest320MP3(t, filepath.Join(root, "a.mp3"))
+
+	changed := make(chan string, 16)
+	errs := make(chan error, 16)
+	backend := newPollingLibraryBackend([]string{root}, func(dir string) { changed <- dir }, func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	})
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() { done <- backend.run(stop) }()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	// Unmounting the root is an error, not the removal of every track.
+	time.Sleep(100 * time.Millisecond)
+	hidden := root + ".unmounted"
+	if err := os.Rename(root, hidden); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("missing root not reported")
+	}
+	select {
+	case dir := <-changed:
+		t.Fatalf("missing root reported a change in %s", dir)
+	default:
+	}
+
+	// Polling continues once the root is back.
+	if err := os.Rename(hidden, root); err != nil {
+		t.Fatal(err)
+	}
+	writeTest320MP3(t, filepath.Join(root, "b.mp3"))
+	select {
+	case dir := <-changed:
+		if dir != root {
+			t.Fatalf("changed dir = %s, want %s", dir, root)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("polling stopped after the error")
+	}
+}
@@ -237,7 +237,7 @@ func EditM4AFields(filePath string, fields map[string]string) error {
 		}
 	}
 
-	// Freeform tags: ISRC, LABEL, ReplayGain (+iTunNORM).
+	// Freeform tags: ISRC, LABEL, ReplayGain (+iTunNORM), provider IDs.
 	removeFreeform := map[string]struct{}{}
 	var freeformTags []m4aFreeformTag
 	if _, ok := fields["isrc"]; ok {
@@ -262,6 +262,12 @@ func EditM4AFields(filePath string, fields map[string]string) error {
 			freeformTags = append(freeformTags, m4aFreeformTag{name: "iTunNORM", value: norm})
 		}
 	}
+	for _, key := range providerIDFieldKeys {
+		if v, ok := fields[key]; ok {
+			removeFreeform[strings.ToUpper(key)] = struct{}{}
+			freeformTags = append(freeformTags, m4aFreeformTag{name: strings.ToUpper(key), value: strings.TrimSpace(v)})
+		}
+	}
 	for _, tag := range freeformTags {
 		if tag.value != "" {
 			appended = append(appended, buildM4AFreeformAtom(tag.name, tag.value)...)
@@ -194,6 +194,13 @@ type Metadata struct {
 	ReplayGainTrackPeak string // e.g. "0.988831"
 	ReplayGainAlbumGain string // e.g. "-7.20 dB"
 	ReplayGainAlbumPeak string // e.g. "1.000000"
+
+	// Provider track IDs, written as SPOTIFY_ID etc. so the duplicate index
+	// can match files that lack an ISRC.
+	SpotifyID string
+	DeezerID  string
+	TidalID   string
+	QobuzID   string
 }
 
 // parseFlacFile wraps flac.ParseFile but closes the file handle when parsing
@@ -394,6 +401,11 @@ func metadataFromParsedFlac(f *flac.File) *Metadata {
 			metadata.ReplayGainAlbumGain = getComment(cmt, "REPLAYGAIN_ALBUM_GAIN")
 			metadata.ReplayGainAlbumPeak = getComment(cmt, "REPLAYGAIN_ALBUM_PEAK")
 
+			metadata.SpotifyID = getComment(cmt, "SPOTIFY_ID")
+			metadata.DeezerID = getComment(cmt, "DEEZER_ID")
+			metadata.TidalID = getComment(cmt, "TIDAL_ID")
+			metadata.QobuzID = getComment(cmt, "QOBUZ_ID")
+
 			break
 		}
 	}
@@ -442,6 +454,10 @@ func applyVorbisFieldEdits(cmt *flacvorbis.MetaDataBlockVorbisComment, fields ma
 		"replaygain_track_peak": "REPLAYGAIN_TRACK_PEAK",
 		"replaygain_album_gain": "REPLAYGAIN_ALBUM_GAIN",
 		"replaygain_album_peak": "REPLAYGAIN_ALBUM_PEAK",
+		"spotify_id":            "SPOTIFY_ID",
+		"deezer_id":             "DEEZER_ID",
+		"tidal_id":              "TIDAL_ID",
+		"qobuz_id":              "QOBUZ_ID",
 	}
 
 	for fieldKey, vorbisKey := range simpleKeys {
@@ -585,6 +601,11 @@ func writeVorbisMetadata(cmt *flacvorbis.MetaDataBlockVorbisComment, metadata Me
 	setComment(cmt, "REPLAYGAIN_TRACK_PEAK", metadata.ReplayGainTrackPeak)
 	setComment(cmt, "REPLAYGAIN_ALBUM_GAIN", metadata.ReplayGainAlbumGain)
 	setComment(cmt, "REPLAYGAIN_ALBUM_PEAK", metadata.ReplayGainAlbumPeak)
+
+	setComment(cmt, "SPOTIFY_ID", metadata.SpotifyID)
+	setComment(cmt, "DEEZER_ID", metadata.DeezerID)
+	setComment(cmt, "TIDAL_ID", metadata.TidalID)
+	setComment(cmt, "QOBUZ_ID", metadata.QobuzID)
 }
 
 func setComment(cmt *flacvorbis.MetaDataBlockVorbisComment, key, value string) {
@@ -863,6 +884,19 @@ func ExtractLyrics(filePath string) (string, error) {
 		return extractLyricsFromSidecarLRC(filePath)
 	}
 
+	if strings.HasSuffix(lower, ".dsf") || strings.HasSuffix(lower, ".dff") {
+		meta, err := ReadDSDTags(filePath)
+		if err == nil && meta != nil {
+			if strings.TrimSpace(meta.Lyrics) != "" {
+				return meta.Lyrics, nil
+			}
+			if looksLikeEmbeddedLyrics(meta.Comment) {
+				return meta.Comment, nil
+			}
+		}
+		return extractLyricsFromSidecarLRC(filePath)
+	}
+
 	if strings.HasSuffix(lower, ".aiff") || strings.HasSuffix(lower, ".aif") || strings.HasSuffix(lower, ".aifc") {
 		meta, err := ReadAIFFTags(filePath)
 		if err == nil && meta != nil {
@@ -105,6 +105,8 @@ func readM4ATagsFromIlst(f *os.File, fileSize int64, ilst atomHeader) (*AudioMet
 					metadata.ReplayGainAlbumGain = value
 				case "REPLAYGAIN_ALBUM_PEAK":
 					metadata.ReplayGainAlbumPeak = value
+				default:
+					setProviderIDTag(metadata, name, value)
 				}
 			}
 		}
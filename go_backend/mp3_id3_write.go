@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 )
 
@@ -166,6 +167,12 @@ func parseID3v2xRawFrames(data []byte, version byte, tagUnsync bool) []id3RawFra
 			if tagUnsync {
 				payload = removeUnsync(payload)
 			}
+			switch id {
+			case "IPLS": // v2.4 renamed the involved people list
+				id = "TIPL"
+			case "CHAP", "CTOC":
+				payload = upgradeID3v23EmbeddedFrames(id, payload)
+			}
 		} else {
 			if formatFlags&(0x08|0x04) != 0 { // compression | encryption
 				continue
@@ -224,6 +231,12 @@ func firstFrameText(frames []id3RawFrame, id string) string {
 // EditMP3Fields updates only the ID3v2 frames whose keys are explicitly present
 // in the fields map (set-or-clear semantics, mirroring EditFlacFields) while
 // preserving every other frame byte-for-byte. The tag is rewritten as ID3v2.4.
+//
+// Beyond the shared editor keys it accepts "synced_lyrics" (LRC, written as
+// SYLT), "rating" (POPM, 0-255), "musicbrainz_trackid" (UFID) and JSON arrays
+// for "chapters" ([]ID3Chapter) and "involved_people"/"musician_credits"
+// ([]ID3Credit). With artist_tag_mode "split_vorbis" artists are stored as
+// separate NUL-separated values.
 func EditMP3Fields(filePath string, fields map[string]string) error {
 	f, err := os.Open(filePath)
 	if err != nil {
@@ -254,9 +267,7 @@ func EditMP3Fields(filePath string, fields map[string]string) error {
 		aliases  []string
 	}{
 		{"title", "TIT2", nil},
-		{"artist", "TPE1", nil},
 		{"album", "TALB", nil},
-		{"album_artist", "TPE2", nil},
 		{"date", "TDRC", []string{"TYER", "TDAT", "TIME"}},
 		{"genre", "TCON", nil},
 		{"label", "TPUB", nil},
@@ -270,6 +281,23 @@ func EditMP3Fields(filePath string, fields map[string]string) error {
 		}
 	}
 
+	artistMode := fields["artist_tag_mode"]
+	for _, key := range []struct{ fieldKey, frameID string }{{"artist", "TPE1"}, {"album_artist", "TPE2"}} {
+		v, ok := fields[key.fieldKey]
+		if !ok {
+			continue
+		}
+		drop[key.frameID] = true
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+		values := []string{v}
+		if shouldSplitVorbisArtistTags(artistMode) {
+			values = splitArtistTagValues(v)
+		}
+		added = append(added, id3RawFrame{id: key.frameID, payload: id3TextValuesPayload(values...)})
+	}
+
 	if v, ok := fields["comment"]; ok {
 		drop["COMM"] = true
 		if strings.TrimSpace(v) != "" {
@@ -306,13 +334,13 @@ func EditMP3Fields(filePath string, fields map[string]string) error {
 		setOrClear("TPOS", formatIndexValue(num, total))
 	}
 
-	// ReplayGain lives in TXXX frames matched by description; only the edited
-	// descriptions are dropped so foreign TXXX frames survive.
+	// ReplayGain and provider IDs live in TXXX frames matched by description;
+	// only the edited descriptions are dropped so foreign TXXX frames survive.
 	dropTXXXDesc := map[string]bool{}
-	for _, key := range []string{
+	for _, key := range append([]string{
 		"replaygain_track_gain", "replaygain_track_peak",
 		"replaygain_album_gain", "replaygain_album_peak",
-	} {
+	}, providerIDFieldKeys...) {
 		if v, ok := fields[key]; ok {
 			desc := strings.ToUpper(key)
 			dropTXXXDesc[desc] = true
@@ -335,9 +363,17 @@ func EditMP3Fields(filePath string, fields map[string]string) error {
 		}
 	}
 
+	skip := map[int]bool{}
+	extended, err := id3ExtendedFrameEdits(filePath, frames, fields, drop, skip)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	added = append(added, extended...)
+
 	var kept []id3RawFrame
-	for _, fr := range frames {
-		if drop[fr.id] {
+	for i, fr := range frames {
+		if drop[fr.id] || skip[i] {
 			continue
 		}
 		if fr.id == "TXXX" && len(dropTXXXDesc) > 0 {
@@ -356,7 +392,107 @@ func EditMP3Fields(filePath string, fields map[string]string) error {
 	return err
 }
 
-func serializeID3v24Tag(frames []id3RawFrame) []byte {
+// id3ExtendedFrameEdits handles the structured frames of EditMP3Fields. It
+// marks replaced frames in drop (by ID) or skip (by index into frames),
+// updates POPM in place and returns the new frames.
+func id3ExtendedFrameEdits(filePath string, frames []id3RawFrame, fields map[string]string, drop map[string]bool, skip map[int]bool) ([]id3RawFrame, error) {
+	var added []id3RawFrame
+
+	// SYLT is only touched through "synced_lyrics"; "lyrics" edits replace
+	// USLT alone.
+	if synced, ok := fields["synced_lyrics"]; ok {
+		drop["SYLT"] = true
+		if payload := id3SyncedLyricsPayload(synced); payload != nil {
+			added = append(added, id3RawFrame{id: "SYLT", payload: payload})
+		}
+	}
+
+	// The rating is rewritten in place into the first POPM (the one the reader
+	// reports), keeping its rater and play count; other raters' frames survive.
+	if v, ok := fields["rating"]; ok {
+		popm := id3Popularimeter{rating: min(parsePositiveInt(v), 255)}
+		index := slices.IndexFunc(frames, func(fr id3RawFrame) bool { return fr.id == "POPM" })
+		if index >= 0 {
+			if existing, ok := parseID3Popularimeter(frames[index].payload); ok {
+				popm.email, popm.playCount = existing.email, existing.playCount
+			}
+		}
+		switch {
+		case popm.rating == 0 && popm.playCount == 0:
+			if index >= 0 {
+				skip[index] = true
+			}
+		case index >= 0:
+			frames[index].payload = popm.payload()
+		default:
+			added = append(added, id3RawFrame{id: "POPM", payload: popm.payload()})
+		}
+	}
+
+	if v, ok := fields["musicbrainz_trackid"]; ok {
+		for i, fr := range frames {
+			if owner, _ := parseID3UniqueFileID(fr.payload); fr.id == "UFID" && owner == musicBrainzUFIDOwner {
+				skip[i] = true
+			}
+		}
+		if v = strings.TrimSpace(v); v != "" {
+			added = append(added, id3RawFrame{id: "UFID", payload: id3UniqueFileIDPayload(musicBrainzUFIDOwner, v)})
+		}
+	}
+
+	if v, ok := fields["chapters"]; ok {
+		drop["CHAP"], drop["CTOC"] = true, true
+		if strings.TrimSpace(v) != "" {
+			chapters, err := parseID3ChaptersField(v)
+			if err != nil {
+				return nil, err
+			}
+			var durationMs int64
+			if quality, err := GetMP3Quality(filePath); err == nil {
+				durationMs = int64(quality.Duration) * 1000
+			}
+			chapterFrames, err := id3ChapterFrames(chapters, durationMs)
+			if err != nil {
+				return nil, err
+			}
+			added = append(added, chapterFrames...)
+		}
+	}
+
+	for _, key := range []struct {
+		fieldKey string
+		frameID  string
+		aliases  []string
+	}{
+		{"involved_people", "TIPL", []string{"IPLS"}},
+		{"musician_credits", "TMCL", nil},
+	} {
+		v, ok := fields[key.fieldKey]
+		if !ok {
+			continue
+		}
+		drop[key.frameID] = true
+		for _, alias := range key.aliases {
+			drop[alias] = true
+		}
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+		credits, err := parseID3CreditsField(key.fieldKey, v)
+		if err != nil {
+			return nil, err
+		}
+		if payload := id3CreditsPayload(credits); payload != nil {
+			added = append(added, id3RawFrame{id: key.frameID, payload: payload})
+		}
+	}
+
+	return added, nil
+}
+
+// serializeID3v24Frames encodes frames with v2.4 headers and no flags; also
+// used for the frames embedded in CHAP and CTOC.
+func serializeID3v24Frames(frames []id3RawFrame) []byte {
 	var body bytes.Buffer
 	for _, fr := range frames {
 		body.WriteString(fr.id)
@@ -364,12 +500,17 @@ func serializeID3v24Tag(frames []id3RawFrame) []byte {
 		body.Write([]byte{0, 0})
 		body.Write(fr.payload)
 	}
+	return body.Bytes()
+}
+
+func serializeID3v24Tag(frames []id3RawFrame) []byte {
+	body := serializeID3v24Frames(frames)
 	const padding = 512
 	var out bytes.Buffer
 	out.WriteString("ID3")
 	out.Write([]byte{0x04, 0x00, 0x00})
-	out.Write(synchsafeEncode(body.Len() + padding))
-	out.Write(body.Bytes())
+	out.Write(synchsafeEncode(len(body) + padding))
+	out.Write(body)
 	out.Write(make([]byte, padding))
 	return out.Bytes()
 }
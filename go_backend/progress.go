@@ -421,6 +421,13 @@ func NewItemProgressWriter(w interface{ Write([]byte) (int, error) }, itemID str
 	}
 }
 
+// resumeFrom starts the byte count at offset for a download that continues
+// an existing partial file, so reported progress does not jump backwards.
+func (pw *ItemProgressWriter) resumeFrom(offset int64) {
+	pw.current = offset
+	pw.lastBytes = offset
+}
+
 func (pw *ItemProgressWriter) Write(p []byte) (int, error) {
 	if pw.itemID != "" && isDownloadCancelled(pw.itemID) {
 		return 0, ErrDownloadCancelled
@@ -0,0 +1,177 @@
+package gobackend
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// replayGainReferenceLUFS is the ReplayGain 2.0 target loudness.
+const replayGainReferenceLUFS = -18.0
+
+var errReplayGainUnsupportedFormat = errors.New("replaygain analysis needs a FLAC file")
+
+type ReplayGainTrackResult struct {
+	Path           string            `json:"path"`
+	IntegratedLUFS float64           `json:"integrated_lufs"`
+	GainDB         float64           `json:"gain_db"`
+	Peak           float64           `json:"peak"`
+	SamplePeak     float64           `json:"sample_peak"`
+	DurationMS     int64             `json:"duration_ms,omitempty"`
+	Tags           map[string]string `json:"tags,omitempty"`
+	Error          string            `json:"error,omitempty"`
+
+	blocks []float64
+}
+
+type ReplayGainResult struct {
+	Tracks         []ReplayGainTrackResult `json:"tracks"`
+	AlbumLUFS      float64                 `json:"album_lufs"`
+	AlbumGainDB    float64                 `json:"album_gain_db"`
+	AlbumPeak      float64                 `json:"album_peak"`
+	AnalyzedTracks int                     `json:"analyzed_tracks"`
+}
+
+func replayGainFromLUFS(lufs float64) float64 {
+	return replayGainReferenceLUFS - lufs
+}
+
+func formatReplayGainDB(gain float64) string {
+	return fmt.Sprintf("%.2f dB", gain)
+}
+
+func formatReplayGainPeak(peak float64) string {
+	return fmt.Sprintf("%.6f", peak)
+}
+
+// analyzeTrackLoudness decodes a FLAC file and measures its integrated
+// loudness and true peak. shouldStop is polled between frames.
+func analyzeTrackLoudness(path string, shouldStop func() bool) (ReplayGainTrackResult, error) {
+	result := ReplayGainTrackResult{Path: path}
+	dec, err := openFLACDecoder(path)
+	if errors.Is(err, errMissingFLACMarker) {
+		return result, errReplayGainUnsupportedFormat
+	}
+	if err != nil {
+		return result, err
+	}
+	defer dec.close()
+
+	meter := newLoudnessMeter(dec.info.sampleRate, dec.info.channels)
+	var samples int64
+	for {
+		if shouldStop != nil && shouldStop() {
+			return result, ErrDownloadCancelled
+		}
+		frame, err := dec.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, err
+		}
+		meter.addPCM(frame.samples, frame.bitsPerSample)
+		samples += int64(frame.blockSize())
+	}
+
+	result.blocks = meter.blocks
+	result.IntegratedLUFS = roundLoudness(gatedLoudness(meter.blocks))
+	result.GainDB = roundLoudness(replayGainFromLUFS(result.IntegratedLUFS))
+	result.SamplePeak, result.Peak = meter.peaks()
+	if dec.info.sampleRate > 0 {
+		result.DurationMS = samples * 1000 / int64(dec.info.sampleRate)
+	}
+	result.Tags = map[string]string{
+		"replaygain_track_gain": formatReplayGainDB(result.GainDB),
+		"replaygain_track_peak": formatReplayGainPeak(result.Peak),
+	}
+	return result, nil
+}
+
+func roundLoudness(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// computeReplayGain analyzes each path as a track and all successful tracks
+// together as one album. Album gain pools the gating blocks of every track,
+// as EBU R128 defines programme loudness, rather than averaging track values.
+func computeReplayGain(paths []string, shouldStop func() bool, onTrack func(done int)) (ReplayGainResult, error) {
+	result := ReplayGainResult{Tracks: make([]ReplayGainTrackResult, 0, len(paths))}
+	var albumBlocks []float64
+	for i, path := range paths {
+		path = strings.TrimSpace(path)
+		track, err := analyzeTrackLoudness(path, shouldStop)
+		if errors.Is(err, ErrDownloadCancelled) {
+			return result, err
+		}
+		if err != nil {
+			track = ReplayGainTrackResult{Path: path, Error: err.Error()}
+		} else {
+			albumBlocks = append(albumBlocks, track.blocks...)
+			if track.Peak > result.AlbumPeak {
+				result.AlbumPeak = track.Peak
+			}
+			result.AnalyzedTracks++
+		}
+		result.Tracks = append(result.Tracks, track)
+		if onTrack != nil {
+			onTrack(i + 1)
+		}
+	}
+	if result.AnalyzedTracks == 0 {
+		return result, nil
+	}
+
+	result.AlbumLUFS = roundLoudness(gatedLoudness(albumBlocks))
+	result.AlbumGainDB = roundLoudness(replayGainFromLUFS(result.AlbumLUFS))
+	for i := range result.Tracks {
+		if result.Tracks[i].Tags == nil {
+			continue
+		}
+		result.Tracks[i].Tags["replaygain_album_gain"] = formatReplayGainDB(result.AlbumGainDB)
+		result.Tracks[i].Tags["replaygain_album_peak"] = formatReplayGainPeak(result.AlbumPeak)
+	}
+	return result, nil
+}
+
+// canAnalyzeReplayGain reports whether path is a local FLAC file the
+// loudness analyzer can decode and the FLAC writer can tag in place.
+func canAnalyzeReplayGain(path string) bool {
+	if !filepath.IsAbs(path) || !strings.EqualFold(filepath.Ext(path), ".flac") {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && info.Size() > 0
+}
+
+// embedExtensionDownloadReplayGain tags a freshly downloaded local FLAC with
+// its track gain and peak when the host asked for req.AnalyzeReplayGain.
+// Album values need every track of the album, see ComputeReplayGainJSON.
+// Failures only log: the download itself succeeded.
+func embedExtensionDownloadReplayGain(resp *DownloadResponse, req DownloadRequest, alreadyExists bool) {
+	if alreadyExists || !req.AnalyzeReplayGain || resp == nil {
+		return
+	}
+	filePath := strings.TrimSpace(resp.FilePath)
+	if !canAnalyzeReplayGain(filePath) {
+		return
+	}
+	track, err := analyzeTrackLoudness(filePath, func() bool {
+		return req.ItemID != "" && isDownloadCancelled(req.ItemID)
+	})
+	if err != nil {
+		GoLog("[ReplayGain] Skipping %s: %v\n", filePath, err)
+		return
+	}
+	if err := EditFlacFields(filePath, track.Tags); err != nil {
+		GoLog("[ReplayGain] Failed to write tags to %s: %v\n", filePath, err)
+		return
+	}
+	resp.ReplayGainTrackGain = track.Tags["replaygain_track_gain"]
+	resp.ReplayGainTrackPeak = track.Tags["replaygain_track_peak"]
+	GoLog("[ReplayGain] %s: %.2f LUFS, gain %s, peak %s\n", filePath, track.IntegratedLUFS, resp.ReplayGainTrackGain, resp.ReplayGainTrackPeak)
+}
@@ -0,0 +1,336 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type AlbumReplayGainProgress struct {
+	TotalAlbums     int     `json:"total_albums"`
+	ProcessedAlbums int     `json:"processed_albums"`
+	TotalFiles      int     `json:"total_files"`
+	ProcessedFiles  int     `json:"processed_files"`
+	CurrentAlbum    string  `json:"current_album"`
+	CurrentFile     string  `json:"current_file"`
+	ErrorCount      int     `json:"error_count"`
+	ProgressPct     float64 `json:"progress_pct"`
+	IsComplete      bool    `json:"is_complete"`
+	IsCancelled     bool    `json:"is_cancelled,omitempty"`
+}
+
+type AlbumReplayGainAlbumResult struct {
+	AlbumName   string   `json:"album_name"`
+	AlbumArtist string   `json:"album_artist"`
+	Paths       []string `json:"paths"`
+	AlbumLUFS   float64  `json:"album_lufs,omitempty"`
+	AlbumGain   string   `json:"album_gain,omitempty"`
+	AlbumPeak   string   `json:"album_peak,omitempty"`
+	Tagged      int      `json:"tagged"`
+	Skipped     bool     `json:"skipped,omitempty"`
+	Errors      []string `json:"errors,omitempty"`
+}
+
+type AlbumReplayGainJobResult struct {
+	Albums         []AlbumReplayGainAlbumResult `json:"albums"`
+	TaggedFiles    int                          `json:"tagged_files"`
+	SkippedAlbums  int                          `json:"skipped_albums"`
+	UngroupedFiles int                          `json:"ungrouped_files"`
+	// SkippedUnsupported counts files the analyzer cannot decode (anything
+	// but FLAC); they are left out of album groups and progress totals.
+	SkippedUnsupported int `json:"skipped_unsupported"`
+	ErrorCount         int `json:"error_count"`
+}
+
+var (
+	albumReplayGainProgress   AlbumReplayGainProgress
+	albumReplayGainProgressMu sync.RWMutex
+	albumReplayGainCancel     chan struct{}
+	albumReplayGainCancelMu   sync.Mutex
+)
+
+type albumReplayGainTrack struct {
+	path        string
+	discNumber  int
+	trackNumber int
+}
+
+type albumReplayGainGroup struct {
+	albumName   string
+	albumArtist string
+	tracks      []albumReplayGainTrack
+}
+
+// groupLibraryAlbumsForReplayGain pools tracks by libraryAlbumKey, so album
+// gain covers exactly the albums the library shows: same-titled releases in
+// different folders or years get their own gain, while the discs of one
+// release share it. Tracks without an album key are counted as ungrouped.
+func groupLibraryAlbumsForReplayGain(results []*LibraryScanResult) ([]albumReplayGainGroup, int) {
+	byKey := make(map[string]*albumReplayGainGroup)
+	var order []string
+	ungrouped := 0
+	for _, result := range results {
+		key := libraryAlbumKey(result)
+		if key == "" {
+			ungrouped++
+			continue
+		}
+		group, ok := byKey[key]
+		if !ok {
+			group = &albumReplayGainGroup{
+				albumName:   libraryAlbumTitle(result),
+				albumArtist: libraryAlbumArtist(result),
+			}
+			byKey[key] = group
+			order = append(order, key)
+		}
+		group.tracks = append(group.tracks, albumReplayGainTrack{
+			path:        result.FilePath,
+			discNumber:  result.DiscNumber,
+			trackNumber: result.TrackNumber,
+		})
+	}
+
+	groups := make([]albumReplayGainGroup, 0, len(order))
+	for _, key := range order {
+		group := byKey[key]
+		sort.SliceStable(group.tracks, func(i, j int) bool {
+			a, b := group.tracks[i], group.tracks[j]
+			if a.discNumber != b.discNumber {
+				return a.discNumber < b.discNumber
+			}
+			if a.trackNumber != b.trackNumber {
+				return a.trackNumber < b.trackNumber
+			}
+			return a.path < b.path
+		})
+		groups = append(groups, *group)
+	}
+	return groups, ungrouped
+}
+
+// albumHasReplayGain reports whether every track already carries album gain,
+// so a rerun after cancellation resumes instead of re-analyzing.
+func albumHasReplayGain(group albumReplayGainGroup) bool {
+	for _, track := range group.tracks {
+		meta, err := ReadMetadata(track.path)
+		if err != nil || strings.TrimSpace(meta.ReplayGainAlbumGain) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// writeReplayGainTags routes through EditFileMetadata so every format uses
+// its native editor. The ffmpeg fallback means nothing was written here.
+func writeReplayGainTags(path string, tags map[string]string) error {
+	fieldsJSON, err := json.Marshal(tags)
+	if err != nil {
+		return err
+	}
+	raw, err := EditFileMetadata(path, string(fieldsJSON))
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Method string `json:"method"`
+	}
+	if err := json.Unmarshal([]byte(raw), &resp); err == nil && resp.Method == "ffmpeg" {
+		return fmt.Errorf("no native tag editor for %s", filepath.Ext(path))
+	}
+	return nil
+}
+
+func updateAlbumReplayGainProgress(update func(p *AlbumReplayGainProgress)) {
+	albumReplayGainProgressMu.Lock()
+	update(&albumReplayGainProgress)
+	if albumReplayGainProgress.TotalFiles > 0 {
+		albumReplayGainProgress.ProgressPct = float64(albumReplayGainProgress.ProcessedFiles) / float64(albumReplayGainProgress.TotalFiles) * 100
+	}
+	albumReplayGainProgressMu.Unlock()
+}
+
+// finishAlbumReplayGainJob marks the progress terminal, so a UI polling
+// GetAlbumReplayGainProgress stops after a cancel as well as a normal run.
+func finishAlbumReplayGainJob(cancelled bool) {
+	updateAlbumReplayGainProgress(func(p *AlbumReplayGainProgress) {
+		p.CurrentAlbum = ""
+		p.CurrentFile = ""
+		p.IsComplete = true
+		p.IsCancelled = cancelled
+	})
+}
+
+// RunAlbumReplayGainJob scans folderPath, groups its FLAC tracks into albums
+// and writes track and album ReplayGain tags to each file. Albums whose
+// tracks all carry album gain already are skipped unless overwriteExisting
+// is set.
+func RunAlbumReplayGainJob(folderPath string, overwriteExisting bool) (string, error) {
+	if folderPath == "" {
+		return "", fmt.Errorf("folder path is empty")
+	}
+	info, err := os.Stat(folderPath)
+	if err != nil {
+		return "", fmt.Errorf("folder not found: %w", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("path is not a folder: %s", folderPath)
+	}
+
+	albumReplayGainProgressMu.Lock()
+	albumReplayGainProgress = AlbumReplayGainProgress{}
+	albumReplayGainProgressMu.Unlock()
+
+	albumReplayGainCancelMu.Lock()
+	if albumReplayGainCancel != nil {
+		close(albumReplayGainCancel)
+	}
+	albumReplayGainCancel = make(chan struct{})
+	cancelCh := albumReplayGainCancel
+	albumReplayGainCancelMu.Unlock()
+
+	shouldStop := func() bool {
+		select {
+		case <-cancelCh:
+			return true
+		default:
+			return false
+		}
+	}
+
+	errCancelled := fmt.Errorf("replaygain job cancelled")
+	fileInfos, err := collectLibraryAudioFiles(folderPath, cancelCh)
+	if err != nil {
+		if shouldStop() {
+			finishAlbumReplayGainJob(true)
+			return "", errCancelled
+		}
+		return "", err
+	}
+
+	scanTime := time.Now().UTC().Format(time.RFC3339)
+	scanned := make([]*LibraryScanResult, 0, len(fileInfos))
+	jobResult := AlbumReplayGainJobResult{Albums: []AlbumReplayGainAlbumResult{}}
+	for _, fileInfo := range fileInfos {
+		if shouldStop() {
+			finishAlbumReplayGainJob(true)
+			return "", errCancelled
+		}
+		// The analyzer only decodes FLAC. A CUE image is one file, so its
+		// sheet is skipped and the image is tagged as a single track.
+		switch strings.ToLower(filepath.Ext(fileInfo.path)) {
+		case ".flac":
+		case ".cue":
+			continue
+		default:
+			jobResult.SkippedUnsupported++
+			continue
+		}
+		result, err := scanAudioFileWithKnownModTime(fileInfo.path, scanTime, fileInfo.modTime)
+		if err != nil {
+			jobResult.ErrorCount++
+			GoLog("[ReplayGain] Error reading %s: %v\n", fileInfo.path, err)
+			continue
+		}
+		scanned = append(scanned, result)
+	}
+
+	groups, ungrouped := groupLibraryAlbumsForReplayGain(scanned)
+	jobResult.UngroupedFiles = ungrouped
+	totalFiles := 0
+	for _, group := range groups {
+		totalFiles += len(group.tracks)
+	}
+	updateAlbumReplayGainProgress(func(p *AlbumReplayGainProgress) {
+		p.TotalAlbums = len(groups)
+		p.TotalFiles = totalFiles
+		p.ErrorCount = jobResult.ErrorCount
+	})
+	GoLog("[ReplayGain] Album job: %d albums, %d files, %d without album tags, %d unsupported\n", len(groups), totalFiles, ungrouped, jobResult.SkippedUnsupported)
+
+	processedFiles := 0
+	for i, group := range groups {
+		albumResult := AlbumReplayGainAlbumResult{
+			AlbumName:   group.albumName,
+			AlbumArtist: group.albumArtist,
+			Paths:       make([]string, len(group.tracks)),
+		}
+		for j, track := range group.tracks {
+			albumResult.Paths[j] = track.path
+		}
+		updateAlbumReplayGainProgress(func(p *AlbumReplayGainProgress) {
+			p.CurrentAlbum = group.albumName
+		})
+
+		if !overwriteExisting && albumHasReplayGain(group) {
+			albumResult.Skipped = true
+			jobResult.SkippedAlbums++
+		} else {
+			base := processedFiles
+			rg, err := computeReplayGain(albumResult.Paths, shouldStop, func(done int) {
+				updateAlbumReplayGainProgress(func(p *AlbumReplayGainProgress) {
+					p.ProcessedFiles = base + done
+					p.CurrentFile = filepath.Base(albumResult.Paths[done-1])
+				})
+			})
+			if errors.Is(err, ErrDownloadCancelled) {
+				finishAlbumReplayGainJob(true)
+				return "", errCancelled
+			}
+			if rg.AnalyzedTracks > 0 {
+				albumResult.AlbumLUFS = rg.AlbumLUFS
+				albumResult.AlbumGain = formatReplayGainDB(rg.AlbumGainDB)
+				albumResult.AlbumPeak = formatReplayGainPeak(rg.AlbumPeak)
+			}
+			for _, track := range rg.Tracks {
+				if track.Error != "" {
+					albumResult.Errors = append(albumResult.Errors, fmt.Sprintf("%s: %s", filepath.Base(track.Path), track.Error))
+					continue
+				}
+				if err := writeReplayGainTags(track.Path, track.Tags); err != nil {
+					albumResult.Errors = append(albumResult.Errors, fmt.Sprintf("%s: %v", filepath.Base(track.Path), err))
+					continue
+				}
+				albumResult.Tagged++
+			}
+			jobResult.TaggedFiles += albumResult.Tagged
+			jobResult.ErrorCount += len(albumResult.Errors)
+			GoLog("[ReplayGain] %s - %s: %.2f LUFS, %d/%d tagged\n", group.albumArtist, group.albumName, albumResult.AlbumLUFS, albumResult.Tagged, len(group.tracks))
+		}
+
+		processedFiles += len(group.tracks)
+		jobResult.Albums = append(jobResult.Albums, albumResult)
+		updateAlbumReplayGainProgress(func(p *AlbumReplayGainProgress) {
+			p.ProcessedAlbums = i + 1
+			p.ProcessedFiles = processedFiles
+			p.ErrorCount = jobResult.ErrorCount
+		})
+	}
+
+	finishAlbumReplayGainJob(false)
+	return marshalJSONString(jobResult)
+}
+
+func GetAlbumReplayGainProgress() string {
+	albumReplayGainProgressMu.RLock()
+	defer albumReplayGainProgressMu.RUnlock()
+
+	jsonBytes, _ := json.Marshal(albumReplayGainProgress)
+	return string(jsonBytes)
+}
+
+func CancelAlbumReplayGainJob() {
+	albumReplayGainCancelMu.Lock()
+	defer albumReplayGainCancelMu.Unlock()
+
+	if albumReplayGainCancel != nil {
+		close(albumReplayGainCancel)
+		albumReplayGainCancel = nil
+	}
+}
@@ -0,0 +1,146 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeAlbumTrackFLAC(t *testing.T, dir, name string, amplitudeDB float64, fields map[string]string) string {
+	t.Helper()
+	src := writeSineFLAC(t, name, 1000, math.Pow(10, amplitudeDB/20), 0, 2)
+	path := filepath.Join(dir, name)
+	if err := os.Rename(src, path); err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) > 0 {
+		if err := EditFlacFields(path, fields); err != nil {
+			t.Fatalf("EditFlacFields: %v", err)
+		}
+	}
+	return path
+}
+
+func TestRunAlbumReplayGainJobTagsAlbumsAcrossDiscs(t *testing.T) {
+	dir := t.TempDir()
+	disc1 := writeAlbumTrackFLAC(t, dir, "d1.flac", -23, map[string]string{
+		"title": "One", "album": "Double", "album_artist": "Band", "artist": "Band", "disc_number": "1", "track_number": "1",
+	})
+	disc2 := writeAlbumTrackFLAC(t, dir, "d2.flac", -13, map[string]string{
+		"title": "Two", "album": "double", "artist": "band", "disc_number": "2", "track_number": "1",
+	})
+	single := writeAlbumTrackFLAC(t, dir, "single.flac", -18, map[string]string{
+		"title": "Solo", "album": "Single", "artist": "Other",
+	})
+	writeAlbumTrackFLAC(t, dir, "loose.flac", -18, nil)
+	writeTest320MP3(t, filepath.Join(dir, "bonus.mp3"), id3TextFrame("TALB", "Double"), id3TextFrame("TPE1", "Band"))
+
+	raw, err := RunAlbumReplayGainJobJSON(dir, false)
+	if err != nil {
+		t.Fatalf("RunAlbumReplayGainJobJSON: %v", err)
+	}
+	var result AlbumReplayGainJobResult
+	if err := json.Unmarshal([]byte(raw), &result); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(result.Albums) != 2 || result.TaggedFiles != 3 || result.UngroupedFiles != 1 ||
+		result.SkippedUnsupported != 1 || result.ErrorCount != 0 {
+		t.Fatalf("result = %+v", result)
+	}
+
+	meta1, _ := ReadMetadata(disc1)
+	meta2, _ := ReadMetadata(disc2)
+	wantAlbum := formatReplayGainDB(roundLoudness(replayGainFromLUFS(10 * math.Log10((math.Pow(10, -2.3)+math.Pow(10, -1.3))/2))))
+	if meta1.ReplayGainAlbumGain != meta2.ReplayGainAlbumGain || meta1.ReplayGainAlbumPeak != meta2.ReplayGainAlbumPeak {
+		t.Fatalf("disc album tags differ: %+v / %+v", meta1, meta2)
+	}
+	if math.Abs(parseTestGain(t, meta1.ReplayGainAlbumGain)-parseTestGain(t, wantAlbum)) > 0.1 {
+		t.Fatalf("album gain = %s, want %s", meta1.ReplayGainAlbumGain, wantAlbum)
+	}
+	if meta1.ReplayGainTrackGain == meta2.ReplayGainTrackGain {
+		t.Fatalf("track gains should differ: %s", meta1.ReplayGainTrackGain)
+	}
+	metaSingle, _ := ReadMetadata(single)
+	if metaSingle.ReplayGainAlbumGain != metaSingle.ReplayGainTrackGain {
+		t.Fatalf("single-track album gain %s != track gain %s", metaSingle.ReplayGainAlbumGain, metaSingle.ReplayGainTrackGain)
+	}
+
+	var progress AlbumReplayGainProgress
+	if err := json.Unmarshal([]byte(GetAlbumReplayGainProgressJSON()), &progress); err != nil {
+		t.Fatalf("progress: %v", err)
+	}
+	if !progress.IsComplete || progress.ProcessedAlbums != 2 || progress.ProcessedFiles != 3 || progress.ProgressPct != 100 {
+		t.Fatalf("progress = %+v", progress)
+	}
+
+	raw, err = RunAlbumReplayGainJobJSON(dir, false)
+	if err != nil {
+		t.Fatalf("rerun: %v", err)
+	}
+	result = AlbumReplayGainJobResult{}
+	if err := json.Unmarshal([]byte(raw), &result); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if result.SkippedAlbums != 2 || result.TaggedFiles != 0 {
+		t.Fatalf("rerun should skip tagged albums: %+v", result)
+	}
+}
+
+func TestGroupLibraryAlbumsForReplayGainSeparatesReleases(t *testing.T) {
+	track := func(path, date string, disc int) *LibraryScanResult {
+		return &LibraryScanResult{FilePath: path, AlbumName: "Greatest Hits", ArtistName: "Band", ReleaseDate: date, DiscNumber: disc}
+	}
+	groups, ungrouped := groupLibraryAlbumsForReplayGain([]*LibraryScanResult{
+		track("/music/Greatest Hits (1990)/CD1/01.flac", "1990", 1),
+		track("/music/Greatest Hits (1990)/CD2/01.flac", "1990", 2),
+		track("/music/Greatest Hits (2005)/01.flac", "2005", 1),
+		track("/music/Greatest Hits (1990) [copy]/01.flac", "1990", 1),
+	})
+	if ungrouped != 0 || len(groups) != 3 || len(groups[0].tracks) != 2 {
+		t.Fatalf("groups = %+v", groups)
+	}
+}
+
+func TestRunAlbumReplayGainJobCancelIsTerminal(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 24 {
+		writeAlbumTrackFLAC(t, dir, fmt.Sprintf("%02d.flac", i+1), -18, map[string]string{
+			"title": fmt.Sprint(i + 1), "album": "Long", "artist": "Band", "track_number": fmt.Sprint(i + 1),
+		})
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := RunAlbumReplayGainJobJSON(dir, true)
+		done <- err
+	}()
+	var progress AlbumReplayGainProgress
+	for progress.TotalFiles != 24 {
+		time.Sleep(time.Millisecond)
+		json.Unmarshal([]byte(GetAlbumReplayGainProgressJSON()), &progress)
+	}
+	CancelAlbumReplayGainJobJSON()
+	if err := <-done; err == nil {
+		t.Fatal("cancelled job reported success")
+	}
+
+	if err := json.Unmarshal([]byte(GetAlbumReplayGainProgressJSON()), &progress); err != nil {
+		t.Fatalf("progress: %v", err)
+	}
+	if !progress.IsComplete || !progress.IsCancelled || progress.ProcessedFiles >= progress.TotalFiles {
+		t.Fatalf("progress after cancel = %+v", progress)
+	}
+}
+
+func parseTestGain(t *testing.T, value string) float64 {
+	t.Helper()
+	var gain float64
+	if _, err := fmt.Sscanf(value, "%f dB", &gain); err != nil {
+		t.Fatalf("parse gain %q: %v", value, err)
+	}
+	return gain
+}
@@ -0,0 +1,117 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeSineFLAC writes a 16-bit stereo 44.1 kHz FLAC of a sine at
+// amplitude (full scale = 1) in both channels.
+func writeSineFLAC(t *testing.T, name string, freq, amplitude, phase float64, seconds int) string {
+	t.Helper()
+	n := 44100 * seconds
+	channel := make([]int64, n)
+	for i := range channel {
+		channel[i] = int64(math.Round(amplitude * 32767 * math.Sin(2*math.Pi*freq*float64(i)/44100+phase)))
+	}
+	return writeTestSignalFLAC(t, t.TempDir(), name, channel)
+}
+
+func TestAnalyzeTrackLoudnessMatchesBS1770Reference(t *testing.T) {
+	// EBU Tech 3341: a 1 kHz stereo sine at -23 dBFS reads -23 LUFS.
+	path := writeSineFLAC(t, "minus23.flac", 1000, math.Pow(10, -23.0/20), 0, 5)
+	track, err := analyzeTrackLoudness(path, nil)
+	if err != nil {
+		t.Fatalf("analyzeTrackLoudness: %v", err)
+	}
+	if math.Abs(track.IntegratedLUFS+23) > 0.1 {
+		t.Fatalf("integrated = %.2f LUFS, want -23", track.IntegratedLUFS)
+	}
+	if math.Abs(track.GainDB-5) > 0.1 {
+		t.Fatalf("gain = %.2f dB, want +5", track.GainDB)
+	}
+	if track.Tags["replaygain_track_gain"] != formatReplayGainDB(track.GainDB) || track.Tags["replaygain_track_peak"] == "" {
+		t.Fatalf("tags = %v", track.Tags)
+	}
+}
+
+func TestAnalyzeTrackLoudnessFindsInterSamplePeak(t *testing.T) {
+	// A quarter-rate sine sampled 45 degrees off its crest never hits a
+	// sample at the crest: samples sit at 0.707 of the true peak.
+	path := writeSineFLAC(t, "isp.flac", 44100.0/4, 0.5, math.Pi/4, 1)
+	track, err := analyzeTrackLoudness(path, nil)
+	if err != nil {
+		t.Fatalf("analyzeTrackLoudness: %v", err)
+	}
+	if math.Abs(track.SamplePeak-0.5*math.Sqrt2/2) > 0.01 {
+		t.Fatalf("sample peak = %.4f", track.SamplePeak)
+	}
+	if math.Abs(track.Peak-0.5) > 0.02 {
+		t.Fatalf("true peak = %.4f, want ~0.5", track.Peak)
+	}
+}
+
+func TestComputeReplayGainJSONPoolsAlbumBlocks(t *testing.T) {
+	quiet := writeSineFLAC(t, "quiet.flac", 1000, math.Pow(10, -23.0/20), 0, 3)
+	loud := writeSineFLAC(t, "loud.flac", 1000, math.Pow(10, -13.0/20), 0, 3)
+	notFLAC := filepath.Join(t.TempDir(), "song.mp3")
+	if err := os.WriteFile(notFLAC, []byte("ID3\x03\x00\x00\x00\x00\x00\x00"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pathsJSON, _ := json.Marshal([]string{quiet, loud, notFLAC})
+	raw, err := ComputeReplayGainJSON(string(pathsJSON))
+	if err != nil {
+		t.Fatalf("ComputeReplayGainJSON: %v", err)
+	}
+	var result ReplayGainResult
+	if err := json.Unmarshal([]byte(raw), &result); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if result.AnalyzedTracks != 2 || len(result.Tracks) != 3 || result.Tracks[2].Error == "" {
+		t.Fatalf("result = %+v", result)
+	}
+	// Equal-length tracks at -23 and -13 LUFS pool to the mean energy.
+	wantAlbum := 10 * math.Log10((math.Pow(10, -2.3)+math.Pow(10, -1.3))/2)
+	if math.Abs(result.AlbumLUFS-wantAlbum) > 0.1 {
+		t.Fatalf("album = %.2f LUFS, want %.2f", result.AlbumLUFS, wantAlbum)
+	}
+	for _, track := range result.Tracks[:2] {
+		if track.Tags["replaygain_album_gain"] != formatReplayGainDB(result.AlbumGainDB) {
+			t.Fatalf("track %s tags = %v", track.Path, track.Tags)
+		}
+	}
+	if result.AlbumPeak < result.Tracks[1].Peak {
+		t.Fatalf("album peak %.4f below loud track peak %.4f", result.AlbumPeak, result.Tracks[1].Peak)
+	}
+}
+
+func TestGatedLoudnessOfSilenceIsAbsoluteGate(t *testing.T) {
+	if got := gatedLoudness([]float64{0, 0, 1e-12}); got != loudnessAbsoluteGateLUFS {
+		t.Fatalf("silence = %v", got)
+	}
+}
+
+func TestEmbedExtensionDownloadReplayGainWritesTrackTags(t *testing.T) {
+	path := writeSineFLAC(t, "download.flac", 440, 0.25, 0, 2)
+	resp := DownloadResponse{Success: true, FilePath: path}
+	// EmbedReplayGain alone is the host's FFmpeg scan; the backend stays out.
+	embedExtensionDownloadReplayGain(&resp, DownloadRequest{EmbedReplayGain: true}, false)
+	if resp.ReplayGainTrackGain != "" {
+		t.Fatalf("analyzed without AnalyzeReplayGain: %+v", resp)
+	}
+	embedExtensionDownloadReplayGain(&resp, DownloadRequest{AnalyzeReplayGain: true}, false)
+	if resp.ReplayGainTrackGain == "" || resp.ReplayGainTrackPeak == "" {
+		t.Fatalf("response not annotated: %+v", resp)
+	}
+	meta, err := ReadMetadata(path)
+	if err != nil {
+		t.Fatalf("ReadMetadata: %v", err)
+	}
+	if meta.ReplayGainTrackGain != resp.ReplayGainTrackGain || meta.ReplayGainTrackPeak != resp.ReplayGainTrackPeak {
+		t.Fatalf("tags = %q/%q, response = %q/%q", meta.ReplayGainTrackGain, meta.ReplayGainTrackPeak, resp.ReplayGainTrackGain, resp.ReplayGainTrackPeak)
+	}
+}
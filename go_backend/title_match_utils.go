@@ -369,7 +369,33 @@ type resolvedTrackInfo struct {
 	SkipNameVerification bool
 }
 
+// Track match verdicts reported by evaluateTrackMatch. The first three
+// accept the track; the *_mismatch verdicts reject it.
+const (
+	trackMatchISRC             = "isrc_match"
+	trackMatchNames            = "matched"
+	trackMatchUnverified       = "name_check_skipped"
+	trackMatchArtistMismatch   = "artist_mismatch"
+	trackMatchTitleMismatch    = "title_mismatch"
+	trackMatchAlbumMismatch    = "album_mismatch"
+	trackMatchDurationMismatch = "duration_mismatch"
+)
+
 func trackMatchesRequest(req DownloadRequest, resolved resolvedTrackInfo, logPrefix string) bool {
+	return trackMatchVerdictAccepted(evaluateTrackMatch(req, resolved, logPrefix))
+}
+
+func trackMatchVerdictAccepted(verdict string) bool {
+	switch verdict {
+	case trackMatchISRC, trackMatchNames, trackMatchUnverified:
+		return true
+	}
+	return false
+}
+
+// evaluateTrackMatch is trackMatchesRequest with the reason kept: it returns
+// which check accepted or rejected the provider's track.
+func evaluateTrackMatch(req DownloadRequest, resolved resolvedTrackInfo, logPrefix string) string {
 	exactISRCMatch := req.ISRC != "" &&
 		resolved.ISRC != "" &&
 		strings.EqualFold(strings.TrimSpace(req.ISRC), strings.TrimSpace(resolved.ISRC))
@@ -379,21 +405,21 @@ func trackMatchesRequest(req DownloadRequest, resolved resolvedTrackInfo, logPre
 			!artistsMatch(req.ArtistName, resolved.ArtistName) {
 			GoLog("[%s] Verification failed: artist mismatch — expected '%s', got '%s'\n",
 				logPrefix, req.ArtistName, resolved.ArtistName)
-			return false
+			return trackMatchArtistMismatch
 		}
 
 		if req.TrackName != "" && resolved.Title != "" &&
 			!titlesMatch(req.TrackName, resolved.Title) {
 			GoLog("[%s] Verification failed: title mismatch — expected '%s', got '%s'\n",
 				logPrefix, req.TrackName, resolved.Title)
-			return false
+			return trackMatchTitleMismatch
 		}
 
 		if req.AlbumName != "" && resolved.AlbumName != "" &&
 			!titlesMatch(req.AlbumName, resolved.AlbumName) {
 			GoLog("[%s] Verification failed: album mismatch — expected '%s', got '%s'\n",
 				logPrefix, req.AlbumName, resolved.AlbumName)
-			return false
+			return trackMatchAlbumMismatch
 		}
 	}
 
@@ -406,9 +432,16 @@ func trackMatchesRequest(req DownloadRequest, resolved resolvedTrackInfo, logPre
 		if diff > 10 {
 			GoLog("[%s] Verification failed: duration mismatch — expected %ds, got %ds\n",
 				logPrefix, expectedDurationSec, resolved.Duration)
-			return false
+			return trackMatchDurationMismatch
 		}
 	}
 
-	return true
+	switch {
+	case exactISRCMatch:
+		return trackMatchISRC
+	case resolved.SkipNameVerification:
+		return trackMatchUnverified
+	default:
+		return trackMatchNames
+	}
 }
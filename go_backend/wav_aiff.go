@@ -55,6 +55,30 @@ func readUint32(b []byte, le bool) uint32 {
 	return binary.BigEndian.Uint32(b)
 }
 
+// readChunkSize / putChunkSize handle 4- and 8-byte chunk size fields; the
+// width is len(b).
+func readChunkSize(b []byte, le bool) int64 {
+	if len(b) >= 8 {
+		if le {
+			return int64(binary.LittleEndian.Uint64(b))
+		}
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return int64(readUint32(b, le))
+}
+
+func putChunkSize(dst []byte, le bool, v int64) {
+	if len(dst) >= 8 {
+		if le {
+			binary.LittleEndian.PutUint64(dst, uint64(v))
+		} else {
+			binary.BigEndian.PutUint64(dst, uint64(v))
+		}
+		return
+	}
+	putUint32(dst, le, uint32(v))
+}
+
 func synchsafeEncode(n int) []byte {
 	return []byte{
 		byte((n >> 21) & 0x7f),
@@ -635,13 +659,19 @@ func buildID3v24Tag(meta *AudioMetadata, coverData []byte, coverMIME string) []b
 // matched case-insensitively) with a fresh ID3v2.4 chunk appended at the end.
 // The audio data and all other chunks are preserved; container size is patched.
 func writeID3Chunk(filePath, expectMagic, chunkID string, le bool, id3 []byte) error {
+	return writeID3ChunkSized(filePath, expectMagic, chunkID, le, 4, id3)
+}
+
+// writeID3ChunkSized is writeID3Chunk for containers whose size fields are
+// sizeLen bytes wide: 4 for RIFF/FORM, 8 for DSDIFF's FRM8.
+func writeID3ChunkSized(filePath, expectMagic, chunkID string, le bool, sizeLen int, id3 []byte) error {
 	in, err := os.Open(filePath)
 	if err != nil {
 		return err
 	}
 	defer in.Close()
 
-	header := make([]byte, 12)
+	header := make([]byte, 8+sizeLen)
 	if _, err := io.ReadFull(in, header); err != nil {
 		return err
 	}
@@ -665,21 +695,22 @@ func writeID3Chunk(filePath, expectMagic, chunkID string, le bool, id3 []byte) e
 	}
 
 	var bodyLen int64 = 4 // the 4-byte form type after the size field
-	hdr := make([]byte, 8)
+	hdrLen := int64(4 + sizeLen)
+	hdr := make([]byte, hdrLen)
 	for {
 		n, rerr := io.ReadFull(in, hdr)
-		if n < 8 {
+		if int64(n) < hdrLen {
 			break
 		}
 		if rerr != nil {
 			break
 		}
 		id := string(hdr[0:4])
-		size := readUint32(hdr[4:8], le)
-		pad := int64(size) & 1
+		size := readChunkSize(hdr[4:], le)
+		pad := size & 1
 
 		if strings.EqualFold(id, chunkID) {
-			if _, err := in.Seek(int64(size)+pad, io.SeekCurrent); err != nil {
+			if _, err := in.Seek(size+pad, io.SeekCurrent); err != nil {
 				cleanup()
 				return err
 			}
@@ -690,17 +721,17 @@ func writeID3Chunk(filePath, expectMagic, chunkID string, le bool, id3 []byte) e
 			cleanup()
 			return err
 		}
-		if _, err := io.CopyN(out, in, int64(size)+pad); err != nil {
+		if _, err := io.CopyN(out, in, size+pad); err != nil {
 			cleanup()
 			return err
 		}
-		bodyLen += 8 + int64(size) + pad
+		bodyLen += hdrLen + size + pad
 	}
 
 	newSize := len(id3)
-	chunkHdr := make([]byte, 8)
+	chunkHdr := make([]byte, hdrLen)
 	copy(chunkHdr[0:4], chunkID)
-	putUint32(chunkHdr[4:8], le, uint32(newSize))
+	putChunkSize(chunkHdr[4:], le, int64(newSize))
 	if _, err := out.Write(chunkHdr); err != nil {
 		cleanup()
 		return err
@@ -715,11 +746,11 @@ func writeID3Chunk(filePath, expectMagic, chunkID string, le bool, id3 []byte) e
 			return err
 		}
 	}
-	bodyLen += 8 + int64(newSize) + int64(newSize&1)
+	bodyLen += hdrLen + int64(newSize) + int64(newSize&1)
 
-	// Patch the container size field (bytes 4..8).
-	sizeBuf := make([]byte, 4)
-	putUint32(sizeBuf, le, uint32(bodyLen))
+	// Patch the container size field after the magic.
+	sizeBuf := make([]byte, sizeLen)
+	putChunkSize(sizeBuf, le, bodyLen)
 	if _, err := out.WriteAt(sizeBuf, 4); err != nil {
 		cleanup()
 		return err
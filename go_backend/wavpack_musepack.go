@@ -0,0 +1,316 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WavPack and Musepack carry their tags in APE tags (ape_tags.go); this file
+// reads the stream properties from their own headers.
+
+// WavPackQuality describes a WavPack stream. Mode is "lossless" or "hybrid";
+// a hybrid file with its .wvc correction file beside it decodes losslessly,
+// which HasCorrection reports.
+type WavPackQuality struct {
+	SampleRate    int
+	BitDepth      int
+	Channels      int
+	Duration      int
+	TotalSamples  int64
+	Mode          string
+	Float         bool
+	HasCorrection bool
+}
+
+// MusepackQuality describes a Musepack SV7 or SV8 stream (always lossy).
+type MusepackQuality struct {
+	StreamVersion int
+	SampleRate    int
+	Channels      int
+	Duration      int
+	TotalSamples  int64
+}
+
+const (
+	wavPackHeaderSize = 32
+	// wavPackMaxSearch bounds the scan for the first block past any leading
+	// tag or junk.
+	wavPackMaxSearch = 64 * 1024
+
+	wavPackFlagBytesPerSample = 0x3
+	wavPackFlagMono           = 0x4
+	wavPackFlagHybrid         = 0x8
+	wavPackFlagFloat          = 0x80
+	wavPackFlagShiftLSB       = 13
+	wavPackFlagShiftMask      = 0x1f << wavPackFlagShiftLSB
+	wavPackFlagSRateLSB       = 23
+	wavPackFlagSRateMask      = 0xf << wavPackFlagSRateLSB
+	wavPackFlagDSD            = 0x80000000
+
+	wavPackIDLarge       = 0x80
+	wavPackIDOddSize     = 0x40
+	wavPackIDFunction    = 0x3f
+	wavPackIDChannelInfo = 0x0d
+	wavPackIDSampleRate  = 0x27
+)
+
+var wavPackSampleRates = [15]int{6000, 8000, 9600, 11025, 12000, 16000, 22050, 24000, 32000, 44100, 48000, 64000, 88200, 96000, 192000}
+
+var musepackSampleRates = [4]int{44100, 48000, 37800, 32000}
+
+// id3v2TagEnd returns the offset just past a leading ID3v2 tag, or 0.
+func id3v2TagEnd(f io.ReaderAt) int64 {
+	header := make([]byte, 10)
+	if _, err := f.ReadAt(header, 0); err != nil || string(header[0:3]) != "ID3" {
+		return 0
+	}
+	end := 10 + int64(synchsafeDecode(header[6:10]))
+	if header[5]&0x10 != 0 {
+		end += 10
+	}
+	return end
+}
+
+func GetWavPackQuality(filePath string) (*WavPackQuality, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, wavPackMaxSearch)
+	n, err := f.ReadAt(buf, id3v2TagEnd(f))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	buf = buf[:n]
+	start := bytes.Index(buf, []byte("wvpk"))
+	if start < 0 || len(buf)-start < wavPackHeaderSize {
+		return nil, fmt.Errorf("no WavPack block header found")
+	}
+	block := buf[start:]
+	blockSize := int(binary.LittleEndian.Uint32(block[4:8])) + 8
+	version := binary.LittleEndian.Uint16(block[8:10])
+	if version < 0x402 || version > 0x410 {
+		return nil, fmt.Errorf("unsupported WavPack version 0x%x", version)
+	}
+	flags := binary.LittleEndian.Uint32(block[24:28])
+
+	quality := &WavPackQuality{
+		Channels: 2,
+		Mode:     "lossless",
+		Float:    flags&wavPackFlagFloat != 0,
+	}
+	if flags&wavPackFlagMono != 0 {
+		quality.Channels = 1
+	}
+	if flags&wavPackFlagHybrid != 0 {
+		quality.Mode = "hybrid"
+		base := filePath
+		if ext := filepath.Ext(filePath); strings.EqualFold(ext, ".wv") {
+			base = strings.TrimSuffix(filePath, ext)
+		}
+		for _, ext := range []string{".wvc", ".WVC"} {
+			if _, err := os.Stat(base + ext); err == nil {
+				quality.HasCorrection = true
+				break
+			}
+		}
+	}
+	if flags&wavPackFlagDSD != 0 {
+		quality.BitDepth = 1
+	} else {
+		bytesPerSample := int(flags&wavPackFlagBytesPerSample) + 1
+		shift := int(flags&wavPackFlagShiftMask) >> wavPackFlagShiftLSB
+		quality.BitDepth = bytesPerSample*8 - shift
+	}
+	if index := (flags & wavPackFlagSRateMask) >> wavPackFlagSRateLSB; int(index) < len(wavPackSampleRates) {
+		quality.SampleRate = wavPackSampleRates[index]
+	}
+
+	// Metadata sub-blocks override the header for non-standard sample rates
+	// and multichannel layouts.
+	end := min(blockSize, len(block))
+	for pos := wavPackHeaderSize; pos+2 <= end; {
+		id := block[pos]
+		size := int(block[pos+1]) * 2
+		pos += 2
+		if id&wavPackIDLarge != 0 {
+			if pos+2 > end {
+				break
+			}
+			size = (int(block[pos-1]) | int(block[pos])<<8 | int(block[pos+1])<<16) * 2
+			pos += 2
+		}
+		dataSize := size
+		if id&wavPackIDOddSize != 0 && dataSize > 0 {
+			dataSize--
+		}
+		if pos+size > end {
+			break
+		}
+		data := block[pos : pos+dataSize]
+		switch id & wavPackIDFunction {
+		case wavPackIDChannelInfo:
+			if len(data) >= 1 && data[0] > 0 {
+				quality.Channels = int(data[0])
+			}
+		case wavPackIDSampleRate:
+			if len(data) >= 3 {
+				quality.SampleRate = int(data[0]) | int(data[1])<<8 | int(data[2])<<16
+				if len(data) >= 4 {
+					quality.SampleRate |= int(data[3]&0x7f) << 24
+				}
+			}
+		}
+		pos += size
+	}
+
+	totalSamples := binary.LittleEndian.Uint32(block[12:16])
+	if totalSamples != 0xFFFFFFFF {
+		quality.TotalSamples = int64(block[11])<<32 | int64(totalSamples)
+		if quality.SampleRate > 0 {
+			quality.Duration = int(quality.TotalSamples / int64(quality.SampleRate))
+		}
+	}
+	if quality.SampleRate == 0 {
+		return nil, fmt.Errorf("WavPack sample rate not found")
+	}
+	return quality, nil
+}
+
+// readMusepackVarint reads an SV8 variable-length size: 7 bits per byte,
+// high bit set on all but the last.
+func readMusepackVarint(buf []byte) (int64, int, error) {
+	var value int64
+	for i := 0; i < len(buf) && i < 9; i++ {
+		value = value<<7 | int64(buf[i]&0x7f)
+		if buf[i]&0x80 == 0 {
+			return value, i + 1, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("truncated Musepack varint")
+}
+
+func GetMusepackQuality(filePath string) (*MusepackQuality, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	start := id3v2TagEnd(f)
+	buf := make([]byte, 4096)
+	n, err := f.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	buf = buf[:n]
+
+	switch {
+	case len(buf) >= 12 && string(buf[0:3]) == "MP+":
+		return parseMusepackSV7(buf)
+	case len(buf) >= 4 && string(buf[0:4]) == "MPCK":
+		return parseMusepackSV8(buf[4:])
+	}
+	return nil, fmt.Errorf("not a Musepack stream")
+}
+
+func parseMusepackSV7(buf []byte) (*MusepackQuality, error) {
+	if version := buf[3] & 0x0f; version != 7 {
+		return nil, fmt.Errorf("unsupported Musepack stream version %d", version)
+	}
+	frames := int64(binary.LittleEndian.Uint32(buf[4:8]))
+	quality := &MusepackQuality{
+		StreamVersion: 7,
+		SampleRate:    musepackSampleRates[buf[10]&0x03],
+		Channels:      2,
+		TotalSamples:  frames * 1152,
+	}
+	quality.Duration = int(quality.TotalSamples / int64(quality.SampleRate))
+	return quality, nil
+}
+
+// parseMusepackSV8 walks the packets after "MPCK" to the stream header.
+func parseMusepackSV8(buf []byte) (*MusepackQuality, error) {
+	for len(buf) >= 3 {
+		key := string(buf[0:2])
+		size, sizeLen, err := readMusepackVarint(buf[2:])
+		if err != nil {
+			return nil, err
+		}
+		headerLen := 2 + sizeLen
+		if size < int64(headerLen) || size > int64(len(buf)) {
+			return nil, fmt.Errorf("truncated Musepack %s packet", key)
+		}
+		if key != "SH" {
+			buf = buf[size:]
+			continue
+		}
+
+		payload := buf[headerLen:size]
+		if len(payload) < 5 {
+			return nil, fmt.Errorf("short Musepack stream header")
+		}
+		quality := &MusepackQuality{StreamVersion: int(payload[4])}
+		pos := 5
+		samples, read, err := readMusepackVarint(payload[pos:])
+		if err != nil {
+			return nil, err
+		}
+		pos += read
+		silence, read, err := readMusepackVarint(payload[pos:])
+		if err != nil {
+			return nil, err
+		}
+		pos += read
+		if len(payload) < pos+2 {
+			return nil, fmt.Errorf("short Musepack stream header")
+		}
+		quality.SampleRate = musepackSampleRates[(payload[pos]>>5)&0x03]
+		quality.Channels = int(payload[pos+1]>>4) + 1
+		quality.TotalSamples = max(samples-silence, 0)
+		quality.Duration = int(quality.TotalSamples / int64(quality.SampleRate))
+		return quality, nil
+	}
+	return nil, fmt.Errorf("Musepack stream header not found")
+}
+
+func averageBitrateKbps(filePath string, duration int) int {
+	if duration <= 0 {
+		return 0
+	}
+	info, err := os.Stat(filePath)
+	if err != nil || info.Size() <= 0 {
+		return 0
+	}
+	return int(float64(info.Size()) * 8 / float64(duration) / 1000)
+}
+
+func scanWavPackFile(filePath string, result *LibraryScanResult, displayNameHint string) (*LibraryScanResult, error) {
+	if quality, err := GetWavPackQuality(filePath); err == nil {
+		result.BitDepth = quality.BitDepth
+		result.SampleRate = quality.SampleRate
+		result.Duration = quality.Duration
+		result.Bitrate = averageBitrateKbps(filePath, quality.Duration)
+	} else {
+		GoLog("[LibraryScan] WavPack header error for %s: %v\n", filePath, err)
+	}
+	return scanAPEFile(filePath, result, displayNameHint)
+}
+
+func scanMusepackFile(filePath string, result *LibraryScanResult, displayNameHint string) (*LibraryScanResult, error) {
+	if quality, err := GetMusepackQuality(filePath); err == nil {
+		result.SampleRate = quality.SampleRate
+		result.Duration = quality.Duration
+		result.Bitrate = averageBitrateKbps(filePath, quality.Duration)
+	} else {
+		GoLog("[LibraryScan] Musepack header error for %s: %v\n", filePath, err)
+	}
+	return scanAPEFile(filePath, result, displayNameHint)
+}
@@ -0,0 +1,131 @@
+package gobackend
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// buildWavPackBlock returns one WavPack 4.x block header with the given
+// flags, followed by metadata sub-blocks.
+func buildWavPackBlock(flags uint32, totalSamples uint32, subBlocks ...[]byte) []byte {
+	var body []byte
+	for _, sub := range subBlocks {
+		body = append(body, sub...)
+	}
+	block := make([]byte, wavPackHeaderSize, wavPackHeaderSize+len(body))
+	copy(block[0:4], "wvpk")
+	binary.LittleEndian.PutUint32(block[4:8], uint32(wavPackHeaderSize-8+len(body)))
+	binary.LittleEndian.PutUint16(block[8:10], 0x410)
+	binary.LittleEndian.PutUint32(block[12:16], totalSamples)
+	binary.LittleEndian.PutUint32(block[20:24], 4096)
+	binary.LittleEndian.PutUint32(block[24:28], flags)
+	return append(block, body...)
+}
+
+func TestGetWavPackQuality(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "master.wv")
+	// 24-bit (3 bytes per sample), 96 kHz, 6 channels, 10 seconds.
+	flags := uint32(2) | 13<<wavPackFlagSRateLSB
+	channelInfo := []byte{wavPackIDChannelInfo, 1, 6, 0}
+	if err := os.WriteFile(path, append(buildWavPackBlock(flags, 960000, channelInfo), make([]byte, 4096)...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	quality, err := GetWavPackQuality(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quality.BitDepth != 24 || quality.SampleRate != 96000 || quality.Channels != 6 || quality.Duration != 10 || quality.Mode != "lossless" {
+		t.Fatalf("quality = %+v", quality)
+	}
+
+	// Hybrid 16-bit stereo with a custom sample rate sub-block and a
+	// correction file beside it.
+	hybrid := filepath.Join(dir, "hybrid.wv")
+	flags = uint32(1) | wavPackFlagHybrid | 15<<wavPackFlagSRateLSB
+	sampleRate := []byte{wavPackIDSampleRate | wavPackIDOddSize, 2, 0x40, 0x9C, 0x00, 0} // 40000 Hz
+	if err := os.WriteFile(hybrid, buildWavPackBlock(flags, 80000, sampleRate), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "hybrid.wvc"), []byte("wvpk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	quality, err = GetWavPackQuality(hybrid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quality.BitDepth != 16 || quality.SampleRate != 40000 || quality.Channels != 2 || quality.Duration != 2 || quality.Mode != "hybrid" || !quality.HasCorrection {
+		t.Fatalf("hybrid quality = %+v", quality)
+	}
+
+	// Upper-case extensions pair the same way.
+	upper := filepath.Join(dir, "LOUD.WV")
+	if err := os.WriteFile(upper, buildWavPackBlock(flags, 80000, sampleRate), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "LOUD.WVC"), []byte("wvpk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if quality, err = GetWavPackQuality(upper); err != nil || !quality.HasCorrection {
+		t.Fatalf("upper-case hybrid quality = %+v, %v", quality, err)
+	}
+}
+
+func TestGetMusepackQuality(t *testing.T) {
+	dir := t.TempDir()
+
+	sv7 := make([]byte, 64)
+	copy(sv7, "MP+\x17")
+	binary.LittleEndian.PutUint32(sv7[4:8], 1000) // frames of 1152 samples
+	sv7[10] = 1                                   // 48 kHz
+	sv7Path := filepath.Join(dir, "old.mpc")
+	if err := os.WriteFile(sv7Path, sv7, 0644); err != nil {
+		t.Fatal(err)
+	}
+	quality, err := GetMusepackQuality(sv7Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quality.StreamVersion != 7 || quality.SampleRate != 48000 || quality.Channels != 2 || quality.Duration != 24 {
+		t.Fatalf("sv7 quality = %+v", quality)
+	}
+
+	// SV8: an "SH" packet with 441000 samples (varint 0x9A 0xF5 0x28), no
+	// leading silence, 44.1 kHz, stereo.
+	payload := []byte{0, 0, 0, 0, 8, 0x9A, 0xF5, 0x28, 0x00, 0<<5 | 0x1F, 1 << 4}
+	sv8 := append([]byte("MPCK"), "SH"...)
+	sv8 = append(sv8, byte(3+len(payload)))
+	sv8 = append(sv8, payload...)
+	sv8 = append(sv8, "SE\x03"...)
+	sv8Path := filepath.Join(dir, "new.mpc")
+	if err := os.WriteFile(sv8Path, append(buildID3v23Tag(id3TextFrame("TIT2", "x")), sv8...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	quality, err = GetMusepackQuality(sv8Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quality.StreamVersion != 8 || quality.SampleRate != 44100 || quality.Channels != 2 || quality.TotalSamples != 441000 || quality.Duration != 10 {
+		t.Fatalf("sv8 quality = %+v", quality)
+	}
+}
+
+func TestScanWavPackFileReadsQualityAndAPETags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "master.wv")
+	flags := uint32(1) | 9<<wavPackFlagSRateLSB
+	if err := os.WriteFile(path, append(buildWavPackBlock(flags, 441000), make([]byte, 100000)...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteAPETags(path, &APETag{Items: AudioMetadataToAPEItems(&AudioMetadata{Title: "Master", Artist: "Archivist", Album: "Tapes"})}); err != nil {
+		t.Fatal(err)
+	}
+	result, err := scanAudioFileWithKnownModTime(path, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TrackName != "Master" || result.BitDepth != 16 || result.SampleRate != 44100 || result.Duration != 10 || result.Bitrate == 0 {
+		t.Fatalf("scan = %+v", result)
+	}
+}